@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/KubeOperator/kubepi/pkg/tunnel"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	serverAddress string
+	clusterName   string
+	token         string
+	target        string
+	caFile        string
+	insecure      bool
+)
+
+func init() {
+	RootCmd.Flags().StringVar(&serverAddress, "server", "", "kubepi address, e.g. https://kubepi.example.com")
+	RootCmd.Flags().StringVar(&clusterName, "cluster", "", "name of this cluster in kubepi")
+	RootCmd.Flags().StringVar(&token, "token", os.Getenv("KUBEPI_AGENT_TOKEN"), "agent token of the cluster, defaults to $KUBEPI_AGENT_TOKEN")
+	RootCmd.Flags().StringVar(&target, "target", defaultTarget(), "host:port of the kubernetes api server")
+	RootCmd.Flags().StringVar(&caFile, "ca-file", "", "ca bundle to verify the kubepi certificate")
+	RootCmd.Flags().BoolVar(&insecure, "insecure-skip-tls-verify", false, "do not verify the kubepi certificate")
+}
+
+// defaultTarget is the api server address injected into every pod
+func defaultTarget() string {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return ""
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+var RootCmd = &cobra.Command{
+	Use:   "kubepi-agent",
+	Short: "Connects a cluster to kubepi from inside the cluster",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if serverAddress == "" || clusterName == "" || token == "" {
+			return errors.New("--server, --cluster and --token are required")
+		}
+		if target == "" {
+			return errors.New("--target is required outside of a cluster")
+		}
+		tc, err := tlsConfig()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer cancel()
+		agent := &tunnel.Agent{
+			Server:    serverAddress,
+			Cluster:   clusterName,
+			Token:     token,
+			Target:    target,
+			TLSConfig: tc,
+			Logf:      logrus.Infof,
+		}
+		if err := agent.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+		return nil
+	},
+}
+
+func main() {
+	if err := RootCmd.Execute(); err != nil {
+		panic(err)
+	}
+}
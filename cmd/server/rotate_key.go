@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/spf13/cobra"
+)
+
+var newKeyFile string
+
+func init() {
+	RotateKeyCmd.Flags().StringVarP(&configPath, "config-path", "c", "", "config file path")
+	RotateKeyCmd.Flags().StringVar(&newKeyFile, "new-key-file", "", "file of the new key, generated when missing. Defaults to <current key file>.new, which replaces the current key file afterwards")
+	RootCmd.AddCommand(RotateKeyCmd)
+}
+
+var RotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Re-encrypt the secrets in the database with a new key, KubePi must be stopped",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return server.RotateEncryptionKey(configPath, newKeyFile)
+	},
+}
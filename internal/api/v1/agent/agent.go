@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/tunnel"
+	"github.com/asdine/storm/v3"
+	"github.com/gorilla/websocket"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+// pendingTimeout 为尚未创建集群的 agent 连接的保留时间，超时后仍未创建集群则断开
+const pendingTimeout = 10 * time.Minute
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  32 * 1024,
+	WriteBufferSize: 32 * 1024,
+}
+
+type Handler struct {
+	clusterService cluster.Service
+}
+
+func NewHandler() *Handler {
+	return &Handler{
+		clusterService: cluster.NewService(),
+	}
+}
+
+// Connect 接受集群内 agent 的隧道连接。集群已存在时 agent 的 token 必须与集群配置一致；
+// 集群尚未创建时按集群名和 token 保留连接，不会替换已有的隧道，创建集群时只有 token 一致的连接会被采用
+func (h *Handler) Connect() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.GetHeader(tunnel.HeaderCluster)
+		token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if clusterName == "" || token == "" {
+			ctx.StatusCode(iris.StatusUnauthorized)
+			ctx.Values().Set("message", "cluster name and agent token are required")
+			return
+		}
+		pending := false
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			if !errors.Is(err, storm.ErrNotFound) {
+				ctx.StatusCode(iris.StatusInternalServerError)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			pending = true
+		} else if c.Spec.Connect.Direction != v1Cluster.ConnectDirectionReverse || !tunnel.TokenEqual(c.Spec.Connect.Reverse.Token, token) {
+			ctx.StatusCode(iris.StatusUnauthorized)
+			ctx.Values().Set("message", "invalid agent token")
+			return
+		}
+		if pending {
+			if err := tunnel.Tunnels.CheckPending(clusterName, token); err != nil {
+				if errors.Is(err, tunnel.ErrTooManyPending) {
+					ctx.StatusCode(iris.StatusTooManyRequests)
+				} else {
+					ctx.StatusCode(iris.StatusConflict)
+				}
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+		}
+
+		ws, err := upgrader.Upgrade(ctx.ResponseWriter(), ctx.Request(), nil)
+		if err != nil {
+			// Upgrade 已经写入了错误响应
+			return
+		}
+		var t *tunnel.Tunnel
+		if pending {
+			t, err = tunnel.Tunnels.RegisterPending(clusterName, token, ws, pendingTimeout)
+		} else {
+			t, err = tunnel.Tunnels.Register(clusterName, token, ws)
+		}
+		if err != nil {
+			server.Logger().Errorf("can not open tunnel of cluster %s: %s", clusterName, err.Error())
+			return
+		}
+		server.Logger().Infof("agent of cluster %s connected from %s", clusterName, t.RemoteAddr)
+		<-t.Done()
+		server.Logger().Infof("agent of cluster %s disconnected", clusterName)
+	}
+}
+
+func Install(parent iris.Party) {
+	handler := NewHandler()
+	sp := parent.Party("/agent")
+	sp.Get("/connect", handler.Connect())
+}
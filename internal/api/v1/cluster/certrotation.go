@@ -0,0 +1,132 @@
+package cluster
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/certificate"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/asdine/storm/v3"
+)
+
+const certCheckInterval = time.Hour
+
+var certRotation sync.Once
+
+// certificateStatus 检查成员证书，返回状态以及是否需要重新签发；ca 为空时不检查签发者
+func certificateStatus(cert, ca []byte, now time.Time) (v1Cluster.CertificateStatus, bool) {
+	status := v1Cluster.CertificateStatus{CheckedAt: now}
+	state, err := certificate.InspectClientCertificate(cert, ca, now)
+	if err != nil {
+		status.Phase = v1Cluster.CertificatePhaseInvalid
+		status.Message = err.Error()
+		return status, true
+	}
+	status.NotAfter = state.NotAfter
+	switch {
+	case state.Expired:
+		status.Phase = v1Cluster.CertificatePhaseExpired
+	case state.Untrusted:
+		status.Phase = v1Cluster.CertificatePhaseUntrusted
+	case state.RenewDue:
+		status.Phase = v1Cluster.CertificatePhaseExpiring
+	default:
+		status.Phase = v1Cluster.CertificatePhaseValid
+	}
+	return status, state.RenewDue
+}
+
+// rotateCertificates 检查所有集群的成员证书，快到期、已过期或 CA 已轮换的证书通过 CSR 重新签发
+func (h *Handler) rotateCertificates() {
+	clusters, err := h.clusterService.List(common.DBOptions{})
+	if err != nil {
+		server.Logger().Errorf("list clusters failed: %s", err.Error())
+		return
+	}
+	for i := range clusters {
+		h.rotateClusterCertificates(&clusters[i])
+	}
+}
+
+func (h *Handler) rotateClusterCertificates(c *v1Cluster.Cluster) {
+	bindings, err := h.clusterBindingService.GetClusterBindingByClusterName(c.Name, common.DBOptions{})
+	if err != nil {
+		if !errors.Is(err, storm.ErrNotFound) {
+			server.Logger().Errorf("list bindings of cluster %s failed: %s", c.Name, err.Error())
+		}
+		return
+	}
+	client := kubernetes.NewKubernetes(c)
+	ca, err := client.ClientCA()
+	if err != nil {
+		server.Logger().Warnf("can not read client ca of cluster %s, the issuer of member certificates is not checked: %s", c.Name, err.Error())
+	}
+	for i := range bindings {
+		b := &bindings[i]
+		if len(b.Certificate) == 0 {
+			continue
+		}
+		now := time.Now()
+		status, renew := certificateStatus(b.Certificate, ca, now)
+		status.RenewedAt = b.CertificateStatus.RenewedAt
+		var renewed []byte
+		if renew {
+			cert, err := client.CreateCommonUser(b.UserRef)
+			if err != nil {
+				status.Message = fmt.Sprintf("renew certificate failed: %s", err.Error())
+				server.Logger().Errorf("renew certificate of user %s in cluster %s failed: %s", b.UserRef, c.Name, err.Error())
+			} else {
+				renewed = cert
+				status, _ = certificateStatus(cert, ca, now)
+				status.RenewedAt = now
+				server.Logger().Infof("renewed certificate of user %s in cluster %s until %s", b.UserRef, c.Name, status.NotAfter.Format(time.RFC3339))
+			}
+		}
+		// 证书未更换且状态未变化时不写库，CheckedAt 为状态最近一次变化的检查时间
+		if renewed == nil && sameCertificateStatus(b.CertificateStatus, status) {
+			continue
+		}
+		if err := h.saveCertificate(b, renewed, status); err != nil {
+			server.Logger().Errorf("update binding %s failed: %s", b.Name, err.Error())
+		}
+	}
+}
+
+func sameCertificateStatus(a, b v1Cluster.CertificateStatus) bool {
+	return a.Phase == b.Phase && a.NotAfter.Equal(b.NotAfter) && a.Message == b.Message
+}
+
+// saveCertificate 重新读取成员绑定后写入新证书与状态，检查期间证书已被其他操作修改或成员已被移除时放弃本次结果
+func (h *Handler) saveCertificate(checked *v1Cluster.Binding, cert []byte, status v1Cluster.CertificateStatus) error {
+	tx, err := server.DB().Begin(true)
+	if err != nil {
+		return err
+	}
+	b, err := h.clusterBindingService.GetBindingByClusterNameAndUserName(checked.ClusterRef, checked.UserRef, common.DBOptions{DB: tx})
+	if err != nil {
+		_ = tx.Rollback()
+		if errors.Is(err, storm.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if b.Name != checked.Name || !bytes.Equal(b.Certificate, checked.Certificate) {
+		_ = tx.Rollback()
+		return nil
+	}
+	if cert != nil {
+		b.Certificate = cert
+	}
+	b.CertificateStatus = status
+	if err := h.clusterBindingService.UpdateClusterBinding(b.Name, b, common.DBOptions{DB: tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
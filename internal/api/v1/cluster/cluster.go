@@ -20,9 +20,13 @@ import (
 	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
 	"github.com/KubeOperator/kubepi/internal/service/v1/clusterbinding"
 	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/internal/service/v1/gitops"
+	"github.com/KubeOperator/kubepi/internal/service/v1/mesh"
 	pkgV1 "github.com/KubeOperator/kubepi/pkg/api/v1"
 	"github.com/KubeOperator/kubepi/pkg/certificate"
+	"github.com/KubeOperator/kubepi/pkg/informer"
 	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/tunnel"
 	"github.com/asdine/storm/v3"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
@@ -34,6 +38,8 @@ type Handler struct {
 	clusterService        cluster.Service
 	clusterBindingService clusterbinding.Service
 	clusterRepoService    clusterrepo.Service
+	gitOpsService         gitops.Service
+	meshService           mesh.Service
 	imageRepoService      imagerepo.Service
 	clusterAppService     clusterapp.Service
 }
@@ -43,6 +49,8 @@ func NewHandler() *Handler {
 		clusterService:        cluster.NewService(),
 		clusterBindingService: clusterbinding.NewService(),
 		clusterRepoService:    clusterrepo.NewService(),
+		gitOpsService:         gitops.NewService(),
+		meshService:           mesh.NewService(),
 		imageRepoService:      imagerepo.NewService(),
 		clusterAppService:     clusterapp.NewService(),
 	}
@@ -76,6 +84,17 @@ func (h *Handler) CreateCluster() iris.Handler {
 			req.Spec.Authentication.Certificate.CertData = []byte(req.CertDataStr)
 			req.Spec.Authentication.Certificate.KeyData = []byte(req.KeyDataStr)
 		}
+		if req.Spec.Connect.Direction == v1Cluster.ConnectDirectionReverse {
+			if req.Spec.Connect.Reverse.Token == "" {
+				ctx.StatusCode(iris.StatusBadRequest)
+				ctx.Values().Set("message", "agent token is required for reverse connect")
+				return
+			}
+			// agent 与 ApiServer 在同一集群内，默认使用集群内的服务地址
+			if req.Spec.Connect.Forward.ApiServer == "" {
+				req.Spec.Connect.Forward.ApiServer = defaultReverseApiServer
+			}
+		}
 		if req.Spec.Connect.Forward.ApiServer != "" {
 			if !strings.HasPrefix(req.Spec.Connect.Forward.ApiServer, "https://") && !strings.HasPrefix(req.Spec.Connect.Forward.ApiServer, "http://") {
 				req.Spec.Connect.Forward.ApiServer = fmt.Sprintf("%s%s", "https://", req.Spec.Connect.Forward.ApiServer)
@@ -90,6 +109,23 @@ func (h *Handler) CreateCluster() iris.Handler {
 			return
 		}
 		req.PrivateKey = privateKey
+		if _, err := h.clusterService.Get(req.Name, common.DBOptions{}); err == nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", fmt.Sprintf("cluster %s already exists", req.Name))
+			return
+		}
+		// 等待中的 agent 只有 token 与集群一致的才会被采用，其余的断开；集群未能创建时再释放采用的隧道
+		created := false
+		agentToken := ""
+		if req.Spec.Connect.Direction == v1Cluster.ConnectDirectionReverse {
+			agentToken = req.Spec.Connect.Reverse.Token
+		}
+		tunnel.Tunnels.Claim(req.Name, agentToken)
+		defer func() {
+			if !created {
+				tunnel.Tunnels.Remove(req.Name)
+			}
+		}()
 		client := kubernetes.NewKubernetes(&req.Cluster)
 		if err := client.Ping(); err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
@@ -147,6 +183,7 @@ func (h *Handler) CreateCluster() iris.Handler {
 			return
 		}
 		_ = tx.Commit()
+		created = true
 		ctx.Values().Set("data", &req)
 		go func() {
 			req.Status.Phase = clusterStatusInitializing
@@ -460,6 +497,15 @@ func (h *Handler) UpdateCluster() iris.Handler {
 			c.Spec.Connect.Forward.ApiServer = req.ApiServer
 			c.Spec.Authentication.Mode = req.Mode
 			c.Spec.Authentication.BearerToken = req.Token
+			if req.Prometheus != nil {
+				c.Spec.Prometheus = *req.Prometheus
+			}
+			if req.NodeShell != nil {
+				c.Spec.NodeShell = *req.NodeShell
+			}
+			if req.Proxy != nil {
+				c.Spec.Connect.Forward.Proxy = *req.Proxy
+			}
 
 			client := kubernetes.NewKubernetes(c)
 			if err := client.Ping(); err != nil {
@@ -518,6 +564,7 @@ func (h *Handler) ListClusters() iris.Handler {
 			}
 			rc := Cluster{
 				Cluster: clusters[i],
+				Agent:   agentStatus(&clusters[i]),
 			}
 			for j := range mbs {
 				if mbs[j].UserRef == profile.Name {
@@ -531,6 +578,18 @@ func (h *Handler) ListClusters() iris.Handler {
 	}
 }
 
+// agentStatus 返回反向连接集群的 agent 状态，正向连接的集群返回 nil
+func agentStatus(c *v1Cluster.Cluster) *AgentStatus {
+	if c.Spec.Connect.Direction != v1Cluster.ConnectDirectionReverse {
+		return nil
+	}
+	t := tunnel.Tunnels.Get(c.Name)
+	if t == nil {
+		return &AgentStatus{}
+	}
+	return &AgentStatus{Connected: true, RemoteAddr: t.RemoteAddr, ConnectedAt: t.ConnectedAt}
+}
+
 // Delete Cluster
 // @Tags clusters
 // @Summary Delete cluster by name
@@ -579,6 +638,19 @@ func (h *Handler) DeleteCluster() iris.Handler {
 			return
 		}
 
+		if err := h.gitOpsService.DeleteByCluster(name, txOptions); err != nil && err != storm.ErrNotFound {
+			_ = tx.Rollback()
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", fmt.Sprintf("delete cluster failed: %s", err.Error()))
+			return
+		}
+		if err := h.meshService.RemoveCluster(name, txOptions); err != nil && err != storm.ErrNotFound {
+			_ = tx.Rollback()
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", fmt.Sprintf("delete cluster failed: %s", err.Error()))
+			return
+		}
+
 		clusterBindings, err := h.clusterBindingService.GetClusterBindingByClusterName(name, txOptions)
 		if err != nil && !errors.Is(err, storm.ErrNotFound) {
 			_ = tx.Rollback()
@@ -597,12 +669,30 @@ func (h *Handler) DeleteCluster() iris.Handler {
 		k := kubernetes.NewKubernetes(c)
 		_ = k.CleanAllRBACResource()
 		_ = tx.Commit()
+		informer.Clusters.Remove(name)
+		tunnel.Tunnels.Remove(name)
 		ctx.StatusCode(iris.StatusOK)
 	}
 }
 
 func Install(parent iris.Party) {
 	handler := NewHandler()
+	certRotation.Do(func() {
+		go func() {
+			handler.rotateCertificates()
+			for range time.Tick(certCheckInterval) {
+				handler.rotateCertificates()
+			}
+		}()
+	})
+	nodeShellSweep.Do(func() {
+		go func() {
+			handler.sweepNodeShells()
+			for range time.Tick(nodeShellSweepInterval) {
+				handler.sweepNodeShells()
+			}
+		}()
+	})
 	sp := parent.Party("/clusters")
 	sp.Post("", handler.CreateCluster())
 	sp.Get("", handler.ListClusters())
@@ -625,7 +715,12 @@ func Install(parent iris.Party) {
 	sp.Get("/:name/terminal/session", handler.TerminalSessionHandler())
 	//node shell
 	sp.Get("/:name/node_terminal/session", handler.NodeTerminalSessionHandler())
+	sp.Get("/:name/debug_terminal/session", handler.DebugTerminalSessionHandler())
 	sp.Get("/:name/logging/session", handler.LoggingHandler())
+	sp.Get("/:name/logging/aggregate/session", handler.AggregateLoggingHandler())
+	sp.Get("/:name/logging/aggregate/download", handler.DownloadAggregateLogging())
+	sp.Get("/:name/events/timeline", handler.EventTimeline())
+	sp.Get("/:name/events/warnings/session", handler.WarningEventSessionHandler())
 	sp.Get("/:name/repos", handler.ListClusterRepos())
 	sp.Get("/:name/repos/detail", handler.ListClusterReposDetail())
 	sp.Post("/:name/repos", handler.AddCLusterRepo())
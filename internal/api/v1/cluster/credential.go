@@ -0,0 +1,57 @@
+package cluster
+
+import (
+	"fmt"
+
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	authV1 "k8s.io/api/authorization/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// checkPodAccess 以当前用户身份发起 SelfSubjectAccessReview，确认可以访问 Pod 的子资源
+func checkPodAccess(client clientset.Interface, verb, subresource, namespace, podName string) error {
+	result, err := kubernetes.SelfHasPermission(client, authV1.ResourceAttributes{
+		Verb:        verb,
+		Resource:    "pods",
+		Subresource: subresource,
+		Namespace:   namespace,
+		Name:        podName,
+	})
+	if err != nil {
+		return err
+	}
+	if !result.Allowed {
+		resource := "pods"
+		if subresource != "" {
+			resource += "/" + subresource
+		}
+		return fmt.Errorf("no permission to %s %s %s in namespace %s", verb, resource, podName, namespace)
+	}
+	return nil
+}
+
+// checkNodeShellAccess 确认用户可以在节点终端的命名空间中创建并进入 Pod，且可以读取该节点；
+// 节点终端以集群凭据创建特权 Pod，只有本身就能做到这些的成员才允许打开
+func checkNodeShellAccess(client clientset.Interface, namespace, nodeName string) error {
+	for _, attr := range []authV1.ResourceAttributes{
+		{Verb: "create", Resource: "pods", Namespace: namespace},
+		{Verb: "create", Resource: "pods", Subresource: "exec", Namespace: namespace},
+		{Verb: "get", Resource: "nodes", Name: nodeName},
+	} {
+		result, err := kubernetes.SelfHasPermission(client, attr)
+		if err != nil {
+			return err
+		}
+		if !result.Allowed {
+			resource := attr.Resource
+			if attr.Subresource != "" {
+				resource += "/" + attr.Subresource
+			}
+			if attr.Namespace != "" {
+				return fmt.Errorf("no permission to %s %s in namespace %s", attr.Verb, resource, attr.Namespace)
+			}
+			return fmt.Errorf("no permission to %s %s %s", attr.Verb, resource, attr.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package cluster
+
+import (
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/collectons"
+	"github.com/KubeOperator/kubepi/pkg/events"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/watch"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+// EventTimeline 按时间顺序返回对象及其拥有的 ReplicaSet、Job、Pod 的事件，集群级对象不传 namespace
+func (h *Handler) EventTimeline() iris.Handler {
+	return func(ctx *context.Context) {
+		ref := events.ObjectRef{
+			Kind:      ctx.URLParam("kind"),
+			Namespace: ctx.URLParam("namespace"),
+			Name:      ctx.URLParam("name"),
+		}
+		if ref.Kind == "" || ref.Name == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "kind and name are required")
+			return
+		}
+		c, err := h.clusterService.Get(ctx.Params().GetString("name"), common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		_, client, err := commons.UserClient(c, profile)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		timeline, err := events.Timeline(client, ref)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", timeline)
+	}
+}
+
+// WarningEventSessionHandler 创建推送新 Warning 事件的会话，只包含用户可见命名空间中的事件
+// 前端拿到 id 后通过 /ws/watch/sockjs 绑定会话
+func (h *Handler) WarningEventSessionHandler() iris.Handler {
+	return func(ctx *context.Context) {
+		namespace := ctx.URLParam("namespace")
+		c, err := h.clusterService.Get(ctx.Params().GetString("name"), common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+
+		var namespaces *collectons.StringSet
+		if !profile.IsAdministrator {
+			allowed, err := kubernetes.NewKubernetes(c).GetUserNamespaceNames(profile.Name)
+			if err != nil {
+				ctx.StatusCode(iris.StatusInternalServerError)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			namespaces = collectons.NewStringSet()
+			for i := range allowed {
+				if namespace == "" || allowed[i] == namespace {
+					namespaces.Add(allowed[i])
+				}
+			}
+		} else if namespace != "" {
+			namespaces = collectons.NewStringSet()
+			namespaces.Add(namespace)
+		}
+
+		cc, err := informer.Clusters.Get(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		var sub *informer.Subscription
+		if profile.IsAdministrator {
+			sub, err = cc.SubscribeFiltered([]string{"events"}, namespaces, events.WarningsSince(time.Now()))
+		} else {
+			sub, err = cc.SubscribeAs(profile.Name, []string{"events"}, namespaces, events.WarningsSince(time.Now()))
+		}
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		sessionId, err := watch.GenWatchSessionId()
+		if err != nil {
+			sub.Close()
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		watch.WatchSessions.Set(sessionId, watch.WatchSession{
+			Id:           sessionId,
+			Bound:        make(chan error),
+			Subscription: sub,
+		})
+		go watch.WaitForWatchStream(sessionId)
+		ctx.Values().Set("data", TerminalResponse{ID: sessionId})
+	}
+}
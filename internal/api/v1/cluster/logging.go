@@ -1,11 +1,23 @@
 package cluster
 
 import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/server"
 	"github.com/KubeOperator/kubepi/internal/service/v1/common"
-	"github.com/KubeOperator/kubepi/pkg/kubernetes"
 	"github.com/KubeOperator/kubepi/pkg/logging"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	clientset "k8s.io/client-go/kubernetes"
 )
 
 func (h *Handler) LoggingHandler() iris.Handler {
@@ -65,13 +77,19 @@ func (h *Handler) LoggingHandler() iris.Handler {
 			ctx.Values().Set("message", err)
 			return
 		}
-		k := kubernetes.NewKubernetes(c)
-		client, err := k.Client()
+		u := ctx.Values().Get("profile")
+		profile := u.(session.UserProfile)
+		_, client, err := commons.UserClient(c, profile)
 		if err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.Values().Set("message", err)
 			return
 		}
+		if err := checkPodAccess(client, "get", "log", namespace, podName); err != nil {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
 		logging.LogSessions.Set(sessionId, logging.LogSession{
 			Id:    sessionId,
 			Bound: make(chan error),
@@ -80,3 +98,155 @@ func (h *Handler) LoggingHandler() iris.Handler {
 		ctx.Values().Set("data", TerminalResponse{ID: sessionId})
 	}
 }
+
+// aggregateOptions 解析聚合日志参数：selector 或 kind+name 指定 Pod，sinceTime/untilTime 为 RFC3339 时间
+func aggregateOptions(ctx *context.Context, client clientset.Interface) (logging.AggregateOptions, error) {
+	opts := logging.AggregateOptions{
+		Namespace: ctx.URLParam("namespace"),
+		Container: ctx.URLParam("containerName"),
+	}
+	if opts.Namespace == "" {
+		return opts, errors.New("namespace is required")
+	}
+	var err error
+	if kind := ctx.URLParam("kind"); kind != "" {
+		opts.Selector, err = logging.WorkloadSelector(client, opts.Namespace, kind, ctx.URLParam("workload"))
+	} else if selector := ctx.URLParam("selector"); selector != "" {
+		opts.Selector, err = labels.Parse(selector)
+	} else {
+		err = errors.New("selector or kind and workload are required")
+	}
+	if err != nil {
+		return opts, err
+	}
+	if opts.Selector.Empty() {
+		return opts, errors.New("the selector must not select every pod of the namespace")
+	}
+	if v := ctx.URLParam("sinceTime"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid sinceTime: %s", err.Error())
+		}
+		opts.SinceTime = &metav1.Time{Time: t}
+	}
+	if v := ctx.URLParam("untilTime"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid untilTime: %s", err.Error())
+		}
+		opts.Until = &t
+	}
+	if ctx.URLParamExists("sinceSeconds") {
+		seconds, err := ctx.URLParamInt64("sinceSeconds")
+		if err != nil || seconds <= 0 {
+			return opts, errors.New("sinceSeconds must be a positive integer")
+		}
+		opts.SinceSeconds = &seconds
+	}
+	if opts.SinceTime != nil && opts.SinceSeconds != nil {
+		return opts, errors.New("only one of sinceTime and sinceSeconds may be set")
+	}
+	if ctx.URLParamExists("tailLines") {
+		lines, err := ctx.URLParamInt64("tailLines")
+		if err != nil || lines < 0 {
+			return opts, errors.New("tailLines must be a non-negative integer")
+		}
+		opts.TailLines = &lines
+	}
+	if v := ctx.URLParam("grep"); v != "" {
+		if opts.Grep, err = regexp.Compile(v); err != nil {
+			return opts, fmt.Errorf("invalid grep: %s", err.Error())
+		}
+	}
+	opts.Follow, _ = ctx.URLParamBool("follow")
+	opts.Timestamps, _ = ctx.URLParamBool("timestamps")
+	return opts, nil
+}
+
+// aggregateClient 返回当前用户的客户端，并确认其可以列出命名空间的 Pod 并读取日志
+func (h *Handler) aggregateClient(ctx *context.Context) (*clientset.Clientset, bool) {
+	c, err := h.clusterService.Get(ctx.Params().GetString("name"), common.DBOptions{})
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", err.Error())
+		return nil, false
+	}
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	_, client, err := commons.UserClient(c, profile)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", err.Error())
+		return nil, false
+	}
+	namespace := ctx.URLParam("namespace")
+	for _, access := range [][2]string{{"list", ""}, {"watch", ""}, {"get", "log"}} {
+		if err := checkPodAccess(client, access[0], access[1], namespace, ""); err != nil {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", err.Error())
+			return nil, false
+		}
+	}
+	return client, true
+}
+
+// AggregateLoggingHandler 打开聚合多个 Pod 日志的会话，follow 时新启动的 Pod 自动加入
+func (h *Handler) AggregateLoggingHandler() iris.Handler {
+	return func(ctx *context.Context) {
+		client, ok := h.aggregateClient(ctx)
+		if !ok {
+			return
+		}
+		opts, err := aggregateOptions(ctx, client)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		sessionId, err := logging.GenLoggingSessionId()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		logging.LogSessions.Set(sessionId, logging.LogSession{
+			Id:    sessionId,
+			Bound: make(chan error),
+		})
+		go logging.WaitForAggregatedStream(client, opts, sessionId)
+		ctx.Values().Set("data", TerminalResponse{ID: sessionId})
+	}
+}
+
+// DownloadAggregateLogging 将时间范围内的聚合日志以 gzip 文件下载，按 Pod 与容器依次输出
+func (h *Handler) DownloadAggregateLogging() iris.Handler {
+	return func(ctx *context.Context) {
+		client, ok := h.aggregateClient(ctx)
+		if !ok {
+			return
+		}
+		opts, err := aggregateOptions(ctx, client)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		opts.Follow = false
+		if opts.Until == nil {
+			now := time.Now()
+			opts.Until = &now
+		}
+		filename := fmt.Sprintf("%s-%s.log.gz", opts.Namespace, opts.Until.Format("20060102150405"))
+		ctx.Header("Content-Type", server.ContentTypeDownload)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment;filename=%s", filename))
+		gz := gzip.NewWriter(ctx.ResponseWriter())
+		err = logging.Aggregate(ctx.Request().Context(), client, opts, func(line string) error {
+			_, err := io.WriteString(gz, line+"\n")
+			return err
+		})
+		if err != nil {
+			// 响应已经开始，只能把错误写进文件末尾
+			_, _ = io.WriteString(gz, fmt.Sprintf("download interrupted: %s\n", err.Error()))
+		}
+		_ = gz.Close()
+	}
+}
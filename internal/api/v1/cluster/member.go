@@ -146,6 +146,7 @@ func (h *Handler) GetClusterMember() iris.Handler {
 		member.ClusterRoles = make([]string, 0)
 		member.NamespaceRoles = make([]NamespaceRoles, 0)
 		member.Name = binding.UserRef
+		member.CertificateStatus = binding.CertificateStatus
 		set := collectons.NewStringSet()
 		for i := range clusterRoleBindings.Items {
 			set.Add(clusterRoleBindings.Items[i].RoleRef.Name)
@@ -194,9 +195,10 @@ func (h *Handler) ListClusterMembers() iris.Handler {
 		members := make([]Member, 0)
 		for i := range bindings {
 			members = append(members, Member{
-				Name:        bindings[i].UserRef,
-				BindingName: bindings[i].Name,
-				CreateAt:    bindings[i].CreateAt,
+				Name:              bindings[i].UserRef,
+				BindingName:       bindings[i].Name,
+				CreateAt:          bindings[i].CreateAt,
+				CertificateStatus: bindings[i].CertificateStatus,
 			})
 		}
 		ctx.Values().Set("data", members)
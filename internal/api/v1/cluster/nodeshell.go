@@ -0,0 +1,43 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/terminal"
+)
+
+const (
+	nodeShellSweepInterval = 10 * time.Minute
+	nodeShellSweepTimeout  = time.Minute
+)
+
+var nodeShellSweep sync.Once
+
+// sweepNodeShells 删除各集群中不属于任何会话的节点终端 Pod，KubePi 在会话期间退出时这些特权 Pod 会一直留在节点上
+func (h *Handler) sweepNodeShells() {
+	clusters, err := h.clusterService.List(common.DBOptions{})
+	if err != nil {
+		server.Logger().Errorf("list clusters failed: %s", err.Error())
+		return
+	}
+	for i := range clusters {
+		client, err := kubernetes.NewKubernetes(&clusters[i]).Client()
+		if err != nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), nodeShellSweepTimeout)
+		deleted, err := terminal.SweepNodeShells(ctx, client)
+		cancel()
+		if err != nil {
+			server.Logger().Warnf("clean up node shell pods of cluster %s failed: %s", clusters[i].Name, err.Error())
+		}
+		if deleted > 0 {
+			server.Logger().Infof("deleted %d orphaned node shell pods in cluster %s", deleted, clusters[i].Name)
+		}
+	}
+}
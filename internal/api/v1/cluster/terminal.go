@@ -1,6 +1,12 @@
 package cluster
 
 import (
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/recording"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Terminal "github.com/KubeOperator/kubepi/internal/model/v1/terminal"
 	"github.com/KubeOperator/kubepi/internal/service/v1/common"
 	"github.com/KubeOperator/kubepi/pkg/kubernetes"
 	"github.com/KubeOperator/kubepi/pkg/terminal"
@@ -13,6 +19,11 @@ type TerminalResponse struct {
 	ID string `json:"id"`
 }
 
+type DebugTerminalResponse struct {
+	ID        string `json:"id"`
+	Container string `json:"container"`
+}
+
 func (h *Handler) TerminalSessionHandler() iris.Handler {
 	return func(ctx *context.Context) {
 		namespace := ctx.URLParam("namespace")
@@ -33,17 +44,17 @@ func (h *Handler) TerminalSessionHandler() iris.Handler {
 			ctx.Values().Set("message", err)
 			return
 		}
-		k := kubernetes.NewKubernetes(c)
-		conf, err := k.Config()
+		u := ctx.Values().Get("profile")
+		profile := u.(session.UserProfile)
+		conf, client, err := commons.UserClient(c, profile)
 		if err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.Values().Set("message", err)
 			return
 		}
-		client, err := k.Client()
-		if err != nil {
-			ctx.StatusCode(iris.StatusInternalServerError)
-			ctx.Values().Set("message", err)
+		if err := checkPodAccess(client, "create", "exec", namespace, podName); err != nil {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", err.Error())
 			return
 		}
 		if shell == "" {
@@ -53,6 +64,14 @@ func (h *Handler) TerminalSessionHandler() iris.Handler {
 			Id:       sessionID,
 			Bound:    make(chan error),
 			SizeChan: make(chan remotecommand.TerminalSize),
+			Recorder: recording.Start(&v1Terminal.Recording{
+				Type:      v1Terminal.RecordingTypeExec,
+				User:      profile.Name,
+				Cluster:   clusterName,
+				Namespace: namespace,
+				Pod:       podName,
+				Container: containerName,
+			}),
 		})
 		go terminal.WaitForTerminal(client, conf, namespace, podName, containerName, sessionID, shell)
 		resp := TerminalResponse{ID: sessionID}
@@ -60,10 +79,78 @@ func (h *Handler) TerminalSessionHandler() iris.Handler {
 	}
 }
 
+// DebugTerminalSessionHandler 为运行中的 Pod 注入临时容器并打开终端，用于没有 shell 的镜像
+func (h *Handler) DebugTerminalSessionHandler() iris.Handler {
+	return func(ctx *context.Context) {
+		namespace := ctx.URLParam("namespace")
+		podName := ctx.URLParam("podName")
+		opts := terminal.DebugContainerOptions{
+			Image:           ctx.URLParam("image"),
+			TargetContainer: ctx.URLParam("targetContainer"),
+			Shell:           ctx.URLParam("shell"),
+		}
+
+		sessionID, err := terminal.GenTerminalSessionId()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		clusterName := ctx.Params().GetString("name")
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		u := ctx.Values().Get("profile")
+		profile := u.(session.UserProfile)
+		conf, client, err := commons.UserClient(c, profile)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		for _, access := range [][2]string{{"update", "ephemeralcontainers"}, {"create", "attach"}} {
+			if err := checkPodAccess(client, access[0], access[1], namespace, podName); err != nil {
+				ctx.StatusCode(iris.StatusForbidden)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+		}
+		containerName, err := terminal.AddDebugContainer(client, namespace, podName, opts)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		terminal.TerminalSessions.Set(sessionID, terminal.TerminalSession{
+			Id:       sessionID,
+			Bound:    make(chan error),
+			SizeChan: make(chan remotecommand.TerminalSize),
+			Recorder: recording.Start(&v1Terminal.Recording{
+				Type:      v1Terminal.RecordingTypeDebug,
+				User:      profile.Name,
+				Cluster:   clusterName,
+				Namespace: namespace,
+				Pod:       podName,
+				Container: containerName,
+			}),
+		})
+		go terminal.WaitForDebugTerminal(client, conf, namespace, podName, containerName, sessionID)
+		ctx.Values().Set("data", DebugTerminalResponse{ID: sessionID, Container: containerName})
+	}
+}
+
 //node shell
 func (h *Handler) NodeTerminalSessionHandler() iris.Handler {
 	return func(ctx *context.Context) {
 		nodeName := ctx.URLParam("nodeName")
+		if nodeName == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "nodeName is required")
+			return
+		}
 
 		sessionID, err := terminal.GenTerminalSessionId()
 		if err != nil {
@@ -78,6 +165,25 @@ func (h *Handler) NodeTerminalSessionHandler() iris.Handler {
 			ctx.Values().Set("message", err)
 			return
 		}
+		u := ctx.Values().Get("profile")
+		profile := u.(session.UserProfile)
+		if !profile.IsAdministrator {
+			namespace := c.Spec.NodeShell.Namespace
+			if namespace == "" {
+				namespace = terminal.DefaultNodeShellNamespace
+			}
+			_, userClient, err := commons.UserClient(c, profile)
+			if err != nil {
+				ctx.StatusCode(iris.StatusInternalServerError)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			if err := checkNodeShellAccess(userClient, namespace, nodeName); err != nil {
+				ctx.StatusCode(iris.StatusForbidden)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+		}
 		k := kubernetes.NewKubernetes(c)
 		conf, err := k.Config()
 		if err != nil {
@@ -95,8 +201,20 @@ func (h *Handler) NodeTerminalSessionHandler() iris.Handler {
 			Id:       sessionID,
 			Bound:    make(chan error),
 			SizeChan: make(chan remotecommand.TerminalSize),
+			Recorder: recording.Start(&v1Terminal.Recording{
+				Type:    v1Terminal.RecordingTypeNode,
+				User:    profile.Name,
+				Cluster: clusterName,
+				Node:    nodeName,
+			}),
+		})
+		go terminal.WaitForNodeShellTerminal(client, conf, nodeName, sessionID, terminal.NodeShellOptions{
+			Image:       c.Spec.NodeShell.Image,
+			Namespace:   c.Spec.NodeShell.Namespace,
+			Tolerations: c.Spec.NodeShell.Tolerations,
+			Resources:   c.Spec.NodeShell.Resources,
+			IdleTimeout: time.Duration(c.Spec.NodeShell.IdleTimeout) * time.Minute,
 		})
-		go terminal.WaitForNodeShellTerminal(client, conf, nodeName, sessionID)
 		resp := TerminalResponse{ID: sessionID}
 		ctx.Values().Set("data", resp)
 	}
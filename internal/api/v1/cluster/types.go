@@ -12,6 +12,8 @@ const (
 	clusterStatusFailed       = "Failed"
 	clusterStatusCompleted    = "Completed"
 	clusterStatusSaved        = "Saved"
+
+	defaultReverseApiServer = "https://kubernetes.default.svc"
 )
 
 type Cluster struct {
@@ -23,6 +25,15 @@ type Cluster struct {
 	Accessable           bool             `json:"accessable"`
 	MemberCount          int              `json:"memberCount"`
 	ExtraClusterInfo     ExtraClusterInfo `json:"extraClusterInfo"`
+	// Agent 只在反向连接的集群上返回
+	Agent *AgentStatus `json:"agent,omitempty"`
+}
+
+// AgentStatus 为反向连接集群的 agent 连接状态
+type AgentStatus struct {
+	Connected   bool      `json:"connected"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	ConnectedAt time.Time `json:"connectedAt"`
 }
 
 type UpdateCluster struct {
@@ -34,6 +45,12 @@ type UpdateCluster struct {
 	ConfigFileContent string   `json:"configFileContent"`
 	WithLabel         bool     `json:"withLabel"`
 	Labels            []string `json:"labels"`
+	// Prometheus 为空时保留原有配置
+	Prometheus *v1Cluster.Prometheus `json:"prometheus"`
+	// NodeShell 为空时保留原有配置
+	NodeShell *v1Cluster.NodeShell `json:"nodeShell"`
+	// Proxy 为空时保留原有配置，URL 为空表示直连
+	Proxy *v1Cluster.Proxy `json:"proxy"`
 }
 
 type ExtraClusterInfo struct {
@@ -58,6 +75,8 @@ type Member struct {
 	BindingName    string           `json:"bindingName"`
 	CreateAt       time.Time        `json:"createAt"`
 	NamespaceRoles []NamespaceRoles `json:"namespaceRoles"`
+	// CertificateStatus 为成员证书最近一次检查的结果，尚未检查时 Phase 为空
+	CertificateStatus v1Cluster.CertificateStatus `json:"certificateStatus"`
 }
 
 type Privilege struct {
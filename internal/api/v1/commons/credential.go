@@ -0,0 +1,46 @@
+package commons
+
+import (
+	"encoding/pem"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/clusterbinding"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// UserConfig 返回以用户身份访问集群的配置：管理员使用集群凭据，其他用户使用成员绑定的证书，
+// 保留集群配置中的地址、CA、代理与反向隧道，只去掉集群自身的 token 和证书
+func UserConfig(c *v1Cluster.Cluster, profile session.UserProfile) (*rest.Config, error) {
+	cfg, err := kubernetes.NewKubernetes(c).Config()
+	if err != nil {
+		return nil, err
+	}
+	if profile.IsAdministrator {
+		return cfg, nil
+	}
+	binding, err := clusterbinding.NewService().GetBindingByClusterNameAndUserName(c.Name, profile.Name, common.DBOptions{})
+	if err != nil {
+		return nil, err
+	}
+	cfg = rest.AnonymousClientConfig(cfg)
+	cfg.CertData = binding.Certificate
+	cfg.KeyData = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: c.PrivateKey})
+	return cfg, nil
+}
+
+// UserClient 返回 UserConfig 的配置以及对应的客户端
+func UserClient(c *v1Cluster.Cluster, profile session.UserProfile) (*rest.Config, *clientset.Clientset, error) {
+	cfg, err := UserConfig(c, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cfg, client, nil
+}
@@ -0,0 +1,327 @@
+package gitops
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1GitOps "github.com/KubeOperator/kubepi/internal/model/v1/gitops"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/internal/service/v1/gitops"
+	pkgGitOps "github.com/KubeOperator/kubepi/pkg/gitops"
+	"github.com/asdine/storm/v3"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+type Handler struct {
+	repoService    gitops.Service
+	clusterService cluster.Service
+	syncer         *syncer
+}
+
+func NewHandler() *Handler {
+	return &Handler{
+		repoService:    gitops.NewService(),
+		clusterService: cluster.NewService(),
+		syncer:         newSyncer(),
+	}
+}
+
+// List GitOps Repositories
+// @Tags gitops
+// @Summary List gitops repositories
+// @Description List gitops repositories, filtered by cluster when given
+// @Accept  json
+// @Produce  json
+// @Param cluster query string false "集群名称"
+// @Success 200 {object} []v1GitOps.Repository
+// @Security ApiKeyAuth
+// @Router /gitops [get]
+func (h *Handler) ListRepositories() iris.Handler {
+	return func(ctx *context.Context) {
+		var (
+			repos []v1GitOps.Repository
+			err   error
+		)
+		if clusterName := ctx.URLParam("cluster"); clusterName != "" {
+			repos, err = h.repoService.ListByCluster(clusterName, common.DBOptions{})
+		} else {
+			repos, err = h.repoService.List(common.DBOptions{})
+		}
+		if err != nil && !errors.Is(err, storm.ErrNotFound) {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if repos == nil {
+			repos = []v1GitOps.Repository{}
+		}
+		for i := range repos {
+			repos[i].WebhookToken = ""
+		}
+		ctx.Values().Set("data", repos)
+	}
+}
+
+// Create GitOps Repository
+// @Tags gitops
+// @Summary Create gitops repository
+// @Description Bind a cluster to a path of a git repository. The webhook token is only returned here, and the repository is synced with the permissions of its creator
+// @Accept  json
+// @Produce  json
+// @Param request body v1GitOps.Repository true "request"
+// @Success 200 {object} v1GitOps.Repository
+// @Security ApiKeyAuth
+// @Router /gitops [post]
+func (h *Handler) CreateRepository() iris.Handler {
+	return func(ctx *context.Context) {
+		var req v1GitOps.Repository
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if err := h.validate(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		req.CreatedBy = profile.Name
+		req.Status = v1GitOps.SyncStatus{}
+		if err := h.repoService.Create(&req, common.DBOptions{}); err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", req)
+	}
+}
+
+// Get GitOps Repository
+// @Tags gitops
+// @Summary Get gitops repository by name
+// @Description Get gitops repository by name, including the drift of the last sync
+// @Accept  json
+// @Produce  json
+// @Param name path string true "名称"
+// @Success 200 {object} v1GitOps.Repository
+// @Security ApiKeyAuth
+// @Router /gitops/{name} [get]
+func (h *Handler) GetRepository() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		repo, err := h.repoService.Get(name, common.DBOptions{})
+		if err != nil {
+			if errors.Is(err, storm.ErrNotFound) {
+				ctx.StatusCode(iris.StatusNotFound)
+			} else {
+				ctx.StatusCode(iris.StatusInternalServerError)
+			}
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		repo.WebhookToken = ""
+		ctx.Values().Set("data", repo)
+	}
+}
+
+// Update GitOps Repository
+// @Tags gitops
+// @Summary Update gitops repository by name
+// @Description Update gitops repository by name
+// @Accept  json
+// @Produce  json
+// @Param request body v1GitOps.Repository true "request"
+// @Param name path string true "名称"
+// @Success 200 {object} v1GitOps.Repository
+// @Security ApiKeyAuth
+// @Router /gitops/{name} [put]
+func (h *Handler) UpdateRepository() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		var req v1GitOps.Repository
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		req.Name = name
+		if err := h.validate(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		// 修改仓库地址或目录即决定了同步的内容，之后以修改者的权限同步
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		req.CreatedBy = profile.Name
+		if err := h.repoService.Update(name, &req, common.DBOptions{}); err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		req.WebhookToken = ""
+		ctx.Values().Set("data", req)
+	}
+}
+
+// Delete GitOps Repository
+// @Tags gitops
+// @Summary Delete gitops repository by name
+// @Description Delete gitops repository by name, objects applied to the cluster are kept
+// @Accept  json
+// @Produce  json
+// @Param name path string true "名称"
+// @Security ApiKeyAuth
+// @Router /gitops/{name} [delete]
+func (h *Handler) DeleteRepository() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		repo, err := h.repoService.Get(name, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if err := h.repoService.Delete(name, common.DBOptions{}); err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		h.syncer.clean(repo)
+	}
+}
+
+// Sync GitOps Repository
+// @Tags gitops
+// @Summary Sync gitops repository
+// @Description Pull the repository and diff it against the cluster, apply=true applies the drift
+// @Accept  json
+// @Produce  json
+// @Param name path string true "名称"
+// @Param apply query bool false "是否应用差异，默认使用仓库的 autoApply"
+// @Success 200 {object} v1GitOps.SyncStatus
+// @Security ApiKeyAuth
+// @Router /gitops/{name}/sync [post]
+func (h *Handler) SyncRepository() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		repo, err := h.repoService.Get(name, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		apply := ctx.URLParamBoolDefault("apply", repo.AutoApply)
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		status, err := h.syncer.Sync(name, profile.Name, apply)
+		if err != nil {
+			if errors.Is(err, errSyncRunning) {
+				ctx.StatusCode(iris.StatusConflict)
+			} else {
+				ctx.StatusCode(iris.StatusInternalServerError)
+			}
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", status)
+	}
+}
+
+// Webhook 供 Git 服务推送事件时触发同步，无需登录，通过仓库的 webhook token 校验：
+// 支持 ?token=、X-Gitlab-Token / X-KubePi-Token 请求头，以及 GitHub 的 X-Hub-Signature-256 签名
+func (h *Handler) Webhook() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		repo, err := h.repoService.Get(name, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.Values().Set("message", "repository not found")
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(ctx.Request().Body, 10<<20))
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if !verifyWebhook(repo.WebhookToken, ctx.URLParam("token"), ctx.GetHeader("X-Gitlab-Token")+ctx.GetHeader("X-KubePi-Token"), ctx.GetHeader("X-Hub-Signature-256"), body) {
+			ctx.StatusCode(iris.StatusUnauthorized)
+			ctx.Values().Set("message", "invalid webhook token")
+			return
+		}
+		go func() {
+			if _, err := h.syncer.Sync(repo.Name, "webhook", repo.AutoApply); err != nil && !errors.Is(err, errSyncRunning) {
+				server.Logger().Errorf("sync gitops repository %s failed: %s", repo.Name, err.Error())
+			}
+		}()
+		ctx.StatusCode(iris.StatusAccepted)
+	}
+}
+
+func verifyWebhook(secret, token, header, signature string, body []byte) bool {
+	if secret == "" {
+		return false
+	}
+	if signature != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(expected), []byte(signature))
+	}
+	for _, t := range []string{token, header} {
+		if t != "" && subtle.ConstantTimeCompare([]byte(t), []byte(secret)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) validate(repo *v1GitOps.Repository) error {
+	if repo.Name == "" {
+		return errors.New("name is required")
+	}
+	if repo.URL == "" {
+		return errors.New("url is required")
+	}
+	if err := pkgGitOps.ValidateURL(repo.URL, allowFileURL()); err != nil {
+		return err
+	}
+	if strings.HasPrefix(repo.Branch, "-") {
+		return errors.New("invalid branch")
+	}
+	if _, err := h.clusterService.Get(repo.ClusterRef, common.DBOptions{}); err != nil {
+		return fmt.Errorf("cluster %s: %s", repo.ClusterRef, err.Error())
+	}
+	if repo.Interval < 0 || (repo.Interval > 0 && repo.Interval < minSyncInterval) {
+		return fmt.Errorf("interval must be 0 or at least %d seconds", minSyncInterval)
+	}
+	return nil
+}
+
+var scheduler sync.Once
+
+func Install(authParty, noAuthParty iris.Party) {
+	handler := NewHandler()
+	scheduler.Do(func() {
+		go handler.syncer.schedule()
+	})
+	sp := authParty.Party("/gitops")
+	sp.Get("/", handler.ListRepositories())
+	sp.Post("/", handler.CreateRepository())
+	sp.Get("/:name", handler.GetRepository())
+	sp.Put("/:name", handler.UpdateRepository())
+	sp.Delete("/:name", handler.DeleteRepository())
+	sp.Post("/:name/sync", handler.SyncRepository())
+	noAuthParty.Post("/gitops/webhook/:name", handler.Webhook())
+}
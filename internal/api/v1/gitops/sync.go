@@ -0,0 +1,201 @@
+package gitops
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	v1GitOps "github.com/KubeOperator/kubepi/internal/model/v1/gitops"
+	v1System "github.com/KubeOperator/kubepi/internal/model/v1/system"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/internal/service/v1/gitops"
+	v1SystemService "github.com/KubeOperator/kubepi/internal/service/v1/system"
+	"github.com/KubeOperator/kubepi/internal/service/v1/user"
+	"github.com/KubeOperator/kubepi/pkg/file"
+	pkgGitOps "github.com/KubeOperator/kubepi/pkg/gitops"
+	"github.com/KubeOperator/kubepi/pkg/meshconfig"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	schedulerInterval = 10 * time.Second
+	minSyncInterval   = 30
+	// systemOperator 为定时同步在操作日志中的操作人
+	systemOperator = "system"
+)
+
+var errSyncRunning = errors.New("sync is already running")
+
+// syncer 保证同一仓库同时只有一个同步任务
+type syncer struct {
+	repoService    gitops.Service
+	clusterService cluster.Service
+	userService    user.Service
+	running        map[string]bool
+	lock           sync.Mutex
+}
+
+func newSyncer() *syncer {
+	return &syncer{
+		repoService:    gitops.NewService(),
+		clusterService: cluster.NewService(),
+		userService:    user.NewService(),
+		running:        make(map[string]bool),
+	}
+}
+
+// allowFileURL 返回是否允许 file:// 仓库，需要在配置文件中显式开启
+func allowFileURL() bool {
+	c := server.Config()
+	return c != nil && c.Spec.GitOps.AllowFileURL
+}
+
+func workDir(repo *v1GitOps.Repository) string {
+	return filepath.Join(file.ReplaceHomeDir(server.Config().Spec.DB.Path), "gitops", repo.UUID)
+}
+
+// Sync 拉取仓库并与集群中的对象比对，apply 为 true 时将差异应用到集群，每次同步都会记录操作日志
+func (s *syncer) Sync(name, operator string, apply bool) (*v1GitOps.SyncStatus, error) {
+	s.lock.Lock()
+	if s.running[name] {
+		s.lock.Unlock()
+		return nil, errSyncRunning
+	}
+	s.running[name] = true
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.running, name)
+		s.lock.Unlock()
+	}()
+
+	repo, err := s.repoService.Get(name, common.DBOptions{})
+	if err != nil {
+		return nil, err
+	}
+	status := s.sync(repo, apply)
+	if err := s.repoService.UpdateStatus(name, status, common.DBOptions{}); err != nil {
+		return nil, err
+	}
+	info := fmt.Sprintf("[%s] %s@%s %s", repo.ClusterRef, repo.Name, shortRevision(status.Revision), status.Phase)
+	if status.Message != "" {
+		info = fmt.Sprintf("%s: %s", info, status.Message)
+	}
+	v1SystemService.NewService().CreateOperationLog(&v1System.OperationLog{
+		Operator:            operator,
+		Operation:           "sync",
+		OperationDomain:     "gitops",
+		SpecificInformation: info,
+	}, common.DBOptions{})
+	return &status, nil
+}
+
+func (s *syncer) sync(repo *v1GitOps.Repository, apply bool) v1GitOps.SyncStatus {
+	status := v1GitOps.SyncStatus{LastSyncAt: time.Now(), Revision: repo.Status.Revision, Drifts: []pkgGitOps.Drift{}}
+	fail := func(err error) v1GitOps.SyncStatus {
+		status.Phase = v1GitOps.PhaseFailed
+		status.Message = err.Error()
+		return status
+	}
+	c, err := s.clusterService.Get(repo.ClusterRef, common.DBOptions{})
+	if err != nil {
+		return fail(fmt.Errorf("get cluster failed: %w", err))
+	}
+	dir := workDir(repo)
+	revision, err := pkgGitOps.Fetch(repo.URL, repo.Branch, dir, allowFileURL())
+	if err != nil {
+		return fail(err)
+	}
+	status.Revision = revision
+	objs, err := pkgGitOps.Load(dir, repo.Path)
+	if err != nil {
+		return fail(err)
+	}
+	// 以仓库创建者的身份读写集群，仓库只能同步创建者本身有权限修改的对象
+	cfg, err := s.creatorConfig(repo, c)
+	if err != nil {
+		return fail(err)
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return fail(err)
+	}
+
+	status.Drifts = pkgGitOps.Diff(client, objs)
+	if !pkgGitOps.OutOfSync(status.Drifts) {
+		status.Phase = v1GitOps.PhaseSynced
+		return status
+	}
+	if !apply {
+		status.Phase = v1GitOps.PhaseOutOfSync
+		return status
+	}
+	// Git 仓库是配置的唯一来源，直接覆盖集群中的对象
+	report := meshconfig.Import(client, objs, meshconfig.Options{Policy: meshconfig.PolicyOverwrite})
+	status.Drifts = pkgGitOps.Diff(client, objs)
+	status.Message = fmt.Sprintf("created %d, updated %d, failed %d", report.Created, report.Updated, report.Failed)
+	if report.Failed > 0 {
+		status.Phase = v1GitOps.PhaseFailed
+		for _, item := range report.Items {
+			if item.Error != "" {
+				status.Message = fmt.Sprintf("%s; %s %s/%s: %s", status.Message, item.Kind, item.Namespace, item.Name, item.Error)
+			}
+		}
+		return status
+	}
+	status.Phase = v1GitOps.PhaseApplied
+	return status
+}
+
+func (s *syncer) creatorConfig(repo *v1GitOps.Repository, c *v1Cluster.Cluster) (*rest.Config, error) {
+	if repo.CreatedBy == "" {
+		return nil, errors.New("the repository has no creator, update it to sync with your permissions")
+	}
+	u, err := s.userService.GetByNameOrEmail(repo.CreatedBy, common.DBOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get creator %s failed: %w", repo.CreatedBy, err)
+	}
+	return commons.UserConfig(c, session.UserProfile{Name: u.Name, IsAdministrator: u.IsAdmin})
+}
+
+// schedule 定时检查各仓库是否到达同步时间
+func (s *syncer) schedule() {
+	for range time.Tick(schedulerInterval) {
+		repos, err := s.repoService.List(common.DBOptions{})
+		if err != nil {
+			server.Logger().Errorf("list gitops repositories failed: %s", err.Error())
+			continue
+		}
+		for i := range repos {
+			repo := repos[i]
+			if repo.Interval <= 0 || time.Since(repo.Status.LastSyncAt) < time.Duration(repo.Interval)*time.Second {
+				continue
+			}
+			go func() {
+				if _, err := s.Sync(repo.Name, systemOperator, repo.AutoApply); err != nil && !errors.Is(err, errSyncRunning) {
+					server.Logger().Errorf("sync gitops repository %s failed: %s", repo.Name, err.Error())
+				}
+			}()
+		}
+	}
+}
+
+func (s *syncer) clean(repo *v1GitOps.Repository) {
+	_ = os.RemoveAll(workDir(repo))
+}
+
+func shortRevision(revision string) string {
+	if len(revision) > 8 {
+		return revision[:8]
+	}
+	return revision
+}
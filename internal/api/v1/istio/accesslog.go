@@ -0,0 +1,189 @@
+package istio
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/logging"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	authV1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// AccessLogSessionHandler 创建 istio-proxy 访问日志会话，随后通过 /ws/logging/sockjs 绑定
+// 目标 Pod 通过 pods（逗号分隔）指定，或通过 host + subset 选择 DestinationRule 子集下的全部 Pod
+// codes（如 5xx,404,400-499）、flags（如 UH,UF）、path 在服务端过滤
+func (h *Handler) AccessLogSessionHandler() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		namespace := ctx.URLParam("namespace")
+		if namespace == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "namespace is required")
+			return
+		}
+		filter, err := logging.ParseAccessLogFilter(ctx.URLParam("codes"), ctx.URLParam("flags"), ctx.URLParam("path"))
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		opts := logging.AccessLogOptions{
+			TailLines: int64(ctx.URLParamIntDefault("tailLines", 100)),
+			Follow:    ctx.URLParamBoolDefault("follow", true),
+			Filter:    filter,
+		}
+
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		k := kubernetes.NewKubernetes(c)
+		if !profile.IsAdministrator {
+			result, err := k.UserHasPermission(profile.Name, authV1.ResourceAttributes{
+				Verb:        "get",
+				Resource:    "pods",
+				Subresource: "log",
+				Namespace:   namespace,
+			})
+			if err != nil {
+				ctx.StatusCode(iris.StatusInternalServerError)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			if !result.Allowed {
+				ctx.StatusCode(iris.StatusForbidden)
+				ctx.Values().Set("message", fmt.Sprintf("can not get pods/log in namespace %s", namespace))
+				return
+			}
+		}
+
+		var pods []string
+		if p := ctx.URLParam("pods"); p != "" {
+			pods = strings.Split(p, ",")
+		} else if host := ctx.URLParam("host"); host != "" {
+			cc, err := informer.Clusters.Get(c)
+			if err != nil {
+				ctx.StatusCode(iris.StatusInternalServerError)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			pods, err = h.subsetPods(cc, namespace, host, ctx.URLParam("subset"))
+			if err != nil {
+				ctx.StatusCode(iris.StatusBadRequest)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+		}
+		if len(pods) == 0 {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "no pods selected")
+			return
+		}
+
+		client, err := k.Client()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		sessionId, err := logging.GenLoggingSessionId()
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		logging.LogSessions.Set(sessionId, logging.LogSession{
+			Id:    sessionId,
+			Bound: make(chan error),
+		})
+		go logging.WaitForAccessLogStream(client, namespace, pods, opts, sessionId)
+		ctx.JSON(map[string]interface{}{
+			"data":    map[string]interface{}{"id": sessionId, "pods": pods},
+			"success": true,
+		})
+	}
+}
+
+// subsetPods 返回注入了 sidecar 且属于 host 对应服务的 Pod，subset 不为空时再按 DestinationRule 子集标签过滤
+func (h *Handler) subsetPods(cc *informer.ClusterCache, namespace, host, subset string) ([]string, error) {
+	short := strings.Split(host, ".")[0]
+	var selector labels.Selector
+	svcs, err := cc.List(informer.Services, namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range svcs {
+		if svc.GetName() != short {
+			continue
+		}
+		sel, ok, _ := unstructured.NestedStringMap(svc.Object, "spec", "selector")
+		if ok && len(sel) > 0 {
+			selector = labels.SelectorFromSet(sel)
+		}
+	}
+	if selector == nil {
+		return nil, fmt.Errorf("service %s with selector not found in namespace %s", short, namespace)
+	}
+
+	var subsetDef map[string]interface{}
+	if subset != "" {
+		drs, err := cc.List(informer.DestinationRules, namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, dr := range drs {
+			drHost, _, _ := unstructured.NestedString(dr.Object, "spec", "host")
+			if drHost != host && strings.Split(drHost, ".")[0] != short {
+				continue
+			}
+			subsets, _, _ := unstructured.NestedSlice(dr.Object, "spec", "subsets")
+			for i := range subsets {
+				if s, ok := subsets[i].(map[string]interface{}); ok && s["name"] == subset {
+					subsetDef = s
+				}
+			}
+		}
+		if subsetDef == nil {
+			return nil, fmt.Errorf("subset %s of %s not found", subset, host)
+		}
+	}
+
+	pods, err := cc.List(informer.Pods, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, pod := range pods {
+		podLabels := pod.GetLabels()
+		if !selector.Matches(labels.Set(podLabels)) || !hasSidecar(pod) {
+			continue
+		}
+		if subsetDef != nil && !h.podMatchesSubsetLabels(podLabels, subsetDef) {
+			continue
+		}
+		result = append(result, pod.GetName())
+	}
+	return result, nil
+}
+
+func hasSidecar(pod *unstructured.Unstructured) bool {
+	for _, field := range []string{"containers", "initContainers"} {
+		containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", field)
+		for i := range containers {
+			if c, ok := containers[i].(map[string]interface{}); ok && c["name"] == logging.IstioProxyContainer {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,320 @@
+package istio
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	dataplaneModeLabel = "istio.io/dataplane-mode"
+	useWaypointLabel   = "istio.io/use-waypoint"
+	useWaypointNsLabel = "istio.io/use-waypoint-namespace"
+	waypointForLabel   = "istio.io/waypoint-for"
+	waypointClassName  = "istio-waypoint"
+	sidecarStatusKey   = "sidecar.istio.io/status"
+	ztunnelAppLabel    = "ztunnel"
+
+	DataplaneSidecar  = "sidecar"
+	DataplaneAmbient  = "ambient"
+	DataplaneWaypoint = "waypoint"
+	DataplaneNone     = "none"
+)
+
+// ambientIndex 保存判断 Pod 数据面类型所需的命名空间与服务标签
+type ambientIndex struct {
+	namespaces map[string]map[string]string
+	services   map[string]map[string]string
+}
+
+func newAmbientIndex(namespaces, services []*unstructured.Unstructured) *ambientIndex {
+	a := &ambientIndex{
+		namespaces: make(map[string]map[string]string),
+		services:   make(map[string]map[string]string),
+	}
+	for _, ns := range namespaces {
+		a.namespaces[ns.GetName()] = ns.GetLabels()
+	}
+	for _, svc := range services {
+		a.services[svc.GetNamespace()+"/"+svc.GetName()] = svc.GetLabels()
+	}
+	return a
+}
+
+// namespaceMode 返回命名空间的 istio.io/dataplane-mode
+func (a *ambientIndex) namespaceMode(namespace string) string {
+	return a.namespaces[namespace][dataplaneModeLabel]
+}
+
+// dataplane 判断 Pod 的数据面：注入了 sidecar、由 ztunnel 接管（ambient）、本身是 waypoint，或不在网格中
+func (a *ambientIndex) dataplane(pod *unstructured.Unstructured) string {
+	podLabels := pod.GetLabels()
+	if podLabels["gateway.networking.k8s.io/gateway-class-name"] == waypointClassName {
+		return DataplaneWaypoint
+	}
+	if _, ok := pod.GetAnnotations()[sidecarStatusKey]; ok || hasSidecar(pod) {
+		return DataplaneSidecar
+	}
+	// Pod 上的标签优先于命名空间，值为 none 表示退出 ambient
+	if mode, ok := podLabels[dataplaneModeLabel]; ok {
+		if mode == DataplaneAmbient {
+			return DataplaneAmbient
+		}
+		return DataplaneNone
+	}
+	if a.namespaceMode(pod.GetNamespace()) == DataplaneAmbient {
+		return DataplaneAmbient
+	}
+	return DataplaneNone
+}
+
+// waypointFor 返回服务使用的 waypoint（namespace/name），服务上的 istio.io/use-waypoint 优先于命名空间
+func (a *ambientIndex) waypointFor(namespace, service string) string {
+	svcLabels, ok := a.services[namespace+"/"+service]
+	labelSet := a.namespaces[namespace]
+	if ok {
+		if _, bound := svcLabels[useWaypointLabel]; bound {
+			labelSet = svcLabels
+		}
+	}
+	name := labelSet[useWaypointLabel]
+	if name == "" || name == DataplaneNone {
+		return ""
+	}
+	if ns := labelSet[useWaypointNsLabel]; ns != "" {
+		namespace = ns
+	}
+	return namespace + "/" + name
+}
+
+type AmbientNamespace struct {
+	Name          string `json:"name"`
+	DataplaneMode string `json:"dataplaneMode"`
+	Waypoint      string `json:"waypoint,omitempty"`
+}
+
+type Waypoint struct {
+	Name        string   `json:"name"`
+	Namespace   string   `json:"namespace"`
+	WaypointFor string   `json:"waypointFor"`
+	Programmed  bool     `json:"programmed"`
+	Addresses   []string `json:"addresses"`
+	Services    []string `json:"services"`
+}
+
+type ZtunnelNode struct {
+	Node     string `json:"node"`
+	Pod      string `json:"pod,omitempty"`
+	Phase    string `json:"phase,omitempty"`
+	Ready    bool   `json:"ready"`
+	Restarts int64  `json:"restarts"`
+}
+
+type ZtunnelStatus struct {
+	Namespace string        `json:"namespace,omitempty"`
+	Name      string        `json:"name,omitempty"`
+	Desired   int64         `json:"desired"`
+	Ready     int64         `json:"ready"`
+	Available int64         `json:"available"`
+	Nodes     []ZtunnelNode `json:"nodes"`
+}
+
+// GetAmbient 返回 ambient 模式的命名空间、waypoint 及其绑定的服务，以及各节点上 ztunnel 的状态
+func (h *Handler) GetAmbient() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		cc, err := informer.Clusters.Get(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+
+		namespaces, err := cc.List(informer.Namespaces, "")
+		if err == nil && !profile.IsAdministrator {
+			namespaces, err = cc.FilterByAccess(profile.Name, informer.Namespaces, namespaces)
+		}
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		services, err := h.listUnstructured(cc, profile, informer.Services)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		gateways, err := h.listUnstructured(cc, profile, informer.KubernetesGateways)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		index := newAmbientIndex(namespaces, services)
+
+		ambientNamespaces := make([]AmbientNamespace, 0)
+		for _, ns := range namespaces {
+			mode := index.namespaceMode(ns.GetName())
+			if mode == "" {
+				continue
+			}
+			ambientNamespaces = append(ambientNamespaces, AmbientNamespace{
+				Name:          ns.GetName(),
+				DataplaneMode: mode,
+				Waypoint:      index.waypointFor(ns.GetName(), ""),
+			})
+		}
+		waypoints := buildWaypoints(gateways, services, index)
+
+		// ztunnel 运行在 istio 系统命名空间，普通用户通常没有权限，只有管理员或具备 daemonsets 权限的用户可以看到
+		ztunnel, err := h.ztunnelStatus(cc, profile)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+
+		ctx.JSON(map[string]interface{}{
+			"data": map[string]interface{}{
+				"enabled":    ztunnel.Name != "" || len(ambientNamespaces) > 0,
+				"namespaces": ambientNamespaces,
+				"waypoints":  waypoints,
+				"ztunnel":    ztunnel,
+			},
+			"success": true,
+		})
+	}
+}
+
+// listUnstructured 与 listObjects 相同，但保留 Unstructured 以便读取元数据
+func (h *Handler) listUnstructured(cc *informer.ClusterCache, profile session.UserProfile, gvr schema.GroupVersionResource) ([]*unstructured.Unstructured, error) {
+	objs, err := listObjects(cc, profile, gvr, "")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*unstructured.Unstructured, 0, len(objs))
+	for i := range objs {
+		result = append(result, &unstructured.Unstructured{Object: objs[i]})
+	}
+	return result, nil
+}
+
+func buildWaypoints(gateways, services []*unstructured.Unstructured, index *ambientIndex) []Waypoint {
+	waypoints := make([]Waypoint, 0)
+	for _, gw := range gateways {
+		className, _, _ := unstructured.NestedString(gw.Object, "spec", "gatewayClassName")
+		if className != waypointClassName {
+			continue
+		}
+		wp := Waypoint{
+			Name:        gw.GetName(),
+			Namespace:   gw.GetNamespace(),
+			WaypointFor: gw.GetLabels()[waypointForLabel],
+			Addresses:   []string{},
+			Services:    []string{},
+		}
+		if wp.WaypointFor == "" {
+			wp.WaypointFor = "service"
+		}
+		addresses, _, _ := unstructured.NestedSlice(gw.Object, "status", "addresses")
+		for i := range addresses {
+			if a, ok := addresses[i].(map[string]interface{}); ok {
+				if v, ok := a["value"].(string); ok {
+					wp.Addresses = append(wp.Addresses, v)
+				}
+			}
+		}
+		conditions, _, _ := unstructured.NestedSlice(gw.Object, "status", "conditions")
+		for i := range conditions {
+			if cond, ok := conditions[i].(map[string]interface{}); ok && cond["type"] == "Programmed" {
+				wp.Programmed = cond["status"] == "True"
+			}
+		}
+		key := wp.Namespace + "/" + wp.Name
+		for _, svc := range services {
+			// waypoint 自身的服务不算绑定
+			if svc.GetNamespace() == wp.Namespace && svc.GetName() == wp.Name {
+				continue
+			}
+			if index.waypointFor(svc.GetNamespace(), svc.GetName()) == key {
+				wp.Services = append(wp.Services, svc.GetNamespace()+"/"+svc.GetName())
+			}
+		}
+		sort.Strings(wp.Services)
+		waypoints = append(waypoints, wp)
+	}
+	return waypoints
+}
+
+func (h *Handler) ztunnelStatus(cc *informer.ClusterCache, profile session.UserProfile) (ZtunnelStatus, error) {
+	status := ZtunnelStatus{Nodes: []ZtunnelNode{}}
+	daemonSets, err := h.listUnstructured(cc, profile, informer.DaemonSets)
+	if err != nil {
+		return status, err
+	}
+	for _, ds := range daemonSets {
+		if ds.GetName() != ztunnelAppLabel && ds.GetLabels()["app"] != ztunnelAppLabel {
+			continue
+		}
+		status.Namespace, status.Name = ds.GetNamespace(), ds.GetName()
+		status.Desired, _, _ = unstructured.NestedInt64(ds.Object, "status", "desiredNumberScheduled")
+		status.Ready, _, _ = unstructured.NestedInt64(ds.Object, "status", "numberReady")
+		status.Available, _, _ = unstructured.NestedInt64(ds.Object, "status", "numberAvailable")
+		break
+	}
+	if status.Name == "" {
+		return status, nil
+	}
+	pods, err := listObjects(cc, profile, informer.Pods, status.Namespace)
+	if err != nil {
+		return status, err
+	}
+	byNode := make(map[string]ZtunnelNode)
+	for _, p := range pods {
+		pod := &unstructured.Unstructured{Object: p}
+		if pod.GetLabels()["app"] != ztunnelAppLabel {
+			continue
+		}
+		node, _, _ := unstructured.NestedString(p, "spec", "nodeName")
+		phase, _, _ := unstructured.NestedString(p, "status", "phase")
+		zn := ZtunnelNode{Node: node, Pod: pod.GetName(), Phase: phase, Ready: podReady(p)}
+		statuses, _, _ := unstructured.NestedSlice(p, "status", "containerStatuses")
+		for i := range statuses {
+			if cs, ok := statuses[i].(map[string]interface{}); ok {
+				restarts, _, _ := unstructured.NestedInt64(cs, "restartCount")
+				zn.Restarts += restarts
+			}
+		}
+		byNode[node] = zn
+	}
+	// 节点只用于找出没有运行 ztunnel 的节点，直接读取缓存
+	nodes, err := cc.List(informer.Nodes, "")
+	if err != nil {
+		return status, err
+	}
+	for _, n := range nodes {
+		if _, ok := byNode[n.GetName()]; !ok {
+			byNode[n.GetName()] = ZtunnelNode{Node: n.GetName()}
+		}
+	}
+	for _, zn := range byNode {
+		status.Nodes = append(status.Nodes, zn)
+	}
+	sort.Slice(status.Nodes, func(i, j int) bool { return status.Nodes[i].Node < status.Nodes[j].Node })
+	return status, nil
+}
@@ -0,0 +1,53 @@
+package istio
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newObject(namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	u := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	u.SetNamespace(namespace)
+	u.SetName(name)
+	u.SetLabels(labels)
+	return u
+}
+
+func TestAmbientIndex(t *testing.T) {
+	index := newAmbientIndex(
+		[]*unstructured.Unstructured{
+			newObject("", "ambient", map[string]string{dataplaneModeLabel: "ambient", useWaypointLabel: "waypoint"}),
+			newObject("", "legacy", nil),
+		},
+		[]*unstructured.Unstructured{
+			newObject("ambient", "reviews", map[string]string{useWaypointLabel: "reviews-waypoint"}),
+			newObject("ambient", "ratings", map[string]string{useWaypointLabel: "none"}),
+		},
+	)
+	cases := []struct {
+		pod    *unstructured.Unstructured
+		expect string
+	}{
+		{newObject("ambient", "p1", nil), DataplaneAmbient},
+		{newObject("ambient", "p2", map[string]string{dataplaneModeLabel: "none"}), DataplaneNone},
+		{newObject("legacy", "p3", map[string]string{dataplaneModeLabel: "ambient"}), DataplaneAmbient},
+		{newObject("legacy", "p4", nil), DataplaneNone},
+		{newObject("ambient", "p5", map[string]string{"gateway.networking.k8s.io/gateway-class-name": waypointClassName}), DataplaneWaypoint},
+	}
+	for _, c := range cases {
+		if got := index.dataplane(c.pod); got != c.expect {
+			t.Errorf("pod %s: expect %s, got %s", c.pod.GetName(), c.expect, got)
+		}
+	}
+
+	if w := index.waypointFor("ambient", "reviews"); w != "ambient/reviews-waypoint" {
+		t.Errorf("unexpected waypoint %s", w)
+	}
+	if w := index.waypointFor("ambient", "ratings"); w != "" {
+		t.Errorf("unexpected waypoint %s", w)
+	}
+	if w := index.waypointFor("ambient", "productpage"); w != "ambient/waypoint" {
+		t.Errorf("unexpected waypoint %s", w)
+	}
+}
@@ -0,0 +1,518 @@
+package istio
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	AuthzAllow  = "ALLOW"
+	AuthzDeny   = "DENY"
+	AuthzCustom = "CUSTOM"
+	AuthzAudit  = "AUDIT"
+)
+
+type AuthzSource struct {
+	Namespace      string `json:"namespace"`
+	ServiceAccount string `json:"serviceAccount"`
+	// Labels 只用于回显，AuthorizationPolicy 以 mTLS 证书中的 principal 识别来源，不匹配来源标签
+	Labels map[string]string `json:"labels"`
+	IP     string            `json:"ip"`
+}
+
+type AuthzDestination struct {
+	Host      string `json:"host"`
+	Namespace string `json:"namespace"`
+	Port      int64  `json:"port"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	// Labels 为空时使用 host 对应服务所选中的 Pod 的标签
+	Labels  map[string]string `json:"labels"`
+	Headers map[string]string `json:"headers"`
+}
+
+type AuthzRequest struct {
+	Source         AuthzSource      `json:"source"`
+	Destination    AuthzDestination `json:"destination"`
+	IstioNamespace string           `json:"istioNamespace"`
+}
+
+// AuthzPolicyResult 为单个 AuthorizationPolicy 的匹配情况，Rule 为第一条匹配的规则下标，未匹配时为 -1
+type AuthzPolicyResult struct {
+	Policy string   `json:"policy"`
+	Action string   `json:"action"`
+	Rule   int      `json:"rule"`
+	Notes  []string `json:"notes,omitempty"`
+}
+
+type AuthzDecision struct {
+	// Decision 为 ALLOW、DENY，匹配 CUSTOM 策略时为 CUSTOM，表示由外部授权服务决定
+	Decision string              `json:"decision"`
+	Reason   string              `json:"reason"`
+	Policy   string              `json:"policy,omitempty"`
+	Rule     int                 `json:"rule"`
+	Policies []AuthzPolicyResult `json:"policies"`
+}
+
+// authzRequest 为评估时使用的请求属性，principal 按 SPIFFE 格式去掉 spiffe:// 前缀
+type authzRequest struct {
+	principal       string
+	sourceNamespace string
+	sourceIP        string
+	host            string
+	port            int64
+	method          string
+	path            string
+	headers         map[string]string
+}
+
+// EvaluateAuthorization 回答“A 能否调用 B”：按 CUSTOM、DENY、ALLOW 的顺序评估作用于目标工作负载的 AuthorizationPolicy
+func (h *Handler) EvaluateAuthorization() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		var req AuthzRequest
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if req.Source.Namespace == "" || req.Destination.Host == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "source namespace and destination host are required")
+			return
+		}
+		if req.Source.ServiceAccount == "" {
+			req.Source.ServiceAccount = "default"
+		}
+		if req.IstioNamespace == "" {
+			req.IstioNamespace = defaultIstioNamespace
+		}
+		svcName, namespace := splitServiceHost(req.Destination.Host, req.Destination.Namespace)
+		if namespace == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "destination namespace is required for short host names")
+			return
+		}
+
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		cc, err := informer.Clusters.Get(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		mesh, err := h.loadMeshSettings(c, req.IstioNamespace)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+
+		port := req.Destination.Port
+		workloadLabels := req.Destination.Labels
+		if workloadLabels == nil || port != 0 {
+			labelsOfPod, targetPort, err := destinationWorkload(cc, profile, namespace, svcName, port)
+			if err != nil {
+				ctx.StatusCode(iris.StatusBadRequest)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			if workloadLabels == nil {
+				workloadLabels = labelsOfPod
+			}
+			port = targetPort
+		}
+
+		// 无论用户能否看到，所有作用于目标的策略都会影响结果，因此直接读取缓存
+		objs, err := cc.List(informer.AuthorizationPolicies, "")
+		if err != nil && !errors.Is(err, informer.ErrNotServed) {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		policies := applicablePolicies(objs, namespace, mesh.RootNamespace, workloadLabels)
+		method := strings.ToUpper(req.Destination.Method)
+		if method == "" {
+			method = "GET"
+		}
+		path := req.Destination.Path
+		if path == "" {
+			path = "/"
+		}
+		decision := evaluateAuthorization(policies, authzRequest{
+			principal:       fmt.Sprintf("%s/ns/%s/sa/%s", mesh.TrustDomain, req.Source.Namespace, req.Source.ServiceAccount),
+			sourceNamespace: req.Source.Namespace,
+			sourceIP:        req.Source.IP,
+			host:            req.Destination.Host,
+			port:            port,
+			method:          method,
+			path:            path,
+			headers:         req.Destination.Headers,
+		})
+		ctx.JSON(map[string]interface{}{
+			"data":    decision,
+			"success": true,
+		})
+	}
+}
+
+// splitServiceHost 从 name、name.ns、name.ns.svc.cluster.local 形式的主机中解析服务名与命名空间
+func splitServiceHost(host, namespace string) (string, string) {
+	parts := strings.Split(host, ".")
+	if len(parts) > 1 && namespace == "" {
+		namespace = parts[1]
+	}
+	return parts[0], namespace
+}
+
+// destinationWorkload 返回服务所选中的第一个 Pod 的标签，并将服务端口转换为 AuthorizationPolicy 匹配使用的容器端口
+func destinationWorkload(cc *informer.ClusterCache, profile session.UserProfile, namespace, name string, port int64) (map[string]string, int64, error) {
+	svcs, err := listObjects(cc, profile, informer.Services, namespace)
+	if err != nil {
+		return nil, 0, err
+	}
+	var svc *unstructured.Unstructured
+	for _, s := range svcs {
+		if u := (&unstructured.Unstructured{Object: s}); u.GetName() == name {
+			svc = u
+			break
+		}
+	}
+	if svc == nil {
+		return nil, 0, fmt.Errorf("service %s not found in namespace %s", name, namespace)
+	}
+	selector, _, _ := unstructured.NestedStringMap(svc.Object, "spec", "selector")
+	var pod *unstructured.Unstructured
+	if len(selector) > 0 {
+		pods, err := listObjects(cc, profile, informer.Pods, namespace)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, p := range pods {
+			u := &unstructured.Unstructured{Object: p}
+			if labels.SelectorFromSet(selector).Matches(labels.Set(u.GetLabels())) {
+				pod = u
+				break
+			}
+		}
+	}
+	workloadLabels := map[string]string{}
+	if pod != nil {
+		workloadLabels = pod.GetLabels()
+	}
+
+	ports, _, _ := unstructured.NestedSlice(svc.Object, "spec", "ports")
+	for i := range ports {
+		p, ok := ports[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if number, _ := toFloat(p["port"]); int64(number) != port {
+			continue
+		}
+		switch target := p["targetPort"].(type) {
+		case int64:
+			return workloadLabels, target, nil
+		case string:
+			if pod != nil {
+				if n := containerPort(pod, target); n != 0 {
+					return workloadLabels, n, nil
+				}
+			}
+		}
+	}
+	return workloadLabels, port, nil
+}
+
+func containerPort(pod *unstructured.Unstructured, name string) int64 {
+	containers, _, _ := unstructured.NestedSlice(pod.Object, "spec", "containers")
+	for i := range containers {
+		c, _ := containers[i].(map[string]interface{})
+		ports, _, _ := unstructured.NestedSlice(c, "ports")
+		for j := range ports {
+			if p, ok := ports[j].(map[string]interface{}); ok && p["name"] == name {
+				n, _ := toFloat(p["containerPort"])
+				return int64(n)
+			}
+		}
+	}
+	return 0
+}
+
+// applicablePolicies 返回作用于目标工作负载的策略：目标命名空间或根命名空间中 selector 为空或与工作负载标签匹配的策略
+func applicablePolicies(objs []*unstructured.Unstructured, namespace, rootNamespace string, workloadLabels map[string]string) []*unstructured.Unstructured {
+	var result []*unstructured.Unstructured
+	for _, p := range objs {
+		if p.GetNamespace() != namespace && p.GetNamespace() != rootNamespace {
+			continue
+		}
+		// targetRef 绑定到 waypoint 或网关的策略不作用于 sidecar
+		if _, ok, _ := unstructured.NestedFieldNoCopy(p.Object, "spec", "targetRef"); ok {
+			continue
+		}
+		if _, ok, _ := unstructured.NestedFieldNoCopy(p.Object, "spec", "targetRefs"); ok {
+			continue
+		}
+		matchLabels, _, _ := unstructured.NestedStringMap(p.Object, "spec", "selector", "matchLabels")
+		if labels.SelectorFromSet(matchLabels).Matches(labels.Set(workloadLabels)) {
+			result = append(result, p)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetNamespace()+"/"+result[i].GetName() < result[j].GetNamespace()+"/"+result[j].GetName()
+	})
+	return result
+}
+
+// evaluateAuthorization 按 Istio 的顺序评估：匹配任一 CUSTOM 策略时交由外部授权服务决定，
+// 匹配任一 DENY 策略时拒绝，不存在 ALLOW 策略时允许，匹配任一 ALLOW 策略时允许，否则拒绝
+func evaluateAuthorization(policies []*unstructured.Unstructured, req authzRequest) AuthzDecision {
+	decision := AuthzDecision{Rule: -1, Policies: []AuthzPolicyResult{}}
+	results := make(map[string][]AuthzPolicyResult)
+	for _, p := range policies {
+		action, _, _ := unstructured.NestedString(p.Object, "spec", "action")
+		if action == "" {
+			action = AuthzAllow
+		}
+		r := AuthzPolicyResult{Policy: p.GetNamespace() + "/" + p.GetName(), Action: action, Rule: -1}
+		rules, _, _ := unstructured.NestedSlice(p.Object, "spec", "rules")
+		for i := range rules {
+			rule, _ := rules[i].(map[string]interface{})
+			ok, notes := matchRule(rule, req)
+			r.Notes = append(r.Notes, notes...)
+			if ok {
+				r.Rule = i
+				break
+			}
+		}
+		decision.Policies = append(decision.Policies, r)
+		results[action] = append(results[action], r)
+	}
+
+	for _, action := range []string{AuthzCustom, AuthzDeny} {
+		for _, r := range results[action] {
+			if r.Rule >= 0 {
+				decision.Decision, decision.Policy, decision.Rule = action, r.Policy, r.Rule
+				decision.Reason = fmt.Sprintf("request matches rule %d of %s policy %s", r.Rule, action, r.Policy)
+				return decision
+			}
+		}
+	}
+	if len(results[AuthzAllow]) == 0 {
+		decision.Decision = AuthzAllow
+		decision.Reason = "no ALLOW policy applies to the destination workload"
+		return decision
+	}
+	for _, r := range results[AuthzAllow] {
+		if r.Rule >= 0 {
+			decision.Decision, decision.Policy, decision.Rule = AuthzAllow, r.Policy, r.Rule
+			decision.Reason = fmt.Sprintf("request matches rule %d of ALLOW policy %s", r.Rule, r.Policy)
+			return decision
+		}
+	}
+	decision.Decision = AuthzDeny
+	decision.Reason = "ALLOW policies apply to the destination workload but none of their rules match"
+	return decision
+}
+
+// matchRule 规则中 from、to 各自的多个条目为或的关系，from、to、when 之间为与的关系，空规则匹配所有请求
+func matchRule(rule map[string]interface{}, req authzRequest) (bool, []string) {
+	var notes []string
+	if from, ok := rule["from"].([]interface{}); ok && len(from) > 0 {
+		matched := false
+		for i := range from {
+			f, _ := from[i].(map[string]interface{})
+			source, _ := f["source"].(map[string]interface{})
+			ok, n := matchSource(source, req)
+			notes = append(notes, n...)
+			if ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, notes
+		}
+	}
+	if to, ok := rule["to"].([]interface{}); ok && len(to) > 0 {
+		matched := false
+		for i := range to {
+			t, _ := to[i].(map[string]interface{})
+			operation, _ := t["operation"].(map[string]interface{})
+			if matchOperation(operation, req) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, notes
+		}
+	}
+	if when, ok := rule["when"].([]interface{}); ok {
+		for i := range when {
+			cond, _ := when[i].(map[string]interface{})
+			ok, n := matchCondition(cond, req)
+			notes = append(notes, n...)
+			if !ok {
+				return false, notes
+			}
+		}
+	}
+	return true, notes
+}
+
+func matchSource(source map[string]interface{}, req authzRequest) (bool, []string) {
+	var notes []string
+	// 请求中没有 JWT，requestPrincipals 只能匹配 notRequestPrincipals
+	if _, ok := source["requestPrincipals"]; ok {
+		notes = append(notes, "requestPrincipals require a JWT, the evaluated request carries none")
+		return false, notes
+	}
+	checks := []struct {
+		field string
+		value string
+		match func(pattern, value string) bool
+	}{
+		{"principals", req.principal, matchValue},
+		{"namespaces", req.sourceNamespace, matchValue},
+		{"ipBlocks", req.sourceIP, matchIP},
+		{"remoteIpBlocks", req.sourceIP, matchIP},
+	}
+	for _, c := range checks {
+		if (c.field == "ipBlocks" || c.field == "remoteIpBlocks") && req.sourceIP == "" {
+			if _, ok := source[c.field]; ok {
+				notes = append(notes, fmt.Sprintf("%s is set but no source ip was given", c.field))
+				return false, notes
+			}
+			continue
+		}
+		if !matchField(source, c.field, c.value, c.match) {
+			return false, notes
+		}
+	}
+	return true, notes
+}
+
+func matchOperation(operation map[string]interface{}, req authzRequest) bool {
+	port := strconv.FormatInt(req.port, 10)
+	return matchField(operation, "hosts", req.host, matchHost) &&
+		matchField(operation, "ports", port, matchValue) &&
+		matchField(operation, "methods", req.method, matchValue) &&
+		matchField(operation, "paths", req.path, matchValue)
+}
+
+func matchCondition(cond map[string]interface{}, req authzRequest) (bool, []string) {
+	key, _ := cond["key"].(string)
+	var value string
+	switch {
+	case key == "source.principal":
+		value = req.principal
+	case key == "source.namespace":
+		value = req.sourceNamespace
+	case key == "source.ip" || key == "remote.ip":
+		if req.sourceIP == "" {
+			return false, []string{fmt.Sprintf("condition %s needs a source ip", key)}
+		}
+		return matchField(cond, "values", req.sourceIP, matchIP), nil
+	case key == "destination.port":
+		value = strconv.FormatInt(req.port, 10)
+	case strings.HasPrefix(key, "request.headers[") && strings.HasSuffix(key, "]"):
+		name := strings.TrimSuffix(strings.TrimPrefix(key, "request.headers["), "]")
+		for k, v := range req.headers {
+			if strings.EqualFold(k, name) {
+				value = v
+			}
+		}
+	default:
+		return false, []string{fmt.Sprintf("condition %s can not be evaluated", key)}
+	}
+	return matchField(cond, "values", value, matchValue), nil
+}
+
+// matchField 字段存在时值须匹配其中任一项，not 字段存在时值不能匹配其中任何一项
+func matchField(obj map[string]interface{}, field, value string, match func(pattern, value string) bool) bool {
+	notField := "not" + strings.ToUpper(field[:1]) + field[1:]
+	if patterns, ok := stringList(obj[field]); ok {
+		matched := false
+		for _, p := range patterns {
+			if match(p, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if patterns, ok := stringList(obj[notField]); ok {
+		for _, p := range patterns {
+			if match(p, value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func stringList(v interface{}) ([]string, bool) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	result := make([]string, 0, len(list))
+	for i := range list {
+		if s, ok := list[i].(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result, true
+}
+
+// matchValue 支持精确、前缀（abc*）、后缀（*abc）匹配，* 匹配任意非空值
+func matchValue(pattern, value string) bool {
+	switch {
+	case pattern == "*":
+		return value != ""
+	case strings.HasSuffix(pattern, "*"):
+		return strings.HasPrefix(value, strings.TrimSuffix(pattern, "*"))
+	case strings.HasPrefix(pattern, "*"):
+		return strings.HasSuffix(value, strings.TrimPrefix(pattern, "*"))
+	}
+	return pattern == value
+}
+
+// matchHost 主机名不区分大小写，请求中带端口时同样匹配
+func matchHost(pattern, host string) bool {
+	host = strings.ToLower(host)
+	pattern = strings.ToLower(pattern)
+	if matchValue(pattern, host) {
+		return true
+	}
+	h, _ := splitHostPort(host)
+	return matchValue(pattern, h)
+}
+
+func matchIP(pattern, ip string) bool {
+	if _, network, err := net.ParseCIDR(pattern); err == nil {
+		return network.Contains(net.ParseIP(ip))
+	}
+	return pattern == ip
+}
@@ -0,0 +1,82 @@
+package istio
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newPolicy(namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return newIstioObject("AuthorizationPolicy", namespace, name, spec)
+}
+
+func TestEvaluateAuthorization(t *testing.T) {
+	allowFrontend := newPolicy("shop", "allow-frontend", map[string]interface{}{
+		"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "cart"}},
+		"rules": []interface{}{
+			map[string]interface{}{
+				"from": []interface{}{map[string]interface{}{"source": map[string]interface{}{
+					"principals": []interface{}{"cluster.local/ns/web/sa/frontend"},
+				}}},
+				"to": []interface{}{map[string]interface{}{"operation": map[string]interface{}{
+					"methods": []interface{}{"GET", "POST"},
+					"paths":   []interface{}{"/api/*"},
+					"ports":   []interface{}{"8080"},
+				}}},
+			},
+		},
+	})
+	denyAdmin := newPolicy("istio-system", "deny-admin", map[string]interface{}{
+		"action": "DENY",
+		"rules": []interface{}{
+			map[string]interface{}{
+				"to": []interface{}{map[string]interface{}{"operation": map[string]interface{}{
+					"paths": []interface{}{"/api/admin*"},
+				}}},
+				"when": []interface{}{map[string]interface{}{
+					"key":       "request.headers[x-override]",
+					"notValues": []interface{}{"yes"},
+				}},
+			},
+		},
+	})
+	other := newPolicy("shop", "other-workload", map[string]interface{}{
+		"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "payment"}},
+	})
+	policies := applicablePolicies([]*unstructured.Unstructured{allowFrontend, denyAdmin, other}, "shop", "istio-system", map[string]string{"app": "cart"})
+	if len(policies) != 2 {
+		t.Fatalf("expect 2 applicable policies, got %d", len(policies))
+	}
+
+	req := authzRequest{
+		principal:       "cluster.local/ns/web/sa/frontend",
+		sourceNamespace: "web",
+		host:            "cart.shop.svc.cluster.local",
+		port:            8080,
+		method:          "GET",
+		path:            "/api/items",
+	}
+	if d := evaluateAuthorization(policies, req); d.Decision != AuthzAllow || d.Policy != "shop/allow-frontend" || d.Rule != 0 {
+		t.Errorf("unexpected decision %+v", d)
+	}
+
+	admin := req
+	admin.path = "/api/admin/users"
+	if d := evaluateAuthorization(policies, admin); d.Decision != AuthzDeny || d.Policy != "istio-system/deny-admin" {
+		t.Errorf("unexpected decision %+v", d)
+	}
+	admin.headers = map[string]string{"X-Override": "yes"}
+	if d := evaluateAuthorization(policies, admin); d.Decision != AuthzAllow {
+		t.Errorf("unexpected decision %+v", d)
+	}
+
+	stranger := req
+	stranger.principal = "cluster.local/ns/batch/sa/default"
+	if d := evaluateAuthorization(policies, stranger); d.Decision != AuthzDeny || d.Policy != "" {
+		t.Errorf("unexpected decision %+v", d)
+	}
+
+	if d := evaluateAuthorization(nil, stranger); d.Decision != AuthzAllow {
+		t.Errorf("unexpected decision %+v", d)
+	}
+}
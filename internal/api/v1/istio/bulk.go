@@ -0,0 +1,133 @@
+package istio
+
+import (
+	"fmt"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1System "github.com/KubeOperator/kubepi/internal/model/v1/system"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	v1SystemService "github.com/KubeOperator/kubepi/internal/service/v1/system"
+	"github.com/KubeOperator/kubepi/pkg/meshconfig"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"k8s.io/client-go/dynamic"
+)
+
+type BulkRequest struct {
+	Items       []meshconfig.ObjectRef `json:"items"`
+	Labels      map[string]*string     `json:"labels"`
+	Annotations map[string]*string     `json:"annotations"`
+	Atomic      bool                   `json:"atomic"`
+	DryRun      bool                   `json:"dryRun"`
+}
+
+// userDynamicClient 返回以当前用户身份访问集群的 dynamic client
+func (h *Handler) userDynamicClient(ctx *context.Context) (dynamic.Interface, error) {
+	c, err := h.clusterService.Get(ctx.Params().GetString("cluster"), common.DBOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get cluster failed: %s", err.Error())
+	}
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	cfg, err := commons.UserConfig(c, profile)
+	if err != nil {
+		return nil, err
+	}
+	return dynamic.NewForConfig(cfg)
+}
+
+// BulkDelete 批量删除 VirtualService、DestinationRule、Gateway，atomic=true 时任一失败则重新创建已删除的对象
+func (h *Handler) BulkDelete() iris.Handler {
+	return func(ctx *context.Context) {
+		var req BulkRequest
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		h.runBulk(ctx, "delete", req.DryRun, func(client dynamic.Interface) *meshconfig.BulkReport {
+			return meshconfig.BulkDelete(client, req.Items, meshconfig.BulkOptions{Atomic: req.Atomic, DryRun: req.DryRun})
+		})
+	}
+}
+
+// BulkLabel 批量设置标签与注解，值为 null 时删除对应的键
+func (h *Handler) BulkLabel() iris.Handler {
+	return func(ctx *context.Context) {
+		var req BulkRequest
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if len(req.Labels) == 0 && len(req.Annotations) == 0 {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "labels or annotations are required")
+			return
+		}
+		h.runBulk(ctx, "label", req.DryRun, func(client dynamic.Interface) *meshconfig.BulkReport {
+			return meshconfig.BulkLabel(client, req.Items, req.Labels, req.Annotations, meshconfig.BulkOptions{Atomic: req.Atomic, DryRun: req.DryRun})
+		})
+	}
+}
+
+// BulkApply 按顺序创建或替换多文档 YAML 中的对象，namespace 参数为未指定命名空间的对象的默认值
+func (h *Handler) BulkApply() iris.Handler {
+	return func(ctx *context.Context) {
+		opts := meshconfig.BulkOptions{
+			Atomic: ctx.URLParamBoolDefault("atomic", false),
+			DryRun: ctx.URLParamBoolDefault("dryRun", false),
+		}
+		data, err := readBundle(ctx)
+		if err != nil {
+			ctx.StatusCode(readBundleStatus(err))
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		objs, err := meshconfig.DecodeYAML(data)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", fmt.Sprintf("decode yaml failed: %s", err.Error()))
+			return
+		}
+		if namespace := ctx.URLParam("namespace"); namespace != "" {
+			for _, o := range objs {
+				if o.GetNamespace() == "" {
+					o.SetNamespace(namespace)
+				}
+			}
+		}
+		h.runBulk(ctx, "apply", opts.DryRun, func(client dynamic.Interface) *meshconfig.BulkReport {
+			return meshconfig.BulkApply(client, objs, opts)
+		})
+	}
+}
+
+func (h *Handler) runBulk(ctx *context.Context, operation string, dryRun bool, run func(client dynamic.Interface) *meshconfig.BulkReport) {
+	client, err := h.userDynamicClient(ctx)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.Values().Set("message", err.Error())
+		return
+	}
+	report := run(client)
+	if !dryRun && report.Succeeded > 0 {
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		var changed []string
+		for _, item := range report.Items {
+			if item.Status == meshconfig.BulkSucceeded {
+				changed = append(changed, fmt.Sprintf("%s %s/%s", item.Kind, item.Namespace, item.Name))
+			}
+		}
+		go v1SystemService.NewService().CreateOperationLog(&v1System.OperationLog{
+			Operator:            profile.Name,
+			Operation:           operation,
+			OperationDomain:     "istio_bulk",
+			SpecificInformation: fmt.Sprintf("[%s] %v", ctx.Params().GetString("cluster"), changed),
+		}, common.DBOptions{})
+	}
+	ctx.JSON(map[string]interface{}{
+		"data":    report,
+		"success": report.Failed == 0,
+	})
+}
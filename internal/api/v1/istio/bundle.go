@@ -0,0 +1,208 @@
+package istio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1System "github.com/KubeOperator/kubepi/internal/model/v1/system"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	v1SystemService "github.com/KubeOperator/kubepi/internal/service/v1/system"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/KubeOperator/kubepi/pkg/meshconfig"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// ExportBundle 导出清理后的 Istio 配置，format=yaml 为多文档 YAML，format=tar 为每个对象一个文件的 tar 包
+// 可通过 namespaces、kinds（资源名，逗号分隔）筛选，默认导出全部命名空间的全部 Istio 配置
+func (h *Handler) ExportBundle() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		format := ctx.URLParamDefault("format", "yaml")
+		if format != "yaml" && format != "tar" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", fmt.Sprintf("unsupported format %s", format))
+			return
+		}
+		resources := make(map[string]bool)
+		if k := ctx.URLParam("kinds"); k != "" {
+			for _, r := range strings.Split(k, ",") {
+				resources[r] = true
+			}
+		}
+		namespaces := []string{""}
+		if ns := ctx.URLParam("namespaces"); ns != "" {
+			namespaces = strings.Split(ns, ",")
+		}
+
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		cc, err := informer.Clusters.Get(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+
+		var objs []*unstructured.Unstructured
+		for _, k := range meshconfig.Kinds {
+			if len(resources) > 0 && !resources[k.Resource.Resource] {
+				continue
+			}
+			for _, ns := range namespaces {
+				items, err := listObjects(cc, profile, k.Resource, ns)
+				if err != nil {
+					ctx.StatusCode(iris.StatusInternalServerError)
+					ctx.Values().Set("message", err.Error())
+					return
+				}
+				for i := range items {
+					objs = append(objs, meshconfig.Clean(&unstructured.Unstructured{Object: items[i]}))
+				}
+			}
+		}
+		meshconfig.Sort(objs)
+
+		var data []byte
+		if format == "tar" {
+			data, err = meshconfig.EncodeTar(objs)
+		} else {
+			data, err = meshconfig.EncodeYAML(objs)
+		}
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		filename := fmt.Sprintf("%s-istio-%s.%s", clusterName, time.Now().Format("20060102150405"), format)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+		if format == "tar" {
+			ctx.ContentType("application/x-tar")
+		} else {
+			ctx.ContentType("application/yaml")
+		}
+		_, _ = ctx.Write(data)
+	}
+}
+
+// ImportBundle 以当前用户身份将配置包应用到集群
+// 请求体为 YAML 或 tar 包（也可通过 multipart 的 file 字段上传），参数：
+// conflictPolicy=skip|overwrite|fail（默认 fail），dryRun=true 只返回报告，namespaceMapping=staging:prod,a:b
+func (h *Handler) ImportBundle() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		opts := meshconfig.Options{
+			Policy:           ctx.URLParamDefault("conflictPolicy", meshconfig.PolicyFail),
+			DryRun:           ctx.URLParamBoolDefault("dryRun", false),
+			NamespaceMapping: make(map[string]string),
+		}
+		if !meshconfig.ValidPolicy(opts.Policy) {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", fmt.Sprintf("unsupported conflict policy %s", opts.Policy))
+			return
+		}
+		if m := ctx.URLParam("namespaceMapping"); m != "" {
+			for _, pair := range strings.Split(m, ",") {
+				ss := strings.SplitN(pair, ":", 2)
+				if len(ss) != 2 || ss[0] == "" || ss[1] == "" {
+					ctx.StatusCode(iris.StatusBadRequest)
+					ctx.Values().Set("message", fmt.Sprintf("invalid namespace mapping %s", pair))
+					return
+				}
+				opts.NamespaceMapping[ss[0]] = ss[1]
+			}
+		}
+
+		data, err := readBundle(ctx)
+		if err != nil {
+			ctx.StatusCode(readBundleStatus(err))
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		objs, err := meshconfig.Decode(data)
+		if err != nil {
+			ctx.StatusCode(readBundleStatus(err))
+			ctx.Values().Set("message", fmt.Sprintf("decode bundle failed: %s", err.Error()))
+			return
+		}
+
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		cfg, err := commons.UserConfig(c, profile)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		client, err := dynamic.NewForConfig(cfg)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+
+		report := meshconfig.Import(client, objs, opts)
+		if !opts.DryRun && !report.Aborted {
+			go v1SystemService.NewService().CreateOperationLog(&v1System.OperationLog{
+				Operator:            profile.Name,
+				Operation:           "import",
+				OperationDomain:     "istio_bundle",
+				SpecificInformation: fmt.Sprintf("[%s] created %d, updated %d, skipped %d, failed %d", clusterName, report.Created, report.Updated, report.Skipped, report.Failed),
+			}, common.DBOptions{})
+		}
+		if report.Aborted {
+			ctx.StatusCode(iris.StatusConflict)
+			ctx.JSON(map[string]interface{}{
+				"data":    report,
+				"message": "bundle conflicts with existing objects, nothing was applied",
+				"success": false,
+			})
+			return
+		}
+		ctx.JSON(map[string]interface{}{
+			"data":    report,
+			"success": true,
+		})
+	}
+}
+
+// readBundle 读取请求体中的配置包，配置包整体读入内存，超过 meshconfig.MaxBundleSize 时返回 *http.MaxBytesError
+func readBundle(ctx *context.Context) ([]byte, error) {
+	ctx.Request().Body = http.MaxBytesReader(ctx.ResponseWriter(), ctx.Request().Body, meshconfig.MaxBundleSize)
+	if strings.HasPrefix(ctx.GetContentTypeRequested(), "multipart/") {
+		f, _, err := ctx.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+	return io.ReadAll(ctx.Request().Body)
+}
+
+// readBundleStatus 返回读取或解压配置包失败时的状态码
+func readBundleStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || errors.Is(err, meshconfig.ErrBundleTooLarge) {
+		return iris.StatusRequestEntityTooLarge
+	}
+	return iris.StatusBadRequest
+}
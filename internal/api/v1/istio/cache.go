@@ -0,0 +1,71 @@
+package istio
+
+import (
+	"errors"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/kataras/iris/v12/context"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// listFromCache 从集群共享缓存返回资源列表，并按当前用户的 RBAC 权限过滤
+// 缓存不可用时返回 false，由调用方回退到直接访问 API Server
+func (h *Handler) listFromCache(ctx *context.Context, clusterName, namespace string, gvr schema.GroupVersionResource) bool {
+	c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+	if err != nil {
+		return false
+	}
+	cc, err := informer.Clusters.Get(c)
+	if err != nil {
+		return false
+	}
+	objs, err := cc.List(gvr, namespace)
+	if err != nil {
+		return false
+	}
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	if !profile.IsAdministrator {
+		objs, err = cc.FilterByAccess(profile.Name, gvr, objs)
+		if err != nil {
+			return false
+		}
+	}
+	items := make([]interface{}, 0, len(objs))
+	for i := range objs {
+		items = append(items, objs[i].Object)
+	}
+	ctx.JSON(map[string]interface{}{
+		"data": map[string]interface{}{
+			"apiVersion": gvr.GroupVersion().String(),
+			"kind":       informer.ListKind(gvr),
+			"metadata":   map[string]interface{}{"resourceVersion": cc.ResourceVersion(gvr)},
+			"items":      items,
+		},
+		"success": true,
+	})
+	return true
+}
+
+// listObjects 从缓存读取用户可见的对象，集群未安装对应 CRD 时返回空列表
+func listObjects(cc *informer.ClusterCache, profile session.UserProfile, gvr schema.GroupVersionResource, namespace string) ([]map[string]interface{}, error) {
+	objs, err := cc.List(gvr, namespace)
+	if err != nil {
+		if errors.Is(err, informer.ErrNotServed) {
+			return []map[string]interface{}{}, nil
+		}
+		return nil, err
+	}
+	if !profile.IsAdministrator {
+		objs, err = cc.FilterByAccess(profile.Name, gvr, objs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := make([]map[string]interface{}, 0, len(objs))
+	for i := range objs {
+		result = append(result, objs[i].Object)
+	}
+	return result, nil
+}
@@ -0,0 +1,661 @@
+package istio
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	v1System "github.com/KubeOperator/kubepi/internal/model/v1/system"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	v1SystemService "github.com/KubeOperator/kubepi/internal/service/v1/system"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/KubeOperator/kubepi/pkg/logging"
+	"github.com/KubeOperator/kubepi/pkg/meshconfig"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	OutboundAllowAny     = "ALLOW_ANY"
+	OutboundRegistryOnly = "REGISTRY_ONLY"
+
+	EgressPathPassthrough = "passthrough"
+	EgressPathDirect      = "direct"
+	EgressPathGateway     = "egress-gateway"
+
+	passthroughCluster    = "PassthroughCluster"
+	defaultIstioNamespace = "istio-system"
+	defaultEgressTail     = 500
+)
+
+type EgressHost struct {
+	Host         string   `json:"host"`
+	Ports        []string `json:"ports"`
+	Path         string   `json:"path"`
+	ServiceEntry string   `json:"serviceEntry,omitempty"`
+	Gateway      string   `json:"gateway,omitempty"`
+	Resolution   string   `json:"resolution,omitempty"`
+}
+
+// ObservedHost 为 istio-proxy 访问日志中经 PassthroughCluster 直接访问的外部地址
+type ObservedHost struct {
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Requests int    `json:"requests"`
+	Covered  bool   `json:"covered"`
+}
+
+type NamespaceEgress struct {
+	Namespace string `json:"namespace"`
+	Mode      string `json:"mode"`
+	// ModeSource 为 mesh 或生效的 Sidecar（namespace/name）
+	ModeSource string         `json:"modeSource"`
+	Hosts      []EgressHost   `json:"hosts"`
+	Observed   []ObservedHost `json:"observed,omitempty"`
+}
+
+// egressConfig 为计算出口清单所需的网格配置
+type egressConfig struct {
+	meshMode        string
+	rootNamespace   string
+	serviceEntries  []*unstructured.Unstructured
+	sidecars        []*unstructured.Unstructured
+	gateways        []*unstructured.Unstructured
+	virtualServices []*unstructured.Unstructured
+}
+
+// GetEgress 列出每个命名空间可以访问的外部主机及访问路径，observe=true 时从访问日志中统计经 passthrough 访问的主机
+func (h *Handler) GetEgress() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		namespace := ctx.URLParam("namespace")
+		observe, _ := ctx.URLParamBool("observe")
+		if observe && namespace == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "namespace is required when observe is enabled")
+			return
+		}
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		cc, err := informer.Clusters.Get(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if namespace != "" {
+			if status, err := checkNamespaceAccess(cc, profile, namespace); err != nil {
+				ctx.StatusCode(status)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+		}
+		cfg, err := h.loadEgressConfig(c, cc, profile, ctx.URLParamDefault("istioNamespace", defaultIstioNamespace))
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+
+		var namespaces []string
+		if namespace != "" {
+			namespaces = []string{namespace}
+		} else {
+			objs, err := listObjects(cc, profile, informer.Namespaces, "")
+			if err != nil {
+				ctx.StatusCode(iris.StatusInternalServerError)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			for _, o := range objs {
+				namespaces = append(namespaces, (&unstructured.Unstructured{Object: o}).GetName())
+			}
+			sort.Strings(namespaces)
+		}
+
+		result := make([]NamespaceEgress, 0, len(namespaces))
+		for _, ns := range namespaces {
+			result = append(result, cfg.inventory(ns))
+		}
+		if observe {
+			entries, err := h.observeEgress(c, profile, namespace, ctx.URLParamInt64Default("tailLines", defaultEgressTail))
+			if err != nil {
+				ctx.StatusCode(iris.StatusInternalServerError)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			result[0].Observed = observedHosts(entries, result[0].Hosts)
+		}
+
+		ctx.JSON(map[string]interface{}{
+			"data": map[string]interface{}{
+				"meshMode":   cfg.meshMode,
+				"namespaces": result,
+			},
+			"success": true,
+		})
+	}
+}
+
+type RegistryOnlyRequest struct {
+	// Hosts 为需要生成 ServiceEntry 的主机，格式为 host 或 host:port
+	Hosts     []string `json:"hosts"`
+	Observe   bool     `json:"observe"`
+	TailLines int64    `json:"tailLines"`
+}
+
+// SwitchRegistryOnly 将命名空间的出口策略切换为 REGISTRY_ONLY，切换前为指定的和访问日志中观察到的外部主机生成 ServiceEntry
+func (h *Handler) SwitchRegistryOnly() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		namespace := ctx.Params().GetString("namespace")
+		dryRun, _ := ctx.URLParamBool("dryRun")
+		var req RegistryOnlyRequest
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		cc, err := informer.Clusters.Get(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if status, err := checkNamespaceAccess(cc, profile, namespace); err != nil {
+			ctx.StatusCode(status)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		cfg, err := h.loadEgressConfig(c, cc, profile, ctx.URLParamDefault("istioNamespace", defaultIstioNamespace))
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		inventory := cfg.inventory(namespace)
+
+		ports := make(map[string][]string)
+		var hosts []string
+		add := func(host, port string) {
+			if _, ok := ports[host]; !ok {
+				hosts = append(hosts, host)
+				ports[host] = []string{}
+			}
+			if port != "" && !containsString(ports[host], port) {
+				ports[host] = append(ports[host], port)
+			}
+		}
+		for _, hp := range req.Hosts {
+			host, port := splitHostPort(hp)
+			add(host, port)
+		}
+		if req.Observe {
+			tailLines := req.TailLines
+			if tailLines <= 0 {
+				tailLines = defaultEgressTail
+			}
+			entries, err := h.observeEgress(c, profile, namespace, tailLines)
+			if err != nil {
+				ctx.StatusCode(iris.StatusInternalServerError)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			for _, o := range observedHosts(entries, inventory.Hosts) {
+				if !o.Covered {
+					add(o.Host, o.Port)
+				}
+			}
+		}
+
+		var objs []*unstructured.Unstructured
+		var ignored []string
+		for _, host := range hosts {
+			// 只有 IP 的地址无法按主机名生成 ServiceEntry，交由用户手动处理
+			if net.ParseIP(host) != nil {
+				ignored = append(ignored, host)
+				continue
+			}
+			objs = append(objs, serviceEntryFor(namespace, host, ports[host]))
+		}
+
+		userCfg, err := commons.UserConfig(c, profile)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		client, err := dynamic.NewForConfig(userCfg)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		// 先创建 ServiceEntry，全部成功后再切换出口策略，避免切换后外部访问中断
+		report := meshconfig.Import(client, objs, meshconfig.Options{Policy: meshconfig.PolicySkip, DryRun: dryRun})
+		if report.Failed == 0 {
+			sidecarReport := meshconfig.Import(client, []*unstructured.Unstructured{cfg.registryOnlySidecar(namespace)},
+				meshconfig.Options{Policy: meshconfig.PolicyOverwrite, DryRun: dryRun})
+			report.Items = append(report.Items, sidecarReport.Items...)
+			report.Created += sidecarReport.Created
+			report.Updated += sidecarReport.Updated
+			report.Skipped += sidecarReport.Skipped
+			report.Failed += sidecarReport.Failed
+		} else {
+			report.Aborted = true
+		}
+		if !dryRun && report.Created+report.Updated > 0 {
+			go v1SystemService.NewService().CreateOperationLog(&v1System.OperationLog{
+				Operator:            profile.Name,
+				Operation:           "registry-only",
+				OperationDomain:     "istio_egress",
+				SpecificInformation: fmt.Sprintf("[%s] %s: service entries for %s", clusterName, namespace, strings.Join(hosts, ",")),
+			}, common.DBOptions{})
+		}
+		ctx.JSON(map[string]interface{}{
+			"data": map[string]interface{}{
+				"report":  report,
+				"ignored": ignored,
+			},
+			"success": true,
+		})
+	}
+}
+
+// loadEgressConfig 读取网格的出口配置，非管理员只能看到有权限的配置
+func (h *Handler) loadEgressConfig(c *v1Cluster.Cluster, cc *informer.ClusterCache, profile session.UserProfile, istioNamespace string) (*egressConfig, error) {
+	mesh, err := h.loadMeshSettings(c, istioNamespace)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &egressConfig{meshMode: mesh.OutboundMode, rootNamespace: mesh.RootNamespace}
+	for _, l := range []struct {
+		gvr  schema.GroupVersionResource
+		dest *[]*unstructured.Unstructured
+	}{
+		{informer.ServiceEntries, &cfg.serviceEntries},
+		{informer.Sidecars, &cfg.sidecars},
+		{informer.Gateways, &cfg.gateways},
+		{informer.VirtualServices, &cfg.virtualServices},
+	} {
+		objs, err := listObjects(cc, profile, l.gvr, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range objs {
+			*l.dest = append(*l.dest, &unstructured.Unstructured{Object: o})
+		}
+	}
+	return cfg, nil
+}
+
+// checkNamespaceAccess 检查非管理员能否访问命名空间，与 FilterByAccess 一致以 namespace 对象的 get 权限为准
+func checkNamespaceAccess(cc *informer.ClusterCache, profile session.UserProfile, namespace string) (int, error) {
+	if profile.IsAdministrator {
+		return 0, nil
+	}
+	ok, err := cc.Allowed(profile.Name, "get", informer.Namespaces, namespace, namespace)
+	if err != nil {
+		return iris.StatusInternalServerError, err
+	}
+	if !ok {
+		return iris.StatusForbidden, fmt.Errorf("forbidden: can not access namespace %s", namespace)
+	}
+	return 0, nil
+}
+
+// observeEgress 以当前用户身份读取命名空间内注入了 sidecar 的 Pod 的访问日志，只保留经 PassthroughCluster 的请求
+func (h *Handler) observeEgress(c *v1Cluster.Cluster, profile session.UserProfile, namespace string, tailLines int64) ([]*logging.AccessLogEntry, error) {
+	cc, err := informer.Clusters.Get(c)
+	if err != nil {
+		return nil, err
+	}
+	objs, err := listObjects(cc, profile, informer.Pods, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var pods []string
+	for _, o := range objs {
+		pod := &unstructured.Unstructured{Object: o}
+		if hasSidecar(pod) {
+			pods = append(pods, pod.GetName())
+		}
+	}
+	userCfg, err := commons.UserConfig(c, profile)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(userCfg)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*logging.AccessLogEntry
+	for _, e := range logging.CollectAccessLogs(client, namespace, pods, logging.AccessLogOptions{TailLines: tailLines}) {
+		if e.UpstreamCluster == passthroughCluster {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// inventory 计算命名空间的出口策略及可访问的外部主机
+func (e *egressConfig) inventory(namespace string) NamespaceEgress {
+	result := NamespaceEgress{Namespace: namespace, Mode: e.meshMode, ModeSource: "mesh", Hosts: []EgressHost{}}
+	sidecar := e.namespaceSidecar(namespace)
+	var egressHosts []string
+	if sidecar != nil {
+		if mode, ok, _ := unstructured.NestedString(sidecar.Object, "spec", "outboundTrafficPolicy", "mode"); ok && mode != "" {
+			result.Mode = mode
+			result.ModeSource = sidecar.GetNamespace() + "/" + sidecar.GetName()
+		}
+		egressHosts = sidecarEgressHosts(sidecar)
+	}
+
+	for _, se := range e.serviceEntries {
+		if location, _, _ := unstructured.NestedString(se.Object, "spec", "location"); location == "MESH_INTERNAL" {
+			continue
+		}
+		if !exportedTo(se, namespace) {
+			continue
+		}
+		hosts, _, _ := unstructured.NestedStringSlice(se.Object, "spec", "hosts")
+		resolution, _, _ := unstructured.NestedString(se.Object, "spec", "resolution")
+		var ports []string
+		ps, _, _ := unstructured.NestedSlice(se.Object, "spec", "ports")
+		for i := range ps {
+			if p, ok := ps[i].(map[string]interface{}); ok {
+				number, _ := toFloat(p["number"])
+				protocol, _ := p["protocol"].(string)
+				ports = append(ports, fmt.Sprintf("%d/%s", int64(number), protocol))
+			}
+		}
+		for _, host := range hosts {
+			if !sidecarImports(egressHosts, namespace, se.GetNamespace(), host) {
+				continue
+			}
+			eh := EgressHost{
+				Host:         host,
+				Ports:        ports,
+				Path:         EgressPathDirect,
+				ServiceEntry: se.GetNamespace() + "/" + se.GetName(),
+				Resolution:   resolution,
+			}
+			if gw := e.egressGatewayFor(namespace, host); gw != "" {
+				eh.Path, eh.Gateway = EgressPathGateway, gw
+			}
+			result.Hosts = append(result.Hosts, eh)
+		}
+	}
+	sort.Slice(result.Hosts, func(i, j int) bool { return result.Hosts[i].Host < result.Hosts[j].Host })
+	// ALLOW_ANY 下未在注册表中的主机经 PassthroughCluster 直接访问
+	if result.Mode != OutboundRegistryOnly {
+		result.Hosts = append(result.Hosts, EgressHost{Host: "*", Path: EgressPathPassthrough})
+	}
+	return result
+}
+
+// namespaceSidecar 返回命名空间内不带 workloadSelector 的 Sidecar，没有时使用根命名空间中的网格默认 Sidecar
+func (e *egressConfig) namespaceSidecar(namespace string) *unstructured.Unstructured {
+	var root *unstructured.Unstructured
+	for _, s := range e.sidecars {
+		if _, ok, _ := unstructured.NestedMap(s.Object, "spec", "workloadSelector"); ok {
+			continue
+		}
+		if s.GetNamespace() == namespace {
+			return s
+		}
+		if s.GetNamespace() == e.rootNamespace && root == nil {
+			root = s
+		}
+	}
+	return root
+}
+
+// registryOnlySidecar 生成命名空间级别的 REGISTRY_ONLY Sidecar，已有命名空间 Sidecar 时只修改其出口策略，否则继承网格默认 Sidecar 的其他配置
+func (e *egressConfig) registryOnlySidecar(namespace string) *unstructured.Unstructured {
+	var obj *unstructured.Unstructured
+	if s := e.namespaceSidecar(namespace); s != nil {
+		obj = s.DeepCopy()
+	}
+	if obj == nil || obj.GetNamespace() != namespace {
+		spec := map[string]interface{}{}
+		if obj != nil {
+			spec, _, _ = unstructured.NestedMap(obj.Object, "spec")
+		}
+		obj = &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": informer.Sidecars.GroupVersion().String(),
+			"kind":       "Sidecar",
+			"metadata":   map[string]interface{}{"name": "default", "namespace": namespace},
+			"spec":       spec,
+		}}
+	}
+	_ = unstructured.SetNestedField(obj.Object, OutboundRegistryOnly, "spec", "outboundTrafficPolicy", "mode")
+	return obj
+}
+
+// egressGatewayFor 返回将 host 的流量转发到出口网关的 Gateway（namespace/name）
+func (e *egressConfig) egressGatewayFor(namespace, host string) string {
+	egress := make(map[string]bool)
+	for _, gw := range e.gateways {
+		selector, _, _ := unstructured.NestedStringMap(gw.Object, "spec", "selector")
+		for _, v := range selector {
+			if strings.Contains(v, "egressgateway") {
+				egress[gw.GetNamespace()+"/"+gw.GetName()] = true
+				break
+			}
+		}
+	}
+	if len(egress) == 0 {
+		return ""
+	}
+	for _, vs := range e.virtualServices {
+		if !exportedTo(vs, namespace) {
+			continue
+		}
+		hosts, _, _ := unstructured.NestedStringSlice(vs.Object, "spec", "hosts")
+		matched := false
+		for _, h := range hosts {
+			if hostMatches(h, host) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		gateways, _, _ := unstructured.NestedStringSlice(vs.Object, "spec", "gateways")
+		for _, g := range gateways {
+			if !strings.Contains(g, "/") {
+				g = vs.GetNamespace() + "/" + g
+			}
+			if egress[g] {
+				return g
+			}
+		}
+	}
+	return ""
+}
+
+func sidecarEgressHosts(sidecar *unstructured.Unstructured) []string {
+	egress, ok, _ := unstructured.NestedSlice(sidecar.Object, "spec", "egress")
+	if !ok {
+		return nil
+	}
+	result := []string{}
+	for i := range egress {
+		if l, ok := egress[i].(map[string]interface{}); ok {
+			hosts, _, _ := unstructured.NestedStringSlice(l, "hosts")
+			result = append(result, hosts...)
+		}
+	}
+	return result
+}
+
+// sidecarImports 判断 Sidecar egress.hosts（namespace/host 形式）是否导入了 sourceNamespace 中的 host，egressHosts 为 nil 表示未配置 egress
+func sidecarImports(egressHosts []string, namespace, sourceNamespace, host string) bool {
+	if egressHosts == nil {
+		return true
+	}
+	for _, eh := range egressHosts {
+		parts := strings.SplitN(eh, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		ns, pattern := parts[0], parts[1]
+		if ns == "*" || ns == sourceNamespace || (ns == "." && sourceNamespace == namespace) {
+			if hostMatches(pattern, host) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exportedTo 判断配置的 exportTo 是否对命名空间可见
+func exportedTo(obj *unstructured.Unstructured, namespace string) bool {
+	exportTo, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "exportTo")
+	if len(exportTo) == 0 {
+		return true
+	}
+	for _, e := range exportTo {
+		if e == "*" || e == namespace || (e == "." && obj.GetNamespace() == namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+func hostMatches(pattern, host string) bool {
+	if pattern == "*" || pattern == host {
+		return true
+	}
+	return strings.HasPrefix(pattern, "*") && strings.HasSuffix(host, pattern[1:])
+}
+
+// observedHosts 按主机和端口汇总访问日志，HTTP 请求取 authority，TLS 取 SNI，都没有时取目的地址
+func observedHosts(entries []*logging.AccessLogEntry, known []EgressHost) []ObservedHost {
+	counts := make(map[string]*ObservedHost)
+	var keys []string
+	for _, e := range entries {
+		_, port := splitHostPort(e.DownstreamLocalAddress)
+		host := ""
+		switch {
+		case e.Authority != "" && e.Authority != "-":
+			host, _ = splitHostPort(e.Authority)
+		case e.RequestedServerName != "" && e.RequestedServerName != "-":
+			host = e.RequestedServerName
+		default:
+			host, _ = splitHostPort(e.DownstreamLocalAddress)
+		}
+		if host == "" || host == "-" {
+			continue
+		}
+		key := host + ":" + port
+		o, ok := counts[key]
+		if !ok {
+			o = &ObservedHost{Host: host, Port: port}
+			for _, k := range known {
+				if k.Path != EgressPathPassthrough && hostMatches(k.Host, host) {
+					o.Covered = true
+				}
+			}
+			counts[key] = o
+			keys = append(keys, key)
+		}
+		o.Requests++
+	}
+	sort.Strings(keys)
+	result := make([]ObservedHost, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, *counts[k])
+	}
+	return result
+}
+
+// serviceEntryFor 为外部主机生成只在当前命名空间可见的 ServiceEntry，443 端口视为 TLS，80 端口视为 HTTP
+func serviceEntryFor(namespace, host string, ports []string) *unstructured.Unstructured {
+	if len(ports) == 0 {
+		ports = []string{"443"}
+	}
+	sort.Strings(ports)
+	var specPorts []interface{}
+	for _, p := range ports {
+		number, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			continue
+		}
+		protocol := "TCP"
+		switch number {
+		case 443:
+			protocol = "TLS"
+		case 80:
+			protocol = "HTTP"
+		}
+		specPorts = append(specPorts, map[string]interface{}{
+			"number":   number,
+			"name":     fmt.Sprintf("%s-%d", strings.ToLower(protocol), number),
+			"protocol": protocol,
+		})
+	}
+	resolution := "DNS"
+	if strings.HasPrefix(host, "*") {
+		resolution = "NONE"
+	}
+	name := "egress-" + strings.NewReplacer("*", "wildcard", ".", "-").Replace(strings.ToLower(host))
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": informer.ServiceEntries.GroupVersion().String(),
+		"kind":       "ServiceEntry",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+			"labels":    map[string]interface{}{"app.kubernetes.io/managed-by": "kubepi"},
+		},
+		"spec": map[string]interface{}{
+			"hosts":      []interface{}{host},
+			"location":   "MESH_EXTERNAL",
+			"resolution": resolution,
+			"exportTo":   []interface{}{"."},
+			"ports":      specPorts,
+		},
+	}}
+}
+
+func splitHostPort(address string) (string, string) {
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		return host, port
+	}
+	return address, ""
+}
+
+func containsString(ss []string, s string) bool {
+	for i := range ss {
+		if ss[i] == s {
+			return true
+		}
+	}
+	return false
+}
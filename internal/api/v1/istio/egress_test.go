@@ -0,0 +1,86 @@
+package istio
+
+import (
+	"testing"
+
+	"github.com/KubeOperator/kubepi/pkg/logging"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newIstioObject(kind, namespace, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"kind":     kind,
+		"metadata": map[string]interface{}{"namespace": namespace, "name": name},
+		"spec":     spec,
+	}}
+}
+
+func TestEgressInventory(t *testing.T) {
+	cfg := &egressConfig{
+		meshMode:      OutboundAllowAny,
+		rootNamespace: "istio-system",
+		serviceEntries: []*unstructured.Unstructured{
+			newIstioObject("ServiceEntry", "shared", "github", map[string]interface{}{
+				"hosts": []interface{}{"api.github.com"},
+				"ports": []interface{}{map[string]interface{}{"number": int64(443), "protocol": "TLS"}},
+			}),
+			newIstioObject("ServiceEntry", "team-a", "private", map[string]interface{}{
+				"hosts":    []interface{}{"db.example.com"},
+				"exportTo": []interface{}{"."},
+			}),
+		},
+		sidecars: []*unstructured.Unstructured{
+			newIstioObject("Sidecar", "team-b", "default", map[string]interface{}{
+				"outboundTrafficPolicy": map[string]interface{}{"mode": OutboundRegistryOnly},
+			}),
+		},
+		gateways: []*unstructured.Unstructured{
+			newIstioObject("Gateway", "istio-system", "egress", map[string]interface{}{
+				"selector": map[string]interface{}{"istio": "egressgateway"},
+			}),
+		},
+		virtualServices: []*unstructured.Unstructured{
+			newIstioObject("VirtualService", "shared", "github", map[string]interface{}{
+				"hosts":    []interface{}{"api.github.com"},
+				"gateways": []interface{}{"mesh", "istio-system/egress"},
+			}),
+		},
+	}
+
+	a := cfg.inventory("team-a")
+	if a.Mode != OutboundAllowAny || len(a.Hosts) != 3 {
+		t.Fatalf("unexpected inventory %+v", a)
+	}
+	if a.Hosts[0].Host != "api.github.com" || a.Hosts[0].Path != EgressPathGateway || a.Hosts[0].Gateway != "istio-system/egress" {
+		t.Errorf("unexpected host %+v", a.Hosts[0])
+	}
+	if a.Hosts[2].Path != EgressPathPassthrough {
+		t.Errorf("expect passthrough, got %+v", a.Hosts[2])
+	}
+
+	b := cfg.inventory("team-b")
+	if b.Mode != OutboundRegistryOnly || b.ModeSource != "team-b/default" || len(b.Hosts) != 1 {
+		t.Fatalf("unexpected inventory %+v", b)
+	}
+
+	observed := observedHosts([]*logging.AccessLogEntry{
+		{Authority: "-", RequestedServerName: "api.github.com", DownstreamLocalAddress: "140.82.112.6:443"},
+		{Authority: "pypi.org", DownstreamLocalAddress: "151.101.0.223:80"},
+		{Authority: "pypi.org", DownstreamLocalAddress: "151.101.0.223:80"},
+	}, a.Hosts)
+	if len(observed) != 2 || !observed[0].Covered || observed[1].Covered || observed[1].Requests != 2 || observed[1].Port != "80" {
+		t.Fatalf("unexpected observed hosts %+v", observed)
+	}
+
+	sidecar := cfg.registryOnlySidecar("team-a")
+	if sidecar.GetNamespace() != "team-a" || sidecar.GetName() != "default" {
+		t.Fatalf("unexpected sidecar %+v", sidecar)
+	}
+	if mode, _, _ := unstructured.NestedString(sidecar.Object, "spec", "outboundTrafficPolicy", "mode"); mode != OutboundRegistryOnly {
+		t.Errorf("unexpected mode %s", mode)
+	}
+	se := serviceEntryFor("team-a", "pypi.org", []string{"80"})
+	if se.GetName() != "egress-pypi-org" {
+		t.Errorf("unexpected name %s", se.GetName())
+	}
+}
@@ -3,32 +3,31 @@ package istio
 import (
 	"bytes"
 	"encoding/json"
-	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
 	"github.com/KubeOperator/kubepi/internal/api/v1/session"
 	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
 	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
-	"github.com/KubeOperator/kubepi/internal/service/v1/clusterbinding"
 	"github.com/KubeOperator/kubepi/internal/service/v1/common"
-	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/informer"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/client-go/rest"
 )
 
 type Handler struct {
-	clusterService        cluster.Service
-	clusterBindingService clusterbinding.Service
+	clusterService cluster.Service
 }
 
 func NewHandler() *Handler {
 	return &Handler{
-		clusterService:        cluster.NewService(),
-		clusterBindingService: clusterbinding.NewService(),
+		clusterService: cluster.NewService(),
 	}
 }
 
@@ -49,6 +48,9 @@ func (h *Handler) ListVirtualServices() iris.Handler {
 		} else {
 			apiPath = fmt.Sprintf("%s/virtualservices", apiPath)
 		}
+		if ctx.Method() == http.MethodGet && h.listFromCache(ctx, clusterName, namespace, informer.VirtualServices) {
+			return
+		}
 		h.proxyToKubernetes(ctx, clusterName, apiPath)
 	}
 }
@@ -116,6 +118,9 @@ func (h *Handler) ListDestinationRules() iris.Handler {
 		} else {
 			apiPath = fmt.Sprintf("%s/destinationrules", apiPath)
 		}
+		if ctx.Method() == http.MethodGet && h.listFromCache(ctx, clusterName, namespace, informer.DestinationRules) {
+			return
+		}
 
 		h.proxyToKubernetes(ctx, clusterName, apiPath)
 	}
@@ -184,6 +189,9 @@ func (h *Handler) ListGateways() iris.Handler {
 		} else {
 			apiPath = fmt.Sprintf("%s/gateways", apiPath)
 		}
+		if ctx.Method() == http.MethodGet && h.listFromCache(ctx, clusterName, namespace, informer.Gateways) {
+			return
+		}
 
 		h.proxyToKubernetes(ctx, clusterName, apiPath)
 	}
@@ -248,7 +256,17 @@ func (h *Handler) GetTrafficAnalytics() iris.Handler {
 		// 3. 获取相关的 Pod 信息
 		// 4. 分析流量路由关系
 
-		analytics := h.analyzeTraffic(clusterName, namespace)
+		// range 为黄金指标的统计窗口，仅在集群配置了 Prometheus 时生效
+		window, _, _, err := signalRange(ctx)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+
+		u := ctx.Values().Get("profile")
+		profile := u.(session.UserProfile)
+		analytics := h.analyzeTraffic(clusterName, namespace, profile, window)
 		ctx.JSON(analytics)
 	}
 }
@@ -391,32 +409,15 @@ func (h *Handler) proxyToKubernetes(ctx *context.Context, clusterName, apiPath s
 
 // generateTLSTransport 生成 TLS 传输层，与其他 API 保持一致
 func (h *Handler) generateTLSTransport(c *v1Cluster.Cluster, profile session.UserProfile) (http.RoundTripper, error) {
-	if profile.IsAdministrator {
-		k := kubernetes.NewKubernetes(c)
-		adminConfig, err := k.Config()
-		if err != nil {
-			return nil, err
-		}
-		return rest.TransportFor(adminConfig)
-	}
-
-	binding, err := h.clusterBindingService.GetBindingByClusterNameAndUserName(c.Name, profile.Name, common.DBOptions{})
+	kubeConf, err := commons.UserConfig(c, profile)
 	if err != nil {
 		return nil, err
 	}
-	kubeConf := &rest.Config{
-		Host: c.Spec.Connect.Forward.ApiServer,
-		TLSClientConfig: rest.TLSClientConfig{
-			Insecure: true,
-			CertData: binding.Certificate,
-			KeyData:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: c.PrivateKey}),
-		},
-	}
 	return rest.TransportFor(kubeConf)
 }
 
 // analyzeTraffic 分析流量路由关系
-func (h *Handler) analyzeTraffic(clusterName, namespace string) interface{} {
+func (h *Handler) analyzeTraffic(clusterName, namespace string, profile session.UserProfile, window time.Duration) interface{} {
 	// 获取集群信息
 	c, err := h.clusterService.Get(clusterName, common.DBOptions{})
 	if err != nil {
@@ -425,20 +426,16 @@ func (h *Handler) analyzeTraffic(clusterName, namespace string) interface{} {
 		}
 	}
 
-	// 生成 TLS 传输层
-	profile := session.UserProfile{Name: "admin", IsAdministrator: true}
-	ts, err := h.generateTLSTransport(c, profile)
+	// 从集群共享缓存读取，避免每次请求都 LIST 三类资源
+	cc, err := informer.Clusters.Get(c)
 	if err != nil {
 		return map[string]interface{}{
-			"error": fmt.Sprintf("generate TLS transport failed: %s", err.Error()),
+			"error": fmt.Sprintf("get cluster cache failed: %s", err.Error()),
 		}
 	}
 
-	httpClient := http.Client{Transport: ts}
-	baseURL := c.Spec.Connect.Forward.ApiServer
-
 	// 获取所有 VirtualService
-	virtualServices, err := h.fetchVirtualServices(httpClient, baseURL, namespace)
+	virtualServices, err := listObjects(cc, profile, informer.VirtualServices, namespace)
 	if err != nil {
 		return map[string]interface{}{
 			"error": fmt.Sprintf("fetch VirtualServices failed: %s", err.Error()),
@@ -446,7 +443,7 @@ func (h *Handler) analyzeTraffic(clusterName, namespace string) interface{} {
 	}
 
 	// 获取所有 DestinationRule
-	destinationRules, err := h.fetchDestinationRules(httpClient, baseURL, namespace)
+	destinationRules, err := listObjects(cc, profile, informer.DestinationRules, namespace)
 	if err != nil {
 		return map[string]interface{}{
 			"error": fmt.Sprintf("fetch DestinationRules failed: %s", err.Error()),
@@ -454,144 +451,56 @@ func (h *Handler) analyzeTraffic(clusterName, namespace string) interface{} {
 	}
 
 	// 获取所有 Pod
-	pods, err := h.fetchPods(httpClient, baseURL, namespace)
+	pods, err := listObjects(cc, profile, informer.Pods, namespace)
 	if err != nil {
 		return map[string]interface{}{
 			"error": fmt.Sprintf("fetch Pods failed: %s", err.Error()),
 		}
 	}
 
-	// 分析流量关系
-	trafficAnalysis := h.analyzeTrafficFlow(virtualServices, destinationRules, pods)
-
-	return trafficAnalysis
-}
-
-// fetchVirtualServices 获取所有 VirtualService
-func (h *Handler) fetchVirtualServices(httpClient http.Client, baseURL, namespace string) ([]map[string]interface{}, error) {
-	apiPath := "/apis/networking.istio.io/v1beta1"
-	if namespace != "" {
-		apiPath = fmt.Sprintf("%s/namespaces/%s/virtualservices", apiPath, namespace)
-	} else {
-		apiPath = fmt.Sprintf("%s/virtualservices", apiPath)
-	}
-
-	fullURL := fmt.Sprintf("%s%s", baseURL, apiPath)
-	resp, err := httpClient.Get(fullURL)
+	// ambient 模式下 Pod 没有 sidecar，需要根据命名空间与服务上的标签判断数据面及 waypoint
+	// 命名空间只用于读取标签，直接读取缓存
+	namespaces, err := cc.List(informer.Namespaces, "")
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-
-	items, ok := result["items"].([]interface{})
-	if !ok {
-		return []map[string]interface{}{}, nil
-	}
-
-	var virtualServices []map[string]interface{}
-	for _, item := range items {
-		if vs, ok := item.(map[string]interface{}); ok {
-			virtualServices = append(virtualServices, vs)
+		return map[string]interface{}{
+			"error": fmt.Sprintf("fetch Namespaces failed: %s", err.Error()),
 		}
 	}
-
-	return virtualServices, nil
-}
-
-// fetchDestinationRules 获取所有 DestinationRule
-func (h *Handler) fetchDestinationRules(httpClient http.Client, baseURL, namespace string) ([]map[string]interface{}, error) {
-	apiPath := "/apis/networking.istio.io/v1beta1"
-	if namespace != "" {
-		apiPath = fmt.Sprintf("%s/namespaces/%s/destinationrules", apiPath, namespace)
-	} else {
-		apiPath = fmt.Sprintf("%s/destinationrules", apiPath)
-	}
-
-	fullURL := fmt.Sprintf("%s%s", baseURL, apiPath)
-	resp, err := httpClient.Get(fullURL)
+	services, err := h.listUnstructured(cc, profile, informer.Services)
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-
-	items, ok := result["items"].([]interface{})
-	if !ok {
-		return []map[string]interface{}{}, nil
-	}
-
-	var destinationRules []map[string]interface{}
-	for _, item := range items {
-		if dr, ok := item.(map[string]interface{}); ok {
-			destinationRules = append(destinationRules, dr)
+		return map[string]interface{}{
+			"error": fmt.Sprintf("fetch Services failed: %s", err.Error()),
 		}
 	}
 
-	return destinationRules, nil
-}
-
-// fetchPods 获取所有 Pod
-func (h *Handler) fetchPods(httpClient http.Client, baseURL, namespace string) ([]map[string]interface{}, error) {
-	apiPath := "/api/v1"
-	if namespace != "" {
-		apiPath = fmt.Sprintf("%s/namespaces/%s/pods", apiPath, namespace)
-	} else {
-		apiPath = fmt.Sprintf("%s/pods", apiPath)
-	}
-
-	fullURL := fmt.Sprintf("%s%s", baseURL, apiPath)
-	resp, err := httpClient.Get(fullURL)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, err
-	}
-
-	items, ok := result["items"].([]interface{})
-	if !ok {
-		return []map[string]interface{}{}, nil
-	}
+	// 分析流量关系
+	trafficAnalysis := h.analyzeTrafficFlow(virtualServices, destinationRules, pods, newAmbientIndex(namespaces, services))
 
-	var pods []map[string]interface{}
-	for _, item := range items {
-		if pod, ok := item.(map[string]interface{}); ok {
-			pods = append(pods, pod)
+	// 配置了 Prometheus 时为每个子集附加请求速率、错误率与延迟，查询失败不影响路由分析结果
+	if c.Spec.Prometheus.URL != "" {
+		podNamespaces := map[string]bool{}
+		for _, pod := range pods {
+			podNamespaces[(&unstructured.Unstructured{Object: pod}).GetNamespace()] = true
+		}
+		if len(podNamespaces) > 0 {
+			nsList := make([]string, 0, len(podNamespaces))
+			for ns := range podNamespaces {
+				nsList = append(nsList, ns)
+			}
+			signals, err := workloadSignals(c, nsList, window)
+			if err != nil {
+				trafficAnalysis["summary"].(map[string]interface{})["signalsError"] = err.Error()
+			} else {
+				attachSignals(trafficAnalysis, signals)
+			}
 		}
 	}
 
-	return pods, nil
+	return trafficAnalysis
 }
 
 // analyzeTrafficFlow 分析流量流向
-func (h *Handler) analyzeTrafficFlow(virtualServices, destinationRules, pods []map[string]interface{}) map[string]interface{} {
+func (h *Handler) analyzeTrafficFlow(virtualServices, destinationRules, pods []map[string]interface{}, ambient *ambientIndex) map[string]interface{} {
 	// 构建 DestinationRule 映射，key 为 host
 	drMap := make(map[string]map[string]interface{})
 	for _, dr := range destinationRules {
@@ -603,10 +512,12 @@ func (h *Handler) analyzeTrafficFlow(virtualServices, destinationRules, pods []m
 	}
 
 	var trafficAnalysis []map[string]interface{}
+	dataplanes := map[string]int{DataplaneSidecar: 0, DataplaneAmbient: 0, DataplaneWaypoint: 0, DataplaneNone: 0}
 
 	// 为每个Pod分析流量类型
 	for _, pod := range pods {
 		podName := ""
+		podNamespace := ""
 		podLabels := make(map[string]string)
 		serviceName := ""
 
@@ -615,6 +526,9 @@ func (h *Handler) analyzeTrafficFlow(virtualServices, destinationRules, pods []m
 			if name, ok := metadata["name"].(string); ok {
 				podName = name
 			}
+			if ns, ok := metadata["namespace"].(string); ok {
+				podNamespace = ns
+			}
 			if labels, ok := metadata["labels"].(map[string]interface{}); ok {
 				for k, v := range labels {
 					if vStr, ok := v.(string); ok {
@@ -628,18 +542,36 @@ func (h *Handler) analyzeTrafficFlow(virtualServices, destinationRules, pods []m
 			}
 		}
 
+		dataplane := ambient.dataplane(&unstructured.Unstructured{Object: pod})
+		dataplanes[dataplane]++
+		waypoint := ""
+		if dataplane == DataplaneAmbient {
+			waypoint = ambient.waypointFor(podNamespace, serviceName)
+		}
+
 		// 分析这个Pod的流量类型
 		trafficResults := h.analyzePodTrafficWithSubsets(podName, serviceName, podLabels, virtualServices, drMap)
 
 		// 为每个匹配的subset创建一条记录
 		for _, result := range trafficResults {
+			trafficType := result["type"]
+			// ambient 模式下 ztunnel 只处理 L4，没有绑定 waypoint 时 VirtualService 的路由规则不会生效
+			l7 := dataplane != DataplaneAmbient || waypoint != ""
+			if !l7 {
+				trafficType = "原生流量"
+			}
 			trafficAnalysis = append(trafficAnalysis, map[string]interface{}{
 				"podName":      podName,
+				"namespace":    podNamespace,
 				"serviceName":  serviceName,
+				"version":      podVersion(podLabels),
 				"vsName":       result["vsName"],
-				"trafficType":  result["type"],
+				"trafficType":  trafficType,
 				"subset":       result["subset"],
 				"matchContent": result["matchContent"],
+				"dataplane":    dataplane,
+				"waypoint":     waypoint,
+				"l7":           l7,
 			})
 		}
 	}
@@ -653,6 +585,7 @@ func (h *Handler) analyzeTrafficFlow(virtualServices, destinationRules, pods []m
 			"basicTraffic": h.countTrafficType(trafficAnalysis, "基础流量"),
 			"grayTraffic":  h.countTrafficType(trafficAnalysis, "灰度流量"),
 			"noTraffic":    h.countTrafficType(trafficAnalysis, "原生流量"),
+			"dataplanes":   dataplanes,
 		},
 	}
 }
@@ -1262,4 +1195,44 @@ func Install(parent iris.Party) {
 
 	// Traffic Analytics 路由
 	istioParty.Get("/traffic-analytics", handler.GetTrafficAnalytics())
+
+	// Watch 推送会话
+	istioParty.Get("/watch/session", handler.WatchSessionHandler())
+
+	// ambient 模式的 waypoint 与 ztunnel 状态
+	istioParty.Get("/ambient", handler.GetAmbient())
+
+	// 出口流量清单与 REGISTRY_ONLY 切换
+	istioParty.Get("/egress", handler.GetEgress())
+	istioParty.Post("/egress/:namespace/registry-only", handler.SwitchRegistryOnly())
+
+	// Prometheus 黄金指标
+	istioParty.Get("/golden-signals", handler.GetGoldenSignals())
+
+	// 未使用配置报告与清理
+	istioParty.Get("/orphans", handler.GetOrphans())
+	istioParty.Post("/orphans/cleanup", handler.CleanupOrphans())
+
+	// 批量操作
+	istioParty.Post("/bulk/delete", handler.BulkDelete())
+	istioParty.Post("/bulk/label", handler.BulkLabel())
+	istioParty.Post("/bulk/apply", handler.BulkApply())
+
+	// 表单 JSON Schema 与配置模板
+	istioParty.Get("/schemas", handler.ListSchemas())
+	istioParty.Get("/templates", handler.ListTemplates())
+	istioParty.Post("/templates/:name/render", handler.RenderTemplate())
+
+	// AuthorizationPolicy 评估：A 能否调用 B
+	istioParty.Post("/authorization/evaluate", handler.EvaluateAuthorization())
+
+	// DestinationRule 的 locality 负载均衡
+	istioParty.Get("/locality", handler.GetLocality())
+
+	// istio-proxy 访问日志会话
+	istioParty.Get("/accesslog/session", handler.AccessLogSessionHandler())
+
+	// 配置导出与导入
+	istioParty.Get("/export", handler.ExportBundle())
+	istioParty.Post("/import", handler.ImportBundle())
 }
@@ -0,0 +1,437 @@
+package istio
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	regionLabel  = "topology.kubernetes.io/region"
+	zoneLabel    = "topology.kubernetes.io/zone"
+	subzoneLabel = "topology.istio.io/subzone"
+)
+
+// LocalityEndpoints 为某个 locality 下的后端 Pod
+type LocalityEndpoints struct {
+	Locality string         `json:"locality"`
+	Total    int            `json:"total"`
+	Ready    int            `json:"ready"`
+	Pods     []string       `json:"pods"`
+	Subsets  map[string]int `json:"subsets"`
+}
+
+// LocalityRoute 为从某个 locality 发出的请求的实际分布
+type LocalityRoute struct {
+	From string `json:"from"`
+	// Mode 为 distribute、failover 或 none（未启用 locality 负载均衡，按端点平均分布）
+	Mode         string             `json:"mode"`
+	Distribution map[string]float64 `json:"distribution"`
+	// FailoverChain 为按优先级排列的 locality 组，流量只会发往第一个存在就绪端点的组
+	FailoverChain [][]string `json:"failoverChain,omitempty"`
+}
+
+type LocalityPolicy struct {
+	Subset           string                 `json:"subset,omitempty"`
+	LoadBalancer     map[string]interface{} `json:"loadBalancer,omitempty"`
+	OutlierDetection map[string]interface{} `json:"outlierDetection,omitempty"`
+	Routes           []LocalityRoute        `json:"routes"`
+	Warnings         []string               `json:"warnings"`
+}
+
+// GetLocality 汇总 host 对应 DestinationRule 的负载均衡设置与后端 Pod 所在节点的拓扑标签
+func (h *Handler) GetLocality() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		namespace := ctx.URLParam("namespace")
+		host := ctx.URLParam("host")
+		if namespace == "" || host == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "namespace and host are required")
+			return
+		}
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		cc, err := informer.Clusters.Get(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		short := strings.Split(host, ".")[0]
+
+		svcs, err := listObjects(cc, profile, informer.Services, namespace)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		var selector labels.Selector
+		for _, svc := range svcs {
+			u := unstructured.Unstructured{Object: svc}
+			if u.GetName() != short {
+				continue
+			}
+			if sel, ok, _ := unstructured.NestedStringMap(svc, "spec", "selector"); ok && len(sel) > 0 {
+				selector = labels.SelectorFromSet(sel)
+			}
+		}
+		if selector == nil {
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.Values().Set("message", fmt.Sprintf("service %s with selector not found in namespace %s", short, namespace))
+			return
+		}
+
+		var dr map[string]interface{}
+		drs, err := listObjects(cc, profile, informer.DestinationRules, namespace)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		for _, d := range drs {
+			drHost, _, _ := unstructured.NestedString(d, "spec", "host")
+			if drHost == host || strings.Split(drHost, ".")[0] == short {
+				dr = d
+				break
+			}
+		}
+
+		pods, err := listObjects(cc, profile, informer.Pods, namespace)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		// 节点只用于读取拓扑标签，不返回给前端，因此直接读取缓存
+		nodes, err := cc.List(informer.Nodes, "")
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		nodeLocality := make(map[string]string)
+		for _, n := range nodes {
+			nodeLocality[n.GetName()] = localityOf(n.GetLabels())
+		}
+
+		var subsets []map[string]interface{}
+		if dr != nil {
+			ss, _, _ := unstructured.NestedSlice(dr, "spec", "subsets")
+			for i := range ss {
+				if s, ok := ss[i].(map[string]interface{}); ok {
+					subsets = append(subsets, s)
+				}
+			}
+		}
+		byLocality := make(map[string]*LocalityEndpoints)
+		for _, p := range pods {
+			pod := &unstructured.Unstructured{Object: p}
+			if !selector.Matches(labels.Set(pod.GetLabels())) {
+				continue
+			}
+			nodeName, _, _ := unstructured.NestedString(p, "spec", "nodeName")
+			loc := nodeLocality[nodeName]
+			le, ok := byLocality[loc]
+			if !ok {
+				le = &LocalityEndpoints{Locality: loc, Pods: []string{}, Subsets: map[string]int{}}
+				byLocality[loc] = le
+			}
+			le.Total++
+			le.Pods = append(le.Pods, pod.GetName())
+			if podReady(p) {
+				le.Ready++
+				for _, s := range subsets {
+					if h.podMatchesSubsetLabels(pod.GetLabels(), s) {
+						name, _ := s["name"].(string)
+						le.Subsets[name]++
+					}
+				}
+			}
+		}
+		endpoints := make([]LocalityEndpoints, 0, len(byLocality))
+		for _, le := range byLocality {
+			endpoints = append(endpoints, *le)
+		}
+		sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Locality < endpoints[j].Locality })
+
+		var policies []LocalityPolicy
+		var drName string
+		if dr != nil {
+			drName = (&unstructured.Unstructured{Object: dr}).GetName()
+			trafficPolicy, _, _ := unstructured.NestedMap(dr, "spec", "trafficPolicy")
+			policies = append(policies, evaluateLocality("", trafficPolicy, endpoints, nil))
+			for _, s := range subsets {
+				name, _ := s["name"].(string)
+				tp, ok := s["trafficPolicy"].(map[string]interface{})
+				if !ok {
+					continue
+				}
+				// 子集的 trafficPolicy 会整体覆盖顶层设置中对应的字段
+				merged := map[string]interface{}{}
+				for k, v := range trafficPolicy {
+					merged[k] = v
+				}
+				for k, v := range tp {
+					merged[k] = v
+				}
+				policies = append(policies, evaluateLocality(name, merged, endpoints, s))
+			}
+		} else {
+			policies = append(policies, evaluateLocality("", nil, endpoints, nil))
+		}
+
+		ctx.JSON(map[string]interface{}{
+			"data": map[string]interface{}{
+				"host":            host,
+				"destinationRule": drName,
+				"endpoints":       endpoints,
+				"policies":        policies,
+			},
+			"success": true,
+		})
+	}
+}
+
+func localityOf(nodeLabels map[string]string) string {
+	region := nodeLabels[regionLabel]
+	if region == "" {
+		region = nodeLabels["failure-domain.beta.kubernetes.io/region"]
+	}
+	zone := nodeLabels[zoneLabel]
+	if zone == "" {
+		zone = nodeLabels["failure-domain.beta.kubernetes.io/zone"]
+	}
+	loc := region + "/" + zone
+	if subzone := nodeLabels[subzoneLabel]; subzone != "" {
+		loc += "/" + subzone
+	}
+	if loc == "/" {
+		return ""
+	}
+	return loc
+}
+
+func podReady(pod map[string]interface{}) bool {
+	conditions, _, _ := unstructured.NestedSlice(pod, "status", "conditions")
+	for i := range conditions {
+		if c, ok := conditions[i].(map[string]interface{}); ok && c["type"] == "Ready" {
+			return c["status"] == "True"
+		}
+	}
+	return false
+}
+
+// evaluateLocality 计算各来源 locality 的流量分布，subset 不为 nil 时只统计属于该子集的端点
+func evaluateLocality(subsetName string, trafficPolicy map[string]interface{}, endpoints []LocalityEndpoints, subset map[string]interface{}) LocalityPolicy {
+	p := LocalityPolicy{Subset: subsetName, Routes: []LocalityRoute{}, Warnings: []string{}}
+	lb, _ := trafficPolicy["loadBalancer"].(map[string]interface{})
+	od, _ := trafficPolicy["outlierDetection"].(map[string]interface{})
+	p.LoadBalancer, p.OutlierDetection = lb, od
+
+	ready := make(map[string]int)
+	for _, e := range endpoints {
+		n := e.Ready
+		if subset != nil {
+			n = e.Subsets[subsetName]
+		}
+		if n > 0 {
+			ready[e.Locality] = n
+		}
+	}
+	for loc := range ready {
+		if loc == "" {
+			p.Warnings = append(p.Warnings, "some endpoints run on nodes without topology.kubernetes.io/region or zone labels, locality load balancing can not place them")
+			break
+		}
+	}
+
+	setting, _ := lb["localityLbSetting"].(map[string]interface{})
+	enabled := true
+	if e, ok := setting["enabled"].(bool); ok {
+		enabled = e
+	}
+	distribute, _ := setting["distribute"].([]interface{})
+	failover, _ := setting["failover"].([]interface{})
+	failoverPriority, _ := setting["failoverPriority"].([]interface{})
+	if len(distribute) > 0 && (len(failover) > 0 || len(failoverPriority) > 0) {
+		p.Warnings = append(p.Warnings, "localityLbSetting.distribute and failover are mutually exclusive")
+	}
+	if (len(failover) > 0 || len(failoverPriority) > 0) && od == nil {
+		p.Warnings = append(p.Warnings, "failover is configured but outlierDetection is missing, Istio ignores locality failover without outlier detection")
+	}
+	if len(failoverPriority) > 0 {
+		p.Warnings = append(p.Warnings, "failoverPriority ordering by labels is not evaluated, the chain below only considers locality")
+	}
+
+	sources := make([]string, 0, len(ready))
+	for loc := range ready {
+		sources = append(sources, loc)
+	}
+	sort.Strings(sources)
+	for _, from := range sources {
+		route := LocalityRoute{From: from}
+		switch {
+		// 没有 outlierDetection 时 Istio 不启用 locality 感知的负载均衡
+		case !enabled || od == nil:
+			route.Mode = "none"
+			route.Distribution = proportional(ready, nil)
+		case len(distribute) > 0:
+			route.Mode = "distribute"
+			route.Distribution = distributeFrom(from, distribute, ready)
+			if route.Distribution == nil {
+				route.Mode = "failover"
+			}
+		default:
+			route.Mode = "failover"
+		}
+		if route.Mode == "failover" {
+			route.FailoverChain = failoverChain(from, failover, ready)
+			if len(route.FailoverChain) > 0 {
+				route.Distribution = proportional(ready, route.FailoverChain[0])
+			}
+		}
+		p.Routes = append(p.Routes, route)
+	}
+	return p
+}
+
+// proportional 按端点数量分配流量，only 不为空时只在这些 locality 之间分配
+func proportional(ready map[string]int, only []string) map[string]float64 {
+	allowed := make(map[string]bool)
+	for _, l := range only {
+		allowed[l] = true
+	}
+	total := 0
+	for loc, n := range ready {
+		if only == nil || allowed[loc] {
+			total += n
+		}
+	}
+	result := make(map[string]float64)
+	for loc, n := range ready {
+		if total > 0 && (only == nil || allowed[loc]) {
+			result[loc] = float64(n) * 100 / float64(total)
+		}
+	}
+	return result
+}
+
+// distributeFrom 返回第一条 from 与来源匹配的 distribute 规则对应的分布，权重在匹配 locality 的端点间按数量分配
+func distributeFrom(from string, distribute []interface{}, ready map[string]int) map[string]float64 {
+	for i := range distribute {
+		rule, ok := distribute[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		pattern, _ := rule["from"].(string)
+		if !localityMatches(pattern, from) {
+			continue
+		}
+		to, _ := rule["to"].(map[string]interface{})
+		result := make(map[string]float64)
+		for target, w := range to {
+			weight, _ := toFloat(w)
+			matched := make(map[string]int)
+			total := 0
+			for loc, n := range ready {
+				if localityMatches(target, loc) {
+					matched[loc] = n
+					total += n
+				}
+			}
+			for loc, n := range matched {
+				result[loc] += weight * float64(n) / float64(total)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case int64:
+		return float64(t), true
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	}
+	return 0, false
+}
+
+// failoverChain 按 Istio 的优先级对 locality 分组：同 region/zone/subzone、同 zone、同 region、failover 指定的 region、其他
+func failoverChain(from string, failover []interface{}, ready map[string]int) [][]string {
+	src := strings.Split(from, "/")
+	segment := func(loc []string, i int) string {
+		if i < len(loc) {
+			return loc[i]
+		}
+		return ""
+	}
+	failoverRegions := make(map[string]bool)
+	for i := range failover {
+		if f, ok := failover[i].(map[string]interface{}); ok && f["from"] == segment(src, 0) {
+			if to, ok := f["to"].(string); ok {
+				failoverRegions[to] = true
+			}
+		}
+	}
+	levels := make([][]string, 5)
+	for loc := range ready {
+		dst := strings.Split(loc, "/")
+		sameRegion := segment(dst, 0) == segment(src, 0)
+		sameZone := sameRegion && segment(dst, 1) == segment(src, 1)
+		var level int
+		switch {
+		case sameZone && segment(dst, 2) == segment(src, 2):
+			level = 0
+		case sameZone:
+			level = 1
+		case sameRegion:
+			level = 2
+		case failoverRegions[segment(dst, 0)]:
+			level = 3
+		default:
+			level = 4
+		}
+		levels[level] = append(levels[level], loc)
+	}
+	var chain [][]string
+	for _, l := range levels {
+		if len(l) > 0 {
+			sort.Strings(l)
+			chain = append(chain, l)
+		}
+	}
+	return chain
+}
+
+// localityMatches 判断 locality 是否匹配 region/zone/subzone 形式的模式，* 与省略的段匹配任意值
+func localityMatches(pattern, locality string) bool {
+	ps := strings.Split(pattern, "/")
+	ls := strings.Split(locality, "/")
+	for i, p := range ps {
+		if p == "*" {
+			return true
+		}
+		if i >= len(ls) || ls[i] != p {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package istio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFailoverChain(t *testing.T) {
+	ready := map[string]int{
+		"us-east/a": 2,
+		"us-east/b": 1,
+		"us-west/a": 3,
+		"eu/a":      1,
+	}
+	failover := []interface{}{map[string]interface{}{"from": "us-east", "to": "us-west"}}
+	chain := failoverChain("us-east/a", failover, ready)
+	expect := [][]string{{"us-east/a"}, {"us-east/b"}, {"us-west/a"}, {"eu/a"}}
+	if !reflect.DeepEqual(chain, expect) {
+		t.Fatalf("unexpected chain %v", chain)
+	}
+}
+
+func TestEvaluateLocality(t *testing.T) {
+	endpoints := []LocalityEndpoints{
+		{Locality: "r1/z1", Ready: 1},
+		{Locality: "r1/z2", Ready: 3},
+	}
+	failoverOnly := map[string]interface{}{
+		"loadBalancer": map[string]interface{}{
+			"localityLbSetting": map[string]interface{}{
+				"failover": []interface{}{map[string]interface{}{"from": "r1", "to": "r2"}},
+			},
+		},
+	}
+	p := evaluateLocality("", failoverOnly, endpoints, nil)
+	if len(p.Warnings) != 1 || p.Routes[0].Mode != "none" || p.Routes[0].Distribution["r1/z2"] != 75 {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+
+	failoverOnly["outlierDetection"] = map[string]interface{}{"consecutive5xxErrors": int64(5)}
+	p = evaluateLocality("", failoverOnly, endpoints, nil)
+	if len(p.Warnings) != 0 || p.Routes[0].Mode != "failover" || p.Routes[0].Distribution["r1/z1"] != 100 {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+
+	distribute := map[string]interface{}{
+		"outlierDetection": map[string]interface{}{},
+		"loadBalancer": map[string]interface{}{
+			"localityLbSetting": map[string]interface{}{
+				"distribute": []interface{}{map[string]interface{}{
+					"from": "r1/z1/*",
+					"to":   map[string]interface{}{"r1/z1/*": int64(20), "r1/z2/*": int64(80)},
+				}},
+			},
+		},
+	}
+	p = evaluateLocality("", distribute, endpoints, nil)
+	if p.Routes[0].Mode != "distribute" || p.Routes[0].Distribution["r1/z2"] != 80 || p.Routes[1].Mode != "failover" {
+		t.Fatalf("unexpected policy %+v", p)
+	}
+}
@@ -0,0 +1,62 @@
+package istio
+
+import (
+	goContext "context"
+
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"gopkg.in/yaml.v3"
+	k8sError "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const defaultTrustDomain = "cluster.local"
+
+// meshSettings 为控制面 istio ConfigMap 中 KubePi 关心的网格配置
+type meshSettings struct {
+	OutboundMode  string
+	RootNamespace string
+	TrustDomain   string
+}
+
+// loadMeshSettings 使用集群凭据读取网格配置，普通用户无需 istio-system 的权限，ConfigMap 不存在时使用 Istio 的默认值
+func (h *Handler) loadMeshSettings(c *v1Cluster.Cluster, istioNamespace string) (meshSettings, error) {
+	client, err := kubernetes.NewKubernetes(c).Client()
+	if err != nil {
+		return meshSettings{}, err
+	}
+	cm, err := client.CoreV1().ConfigMaps(istioNamespace).Get(goContext.TODO(), "istio", metav1.GetOptions{})
+	if err != nil {
+		if k8sError.IsNotFound(err) {
+			return parseMeshConfig("", istioNamespace), nil
+		}
+		return meshSettings{}, err
+	}
+	return parseMeshConfig(cm.Data["mesh"], istioNamespace), nil
+}
+
+func parseMeshConfig(data, istioNamespace string) meshSettings {
+	var mesh struct {
+		RootNamespace         string `yaml:"rootNamespace"`
+		TrustDomain           string `yaml:"trustDomain"`
+		OutboundTrafficPolicy struct {
+			Mode string `yaml:"mode"`
+		} `yaml:"outboundTrafficPolicy"`
+	}
+	_ = yaml.Unmarshal([]byte(data), &mesh)
+	settings := meshSettings{
+		OutboundMode:  mesh.OutboundTrafficPolicy.Mode,
+		RootNamespace: mesh.RootNamespace,
+		TrustDomain:   mesh.TrustDomain,
+	}
+	if settings.OutboundMode == "" {
+		settings.OutboundMode = OutboundAllowAny
+	}
+	if settings.RootNamespace == "" {
+		settings.RootNamespace = istioNamespace
+	}
+	if settings.TrustDomain == "" {
+		settings.TrustDomain = defaultTrustDomain
+	}
+	return settings
+}
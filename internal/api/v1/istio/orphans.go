@@ -0,0 +1,548 @@
+package istio
+
+import (
+	goContext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1System "github.com/KubeOperator/kubepi/internal/model/v1/system"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	v1SystemService "github.com/KubeOperator/kubepi/internal/service/v1/system"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/KubeOperator/kubepi/pkg/meshconfig"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	OrphanDestinationRule = "DestinationRuleWithoutService"
+	OrphanSubset          = "SubsetWithoutPods"
+	OrphanVirtualService  = "UnreferencedVirtualService"
+	OrphanGateway         = "GatewayWithoutVirtualService"
+	OrphanServiceEntry    = "ServiceEntryDuplicatesService"
+)
+
+// cleanupKinds 为清理可以删除的类型，比批量操作多出 ServiceEntry
+var cleanupKinds = append(append([]string{}, meshconfig.BulkKinds...), "ServiceEntry")
+
+// OrphanFinding 为一条未使用或失效的配置，Subset 不为空时表示 DestinationRule 中的某个子集
+type OrphanFinding struct {
+	Reason    string `json:"reason"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Subset    string `json:"subset,omitempty"`
+	Message   string `json:"message"`
+	// ReferencedBy 为仍在路由中引用该子集的 VirtualService，清理前需先修改路由
+	ReferencedBy []string `json:"referencedBy,omitempty"`
+}
+
+func (f OrphanFinding) key() string {
+	return strings.Join([]string{f.Kind, f.Namespace, f.Name, f.Subset}, "/")
+}
+
+type orphanConfig struct {
+	virtualServices  []*unstructured.Unstructured
+	destinationRules []*unstructured.Unstructured
+	gateways         []*unstructured.Unstructured
+	serviceEntries   []*unstructured.Unstructured
+	services         []*unstructured.Unstructured
+	pods             []*unstructured.Unstructured
+}
+
+type CleanupItem struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Subset    string `json:"subset"`
+}
+
+type CleanupRequest struct {
+	Items  []CleanupItem `json:"items"`
+	DryRun bool          `json:"dryRun"`
+}
+
+// cachedObjects 读取集群缓存中的全部对象，未安装对应 CRD 时返回空列表
+func cachedObjects(cc *informer.ClusterCache, gvr schema.GroupVersionResource) ([]*unstructured.Unstructured, error) {
+	objs, err := cc.List(gvr, "")
+	if errors.Is(err, informer.ErrNotServed) {
+		return []*unstructured.Unstructured{}, nil
+	}
+	return objs, err
+}
+
+// loadOrphanConfig 读取判断引用关系所需的全部对象。引用关系以集群的完整视图计算，避免用户看不到其他命名空间的服务时误判
+func loadOrphanConfig(cc *informer.ClusterCache) (*orphanConfig, error) {
+	cfg := &orphanConfig{}
+	for _, item := range []struct {
+		gvr  schema.GroupVersionResource
+		objs *[]*unstructured.Unstructured
+	}{
+		{informer.VirtualServices, &cfg.virtualServices},
+		{informer.DestinationRules, &cfg.destinationRules},
+		{informer.Gateways, &cfg.gateways},
+		{informer.ServiceEntries, &cfg.serviceEntries},
+		{informer.Services, &cfg.services},
+		{informer.Pods, &cfg.pods},
+	} {
+		objs, err := cachedObjects(cc, item.gvr)
+		if err != nil {
+			return nil, err
+		}
+		*item.objs = objs
+	}
+	return cfg, nil
+}
+
+// serviceForHost 将 Istio 主机名解析为集群内服务，短名称按对象所在命名空间补全，带点的主机只有 <name>.<namespace>.svc.* 形式指向集群内服务
+func serviceForHost(host, namespace string) (string, string, bool) {
+	if host == "" || strings.Contains(host, "*") {
+		return "", "", false
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) == 1 {
+		return parts[0], namespace, namespace != ""
+	}
+	if len(parts) >= 3 && parts[2] == "svc" {
+		return parts[0], parts[1], true
+	}
+	return "", "", false
+}
+
+// gatewayRef 解析 VirtualService 中的 gateways 引用，支持 name、namespace/name 及旧的 FQDN 形式
+func gatewayRef(ref, namespace string) string {
+	if strings.Contains(ref, "/") {
+		return ref
+	}
+	if parts := strings.Split(ref, "."); len(parts) > 1 {
+		return parts[1] + "/" + parts[0]
+	}
+	return namespace + "/" + ref
+}
+
+func objectKey(obj *unstructured.Unstructured) string {
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// findOrphans 检查五类问题：DestinationRule 的 host 没有服务、子集选不中 Pod、VirtualService 不被网关或网格流量使用、
+// Gateway 没有绑定 VirtualService，以及 ServiceEntry 重复声明集群内服务
+func (h *Handler) findOrphans(cfg *orphanConfig) []OrphanFinding {
+	services := map[string]*unstructured.Unstructured{}
+	for _, s := range cfg.services {
+		services[objectKey(s)] = s
+	}
+	var entryHosts []string
+	for _, se := range cfg.serviceEntries {
+		hosts, _, _ := unstructured.NestedStringSlice(se.Object, "spec", "hosts")
+		entryHosts = append(entryHosts, hosts...)
+	}
+	inRegistry := func(host, namespace string) bool {
+		if name, ns, ok := serviceForHost(host, namespace); ok && services[ns+"/"+name] != nil {
+			return true
+		}
+		for _, h := range entryHosts {
+			if hostMatches(h, host) || hostMatches(host, h) {
+				return true
+			}
+		}
+		return false
+	}
+	gateways := map[string]bool{}
+	for _, gw := range cfg.gateways {
+		gateways[objectKey(gw)] = true
+	}
+
+	var findings []OrphanFinding
+
+	// VirtualService 路由到的子集，key 为 namespace/service/subset
+	subsetRefs := map[string][]string{}
+	delegated := map[string]bool{}
+	boundGateways := map[string]bool{}
+	for _, vs := range cfg.virtualServices {
+		for _, route := range nestedRoutes(vs.Object) {
+			host, _, _ := unstructured.NestedString(route, "destination", "host")
+			subset, _, _ := unstructured.NestedString(route, "destination", "subset")
+			if name, ns, ok := serviceForHost(host, vs.GetNamespace()); ok && subset != "" {
+				key := ns + "/" + name + "/" + subset
+				if !containsString(subsetRefs[key], objectKey(vs)) {
+					subsetRefs[key] = append(subsetRefs[key], objectKey(vs))
+				}
+			}
+		}
+		httpRoutes, _, _ := unstructured.NestedSlice(vs.Object, "spec", "http")
+		for _, r := range httpRoutes {
+			if rule, ok := r.(map[string]interface{}); ok {
+				if name, _, _ := unstructured.NestedString(rule, "delegate", "name"); name != "" {
+					ns, _, _ := unstructured.NestedString(rule, "delegate", "namespace")
+					if ns == "" {
+						ns = vs.GetNamespace()
+					}
+					delegated[ns+"/"+name] = true
+				}
+			}
+		}
+	}
+
+	for _, vs := range cfg.virtualServices {
+		refs, _, _ := unstructured.NestedStringSlice(vs.Object, "spec", "gateways")
+		if len(refs) == 0 {
+			refs = []string{"mesh"}
+		}
+		var missing []string
+		used := false
+		for _, ref := range refs {
+			if ref == "mesh" {
+				continue
+			}
+			key := gatewayRef(ref, vs.GetNamespace())
+			if gateways[key] {
+				boundGateways[key] = true
+				used = true
+			} else {
+				missing = append(missing, ref)
+			}
+		}
+		hosts, _, _ := unstructured.NestedStringSlice(vs.Object, "spec", "hosts")
+		if containsString(refs, "mesh") {
+			for _, host := range hosts {
+				if strings.Contains(host, "*") || inRegistry(host, vs.GetNamespace()) {
+					used = true
+					break
+				}
+			}
+		}
+		if len(hosts) == 0 && delegated[objectKey(vs)] {
+			used = true
+		}
+		if used {
+			continue
+		}
+		message := "not bound to an existing gateway and no host matches a service or service entry"
+		if len(missing) > 0 {
+			message = fmt.Sprintf("gateways %s do not exist and no host matches a service or service entry", strings.Join(missing, ", "))
+		}
+		findings = append(findings, OrphanFinding{Reason: OrphanVirtualService, Kind: "VirtualService", Namespace: vs.GetNamespace(), Name: vs.GetName(), Message: message})
+	}
+
+	for _, gw := range cfg.gateways {
+		if !boundGateways[objectKey(gw)] {
+			findings = append(findings, OrphanFinding{Reason: OrphanGateway, Kind: "Gateway", Namespace: gw.GetNamespace(), Name: gw.GetName(), Message: "no VirtualService is bound to this gateway"})
+		}
+	}
+
+	for _, dr := range cfg.destinationRules {
+		host, _, _ := unstructured.NestedString(dr.Object, "spec", "host")
+		if strings.Contains(host, "*") {
+			continue
+		}
+		if !inRegistry(host, dr.GetNamespace()) {
+			findings = append(findings, OrphanFinding{Reason: OrphanDestinationRule, Kind: "DestinationRule", Namespace: dr.GetNamespace(), Name: dr.GetName(), Message: fmt.Sprintf("host %s matches no service or service entry", host)})
+			continue
+		}
+		name, ns, ok := serviceForHost(host, dr.GetNamespace())
+		svc := services[ns+"/"+name]
+		if !ok || svc == nil {
+			continue
+		}
+		selector, _, _ := unstructured.NestedStringMap(svc.Object, "spec", "selector")
+		if len(selector) == 0 {
+			continue
+		}
+		subsets, _, _ := unstructured.NestedSlice(dr.Object, "spec", "subsets")
+		for _, s := range subsets {
+			subset, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if _, ok := subset["labels"].(map[string]interface{}); !ok {
+				continue
+			}
+			subsetName, _ := subset["name"].(string)
+			if h.subsetHasPods(cfg.pods, ns, selector, subset) {
+				continue
+			}
+			findings = append(findings, OrphanFinding{
+				Reason:       OrphanSubset,
+				Kind:         "DestinationRule",
+				Namespace:    dr.GetNamespace(),
+				Name:         dr.GetName(),
+				Subset:       subsetName,
+				Message:      fmt.Sprintf("subset %s selects no pod of service %s/%s", subsetName, ns, name),
+				ReferencedBy: subsetRefs[ns+"/"+name+"/"+subsetName],
+			})
+		}
+	}
+
+	for _, se := range cfg.serviceEntries {
+		hosts, _, _ := unstructured.NestedStringSlice(se.Object, "spec", "hosts")
+		for _, host := range hosts {
+			if !strings.Contains(host, ".") {
+				continue
+			}
+			if name, ns, ok := serviceForHost(host, ""); ok && services[ns+"/"+name] != nil {
+				findings = append(findings, OrphanFinding{Reason: OrphanServiceEntry, Kind: "ServiceEntry", Namespace: se.GetNamespace(), Name: se.GetName(), Message: fmt.Sprintf("host %s is already provided by service %s/%s", host, ns, name)})
+				break
+			}
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].Reason != findings[j].Reason {
+			return findings[i].Reason < findings[j].Reason
+		}
+		return findings[i].key() < findings[j].key()
+	})
+	return findings
+}
+
+func (h *Handler) subsetHasPods(pods []*unstructured.Unstructured, namespace string, selector map[string]string, subset map[string]interface{}) bool {
+	for _, pod := range pods {
+		if pod.GetNamespace() != namespace {
+			continue
+		}
+		podLabels := pod.GetLabels()
+		if labels.SelectorFromSet(selector).Matches(labels.Set(podLabels)) && h.podMatchesSubsetLabels(podLabels, subset) {
+			return true
+		}
+	}
+	return false
+}
+
+// nestedRoutes 返回 VirtualService 中 http、tcp、tls 路由的全部 destination
+func nestedRoutes(vs map[string]interface{}) []map[string]interface{} {
+	var routes []map[string]interface{}
+	for _, protocol := range []string{"http", "tcp", "tls"} {
+		rules, _, _ := unstructured.NestedSlice(vs, "spec", protocol)
+		for _, r := range rules {
+			rule, ok := r.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			destinations, _, _ := unstructured.NestedSlice(rule, "route")
+			for _, d := range destinations {
+				if route, ok := d.(map[string]interface{}); ok {
+					routes = append(routes, route)
+				}
+			}
+		}
+	}
+	return routes
+}
+
+// visibleFindings 只保留用户有权查看的对象上的问题，namespace 不为空时只保留该命名空间
+func visibleFindings(cc *informer.ClusterCache, profile session.UserProfile, cfg *orphanConfig, findings []OrphanFinding, namespace string) ([]OrphanFinding, error) {
+	allowed := map[string]bool{}
+	for _, item := range []struct {
+		kind string
+		gvr  schema.GroupVersionResource
+		objs []*unstructured.Unstructured
+	}{
+		{"VirtualService", informer.VirtualServices, cfg.virtualServices},
+		{"DestinationRule", informer.DestinationRules, cfg.destinationRules},
+		{"Gateway", informer.Gateways, cfg.gateways},
+		{"ServiceEntry", informer.ServiceEntries, cfg.serviceEntries},
+	} {
+		objs := item.objs
+		if !profile.IsAdministrator {
+			var err error
+			if objs, err = cc.FilterByAccess(profile.Name, item.gvr, objs); err != nil {
+				return nil, err
+			}
+		}
+		for _, o := range objs {
+			allowed[item.kind+"/"+objectKey(o)] = true
+		}
+	}
+	result := make([]OrphanFinding, 0, len(findings))
+	for _, f := range findings {
+		if (namespace == "" || f.Namespace == namespace) && allowed[f.Kind+"/"+f.Namespace+"/"+f.Name] {
+			result = append(result, f)
+		}
+	}
+	return result, nil
+}
+
+func (h *Handler) orphanFindings(ctx *context.Context, namespace string) ([]OrphanFinding, error) {
+	c, err := h.clusterService.Get(ctx.Params().GetString("cluster"), common.DBOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get cluster failed: %s", err.Error())
+	}
+	cc, err := informer.Clusters.Get(c)
+	if err != nil {
+		return nil, fmt.Errorf("get cluster cache failed: %s", err.Error())
+	}
+	cfg, err := loadOrphanConfig(cc)
+	if err != nil {
+		return nil, err
+	}
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	return visibleFindings(cc, profile, cfg, h.findOrphans(cfg), namespace)
+}
+
+// GetOrphans 列出未使用或失效的网格配置
+func (h *Handler) GetOrphans() iris.Handler {
+	return func(ctx *context.Context) {
+		findings, err := h.orphanFindings(ctx, ctx.URLParam("namespace"))
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		summary := map[string]int{OrphanDestinationRule: 0, OrphanSubset: 0, OrphanVirtualService: 0, OrphanGateway: 0, OrphanServiceEntry: 0}
+		for _, f := range findings {
+			summary[f.Reason]++
+		}
+		ctx.JSON(map[string]interface{}{
+			"data":    map[string]interface{}{"findings": findings, "summary": summary},
+			"success": true,
+		})
+	}
+}
+
+// CleanupOrphans 删除所选的对象或子集，只处理当前仍被报告为未使用的条目，仍被路由引用的子集不会删除
+func (h *Handler) CleanupOrphans() iris.Handler {
+	return func(ctx *context.Context) {
+		var req CleanupRequest
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		findings, err := h.orphanFindings(ctx, "")
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		client, err := h.userDynamicClient(ctx)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		report := cleanupOrphans(client, findings, req)
+
+		if !req.DryRun && report.Succeeded > 0 {
+			profile := ctx.Values().Get("profile").(session.UserProfile)
+			var removed []string
+			for _, item := range report.Items {
+				if item.Status == meshconfig.BulkSucceeded {
+					removed = append(removed, fmt.Sprintf("%s %s/%s", item.Kind, item.Namespace, item.Name))
+				}
+			}
+			go v1SystemService.NewService().CreateOperationLog(&v1System.OperationLog{
+				Operator:            profile.Name,
+				Operation:           "delete",
+				OperationDomain:     "istio_cleanup",
+				SpecificInformation: fmt.Sprintf("[%s] %v", ctx.Params().GetString("cluster"), removed),
+			}, common.DBOptions{})
+		}
+		ctx.JSON(map[string]interface{}{
+			"data":    report,
+			"success": report.Failed == 0,
+		})
+	}
+}
+
+func cleanupOrphans(client dynamic.Interface, findings []OrphanFinding, req CleanupRequest) *meshconfig.BulkReport {
+	reported := map[string]OrphanFinding{}
+	for _, f := range findings {
+		reported[f.key()] = f
+	}
+	report := &meshconfig.BulkReport{DryRun: req.DryRun, Items: []meshconfig.BulkItem{}}
+	fail := func(item meshconfig.BulkItem, message string) {
+		item.Status, item.Error = meshconfig.BulkFailed, message
+		report.Items = append(report.Items, item)
+		report.Failed++
+	}
+
+	var refs []meshconfig.ObjectRef
+	deleted := map[string]bool{}
+	var subsets []CleanupItem
+	for _, item := range req.Items {
+		ref := meshconfig.ObjectRef{Kind: item.Kind, Namespace: item.Namespace, Name: item.Name}
+		f, ok := reported[OrphanFinding{Kind: item.Kind, Namespace: item.Namespace, Name: item.Name, Subset: item.Subset}.key()]
+		if !ok {
+			action := "delete"
+			if item.Subset != "" {
+				action = "removeSubset " + item.Subset
+			}
+			fail(meshconfig.BulkItem{ObjectRef: ref, Action: action}, "not reported as unused")
+			continue
+		}
+		if item.Subset != "" {
+			if len(f.ReferencedBy) > 0 {
+				fail(meshconfig.BulkItem{ObjectRef: ref, Action: "removeSubset " + item.Subset}, fmt.Sprintf("subset is still routed to by %s", strings.Join(f.ReferencedBy, ", ")))
+				continue
+			}
+			subsets = append(subsets, item)
+			continue
+		}
+		refs = append(refs, ref)
+		deleted[item.Kind+"/"+item.Namespace+"/"+item.Name] = true
+	}
+
+	if len(refs) > 0 {
+		r := meshconfig.BulkDelete(client, refs, meshconfig.BulkOptions{DryRun: req.DryRun, Kinds: cleanupKinds})
+		report.Items = append(report.Items, r.Items...)
+		report.Succeeded += r.Succeeded
+		report.Failed += r.Failed
+	}
+	for _, item := range subsets {
+		if deleted[item.Kind+"/"+item.Namespace+"/"+item.Name] {
+			continue
+		}
+		result := meshconfig.BulkItem{ObjectRef: meshconfig.ObjectRef{Kind: item.Kind, Namespace: item.Namespace, Name: item.Name}, Action: "removeSubset " + item.Subset, Status: meshconfig.BulkSucceeded}
+		if err := removeSubset(client, item, req.DryRun); err != nil {
+			result.Status, result.Error = meshconfig.BulkFailed, err.Error()
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+		report.Items = append(report.Items, result)
+	}
+	return report
+}
+
+// removeSubset 以 JSON Patch 删除子集，test 操作保证删除期间子集的位置没有变化
+func removeSubset(client dynamic.Interface, item CleanupItem, dryRun bool) error {
+	ri := client.Resource(informer.DestinationRules).Namespace(item.Namespace)
+	live, err := ri.Get(goContext.TODO(), item.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	subsets, _, _ := unstructured.NestedSlice(live.Object, "spec", "subsets")
+	index := -1
+	for i, s := range subsets {
+		if subset, ok := s.(map[string]interface{}); ok && subset["name"] == item.Subset {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("subset %s not found", item.Subset)
+	}
+	patch, err := json.Marshal([]map[string]interface{}{
+		{"op": "test", "path": fmt.Sprintf("/spec/subsets/%d/name", index), "value": item.Subset},
+		{"op": "remove", "path": fmt.Sprintf("/spec/subsets/%d", index)},
+	})
+	if err != nil {
+		return err
+	}
+	opts := metav1.PatchOptions{}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	_, err = ri.Patch(goContext.TODO(), item.Name, types.JSONPatchType, patch, opts)
+	return err
+}
@@ -0,0 +1,143 @@
+package istio
+
+import (
+	goContext "context"
+	"testing"
+
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+)
+
+func newService(namespace, name string, selector map[string]interface{}) *unstructured.Unstructured {
+	return newIstioObject("Service", namespace, name, map[string]interface{}{"selector": selector})
+}
+
+func newPod(namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	pod := newIstioObject("Pod", namespace, name, nil)
+	pod.SetLabels(labels)
+	return pod
+}
+
+func TestFindOrphans(t *testing.T) {
+	subsets := []interface{}{
+		map[string]interface{}{"name": "v1", "labels": map[string]interface{}{"version": "v1"}},
+		map[string]interface{}{"name": "v2", "labels": map[string]interface{}{"version": "v2"}},
+		map[string]interface{}{"name": "v3", "labels": map[string]interface{}{"version": "v3"}},
+	}
+	cfg := &orphanConfig{
+		services: []*unstructured.Unstructured{
+			newService("prod", "reviews", map[string]interface{}{"app": "reviews"}),
+		},
+		pods: []*unstructured.Unstructured{
+			newPod("prod", "reviews-v1", map[string]string{"app": "reviews", "version": "v1"}),
+			newPod("prod", "other-v2", map[string]string{"app": "other", "version": "v2"}),
+		},
+		destinationRules: []*unstructured.Unstructured{
+			newIstioObject("DestinationRule", "prod", "reviews", map[string]interface{}{"host": "reviews", "subsets": subsets}),
+			newIstioObject("DestinationRule", "prod", "ratings", map[string]interface{}{"host": "ratings.prod.svc.cluster.local"}),
+			newIstioObject("DestinationRule", "prod", "github", map[string]interface{}{"host": "api.github.com"}),
+		},
+		virtualServices: []*unstructured.Unstructured{
+			newIstioObject("VirtualService", "prod", "reviews", map[string]interface{}{
+				"hosts": []interface{}{"reviews"},
+				"http": []interface{}{map[string]interface{}{"route": []interface{}{
+					map[string]interface{}{"destination": map[string]interface{}{"host": "reviews", "subset": "v2"}},
+				}}},
+			}),
+			newIstioObject("VirtualService", "prod", "legacy", map[string]interface{}{"hosts": []interface{}{"legacy"}}),
+			newIstioObject("VirtualService", "prod", "ingress", map[string]interface{}{
+				"hosts": []interface{}{"shop.example.com"}, "gateways": []interface{}{"istio-system/public"},
+			}),
+			newIstioObject("VirtualService", "prod", "broken", map[string]interface{}{
+				"hosts": []interface{}{"old.example.com"}, "gateways": []interface{}{"removed"},
+			}),
+		},
+		gateways: []*unstructured.Unstructured{
+			newIstioObject("Gateway", "istio-system", "public", map[string]interface{}{}),
+			newIstioObject("Gateway", "istio-system", "unused", map[string]interface{}{}),
+		},
+		serviceEntries: []*unstructured.Unstructured{
+			newIstioObject("ServiceEntry", "prod", "github", map[string]interface{}{"hosts": []interface{}{"api.github.com"}}),
+			newIstioObject("ServiceEntry", "prod", "reviews", map[string]interface{}{"hosts": []interface{}{"reviews.prod.svc.cluster.local"}}),
+		},
+	}
+	h := &Handler{}
+	got := map[string]OrphanFinding{}
+	for _, f := range h.findOrphans(cfg) {
+		got[f.Reason+" "+f.key()] = f
+	}
+	want := []string{
+		OrphanDestinationRule + " DestinationRule/prod/ratings/",
+		OrphanSubset + " DestinationRule/prod/reviews/v2",
+		OrphanSubset + " DestinationRule/prod/reviews/v3",
+		OrphanVirtualService + " VirtualService/prod/legacy/",
+		OrphanVirtualService + " VirtualService/prod/broken/",
+		OrphanGateway + " Gateway/istio-system/unused/",
+		OrphanServiceEntry + " ServiceEntry/prod/reviews/",
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d findings, got %v", len(want), got)
+	}
+	for _, w := range want {
+		if _, ok := got[w]; !ok {
+			t.Errorf("missing finding %s", w)
+		}
+	}
+	if refs := got[OrphanSubset+" DestinationRule/prod/reviews/v2"].ReferencedBy; len(refs) != 1 || refs[0] != "prod/reviews" {
+		t.Errorf("subset v2 should be referenced by prod/reviews, got %v", refs)
+	}
+}
+
+func TestCleanupOrphans(t *testing.T) {
+	subsets := []interface{}{
+		map[string]interface{}{"name": "v1", "labels": map[string]interface{}{"version": "v1"}},
+		map[string]interface{}{"name": "v2", "labels": map[string]interface{}{"version": "v2"}},
+		map[string]interface{}{"name": "v3", "labels": map[string]interface{}{"version": "v3"}},
+	}
+	dr := newIstioObject("DestinationRule", "prod", "reviews", map[string]interface{}{"host": "reviews", "subsets": subsets})
+	dr.SetAPIVersion("networking.istio.io/v1beta1")
+	vs := newIstioObject("VirtualService", "prod", "legacy", map[string]interface{}{"hosts": []interface{}{"legacy"}})
+	vs.SetAPIVersion("networking.istio.io/v1beta1")
+	se := newIstioObject("ServiceEntry", "prod", "ratings", map[string]interface{}{"hosts": []interface{}{"ratings.prod.svc.cluster.local"}})
+	se.SetAPIVersion("networking.istio.io/v1beta1")
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		informer.DestinationRules: "DestinationRuleList",
+		informer.VirtualServices:  "VirtualServiceList",
+		informer.ServiceEntries:   "ServiceEntryList",
+	}, dr, vs, se)
+
+	findings := []OrphanFinding{
+		{Reason: OrphanSubset, Kind: "DestinationRule", Namespace: "prod", Name: "reviews", Subset: "v2", ReferencedBy: []string{"prod/reviews"}},
+		{Reason: OrphanSubset, Kind: "DestinationRule", Namespace: "prod", Name: "reviews", Subset: "v3"},
+		{Reason: OrphanVirtualService, Kind: "VirtualService", Namespace: "prod", Name: "legacy"},
+		{Reason: OrphanServiceEntry, Kind: "ServiceEntry", Namespace: "prod", Name: "ratings"},
+	}
+	report := cleanupOrphans(client, findings, CleanupRequest{Items: []CleanupItem{
+		{Kind: "DestinationRule", Namespace: "prod", Name: "reviews", Subset: "v2"},
+		{Kind: "DestinationRule", Namespace: "prod", Name: "reviews", Subset: "v3"},
+		{Kind: "DestinationRule", Namespace: "prod", Name: "reviews"},
+		{Kind: "VirtualService", Namespace: "prod", Name: "legacy"},
+		{Kind: "ServiceEntry", Namespace: "prod", Name: "ratings"},
+	}})
+	if report.Succeeded != 3 || report.Failed != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	live, err := client.Resource(informer.DestinationRules).Namespace("prod").Get(goContext.TODO(), "reviews", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remaining, _, _ := unstructured.NestedSlice(live.Object, "spec", "subsets")
+	if len(remaining) != 2 || remaining[1].(map[string]interface{})["name"] != "v2" {
+		t.Errorf("only subset v3 should be removed, got %v", remaining)
+	}
+	if _, err := client.Resource(informer.VirtualServices).Namespace("prod").Get(goContext.TODO(), "legacy", metav1.GetOptions{}); err == nil {
+		t.Error("VirtualService legacy should be deleted")
+	}
+	if _, err := client.Resource(informer.ServiceEntries).Namespace("prod").Get(goContext.TODO(), "ratings", metav1.GetOptions{}); err == nil {
+		t.Error("ServiceEntry ratings should be deleted")
+	}
+}
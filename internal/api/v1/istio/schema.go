@@ -0,0 +1,164 @@
+package istio
+
+import (
+	goContext "context"
+	"fmt"
+	"strings"
+
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/meshconfig"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	apiextensionv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextension "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	k8sError "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var defaultSchemaKinds = []string{"VirtualService", "DestinationRule", "Gateway"}
+
+type KindSchema struct {
+	Kind       string                 `json:"kind"`
+	APIVersion string                 `json:"apiVersion"`
+	Served     []string               `json:"servedVersions"`
+	Schema     map[string]interface{} `json:"schema"`
+}
+
+// crdSchemas 读取集群中 Istio CRD 的 openAPIV3Schema，优先使用 KubePi 缓存读取的版本，集群未安装的类型不返回
+// CRD 为集群级别的元数据，使用集群凭据读取
+func (h *Handler) crdSchemas(clusterName string, kinds []string) ([]KindSchema, error) {
+	c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get cluster failed: %s", err.Error())
+	}
+	cfg, err := kubernetes.NewKubernetes(c).Config()
+	if err != nil {
+		return nil, err
+	}
+	client, err := apiextension.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]KindSchema, 0, len(kinds))
+	for _, kind := range kinds {
+		name, err := meshconfig.CRDName(kind)
+		if err != nil {
+			return nil, err
+		}
+		crd, err := client.ApiextensionsV1().CustomResourceDefinitions().Get(goContext.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			if k8sError.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		s, err := kindSchema(kind, crd)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+func kindSchema(kind string, crd *apiextensionv1.CustomResourceDefinition) (KindSchema, error) {
+	preferred := ""
+	for i := range meshconfig.Kinds {
+		if meshconfig.Kinds[i].Kind == kind {
+			preferred = meshconfig.Kinds[i].Resource.Version
+		}
+	}
+	version, err := meshconfig.SchemaVersion(crd, preferred)
+	if err != nil {
+		return KindSchema{}, err
+	}
+	s, err := meshconfig.JSONSchema(crd, version)
+	if err != nil {
+		return KindSchema{}, err
+	}
+	return KindSchema{
+		Kind:       kind,
+		APIVersion: crd.Spec.Group + "/" + version.Name,
+		Served:     meshconfig.ServedVersions(crd),
+		Schema:     s,
+	}, nil
+}
+
+// ListSchemas 返回由集群 CRD 生成的 JSON Schema，kinds 为逗号分隔的类型名，默认返回 VirtualService、DestinationRule、Gateway
+func (h *Handler) ListSchemas() iris.Handler {
+	return func(ctx *context.Context) {
+		kinds := defaultSchemaKinds
+		if k := ctx.URLParam("kinds"); k != "" {
+			kinds = strings.Split(k, ",")
+		}
+		schemas, err := h.crdSchemas(ctx.Params().GetString("cluster"), kinds)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.JSON(map[string]interface{}{
+			"data":    schemas,
+			"success": true,
+		})
+	}
+}
+
+// ListTemplates 返回内置的配置模板及其参数
+func (h *Handler) ListTemplates() iris.Handler {
+	return func(ctx *context.Context) {
+		ctx.JSON(map[string]interface{}{
+			"data":    meshconfig.Templates,
+			"success": true,
+		})
+	}
+}
+
+// RenderTemplate 按参数生成模板对象，apiVersion 使用集群 CRD 实际提供的版本，同时返回对应类型的 JSON Schema 供前端表单校验
+func (h *Handler) RenderTemplate() iris.Handler {
+	return func(ctx *context.Context) {
+		t, err := meshconfig.FindTemplate(ctx.Params().GetString("name"))
+		if err != nil {
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		var params map[string]string
+		if err := ctx.ReadJSON(&params); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		schemas, err := h.crdSchemas(ctx.Params().GetString("cluster"), t.Kinds)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		apiVersions := make(map[string]string)
+		for _, s := range schemas {
+			apiVersions[s.Kind] = s.APIVersion
+		}
+		objs, err := t.Render(params, apiVersions)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		data, err := meshconfig.EncodeYAML(objs)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.JSON(map[string]interface{}{
+			"data": map[string]interface{}{
+				"objects": objs,
+				"yaml":    string(data),
+				"schemas": schemas,
+			},
+			"success": true,
+		})
+	}
+}
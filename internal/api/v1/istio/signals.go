@@ -0,0 +1,269 @@
+package istio
+
+import (
+	goContext "context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/prometheus"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	defaultSignalWindow = 5 * time.Minute
+	maxSignalPoints     = 1000
+)
+
+// ServiceSignals 为某个服务在一个版本（子集）上的黄金指标
+type ServiceSignals struct {
+	Namespace string              `json:"namespace"`
+	Service   string              `json:"service"`
+	Version   string              `json:"version"`
+	Subset    string              `json:"subset"`
+	Signals   *prometheus.Signals `json:"signals"`
+}
+
+// signalRange 解析时间范围参数：range 为 Go duration（默认 5m），end 为 unix 秒或 RFC3339（默认当前时间），step 可选
+func signalRange(ctx *context.Context) (window time.Duration, end time.Time, step time.Duration, err error) {
+	window = defaultSignalWindow
+	if v := ctx.URLParam("range"); v != "" {
+		if window, err = time.ParseDuration(v); err != nil || window <= 0 {
+			return 0, end, 0, fmt.Errorf("invalid range %s", v)
+		}
+	}
+	end = time.Now()
+	if v := ctx.URLParam("end"); v != "" {
+		if sec, e := strconv.ParseInt(v, 10, 64); e == nil {
+			end = time.Unix(sec, 0)
+		} else if end, err = time.Parse(time.RFC3339, v); err != nil {
+			return 0, end, 0, fmt.Errorf("invalid end %s", v)
+		}
+	}
+	if v := ctx.URLParam("step"); v != "" {
+		if step, err = time.ParseDuration(v); err != nil || step <= 0 {
+			return 0, end, 0, fmt.Errorf("invalid step %s", v)
+		}
+		if window/step > maxSignalPoints {
+			return 0, end, 0, fmt.Errorf("step too small, at most %d points are allowed", maxSignalPoints)
+		}
+	}
+	return window, end, step, nil
+}
+
+// GetGoldenSignals 按服务与版本返回请求速率、5xx 错误率与延迟分位数，数据来自集群配置的 Prometheus 中的 Istio 标准指标
+func (h *Handler) GetGoldenSignals() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		namespace := ctx.URLParam("namespace")
+		service := ctx.URLParam("service")
+		window, end, step, err := signalRange(ctx)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		client, err := prometheusClient(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		cc, err := informer.Clusters.Get(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster cache failed: %s", err.Error()))
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+
+		// Prometheus 中的指标不区分用户，只返回用户有权查看的服务
+		services, err := listObjects(cc, profile, informer.Services, namespace)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("fetch Services failed: %s", err.Error()))
+			return
+		}
+		destinationRules, err := listObjects(cc, profile, informer.DestinationRules, namespace)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("fetch DestinationRules failed: %s", err.Error()))
+			return
+		}
+		q := prometheus.SignalQuery{
+			By:       []string{prometheus.LabelServiceNamespace, prometheus.LabelServiceName, prometheus.LabelVersion},
+			Matchers: map[string][]string{},
+			Window:   window,
+			End:      end,
+			Step:     step,
+		}
+		visible := visibleServices(services)
+		if !profile.IsAdministrator || namespace != "" {
+			namespaces := make([]string, 0, len(visible))
+			for ns := range visible {
+				namespaces = append(namespaces, ns)
+			}
+			if len(namespaces) == 0 {
+				ctx.JSON(map[string]interface{}{"data": []ServiceSignals{}, "success": true})
+				return
+			}
+			q.Matchers[prometheus.LabelServiceNamespace] = namespaces
+		}
+		if service != "" {
+			q.Matchers[prometheus.LabelServiceName] = []string{service}
+		}
+		signals, err := prometheus.GoldenSignals(goContext.TODO(), client, q)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		result := make([]ServiceSignals, 0, len(signals))
+		for _, s := range signals {
+			ns, name, version := s.Labels[prometheus.LabelServiceNamespace], s.Labels[prometheus.LabelServiceName], s.Labels[prometheus.LabelVersion]
+			if !visible[ns][name] {
+				continue
+			}
+			result = append(result, ServiceSignals{
+				Namespace: ns,
+				Service:   name,
+				Version:   version,
+				Subset:    h.subsetForVersion(destinationRules, ns, name, version),
+				Signals:   s,
+			})
+		}
+		ctx.JSON(map[string]interface{}{
+			"data":    result,
+			"success": true,
+		})
+	}
+}
+
+func visibleServices(services []map[string]interface{}) map[string]map[string]bool {
+	visible := map[string]map[string]bool{}
+	for _, s := range services {
+		u := &unstructured.Unstructured{Object: s}
+		if visible[u.GetNamespace()] == nil {
+			visible[u.GetNamespace()] = map[string]bool{}
+		}
+		visible[u.GetNamespace()][u.GetName()] = true
+	}
+	return visible
+}
+
+// subsetForVersion 返回服务的 DestinationRule 中选中 version 标签为该值的 Pod 的子集，Istio 指标中的 destination_version 取自 Pod 的 version 标签
+func (h *Handler) subsetForVersion(destinationRules []map[string]interface{}, namespace, service, version string) string {
+	if version == "" || version == "unknown" {
+		return ""
+	}
+	for _, dr := range destinationRules {
+		u := &unstructured.Unstructured{Object: dr}
+		host, _, _ := unstructured.NestedString(dr, "spec", "host")
+		if name, ns := splitServiceHost(host, u.GetNamespace()); name != service || ns != namespace {
+			continue
+		}
+		subsets, _, _ := unstructured.NestedSlice(dr, "spec", "subsets")
+		for _, s := range subsets {
+			subset, ok := s.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if h.podMatchesSubsetLabels(map[string]string{"version": version}, subset) {
+				name, _ := subset["name"].(string)
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// prometheusClient 创建集群的 Prometheus 客户端，与 ApiServer 使用同一代理
+func prometheusClient(c *v1Cluster.Cluster) (*prometheus.Client, error) {
+	proxy, err := kubernetes.ProxyURL(c)
+	if err != nil {
+		return nil, err
+	}
+	return prometheus.NewClient(c.Spec.Prometheus, proxy)
+}
+
+// workloadSignals 按命名空间、app 与 version 标签查询黄金指标，与流量分析中按 Pod 标签划分的记录一一对应
+func workloadSignals(c *v1Cluster.Cluster, namespaces []string, window time.Duration) (map[string]*prometheus.Signals, error) {
+	client, err := prometheusClient(c)
+	if err != nil {
+		return nil, err
+	}
+	q := prometheus.SignalQuery{
+		By:       []string{prometheus.LabelWorkloadNs, prometheus.LabelApp, prometheus.LabelVersion},
+		Matchers: map[string][]string{prometheus.LabelWorkloadNs: namespaces},
+		Window:   window,
+	}
+	signals, err := prometheus.GoldenSignals(goContext.TODO(), client, q)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*prometheus.Signals, len(signals))
+	for _, s := range signals {
+		result[workloadKey(s.Labels[prometheus.LabelWorkloadNs], s.Labels[prometheus.LabelApp], s.Labels[prometheus.LabelVersion])] = s
+	}
+	return result, nil
+}
+
+func workloadKey(namespace, app, version string) string {
+	return namespace + "/" + app + "/" + version
+}
+
+// podVersion 返回 Istio 上报指标时使用的版本标签
+func podVersion(labels map[string]string) string {
+	if v := labels["version"]; v != "" {
+		return v
+	}
+	if v := labels["app.kubernetes.io/version"]; v != "" {
+		return v
+	}
+	return "unknown"
+}
+
+// attachSignals 将指标附加到每条流量记录，并按服务与子集汇总到 summary.subsets
+func attachSignals(analysis map[string]interface{}, signals map[string]*prometheus.Signals) {
+	records, _ := analysis["trafficAnalysis"].([]map[string]interface{})
+	summary, _ := analysis["summary"].(map[string]interface{})
+	subsets := make([]map[string]interface{}, 0)
+	seen := map[string]bool{}
+	for _, record := range records {
+		ns, _ := record["namespace"].(string)
+		service, _ := record["serviceName"].(string)
+		version, _ := record["version"].(string)
+		s := signals[workloadKey(ns, service, version)]
+		record["signals"] = s
+		subset := fmt.Sprint(record["subset"])
+		key := workloadKey(ns, service, version) + "/" + subset
+		if seen[key] || s == nil {
+			continue
+		}
+		seen[key] = true
+		subsets = append(subsets, map[string]interface{}{
+			"namespace":   ns,
+			"serviceName": service,
+			"subset":      record["subset"],
+			"version":     version,
+			"trafficType": record["trafficType"],
+			"signals":     s,
+		})
+	}
+	if summary != nil {
+		summary["subsets"] = subsets
+	}
+}
@@ -0,0 +1,103 @@
+package istio
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/collectons"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/watch"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+var defaultWatchKinds = []string{"virtualservices", "destinationrules", "gateways", "pods"}
+
+// WatchSessionHandler 创建 Istio 资源与 Pod 变更的推送会话
+// 前端拿到 id 后通过 /ws/watch/sockjs 绑定会话，后端基于共享 informer 推送增量事件
+func (h *Handler) WatchSessionHandler() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		namespace := ctx.URLParam("namespace")
+		kinds := defaultWatchKinds
+		if k := ctx.URLParam("kinds"); k != "" {
+			kinds = strings.Split(k, ",")
+		}
+		for i := range kinds {
+			if _, ok := informer.Kinds[kinds[i]]; !ok {
+				ctx.StatusCode(iris.StatusBadRequest)
+				ctx.Values().Set("message", fmt.Sprintf("unsupported watch kind %s", kinds[i]))
+				return
+			}
+		}
+
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		u := ctx.Values().Get("profile")
+		profile := u.(session.UserProfile)
+
+		// 根据用户可见的命名空间过滤事件
+		var namespaces *collectons.StringSet
+		if !profile.IsAdministrator {
+			k := kubernetes.NewKubernetes(c)
+			allowed, err := k.GetUserNamespaceNames(profile.Name)
+			if err != nil {
+				ctx.StatusCode(iris.StatusInternalServerError)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			namespaces = collectons.NewStringSet()
+			for i := range allowed {
+				if namespace == "" || allowed[i] == namespace {
+					namespaces.Add(allowed[i])
+				}
+			}
+		} else if namespace != "" {
+			namespaces = collectons.NewStringSet()
+			namespaces.Add(namespace)
+		}
+
+		cc, err := informer.Clusters.Get(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		// 非管理员还需逐个资源类型检查 list 权限，与列表接口一致
+		var sub *informer.Subscription
+		if profile.IsAdministrator {
+			sub, err = cc.Subscribe(kinds, namespaces)
+		} else {
+			sub, err = cc.SubscribeAs(profile.Name, kinds, namespaces, nil)
+		}
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		sessionId, err := watch.GenWatchSessionId()
+		if err != nil {
+			sub.Close()
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		watch.WatchSessions.Set(sessionId, watch.WatchSession{
+			Id:           sessionId,
+			Bound:        make(chan error),
+			Subscription: sub,
+		})
+		go watch.WaitForWatchStream(sessionId)
+		ctx.JSON(map[string]interface{}{
+			"data":    map[string]string{"id": sessionId},
+			"success": true,
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package mesh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1Mesh "github.com/KubeOperator/kubepi/internal/model/v1/mesh"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	eastWestGatewayPort = 15443
+	networkLabel        = "topology.istio.io/network"
+)
+
+type ConfigInstance struct {
+	Cluster   string `json:"cluster"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Hash      string `json:"hash"`
+	// Ignored 为 true 表示该配置位于 remote 集群，不会被控制面读取
+	Ignored bool `json:"ignored"`
+}
+
+type HostConfig struct {
+	Kind      string           `json:"kind"`
+	Host      string           `json:"host"`
+	Instances []ConfigInstance `json:"instances"`
+	Missing   []string         `json:"missing"`
+	Divergent bool             `json:"divergent"`
+}
+
+type RemoteSecret struct {
+	Cluster   string            `json:"cluster"`
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Servers   map[string]string `json:"servers"`
+}
+
+type EastWestGateway struct {
+	Cluster   string   `json:"cluster"`
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Network   string   `json:"network"`
+	Addresses []string `json:"addresses"`
+	Ports     []int64  `json:"ports"`
+	// Ready 表示网关已获取地址且暴露了跨网络端口 15443
+	Ready bool `json:"ready"`
+}
+
+type Link struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Discovery   bool   `json:"discovery"`
+	SameNetwork bool   `json:"sameNetwork"`
+	Gateway     bool   `json:"gateway"`
+	Reachable   bool   `json:"reachable"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type HostEndpoints struct {
+	Host      string         `json:"host"`
+	Endpoints map[string]int `json:"endpoints"`
+	// Reachable 为从各集群出发可以访问到的端点数量
+	Reachable map[string]int `json:"reachable"`
+}
+
+// normalizeHost 将短名称补全为集群内 FQDN，便于跨集群比对
+func normalizeHost(host, namespace string) string {
+	if host == "" || host == "*" || strings.Contains(host, ".") || strings.Contains(host, "/") {
+		return host
+	}
+	return fmt.Sprintf("%s.%s.svc.cluster.local", host, namespace)
+}
+
+// hostsOf 返回 Istio 配置作用的主机
+func hostsOf(kind string, obj *unstructured.Unstructured) []string {
+	ns := obj.GetNamespace()
+	var hosts []string
+	switch kind {
+	case "destinationrules":
+		if h, ok, _ := unstructured.NestedString(obj.Object, "spec", "host"); ok {
+			hosts = append(hosts, normalizeHost(h, ns))
+		}
+	case "gateways":
+		servers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "servers")
+		for i := range servers {
+			s, ok := servers[i].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			hs, _, _ := unstructured.NestedStringSlice(s, "hosts")
+			hosts = append(hosts, hs...)
+		}
+	default:
+		hs, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "hosts")
+		for i := range hs {
+			hosts = append(hosts, normalizeHost(hs[i], ns))
+		}
+	}
+	if len(hosts) == 0 {
+		// 没有声明主机的配置按名称归组
+		hosts = append(hosts, fmt.Sprintf("%s/%s", ns, obj.GetName()))
+	}
+	return uniqueStrings(hosts)
+}
+
+// specHash 计算配置内容的摘要，短名称主机先补全，避免写法不同被误判为差异
+func specHash(kind string, obj *unstructured.Unstructured) string {
+	spec, _, _ := unstructured.NestedMap(obj.Object, "spec")
+	ns := obj.GetNamespace()
+	switch kind {
+	case "destinationrules":
+		if h, ok := spec["host"].(string); ok {
+			spec["host"] = normalizeHost(h, ns)
+		}
+	case "virtualservices", "serviceentries":
+		if hs, ok, _ := unstructured.NestedStringSlice(spec, "hosts"); ok {
+			for i := range hs {
+				hs[i] = normalizeHost(hs[i], ns)
+			}
+			_ = unstructured.SetNestedStringSlice(spec, hs, "hosts")
+		}
+	}
+	data, _ := json.Marshal(spec)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// aggregateConfig 按类型和主机归组各集群的配置，primary 集群之间缺失或内容不一致时标记为 divergent
+// objects 的结构为 cluster -> kind -> objects
+func aggregateConfig(m *v1Mesh.Mesh, objects map[string]map[string][]*unstructured.Unstructured) []HostConfig {
+	roles := make(map[string]string)
+	var primaries []string
+	for _, c := range m.Clusters {
+		roles[c.Name] = c.Role
+		if c.Role != v1Mesh.RoleRemote {
+			primaries = append(primaries, c.Name)
+		}
+	}
+	type key struct{ kind, host string }
+	groups := make(map[key]*HostConfig)
+	for _, c := range m.Clusters {
+		for kind, objs := range objects[c.Name] {
+			for _, obj := range objs {
+				instance := ConfigInstance{
+					Cluster:   c.Name,
+					Namespace: obj.GetNamespace(),
+					Name:      obj.GetName(),
+					Hash:      specHash(kind, obj),
+					Ignored:   roles[c.Name] == v1Mesh.RoleRemote,
+				}
+				for _, host := range hostsOf(kind, obj) {
+					k := key{kind: kind, host: host}
+					g, ok := groups[k]
+					if !ok {
+						g = &HostConfig{Kind: kind, Host: host, Instances: []ConfigInstance{}, Missing: []string{}}
+						groups[k] = g
+					}
+					g.Instances = append(g.Instances, instance)
+				}
+			}
+		}
+	}
+	result := make([]HostConfig, 0, len(groups))
+	for _, g := range groups {
+		present := make(map[string]bool)
+		hashes := make(map[string]bool)
+		for _, in := range g.Instances {
+			if in.Ignored {
+				continue
+			}
+			present[in.Cluster] = true
+			hashes[in.Hash] = true
+		}
+		for _, p := range primaries {
+			if !present[p] {
+				g.Missing = append(g.Missing, p)
+			}
+		}
+		g.Divergent = len(g.Missing) > 0 || len(hashes) > 1
+		sort.Slice(g.Instances, func(i, j int) bool {
+			if g.Instances[i].Cluster != g.Instances[j].Cluster {
+				return g.Instances[i].Cluster < g.Instances[j].Cluster
+			}
+			return g.Instances[i].Namespace+"/"+g.Instances[i].Name < g.Instances[j].Namespace+"/"+g.Instances[j].Name
+		})
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Kind != result[j].Kind {
+			return result[i].Kind < result[j].Kind
+		}
+		return result[i].Host < result[j].Host
+	})
+	return result
+}
+
+// controlPlaneOf 返回为集群下发配置的 primary 集群
+func controlPlaneOf(m *v1Mesh.Mesh, name string) string {
+	for _, c := range m.Clusters {
+		if c.Name == name && c.Role == v1Mesh.RoleRemote {
+			return c.Primary
+		}
+	}
+	return name
+}
+
+// computeReachability 计算集群之间的端点可达性：
+// 源集群的控制面需要通过 remote secret 发现目标集群的端点；跨网络时目标网络需要存在可用的东西向网关
+// apiServers 为 KubePi 中登记的各集群 API Server 地址，用于匹配 remote secret 中的 server
+func computeReachability(m *v1Mesh.Mesh, secrets []RemoteSecret, gateways []EastWestGateway, apiServers map[string]string) []Link {
+	networkGateway := make(map[string]bool)
+	networks := make(map[string]string)
+	for _, c := range m.Clusters {
+		networks[c.Name] = c.Network
+	}
+	for _, g := range gateways {
+		network := g.Network
+		if network == "" {
+			network = networks[g.Cluster]
+		}
+		if g.Ready {
+			networkGateway[network] = true
+		}
+	}
+	var links []Link
+	for _, from := range m.Clusters {
+		cp := controlPlaneOf(m, from.Name)
+		for _, to := range m.Clusters {
+			if from.Name == to.Name {
+				continue
+			}
+			l := Link{From: from.Name, To: to.Name}
+			l.Discovery = to.Name == cp || hasRemoteSecret(secrets, cp, to, apiServers[to.Name])
+			l.SameNetwork = from.Network == to.Network
+			l.Gateway = networkGateway[to.Network]
+			l.Reachable = l.Discovery && (l.SameNetwork || l.Gateway)
+			switch {
+			case !l.Discovery:
+				l.Reason = fmt.Sprintf("control plane %s has no remote secret for cluster %s", cp, to.IstioClusterID())
+			case !l.SameNetwork && !l.Gateway:
+				l.Reason = fmt.Sprintf("network %s has no ready east-west gateway", to.Network)
+			}
+			links = append(links, l)
+		}
+	}
+	return links
+}
+
+func hasRemoteSecret(secrets []RemoteSecret, controlPlane string, to v1Mesh.Cluster, apiServer string) bool {
+	for _, s := range secrets {
+		if s.Cluster != controlPlane {
+			continue
+		}
+		for id, server := range s.Servers {
+			if id == to.IstioClusterID() {
+				return true
+			}
+			if apiServer != "" && strings.TrimSuffix(server, "/") == strings.TrimSuffix(apiServer, "/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// reachableEndpoints 汇总每个主机在各集群的端点数，以及从各集群出发可访问的端点数
+// endpoints 的结构为 host -> cluster -> count
+func reachableEndpoints(m *v1Mesh.Mesh, links []Link, endpoints map[string]map[string]int) []HostEndpoints {
+	reachable := make(map[string]bool)
+	for _, l := range links {
+		if l.Reachable {
+			reachable[l.From+"/"+l.To] = true
+		}
+	}
+	result := make([]HostEndpoints, 0, len(endpoints))
+	for host, counts := range endpoints {
+		he := HostEndpoints{Host: host, Endpoints: counts, Reachable: make(map[string]int)}
+		for _, from := range m.Clusters {
+			total := 0
+			for cluster, count := range counts {
+				if cluster == from.Name || reachable[from.Name+"/"+cluster] {
+					total += count
+				}
+			}
+			he.Reachable[from.Name] = total
+		}
+		result = append(result, he)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Host < result[j].Host
+	})
+	return result
+}
+
+func uniqueStrings(ss []string) []string {
+	seen := make(map[string]bool, len(ss))
+	result := make([]string, 0, len(ss))
+	for _, s := range ss {
+		if seen[s] {
+			continue
+		}
+		seen[s] = true
+		result = append(result, s)
+	}
+	return result
+}
@@ -0,0 +1,88 @@
+package mesh
+
+import (
+	"testing"
+
+	v1Mesh "github.com/KubeOperator/kubepi/internal/model/v1/mesh"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func destinationRule(namespace, name, host, lb string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"metadata": map[string]interface{}{"namespace": namespace, "name": name},
+		"spec": map[string]interface{}{
+			"host":          host,
+			"trafficPolicy": map[string]interface{}{"loadBalancer": map[string]interface{}{"simple": lb}},
+		},
+	}}
+}
+
+func TestAggregateConfig(t *testing.T) {
+	m := &v1Mesh.Mesh{Clusters: []v1Mesh.Cluster{
+		{Name: "east", Role: v1Mesh.RolePrimary},
+		{Name: "west", Role: v1Mesh.RolePrimary},
+		{Name: "edge", Role: v1Mesh.RoleRemote, Primary: "east"},
+	}}
+	objects := map[string]map[string][]*unstructured.Unstructured{
+		"east": {"destinationrules": {
+			destinationRule("default", "reviews", "reviews", "ROUND_ROBIN"),
+			destinationRule("default", "ratings", "ratings.default.svc.cluster.local", "ROUND_ROBIN"),
+			destinationRule("default", "details", "details", "ROUND_ROBIN"),
+		}},
+		"west": {"destinationrules": {
+			destinationRule("default", "reviews", "reviews.default.svc.cluster.local", "ROUND_ROBIN"),
+			destinationRule("default", "ratings", "ratings", "LEAST_REQUEST"),
+		}},
+		"edge": {"destinationrules": {
+			destinationRule("default", "details", "details", "RANDOM"),
+		}},
+	}
+	divergent := map[string]bool{}
+	for _, c := range aggregateConfig(m, objects) {
+		divergent[c.Host] = c.Divergent
+	}
+	cases := map[string]bool{
+		"reviews.default.svc.cluster.local": false,
+		"ratings.default.svc.cluster.local": true,
+		// remote 集群中的配置不参与比较，west 缺失该配置
+		"details.default.svc.cluster.local": true,
+	}
+	for host, want := range cases {
+		if got, ok := divergent[host]; !ok || got != want {
+			t.Errorf("host %s: divergent = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestComputeReachability(t *testing.T) {
+	m := &v1Mesh.Mesh{Clusters: []v1Mesh.Cluster{
+		{Name: "east", Role: v1Mesh.RolePrimary, Network: "net1"},
+		{Name: "west", Role: v1Mesh.RolePrimary, Network: "net2", ClusterID: "cluster-west"},
+		{Name: "edge", Role: v1Mesh.RoleRemote, Primary: "east", Network: "net1"},
+	}}
+	secrets := []RemoteSecret{
+		{Cluster: "east", Servers: map[string]string{"cluster-west": ""}},
+		{Cluster: "east", Servers: map[string]string{"edge-id": "https://10.0.0.3:6443"}},
+	}
+	gateways := []EastWestGateway{{Cluster: "west", Network: "net2", Ready: true}}
+	apiServers := map[string]string{"edge": "https://10.0.0.3:6443/"}
+
+	reachable := map[string]bool{}
+	for _, l := range computeReachability(m, secrets, gateways, apiServers) {
+		reachable[l.From+"/"+l.To] = l.Reachable
+	}
+	cases := map[string]bool{
+		"east/west": true,
+		"east/edge": true,
+		// edge 使用 east 的控制面
+		"edge/west": true,
+		"edge/east": true,
+		// west 没有任何 remote secret
+		"west/east": false,
+	}
+	for link, want := range cases {
+		if got := reachable[link]; got != want {
+			t.Errorf("link %s: reachable = %v, want %v", link, got, want)
+		}
+	}
+}
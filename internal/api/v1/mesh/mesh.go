@@ -0,0 +1,222 @@
+package mesh
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Mesh "github.com/KubeOperator/kubepi/internal/model/v1/mesh"
+	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/internal/service/v1/mesh"
+	"github.com/asdine/storm/v3"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+type Handler struct {
+	meshService    mesh.Service
+	clusterService cluster.Service
+}
+
+func NewHandler() *Handler {
+	return &Handler{
+		meshService:    mesh.NewService(),
+		clusterService: cluster.NewService(),
+	}
+}
+
+// List Meshes
+// @Tags meshes
+// @Summary List meshes
+// @Description List meshes
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} []v1Mesh.Mesh
+// @Security ApiKeyAuth
+// @Router /meshes [get]
+func (h *Handler) ListMeshes() iris.Handler {
+	return func(ctx *context.Context) {
+		meshes, err := h.meshService.List(common.DBOptions{})
+		if err != nil && !errors.Is(err, storm.ErrNotFound) {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", meshes)
+	}
+}
+
+// Create Mesh
+// @Tags meshes
+// @Summary Create mesh
+// @Description Create mesh
+// @Accept  json
+// @Produce  json
+// @Param request body v1Mesh.Mesh true "request"
+// @Success 200 {object} v1Mesh.Mesh
+// @Security ApiKeyAuth
+// @Router /meshes [post]
+func (h *Handler) CreateMesh() iris.Handler {
+	return func(ctx *context.Context) {
+		var req v1Mesh.Mesh
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if err := h.validate(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		req.CreatedBy = profile.Name
+		if err := h.meshService.Create(&req, common.DBOptions{}); err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", req)
+	}
+}
+
+// Get Mesh
+// @Tags meshes
+// @Summary Get mesh by name
+// @Description Get mesh by name
+// @Accept  json
+// @Produce  json
+// @Param name path string true "网格名称"
+// @Success 200 {object} v1Mesh.Mesh
+// @Security ApiKeyAuth
+// @Router /meshes/{name} [get]
+func (h *Handler) GetMesh() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		m, err := h.meshService.Get(name, common.DBOptions{})
+		if err != nil {
+			if errors.Is(err, storm.ErrNotFound) {
+				ctx.StatusCode(iris.StatusNotFound)
+			} else {
+				ctx.StatusCode(iris.StatusInternalServerError)
+			}
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", m)
+	}
+}
+
+// Update Mesh
+// @Tags meshes
+// @Summary Update mesh by name
+// @Description Update mesh by name
+// @Accept  json
+// @Produce  json
+// @Param request body v1Mesh.Mesh true "request"
+// @Param name path string true "网格名称"
+// @Success 200 {object} v1Mesh.Mesh
+// @Security ApiKeyAuth
+// @Router /meshes/{name} [put]
+func (h *Handler) UpdateMesh() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		var req v1Mesh.Mesh
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		req.Name = name
+		if err := h.validate(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		req.CreatedBy = profile.Name
+		if err := h.meshService.Update(name, &req, common.DBOptions{}); err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", req)
+	}
+}
+
+// Delete Mesh
+// @Tags meshes
+// @Summary Delete mesh by name
+// @Description Delete mesh by name
+// @Accept  json
+// @Produce  json
+// @Param name path string true "网格名称"
+// @Security ApiKeyAuth
+// @Router /meshes/{name} [delete]
+func (h *Handler) DeleteMesh() iris.Handler {
+	return func(ctx *context.Context) {
+		name := ctx.Params().GetString("name")
+		if err := h.meshService.Delete(name, common.DBOptions{}); err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+	}
+}
+
+// validate 检查网格中的集群均已注册，remote 集群必须指向同一网格中的 primary 集群
+func (h *Handler) validate(m *v1Mesh.Mesh) error {
+	if m.Name == "" {
+		return errors.New("mesh name is required")
+	}
+	if len(m.Clusters) == 0 {
+		return errors.New("mesh must contain at least one cluster")
+	}
+	roles := make(map[string]string)
+	for i := range m.Clusters {
+		c := &m.Clusters[i]
+		if _, ok := roles[c.Name]; ok {
+			return fmt.Errorf("cluster %s is added more than once", c.Name)
+		}
+		if _, err := h.clusterService.Get(c.Name, common.DBOptions{}); err != nil {
+			return fmt.Errorf("cluster %s: %s", c.Name, err.Error())
+		}
+		if c.Role == "" {
+			c.Role = v1Mesh.RolePrimary
+		}
+		if c.Role != v1Mesh.RolePrimary && c.Role != v1Mesh.RoleRemote {
+			return fmt.Errorf("cluster %s: unknown role %s", c.Name, c.Role)
+		}
+		roles[c.Name] = c.Role
+	}
+	hasPrimary := false
+	for i := range m.Clusters {
+		c := m.Clusters[i]
+		if c.Role == v1Mesh.RolePrimary {
+			hasPrimary = true
+			continue
+		}
+		if roles[c.Primary] != v1Mesh.RolePrimary {
+			return fmt.Errorf("remote cluster %s must reference a primary cluster of the mesh", c.Name)
+		}
+	}
+	if !hasPrimary {
+		return errors.New("mesh must contain at least one primary cluster")
+	}
+	return nil
+}
+
+func Install(parent iris.Party) {
+	handler := NewHandler()
+	sp := parent.Party("/meshes")
+	sp.Get("/", handler.ListMeshes())
+	sp.Post("/", handler.CreateMesh())
+	sp.Get("/:name", handler.GetMesh())
+	sp.Put("/:name", handler.UpdateMesh())
+	sp.Delete("/:name", handler.DeleteMesh())
+	sp.Get("/:name/config", handler.GetMeshConfig())
+	sp.Get("/:name/remote-secrets", handler.ListRemoteSecrets())
+	sp.Get("/:name/east-west-gateways", handler.ListEastWestGateways())
+	sp.Get("/:name/reachability", handler.GetReachability())
+}
@@ -0,0 +1,374 @@
+package mesh
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Mesh "github.com/KubeOperator/kubepi/internal/model/v1/mesh"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/asdine/storm/v3"
+	"github.com/kataras/iris/v12"
+	irisContext "github.com/kataras/iris/v12/context"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	defaultIstioNamespace = "istio-system"
+	multiClusterLabel     = "istio/multiCluster"
+	eastWestGatewayLabel  = "istio=eastwestgateway"
+)
+
+var (
+	secrets     = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+	configKinds = []string{"virtualservices", "destinationrules", "gateways", "serviceentries"}
+)
+
+// clusterView 为单个集群读取到的数据，读取失败的集群记录在 errors 中，不影响其他集群的展示
+type clusterView struct {
+	mesh    *v1Mesh.Mesh
+	profile session.UserProfile
+	caches  map[string]*informer.ClusterCache
+	errors  map[string]string
+}
+
+func (h *Handler) loadView(ctx *irisContext.Context) (*clusterView, bool) {
+	name := ctx.Params().GetString("name")
+	m, err := h.meshService.Get(name, common.DBOptions{})
+	if err != nil {
+		if errors.Is(err, storm.ErrNotFound) {
+			ctx.StatusCode(iris.StatusNotFound)
+		} else {
+			ctx.StatusCode(iris.StatusInternalServerError)
+		}
+		ctx.Values().Set("message", err.Error())
+		return nil, false
+	}
+	v := &clusterView{
+		mesh:    m,
+		profile: ctx.Values().Get("profile").(session.UserProfile),
+		caches:  make(map[string]*informer.ClusterCache),
+		errors:  make(map[string]string),
+	}
+	for _, mc := range m.Clusters {
+		c, err := h.clusterService.Get(mc.Name, common.DBOptions{})
+		if err != nil {
+			v.errors[mc.Name] = err.Error()
+			continue
+		}
+		cc, err := informer.Clusters.Get(c)
+		if err != nil {
+			v.errors[mc.Name] = err.Error()
+			continue
+		}
+		v.caches[mc.Name] = cc
+	}
+	return v, true
+}
+
+// list 读取缓存中用户可见的对象，集群未安装对应 CRD 时返回空列表
+func (v *clusterView) list(cluster string, gvr schema.GroupVersionResource, namespace string) ([]*unstructured.Unstructured, error) {
+	cc := v.caches[cluster]
+	objs, err := cc.List(gvr, namespace)
+	if err != nil {
+		if errors.Is(err, informer.ErrNotServed) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !v.profile.IsAdministrator {
+		return cc.FilterByAccess(v.profile.Name, gvr, objs)
+	}
+	return objs, nil
+}
+
+func (v *clusterView) result(items interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"mesh":   v.mesh,
+		"items":  items,
+		"errors": v.errors,
+	}
+}
+
+// GetMeshConfig 汇总各集群的 Istio 配置并按主机标记差异
+func (h *Handler) GetMeshConfig() iris.Handler {
+	return func(ctx *irisContext.Context) {
+		v, ok := h.loadView(ctx)
+		if !ok {
+			return
+		}
+		namespace := ctx.URLParam("namespace")
+		objects := make(map[string]map[string][]*unstructured.Unstructured)
+		for cluster := range v.caches {
+			byKind := make(map[string][]*unstructured.Unstructured)
+			for _, kind := range configKinds {
+				objs, err := v.list(cluster, informer.Kinds[kind], namespace)
+				if err != nil {
+					v.errors[cluster] = err.Error()
+					break
+				}
+				byKind[kind] = objs
+			}
+			if _, failed := v.errors[cluster]; !failed {
+				objects[cluster] = byKind
+			}
+		}
+		configs := aggregateConfig(v.mesh, objects)
+		if ctx.URLParamExists("divergent") {
+			divergent := make([]HostConfig, 0)
+			for i := range configs {
+				if configs[i].Divergent {
+					divergent = append(divergent, configs[i])
+				}
+			}
+			configs = divergent
+		}
+		ctx.Values().Set("data", v.result(configs))
+	}
+}
+
+// ListRemoteSecrets 列出各集群控制面命名空间中的 remote secret，只返回集群标识和 API Server 地址，不返回凭据
+func (h *Handler) ListRemoteSecrets() iris.Handler {
+	return func(ctx *irisContext.Context) {
+		v, ok := h.loadView(ctx)
+		if !ok {
+			return
+		}
+		namespace := ctx.URLParamDefault("namespace", defaultIstioNamespace)
+		items := make([]RemoteSecret, 0)
+		for _, mc := range v.mesh.Clusters {
+			if _, ok := v.caches[mc.Name]; !ok {
+				continue
+			}
+			ss, err := h.remoteSecrets(v, mc.Name, namespace)
+			if err != nil {
+				v.errors[mc.Name] = err.Error()
+				continue
+			}
+			items = append(items, ss...)
+		}
+		ctx.Values().Set("data", v.result(items))
+	}
+}
+
+func (h *Handler) remoteSecrets(v *clusterView, cluster, namespace string) ([]RemoteSecret, error) {
+	if !v.profile.IsAdministrator {
+		allowed, err := v.caches[cluster].Allowed(v.profile.Name, "list", secrets, namespace, "")
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, errors.New("forbidden: can not list secrets in " + namespace)
+		}
+	}
+	c, err := h.clusterService.Get(cluster, common.DBOptions{})
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewKubernetes(c).Client()
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.CoreV1().Secrets(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: multiClusterLabel + "=true",
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]RemoteSecret, 0, len(list.Items))
+	for _, s := range list.Items {
+		rs := RemoteSecret{Cluster: cluster, Namespace: s.Namespace, Name: s.Name, Servers: make(map[string]string)}
+		for id, data := range s.Data {
+			server := ""
+			if cfg, err := clientcmd.Load(data); err == nil {
+				if ctxName := cfg.CurrentContext; ctxName != "" && cfg.Contexts[ctxName] != nil {
+					if kc, ok := cfg.Clusters[cfg.Contexts[ctxName].Cluster]; ok {
+						server = kc.Server
+					}
+				}
+			}
+			rs.Servers[id] = server
+		}
+		result = append(result, rs)
+	}
+	return result, nil
+}
+
+// ListEastWestGateways 列出各集群的东西向网关
+func (h *Handler) ListEastWestGateways() iris.Handler {
+	return func(ctx *irisContext.Context) {
+		v, ok := h.loadView(ctx)
+		if !ok {
+			return
+		}
+		items := make([]EastWestGateway, 0)
+		for _, mc := range v.mesh.Clusters {
+			if _, ok := v.caches[mc.Name]; !ok {
+				continue
+			}
+			gws, err := v.eastWestGateways(mc)
+			if err != nil {
+				v.errors[mc.Name] = err.Error()
+				continue
+			}
+			items = append(items, gws...)
+		}
+		ctx.Values().Set("data", v.result(items))
+	}
+}
+
+func (v *clusterView) eastWestGateways(mc v1Mesh.Cluster) ([]EastWestGateway, error) {
+	selector, _ := labels.Parse(eastWestGatewayLabel)
+	svcs, err := v.list(mc.Name, informer.Services, "")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]EastWestGateway, 0)
+	for _, svc := range svcs {
+		if !selector.Matches(labels.Set(svc.GetLabels())) {
+			continue
+		}
+		g := EastWestGateway{
+			Cluster:   mc.Name,
+			Namespace: svc.GetNamespace(),
+			Name:      svc.GetName(),
+			Network:   svc.GetLabels()[networkLabel],
+			Addresses: []string{},
+			Ports:     []int64{},
+		}
+		if g.Network == "" {
+			g.Network = mc.Network
+		}
+		ingress, _, _ := unstructured.NestedSlice(svc.Object, "status", "loadBalancer", "ingress")
+		for i := range ingress {
+			if in, ok := ingress[i].(map[string]interface{}); ok {
+				if ip, ok := in["ip"].(string); ok && ip != "" {
+					g.Addresses = append(g.Addresses, ip)
+				}
+				if hostname, ok := in["hostname"].(string); ok && hostname != "" {
+					g.Addresses = append(g.Addresses, hostname)
+				}
+			}
+		}
+		externalIPs, _, _ := unstructured.NestedStringSlice(svc.Object, "spec", "externalIPs")
+		g.Addresses = append(g.Addresses, externalIPs...)
+		ports, _, _ := unstructured.NestedSlice(svc.Object, "spec", "ports")
+		hasTunnelPort := false
+		for i := range ports {
+			if p, ok := ports[i].(map[string]interface{}); ok {
+				if port, ok := p["port"].(int64); ok {
+					g.Ports = append(g.Ports, port)
+					hasTunnelPort = hasTunnelPort || port == eastWestGatewayPort
+				}
+			}
+		}
+		g.Ready = len(g.Addresses) > 0 && hasTunnelPort
+		result = append(result, g)
+	}
+	return result, nil
+}
+
+// GetReachability 计算集群之间以及各服务端点的跨集群可达性
+func (h *Handler) GetReachability() iris.Handler {
+	return func(ctx *irisContext.Context) {
+		v, ok := h.loadView(ctx)
+		if !ok {
+			return
+		}
+		namespace := ctx.URLParam("namespace")
+		istioNamespace := ctx.URLParamDefault("istioNamespace", defaultIstioNamespace)
+		var (
+			remoteSecrets []RemoteSecret
+			gateways      []EastWestGateway
+		)
+		apiServers := make(map[string]string)
+		endpoints := make(map[string]map[string]int)
+		for _, mc := range v.mesh.Clusters {
+			if _, ok := v.caches[mc.Name]; !ok {
+				continue
+			}
+			if c, err := h.clusterService.Get(mc.Name, common.DBOptions{}); err == nil {
+				apiServers[mc.Name] = c.Spec.Connect.Forward.ApiServer
+			}
+			if mc.Role != v1Mesh.RoleRemote {
+				ss, err := h.remoteSecrets(v, mc.Name, istioNamespace)
+				if err != nil {
+					v.errors[mc.Name] = err.Error()
+				}
+				remoteSecrets = append(remoteSecrets, ss...)
+			}
+			gws, err := v.eastWestGateways(mc)
+			if err != nil {
+				v.errors[mc.Name] = err.Error()
+				continue
+			}
+			gateways = append(gateways, gws...)
+			counts, err := v.serviceEndpoints(mc.Name, namespace)
+			if err != nil {
+				v.errors[mc.Name] = err.Error()
+				continue
+			}
+			for host, n := range counts {
+				if endpoints[host] == nil {
+					endpoints[host] = make(map[string]int)
+				}
+				endpoints[host][mc.Name] = n
+			}
+		}
+		links := computeReachability(v.mesh, remoteSecrets, gateways, apiServers)
+		sort.Slice(links, func(i, j int) bool {
+			if links[i].From != links[j].From {
+				return links[i].From < links[j].From
+			}
+			return links[i].To < links[j].To
+		})
+		result := v.result(links)
+		result["hosts"] = reachableEndpoints(v.mesh, links, endpoints)
+		ctx.Values().Set("data", result)
+	}
+}
+
+// serviceEndpoints 统计每个服务在集群中就绪的 Pod 数量
+func (v *clusterView) serviceEndpoints(cluster, namespace string) (map[string]int, error) {
+	svcs, err := v.list(cluster, informer.Services, namespace)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := v.list(cluster, informer.Pods, namespace)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]int)
+	for _, svc := range svcs {
+		sel, ok, _ := unstructured.NestedStringMap(svc.Object, "spec", "selector")
+		if !ok || len(sel) == 0 {
+			continue
+		}
+		selector := labels.SelectorFromSet(sel)
+		count := 0
+		for _, pod := range pods {
+			if pod.GetNamespace() == svc.GetNamespace() && selector.Matches(labels.Set(pod.GetLabels())) && podReady(pod) {
+				count++
+			}
+		}
+		result[normalizeHost(svc.GetName(), svc.GetNamespace())] = count
+	}
+	return result, nil
+}
+
+func podReady(pod *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(pod.Object, "status", "conditions")
+	for i := range conditions {
+		if c, ok := conditions[i].(map[string]interface{}); ok && c["type"] == "Ready" {
+			return c["status"] == "True"
+		}
+	}
+	return false
+}
@@ -0,0 +1,301 @@
+package portforward
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/portforward"
+	"github.com/google/uuid"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+	authV1 "k8s.io/api/authorization/v1"
+)
+
+const (
+	defaultMaxLifetime = 60 * time.Minute
+	defaultIdleTimeout = 10 * time.Minute
+	defaultMaxPerUser  = 5
+	reapInterval       = 30 * time.Second
+)
+
+type Handler struct {
+	clusterService cluster.Service
+	forwards       *registry
+}
+
+func NewHandler() *Handler {
+	return &Handler{
+		clusterService: cluster.NewService(),
+		forwards:       newRegistry(),
+	}
+}
+
+type CreateRequest struct {
+	Namespace string `json:"namespace"`
+	// Pod 与 Service 二选一，Service 时转发到其后一个就绪的 Pod
+	Pod     string `json:"pod"`
+	Service string `json:"service"`
+	// Port 为 Pod 端口号，或 Service 的端口号、端口名
+	Port string `json:"port"`
+	// Lifetime 为转发的存活分钟数，不能超过配置的上限
+	Lifetime int `json:"lifetime"`
+}
+
+// limits 返回配置的转发限制，未配置的项使用默认值
+func limits() (maxLifetime, idleTimeout time.Duration, maxPerUser int) {
+	cfg := v1Config.PortForwardConfig{}
+	if c := server.Config(); c != nil {
+		cfg = c.Spec.PortForward
+	}
+	maxLifetime, idleTimeout, maxPerUser = defaultMaxLifetime, defaultIdleTimeout, defaultMaxPerUser
+	if cfg.MaxLifetime > 0 {
+		maxLifetime = time.Duration(cfg.MaxLifetime) * time.Minute
+	}
+	if cfg.IdleTimeout > 0 {
+		idleTimeout = time.Duration(cfg.IdleTimeout) * time.Minute
+	}
+	if cfg.MaxPerUser > 0 {
+		maxPerUser = cfg.MaxPerUser
+	}
+	return
+}
+
+func (h *Handler) CreatePortForward() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		var req CreateRequest
+		if err := ctx.ReadJSON(&req); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if req.Namespace == "" || (req.Pod == "") == (req.Service == "") {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", "namespace and one of pod or service are required")
+			return
+		}
+		maxLifetime, _, maxPerUser := limits()
+		lifetime := maxLifetime
+		if req.Lifetime > 0 && time.Duration(req.Lifetime)*time.Minute < maxLifetime {
+			lifetime = time.Duration(req.Lifetime) * time.Minute
+		}
+
+		c, err := h.clusterService.Get(clusterName, common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("get cluster failed: %s", err.Error()))
+			return
+		}
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		conf, client, err := commons.UserClient(c, profile)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+
+		podName := req.Pod
+		var port int
+		if req.Service != "" {
+			podName, port, err = portforward.ResolveService(client, req.Namespace, req.Service, req.Port)
+		} else if port, err = strconv.Atoi(req.Port); err == nil && (port <= 0 || port > 65535) {
+			err = fmt.Errorf("invalid port %d", port)
+		}
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		result, err := kubernetes.SelfHasPermission(client, authV1.ResourceAttributes{
+			Verb:        "create",
+			Resource:    "pods",
+			Subresource: "portforward",
+			Namespace:   req.Namespace,
+			Name:        podName,
+		})
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if !result.Allowed {
+			ctx.StatusCode(iris.StatusForbidden)
+			ctx.Values().Set("message", fmt.Sprintf("no permission to create pods/portforward %s in namespace %s", podName, req.Namespace))
+			return
+		}
+
+		tunnel, err := portforward.Open(client, conf, req.Namespace, podName, port)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		now := time.Now()
+		id := uuid.New().String()
+		f := &Forward{
+			ID:         id,
+			User:       profile.Name,
+			Cluster:    clusterName,
+			Namespace:  req.Namespace,
+			Pod:        podName,
+			Service:    req.Service,
+			Port:       port,
+			ProxyPath:  fmt.Sprintf("/kubepi/api/v1/portforward/%s/%s/proxy/", clusterName, id),
+			CreatedAt:  now,
+			ExpiresAt:  now.Add(lifetime),
+			LastActive: now,
+			tunnel:     tunnel,
+		}
+		data := *f
+		if err := h.forwards.add(f, maxPerUser); err != nil {
+			tunnel.Close()
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		go func() {
+			<-tunnel.Done()
+			if err := tunnel.Err(); err != nil {
+				server.Logger().Infof("port forward %s to %s/%s:%d stopped: %s", id, req.Namespace, podName, port, err.Error())
+			}
+			h.forwards.remove(id)
+		}()
+		server.Logger().Infof("user %s forwards %s/%s:%d in cluster %s until %s", profile.Name, req.Namespace, podName, port, clusterName, data.ExpiresAt.Format(time.RFC3339))
+		ctx.Values().Set("data", data)
+	}
+}
+
+// ListPortForwards 返回当前用户在集群中的转发，管理员可以看到所有用户的转发
+func (h *Handler) ListPortForwards() iris.Handler {
+	return func(ctx *context.Context) {
+		clusterName := ctx.Params().GetString("cluster")
+		profile := ctx.Values().Get("profile").(session.UserProfile)
+		user := profile.Name
+		if profile.IsAdministrator {
+			user = ""
+		}
+		ctx.Values().Set("data", h.forwards.list(clusterName, user))
+	}
+}
+
+// ownedForward 返回转发，不存在或不属于当前用户时写入错误；allowAdmin 时管理员可以操作其他用户的转发
+func (h *Handler) ownedForward(ctx *context.Context, allowAdmin bool) (Forward, bool) {
+	f, ok := h.forwards.get(ctx.Params().GetString("id"))
+	profile := ctx.Values().Get("profile").(session.UserProfile)
+	if !ok || f.Cluster != ctx.Params().GetString("cluster") || (f.User != profile.Name && !(allowAdmin && profile.IsAdministrator)) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.Values().Set("message", fmt.Sprintf("port forward %s not found", ctx.Params().GetString("id")))
+		return Forward{}, false
+	}
+	return f, true
+}
+
+func (h *Handler) DeletePortForward() iris.Handler {
+	return func(ctx *context.Context) {
+		f, ok := h.ownedForward(ctx, true)
+		if !ok {
+			return
+		}
+		h.forwards.remove(f.ID)
+	}
+}
+
+// ProxyPortForward 将请求反向代理到转发的本地端口，只有创建者可以访问；KubePi 自身的会话凭据不会传给被转发的服务。
+// 被转发的页面与 KubePi 同源，响应以沙箱方式加载，其中的脚本无法以当前用户的会话调用 KubePi 接口
+func (h *Handler) ProxyPortForward() iris.Handler {
+	return func(ctx *context.Context) {
+		f, ok := h.ownedForward(ctx, false)
+		if !ok {
+			return
+		}
+		done := h.forwards.begin(f.ID)
+		defer done()
+
+		target := &url.URL{Scheme: "http", Host: fmt.Sprintf("127.0.0.1:%d", f.tunnel.LocalPort)}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		director := proxy.Director
+		proxy.Director = func(r *http.Request) {
+			director(r)
+			r.URL.Path = "/" + ctx.Params().GetString("p")
+			r.URL.RawPath = ""
+			// 与 kubectl port-forward 一致，被转发的服务看到的是本机地址
+			r.Host = fmt.Sprintf("localhost:%d", f.Port)
+			r.Header.Del("Authorization")
+			r.Header.Set("X-Forwarded-Prefix", strings.TrimSuffix(f.ProxyPath, "/"))
+			removeCookie(r, server.SessionCookieName)
+		}
+		proxy.ModifyResponse = isolateResponse
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = w.Write([]byte(err.Error()))
+		}
+		proxy.ServeHTTP(ctx.ResponseWriter(), ctx.Request())
+	}
+}
+
+// isolateResponse 让浏览器在独立的匿名源中加载被转发的内容：禁止按内容猜测类型，非 GET 请求的响应只能下载，
+// 并且不允许被转发的服务覆盖 KubePi 的会话 Cookie
+func isolateResponse(resp *http.Response) error {
+	resp.Header.Set("Content-Security-Policy", "sandbox")
+	resp.Header.Set("X-Content-Type-Options", "nosniff")
+	if resp.Request != nil && resp.Request.Method != http.MethodGet && resp.Request.Method != http.MethodHead {
+		resp.Header.Set("Content-Disposition", "attachment")
+	}
+	cookies := resp.Header.Values("Set-Cookie")
+	resp.Header.Del("Set-Cookie")
+	for _, c := range cookies {
+		if !strings.HasPrefix(strings.TrimSpace(c), server.SessionCookieName+"=") {
+			resp.Header.Add("Set-Cookie", c)
+		}
+	}
+	return nil
+}
+
+func removeCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, c := range cookies {
+		if c.Name != name {
+			r.AddCookie(c)
+		}
+	}
+}
+
+func (h *Handler) reap() {
+	_, idleTimeout, _ := limits()
+	for _, id := range h.forwards.expired(time.Now(), idleTimeout) {
+		h.forwards.remove(id)
+	}
+}
+
+var reaper sync.Once
+
+func Install(parent iris.Party) {
+	handler := NewHandler()
+	reaper.Do(func() {
+		go func() {
+			for range time.Tick(reapInterval) {
+				handler.reap()
+			}
+		}()
+	})
+	sp := parent.Party("/portforward/:cluster")
+	sp.Post("/", handler.CreatePortForward())
+	sp.Get("/", handler.ListPortForwards())
+	sp.Delete("/:id", handler.DeletePortForward())
+	sp.Any("/:id/proxy", handler.ProxyPortForward())
+	sp.Any("/:id/proxy/{p:path}", handler.ProxyPortForward())
+}
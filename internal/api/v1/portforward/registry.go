@@ -0,0 +1,124 @@
+package portforward
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/KubeOperator/kubepi/pkg/portforward"
+)
+
+// Forward 为一个活动的端口转发，浏览器通过 ProxyPath 访问被转发的端口
+type Forward struct {
+	ID         string    `json:"id"`
+	User       string    `json:"user"`
+	Cluster    string    `json:"cluster"`
+	Namespace  string    `json:"namespace"`
+	Pod        string    `json:"pod"`
+	Service    string    `json:"service,omitempty"`
+	Port       int       `json:"port"`
+	ProxyPath  string    `json:"proxyPath"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastActive time.Time `json:"lastActive"`
+
+	tunnel *portforward.Tunnel
+	// active 为正在代理的请求数，websocket 连接在关闭前一直计入
+	active int
+}
+
+type registry struct {
+	lock     sync.Mutex
+	forwards map[string]*Forward
+}
+
+func newRegistry() *registry {
+	return &registry{forwards: map[string]*Forward{}}
+}
+
+// add 登记转发，超过单用户上限时返回错误，调用方负责关闭隧道
+func (r *registry) add(f *Forward, maxPerUser int) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	count := 0
+	for _, existing := range r.forwards {
+		if existing.User == f.User {
+			count++
+		}
+	}
+	if count >= maxPerUser {
+		return fmt.Errorf("user %s already has %d active port forwards", f.User, count)
+	}
+	r.forwards[f.ID] = f
+	return nil
+}
+
+// get 返回转发的副本
+func (r *registry) get(id string) (Forward, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	f, ok := r.forwards[id]
+	if !ok {
+		return Forward{}, false
+	}
+	return *f, true
+}
+
+// list 返回集群中的转发，user 为空时返回所有用户的转发
+func (r *registry) list(cluster, user string) []Forward {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := make([]Forward, 0)
+	for _, f := range r.forwards {
+		if f.Cluster == cluster && (user == "" || f.User == user) {
+			result = append(result, *f)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// remove 关闭隧道并删除转发
+func (r *registry) remove(id string) {
+	r.lock.Lock()
+	f, ok := r.forwards[id]
+	delete(r.forwards, id)
+	r.lock.Unlock()
+	if ok && f.tunnel != nil {
+		f.tunnel.Close()
+	}
+}
+
+// begin 记录一次代理请求的开始，返回的函数在请求结束时调用
+func (r *registry) begin(id string) func() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if f, ok := r.forwards[id]; ok {
+		f.active++
+		f.LastActive = time.Now()
+	}
+	return func() {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		if f, ok := r.forwards[id]; ok {
+			f.active--
+			f.LastActive = time.Now()
+		}
+	}
+}
+
+// expired 返回已到期或空闲超时的转发
+func (r *registry) expired(now time.Time, idleTimeout time.Duration) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var ids []string
+	for id, f := range r.forwards {
+		if now.After(f.ExpiresAt) || (f.active == 0 && now.Sub(f.LastActive) > idleTimeout) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
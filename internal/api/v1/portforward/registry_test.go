@@ -0,0 +1,41 @@
+package portforward
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistryLimits(t *testing.T) {
+	r := newRegistry()
+	now := time.Now()
+	for _, f := range []*Forward{
+		{ID: "a", User: "alice", Cluster: "c1", CreatedAt: now, ExpiresAt: now.Add(time.Hour), LastActive: now},
+		{ID: "b", User: "alice", Cluster: "c2", CreatedAt: now.Add(time.Second), ExpiresAt: now.Add(time.Minute), LastActive: now},
+		{ID: "c", User: "bob", Cluster: "c1", CreatedAt: now.Add(2 * time.Second), ExpiresAt: now.Add(time.Hour), LastActive: now.Add(-time.Hour)},
+	} {
+		if err := r.add(f, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.add(&Forward{ID: "d", User: "alice"}, 2); err == nil {
+		t.Error("third forward of alice should exceed the limit")
+	}
+	if got := r.list("c1", ""); len(got) != 2 || got[0].ID != "a" {
+		t.Errorf("unexpected list %v", got)
+	}
+	if got := r.list("c1", "alice"); len(got) != 1 {
+		t.Errorf("alice should only see her own forward, got %v", got)
+	}
+
+	// bob's forward is idle, but an open connection keeps it alive
+	done := r.begin("c")
+	r.forwards["c"].LastActive = now.Add(-time.Hour)
+	later := now.Add(2 * time.Minute)
+	if ids := r.expired(later, 10*time.Minute); len(ids) != 1 || ids[0] != "b" {
+		t.Errorf("only the expired forward should be reaped, got %v", ids)
+	}
+	done()
+	if ids := r.expired(later, 10*time.Minute); len(ids) != 1 || ids[0] != "b" {
+		t.Errorf("a just closed connection counts as activity, got %v", ids)
+	}
+}
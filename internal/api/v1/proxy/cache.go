@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/kataras/iris/v12/context"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// 这些查询参数由 KubePi 自身处理，其余参数（fieldSelector、limit、watch 等）需要直接访问 API Server
+var cacheableParams = map[string]struct{}{
+	"namespace":     {},
+	"search":        {},
+	"keywords":      {},
+	"pageNum":       {},
+	"pageSize":      {},
+	"labelSelector": {},
+}
+
+func isCacheableQuery(ctx *context.Context) bool {
+	for k := range ctx.Request().URL.Query() {
+		if _, ok := cacheableParams[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCachedListPath 解析形如 /api/v1/[namespaces/{ns}/]pods 的列表请求，只有共享缓存中维护的资源才会命中
+func parseCachedListPath(path string) (schema.GroupVersionResource, string, bool) {
+	ss := strings.Split(strings.Trim(path, "/"), "/")
+	var gvr schema.GroupVersionResource
+	var rest []string
+	switch {
+	case len(ss) >= 3 && ss[0] == "api":
+		gvr.Version = ss[1]
+		rest = ss[2:]
+	case len(ss) >= 4 && ss[0] == "apis":
+		gvr.Group = ss[1]
+		gvr.Version = ss[2]
+		rest = ss[3:]
+	default:
+		return gvr, "", false
+	}
+	namespace := ""
+	switch {
+	case len(rest) == 1:
+		gvr.Resource = rest[0]
+	case len(rest) == 3 && rest[0] == "namespaces":
+		namespace = rest[1]
+		gvr.Resource = rest[2]
+	default:
+		return gvr, "", false
+	}
+	if informer.ListKind(gvr) == "" {
+		return gvr, "", false
+	}
+	return gvr, namespace, true
+}
+
+func filterByLabelSelector(objs []*unstructured.Unstructured, selector string) ([]*unstructured.Unstructured, error) {
+	if selector == "" {
+		return objs, nil
+	}
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*unstructured.Unstructured, 0, len(objs))
+	for i := range objs {
+		if s.Matches(labels.Set(objs[i].GetLabels())) {
+			result = append(result, objs[i])
+		}
+	}
+	return result, nil
+}
+
+// listFromCache 读取缓存中的对象并转换为 K8sListObj，非管理员按 RBAC 过滤
+func listFromCache(cc *informer.ClusterCache, gvr schema.GroupVersionResource, namespace, labelSelector, username string, isAdministrator bool) (*K8sListObj, error) {
+	objs, err := cc.List(gvr, namespace)
+	if err != nil {
+		return nil, err
+	}
+	objs, err = filterByLabelSelector(objs, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdministrator {
+		objs, err = cc.FilterByAccess(username, gvr, objs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	items := make(ItemList, 0, len(objs))
+	for i := range objs {
+		items = append(items, objs[i].Object)
+	}
+	return &K8sListObj{
+		Kind:       informer.ListKind(gvr),
+		ApiVersion: gvr.GroupVersion().String(),
+		Metadata:   map[string]interface{}{"resourceVersion": cc.ResourceVersion(gvr)},
+		Items:      items,
+	}, nil
+}
@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/KubeOperator/kubepi/pkg/informer"
+)
+
+func TestParseCachedListPath(t *testing.T) {
+	cases := []struct {
+		path      string
+		ok        bool
+		resource  string
+		namespace string
+	}{
+		{path: "/api/v1/pods", ok: true, resource: "pods"},
+		{path: "/api/v1/namespaces/default/pods", ok: true, resource: "pods", namespace: "default"},
+		{path: "/api/v1/namespaces", ok: true, resource: "namespaces"},
+		{path: "/api/v1/namespaces/default", ok: false},
+		{path: "/api/v1/namespaces/default/pods/nginx", ok: false},
+		{path: "/api/v1/configmaps", ok: false},
+		{path: "/apis/networking.istio.io/v1beta1/namespaces/demo/virtualservices", ok: true, resource: "virtualservices", namespace: "demo"},
+		{path: "/apis/networking.istio.io/v1alpha3/virtualservices", ok: false},
+	}
+	for _, c := range cases {
+		gvr, ns, ok := parseCachedListPath(c.path)
+		if ok != c.ok {
+			t.Errorf("%s: expect ok=%v, got %v", c.path, c.ok, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if gvr.Resource != c.resource || ns != c.namespace {
+			t.Errorf("%s: expect %s in %q, got %s in %q", c.path, c.resource, c.namespace, gvr.Resource, ns)
+		}
+		if informer.ListKind(gvr) == "" {
+			t.Errorf("%s: %s should be cached", c.path, gvr.String())
+		}
+	}
+}
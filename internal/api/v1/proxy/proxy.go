@@ -19,6 +19,7 @@ import (
 	"github.com/KubeOperator/kubepi/internal/service/v1/clusterbinding"
 	"github.com/KubeOperator/kubepi/internal/service/v1/common"
 	pkgV1 "github.com/KubeOperator/kubepi/pkg/api/v1"
+	"github.com/KubeOperator/kubepi/pkg/informer"
 	"github.com/KubeOperator/kubepi/pkg/kubernetes"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
@@ -78,7 +79,14 @@ func (h *Handler) KubernetesAPIProxy() iris.Handler {
 		// 生成httpClient
 		httpClient := http.Client{Transport: ts}
 		k := kubernetes.NewKubernetes(c)
-		clusterVersionMinor, err := k.VersionMinor()
+		// 版本与资源作用域等发现信息从集群共享缓存读取，避免每次请求都访问 discovery 接口
+		cc, err := informer.Clusters.Get(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err)
+			return
+		}
+		clusterVersionMinor, err := cc.VersionMinor()
 		if err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.Values().Set("message", err)
@@ -95,7 +103,7 @@ func (h *Handler) KubernetesAPIProxy() iris.Handler {
 			return
 		}
 		// 判断资源类型是否是namespace级别的
-		namespaced, err := k.IsNamespacedResource(resourceName)
+		namespaced, err := cc.IsNamespacedResource(resourceName)
 		if err != nil {
 			ctx.StatusCode(iris.StatusInternalServerError)
 			ctx.Values().Set("message", err)
@@ -122,6 +130,29 @@ func (h *Handler) KubernetesAPIProxy() iris.Handler {
 			return
 		}
 		apiUrl.RawQuery = ctx.Request().URL.RawQuery
+		// 常用资源的列表请求直接由共享缓存返回
+		if http.MethodGet == requestMethod && isCacheableQuery(ctx) {
+			if gvr, ns, ok := parseCachedListPath(proxyPath); ok {
+				if ns == "" && informer.Namespaced(gvr) {
+					ns = namespace
+				}
+				klo, err := listFromCache(cc, gvr, ns, ctx.URLParam("labelSelector"), profile.Name, profile.IsAdministrator)
+				if err == nil {
+					if search || (ns == "" && namespaced && !canVisitAll) {
+						p, err := pagerAndSearch(ctx, *klo, keywords)
+						if err != nil {
+							ctx.StatusCode(iris.StatusInternalServerError)
+							ctx.Values().Set("message", err.Error())
+							return
+						}
+						_ = ctx.JSON(p)
+						return
+					}
+					_ = ctx.JSON(klo)
+					return
+				}
+			}
+		}
 		if http.MethodGet == requestMethod && namespace == "" && namespaced && !canVisitAll {
 			// 调用多namespace 逻辑
 			allowedNamespaces, err := k.GetUserNamespaceNames(profile.Name)
@@ -431,14 +462,14 @@ func (h *Handler) generateTLSTransport(c *v1Cluster.Cluster, profile session.Use
 	if err != nil {
 		return nil, err
 	}
-	kubeConf := &rest.Config{
-		Host: c.Spec.Connect.Forward.ApiServer,
-		TLSClientConfig: rest.TLSClientConfig{
-			Insecure: true,
-			CertData: binding.Certificate,
-			KeyData:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: c.PrivateKey}),
-		},
+	// 沿用集群配置的连接方式（如反向隧道），只替换认证信息
+	clusterConfig, err := kubernetes.NewKubernetes(c).Config()
+	if err != nil {
+		return nil, err
 	}
+	kubeConf := rest.AnonymousClientConfig(clusterConfig)
+	kubeConf.CertData = binding.Certificate
+	kubeConf.KeyData = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: c.PrivateKey})
 	return rest.TransportFor(kubeConf)
 }
 
@@ -0,0 +1,194 @@
+package recording
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/commons"
+	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
+	v1Terminal "github.com/KubeOperator/kubepi/internal/model/v1/terminal"
+	"github.com/KubeOperator/kubepi/internal/server"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	terminalService "github.com/KubeOperator/kubepi/internal/service/v1/terminal"
+	pkgV1 "github.com/KubeOperator/kubepi/pkg/api/v1"
+	"github.com/KubeOperator/kubepi/pkg/file"
+	"github.com/KubeOperator/kubepi/pkg/terminal"
+	"github.com/asdine/storm/v3"
+	"github.com/google/uuid"
+	"github.com/kataras/iris/v12"
+	"github.com/kataras/iris/v12/context"
+)
+
+const retentionInterval = time.Hour
+
+type Handler struct {
+	recordingService terminalService.Service
+}
+
+func NewHandler() *Handler {
+	return &Handler{
+		recordingService: terminalService.NewService(),
+	}
+}
+
+func recordingConfig() v1Config.RecordingConfig {
+	return server.Config().Spec.Terminal.Recording
+}
+
+// recordingDir 为录像目录，未配置时保存在数据目录下的 recordings 中
+func recordingDir(cfg v1Config.RecordingConfig) string {
+	if cfg.Path != "" {
+		return file.ReplaceHomeDir(cfg.Path)
+	}
+	return filepath.Join(file.ReplaceHomeDir(server.Config().Spec.DB.Path), "recordings")
+}
+
+// Start 在开启录制时创建录像文件与记录，会话结束时补全结束时间与原因；未开启或创建失败时返回 nil，不影响会话本身
+func Start(r *v1Terminal.Recording) *terminal.Recorder {
+	cfg := recordingConfig()
+	if !cfg.Enabled {
+		return nil
+	}
+	dir := recordingDir(cfg)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		server.Logger().Errorf("create recording dir %s failed: %s", dir, err.Error())
+		return nil
+	}
+	r.Name = uuid.New().String()
+	r.File = r.Name + ".cast"
+	r.StartTime = time.Now()
+	recorder, err := terminal.NewRecorder(filepath.Join(dir, r.File), title(r), cfg.RecordInput)
+	if err != nil {
+		server.Logger().Errorf("create recording %s failed: %s", r.File, err.Error())
+		return nil
+	}
+	service := terminalService.NewService()
+	if err := service.Create(r, common.DBOptions{}); err != nil {
+		server.Logger().Errorf("save recording %s failed: %s", r.Name, err.Error())
+	}
+	recorder.OnClose(func(reason string, size int64) {
+		r.EndTime = time.Now()
+		r.ExitReason = reason
+		r.Size = size
+		if err := service.Update(r, common.DBOptions{}); err != nil {
+			server.Logger().Errorf("update recording %s failed: %s", r.Name, err.Error())
+		}
+	})
+	return recorder
+}
+
+func title(r *v1Terminal.Recording) string {
+	target := r.Node
+	if r.Pod != "" {
+		target = strings.TrimSuffix(fmt.Sprintf("%s/%s/%s", r.Namespace, r.Pod, r.Container), "/")
+	}
+	if target == "" {
+		return fmt.Sprintf("%s@%s", r.User, r.Cluster)
+	}
+	return fmt.Sprintf("%s@%s %s", r.User, r.Cluster, target)
+}
+
+// SearchRecordings 按条件分页查询录像，可按 user、pod、cluster 等字段过滤
+func (h *Handler) SearchRecordings() iris.Handler {
+	return func(ctx *context.Context) {
+		pageNum, _ := ctx.Values().GetInt(pkgV1.PageNum)
+		pageSize, _ := ctx.Values().GetInt(pkgV1.PageSize)
+
+		var conditions commons.SearchConditions
+		if err := ctx.ReadJSON(&conditions); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		recordings, total, err := h.recordingService.Search(pageNum, pageSize, conditions.Conditions, common.DBOptions{})
+		if err != nil && !errors.Is(err, storm.ErrNotFound) {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", pkgV1.Page{Items: recordings, Total: total})
+	}
+}
+
+func (h *Handler) GetRecording() iris.Handler {
+	return func(ctx *context.Context) {
+		r, err := h.recordingService.Get(ctx.Params().GetString("name"), common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		ctx.Values().Set("data", r)
+	}
+}
+
+// ReplayRecording 返回 asciicast 文件，可直接交给 asciinema-player 播放；进行中的会话返回已录制的部分
+func (h *Handler) ReplayRecording() iris.Handler {
+	return func(ctx *context.Context) {
+		r, err := h.recordingService.Get(ctx.Params().GetString("name"), common.DBOptions{})
+		if err != nil {
+			ctx.StatusCode(iris.StatusNotFound)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		data, err := os.ReadFile(filepath.Join(recordingDir(recordingConfig()), filepath.Base(r.File)))
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", fmt.Sprintf("read recording failed: %s", err.Error()))
+			return
+		}
+		ctx.Header("Content-Type", server.ContentTypeDownload)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment;filename=%s", r.File))
+		_, _ = ctx.Write(data)
+	}
+}
+
+func (h *Handler) remove(name string) error {
+	r, err := h.recordingService.Get(name, common.DBOptions{})
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(recordingDir(recordingConfig()), filepath.Base(r.File))
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return h.recordingService.Delete(name, common.DBOptions{})
+}
+
+// cleanup 定时删除超过保留天数的录像
+func (h *Handler) cleanup() {
+	for range time.Tick(retentionInterval) {
+		days := recordingConfig().RetentionDays
+		if days <= 0 {
+			continue
+		}
+		expired, err := h.recordingService.ListStartedBefore(time.Now().AddDate(0, 0, -days), common.DBOptions{})
+		if err != nil && !errors.Is(err, storm.ErrNotFound) {
+			server.Logger().Errorf("list expired recordings failed: %s", err.Error())
+			continue
+		}
+		for i := range expired {
+			if err := h.remove(expired[i].Name); err != nil {
+				server.Logger().Errorf("delete recording %s failed: %s", expired[i].Name, err.Error())
+			}
+		}
+	}
+}
+
+var retention sync.Once
+
+func Install(parent iris.Party) {
+	handler := NewHandler()
+	retention.Do(func() {
+		go handler.cleanup()
+	})
+	sp := parent.Party("/systems/recordings")
+	sp.Post("/search", handler.SearchRecordings())
+	sp.Get("/:name", handler.GetRecording())
+	sp.Get("/:name/cast", handler.ReplayRecording())
+}
@@ -16,12 +16,17 @@ import (
 	"github.com/KubeOperator/kubepi/internal/api/v1/file"
 	"github.com/kataras/iris/v12/middleware/jwt"
 
+	"github.com/KubeOperator/kubepi/internal/api/v1/agent"
 	"github.com/KubeOperator/kubepi/internal/api/v1/chart"
 	"github.com/KubeOperator/kubepi/internal/api/v1/cluster"
+	"github.com/KubeOperator/kubepi/internal/api/v1/gitops"
 	"github.com/KubeOperator/kubepi/internal/api/v1/imagerepo"
 	"github.com/KubeOperator/kubepi/internal/api/v1/istio"
 	"github.com/KubeOperator/kubepi/internal/api/v1/ldap"
+	"github.com/KubeOperator/kubepi/internal/api/v1/mesh"
+	"github.com/KubeOperator/kubepi/internal/api/v1/portforward"
 	"github.com/KubeOperator/kubepi/internal/api/v1/proxy"
+	"github.com/KubeOperator/kubepi/internal/api/v1/recording"
 	"github.com/KubeOperator/kubepi/internal/api/v1/role"
 	"github.com/KubeOperator/kubepi/internal/api/v1/session"
 	"github.com/KubeOperator/kubepi/internal/api/v1/system"
@@ -138,6 +143,11 @@ func logHandler() iris.Handler {
 			ctx.Next()
 			return
 		}
+		// 端口转发的代理请求属于被转发的服务，不记录为 KubePi 的操作，也不读取请求体
+		if strings.HasPrefix(currentPath, "portforward/") && strings.Contains(currentPath, "/proxy") {
+			ctx.Next()
+			return
+		}
 
 		u := ctx.Values().Get("profile")
 		profile := u.(session.UserProfile)
@@ -428,6 +438,7 @@ func AddV1Route(app iris.Party) {
 	session.Install(v1Party)
 	mfa.Install(v1Party)
 	sso.Install(v1Party)
+	agent.Install(v1Party)
 	v1Party.Use(langHandler())
 	v1Party.Use(pageHandler())
 
@@ -444,6 +455,7 @@ func AddV1Route(app iris.Party) {
 	cluster.Install(authParty)
 	role.Install(authParty)
 	system.Install(authParty)
+	recording.Install(authParty)
 	proxy.Install(authParty)
 	ws.Install(authParty)
 	chart.Install(authParty)
@@ -451,5 +463,8 @@ func AddV1Route(app iris.Party) {
 	ldap.Install(authParty)
 	imagerepo.Install(authParty)
 	istio.Install(authParty)
+	portforward.Install(authParty)
+	mesh.Install(authParty)
+	gitops.Install(authParty, v1Party)
 	file.Install(authParty)
 }
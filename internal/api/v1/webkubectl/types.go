@@ -6,6 +6,8 @@ type Session struct {
 	User    string
 	config  *rest.Config
 	Cluster string `json:"cluster"`
+	// proxyURL 为 kubeconfig 中的 proxy-url，kubectl 无法使用 rest.Config 中的 Proxy 函数
+	proxyURL string
 }
 
 type SessionResponse struct {
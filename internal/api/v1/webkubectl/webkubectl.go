@@ -3,11 +3,21 @@ package webkubectl
 import (
 	"encoding/pem"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
+
+	"github.com/KubeOperator/kubepi/internal/api/v1/recording"
 	"github.com/KubeOperator/kubepi/internal/api/v1/session"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	v1Terminal "github.com/KubeOperator/kubepi/internal/model/v1/terminal"
+	"github.com/KubeOperator/kubepi/internal/server"
 	"github.com/KubeOperator/kubepi/internal/service/v1/cluster"
 	"github.com/KubeOperator/kubepi/internal/service/v1/clusterbinding"
 	"github.com/KubeOperator/kubepi/internal/service/v1/common"
 	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"github.com/KubeOperator/kubepi/pkg/terminal"
+	"github.com/KubeOperator/kubepi/pkg/tunnel"
 	"github.com/google/uuid"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
@@ -19,6 +29,8 @@ type Handler struct {
 	clusterBindingService clusterbinding.Service
 	clusterService        cluster.Service
 	sessionCache          *TerminalSessions
+	// recordingOwners 记录 token 对应的用户与集群，gotty 连接建立时取出用于会话录制
+	recordingOwners *TerminalSessions
 }
 
 func NewHandler() *Handler {
@@ -26,6 +38,7 @@ func NewHandler() *Handler {
 		clusterBindingService: clusterbinding.NewService(),
 		clusterService:        cluster.NewService(),
 		sessionCache:          NewTerminalSessions(),
+		recordingOwners:       NewTerminalSessions(),
 	}
 }
 
@@ -67,6 +80,7 @@ func toCmdConfig(sess *Session) *clientcmdapi.Config {
 	cc.Clusters[sess.Cluster] = &clientcmdapi.Cluster{
 		Server:                sess.config.Host,
 		InsecureSkipTLSVerify: true,
+		ProxyURL:              sess.proxyURL,
 	}
 	cc.AuthInfos[sess.User] = &clientcmdapi.AuthInfo{
 		ClientCertificateData: sess.config.CertData,
@@ -116,16 +130,66 @@ func (h *Handler) CreateSession() iris.Handler {
 			cfg.CertData = rb.Certificate
 			cfg.KeyData =pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: c.PrivateKey})
 		}
+		if c.Spec.Connect.Direction == v1Cluster.ConnectDirectionReverse {
+			// kubectl 运行在独立进程中，经本地端口转入 agent 的隧道
+			apiServer, err := url.Parse(cfg.Host)
+			if err != nil {
+				ctx.StatusCode(iris.StatusInternalServerError)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			target := apiServer.Host
+			if apiServer.Port() == "" {
+				target = net.JoinHostPort(apiServer.Hostname(), "443")
+			}
+			addr, err := tunnel.Tunnels.Listen(c.Name, c.Spec.Connect.Reverse.Token, target)
+			if err != nil {
+				ctx.StatusCode(iris.StatusInternalServerError)
+				ctx.Values().Set("message", err.Error())
+				return
+			}
+			cfg.Host = "https://" + addr
+		}
+		proxyURL, err := kubernetes.ProxyURL(c)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.Values().Set("message", err.Error())
+			return
+		}
+		if proxyURL != nil {
+			// kubeconfig 对终端内的用户可见，不写入代理的用户名和密码，需要认证的代理在 webkubectl 中不可用
+			proxyURL.User = nil
+			sess.proxyURL = proxyURL.String()
+		}
 		sess.config = cfg
 		sess.User = profile.Name
 		sessionId := uuid.New().String()
 		h.sessionCache.Put(sessionId, &sess)
+		h.recordingOwners.Put(sessionId, &sess)
 		ctx.Values().Set("data", &SessionResponse{Token: sessionId})
 	}
 }
 
+// recordConn 从 gotty 初始化消息的 Arguments 中取出 token，找到会话所属用户后开始录制
+func (h *Handler) recordConn(conn io.ReadWriteCloser) io.ReadWriteCloser {
+	return terminal.TapGotty(conn, func(arguments url.Values) *terminal.Recorder {
+		token := arguments.Get("token")
+		sess := h.recordingOwners.Get(token)
+		if sess == nil {
+			return nil
+		}
+		h.recordingOwners.Delete(token)
+		return recording.Start(&v1Terminal.Recording{
+			Type:    v1Terminal.RecordingTypeWebkubectl,
+			User:    sess.User,
+			Cluster: sess.Cluster,
+		})
+	})
+}
+
 func Install(authParent, noAuthParty iris.Party) {
 	handler := NewHandler()
+	server.WebkubectlConnHook = handler.recordConn
 	authParent.Post("/webkubectl/session", handler.CreateSession())
 	noAuthParty.Get("/webkubectl/session", handler.GetConfigFile())
 }
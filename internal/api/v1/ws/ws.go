@@ -3,6 +3,7 @@ package ws
 import (
 	"github.com/KubeOperator/kubepi/pkg/logging"
 	"github.com/KubeOperator/kubepi/pkg/terminal"
+	"github.com/KubeOperator/kubepi/pkg/watch"
 	"github.com/kataras/iris/v12"
 	"github.com/kataras/iris/v12/context"
 )
@@ -17,4 +18,8 @@ func Install(parent iris.Party) {
 	wsParty.Any("/logging/sockjs/{p:path}", func(ctx *context.Context) {
 		l.ServeHTTP(ctx.ResponseWriter(), ctx.Request())
 	})
+	w := watch.CreateWatchHandler("/watch/sockjs")
+	wsParty.Any("/watch/sockjs/{p:path}", func(ctx *context.Context) {
+		w.ServeHTTP(ctx.ResponseWriter(), ctx.Request())
+	})
 }
@@ -1,11 +1,34 @@
 package cluster
 
-import v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+import (
+	"time"
+
+	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+)
+
+const (
+	CertificatePhaseValid    = "Valid"
+	CertificatePhaseExpiring = "Expiring"
+	CertificatePhaseExpired  = "Expired"
+	// CertificatePhaseUntrusted 为证书不是由集群当前的 CA 签发，通常是集群轮换了 CA
+	CertificatePhaseUntrusted = "UntrustedCA"
+	CertificatePhaseInvalid   = "Invalid"
+)
 
 type Binding struct {
-	v1.BaseModel `storm:"inline"`
-	v1.Metadata  `storm:"inline"`
-	UserRef      string `json:"UserRef" storm:"inline"`
-	ClusterRef   string `json:"clusterRef" storm:"index"`
-	Certificate  []byte `json:"certificate"`
+	v1.BaseModel      `storm:"inline"`
+	v1.Metadata       `storm:"inline"`
+	UserRef           string            `json:"UserRef" storm:"inline"`
+	ClusterRef        string            `json:"clusterRef" storm:"index"`
+	Certificate       []byte            `json:"certificate"`
+	CertificateStatus CertificateStatus `json:"certificateStatus" storm:"inline"`
+}
+
+// CertificateStatus 为后台任务最近一次检查成员证书的结果
+type CertificateStatus struct {
+	Phase     string    `json:"phase"`
+	NotAfter  time.Time `json:"notAfter"`
+	Message   string    `json:"message"`
+	CheckedAt time.Time `json:"checkedAt"`
+	RenewedAt time.Time `json:"renewedAt"`
 }
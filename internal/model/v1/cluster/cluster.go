@@ -2,6 +2,7 @@ package cluster
 
 import (
 	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+	corev1 "k8s.io/api/core/v1"
 )
 
 type Cluster struct {
@@ -9,7 +10,7 @@ type Cluster struct {
 	v1.Metadata   `storm:"inline"`
 	CaCertificate Certificate `json:"caCertificate" storm:"inline"`
 	Spec          Spec        `json:"spec" storm:"inline"`
-	PrivateKey    []byte      `json:"privateKey"`
+	PrivateKey    []byte      `json:"privateKey" secret:"true"`
 	Status        Status      `json:"status" storm:"inline"`
 	Labels        []string    `json:"labels"`
 }
@@ -18,11 +19,44 @@ type Spec struct {
 	Connect        Connect        `json:"connect" storm:"inline"`
 	Authentication Authentication `json:"authentication" storm:"inline"`
 	Local          bool           `json:"local"`
+	Prometheus     Prometheus     `json:"prometheus" storm:"inline"`
+	NodeShell      NodeShell      `json:"nodeShell" storm:"inline"`
 }
 
+// Prometheus 为集群可选的监控地址，用于读取 Istio 标准指标
+type Prometheus struct {
+	URL                string `json:"url"`
+	BearerToken        string `json:"bearerToken" secret:"true"`
+	Username           string `json:"username"`
+	Password           string `json:"password" secret:"true"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+}
+
+// NodeShell 为节点终端创建的调试 Pod 配置，字段为空时使用默认值
+type NodeShell struct {
+	Image       string                      `json:"image"`
+	Namespace   string                      `json:"namespace"`
+	Tolerations []corev1.Toleration         `json:"tolerations"`
+	Resources   corev1.ResourceRequirements `json:"resources"`
+	// IdleTimeout 为无输入后自动关闭的分钟数，0 表示使用默认值
+	IdleTimeout int `json:"idleTimeout"`
+}
+
+const (
+	ConnectDirectionForward = "forward"
+	// ConnectDirectionReverse 为集群内的 agent 主动连接 KubePi，KubePi 经 agent 建立的隧道访问 ApiServer
+	ConnectDirectionReverse = "reverse"
+)
+
 type Connect struct {
 	Direction string  `json:"direction"`
 	Forward   Forward `json:"forward" storm:"inline"`
+	Reverse   Reverse `json:"reverse" storm:"inline"`
+}
+
+// Reverse 为反向连接的配置，agent 以 Token 认证，ApiServer 仍填写 agent 所在集群内的地址
+type Reverse struct {
+	Token string `json:"token" secret:"true"`
 }
 
 type Forward struct {
@@ -30,21 +64,23 @@ type Forward struct {
 	Proxy     Proxy  `json:"proxy"   storm:"inline"`
 }
 
+// Proxy 为访问 ApiServer 与 Prometheus 使用的代理。webkubectl 的 kubeconfig 对用户可见，不包含代理的用户名和密码，
+// 因此需要认证的代理在 webkubectl 中不可用
 type Proxy struct {
 	URL      string `json:"url"`
 	Username string `json:"username"`
-	Password string `json:"password"`
+	Password string `json:"password" secret:"true"`
 }
 
 type Authentication struct {
 	Mode              string      `json:"mode"`
-	BearerToken       string      `json:"bearerToken"`
+	BearerToken       string      `json:"bearerToken" secret:"true"`
 	Certificate       Certificate `json:"certificate" storm:"inline"`
-	ConfigFileContent []byte      `json:"configFileContent"`
+	ConfigFileContent []byte      `json:"configFileContent" secret:"true"`
 }
 
 type Certificate struct {
-	KeyData  []byte `json:"keyData"`
+	KeyData  []byte `json:"keyData" secret:"true"`
 	CertData []byte `json:"certData"`
 }
 
@@ -8,12 +8,16 @@ type Config struct {
 	Spec Spec `json:"spec"`
 }
 type Spec struct {
-	Server  ServerConfig  `json:"server"`
-	DB      DBConfig      `json:"db"`
-	Session SessionConfig `json:"session"`
-	Logger  LoggerConfig  `json:"logger"`
-	Jwt     JwtConfig     `json:"jwt"`
-	AppId   string        `json:"appId"`
+	Server      ServerConfig      `json:"server"`
+	DB          DBConfig          `json:"db"`
+	Session     SessionConfig     `json:"session"`
+	Logger      LoggerConfig      `json:"logger"`
+	Jwt         JwtConfig         `json:"jwt"`
+	AppId       string            `json:"appId"`
+	Terminal    TerminalConfig    `json:"terminal"`
+	PortForward PortForwardConfig `json:"portForward"`
+	Encryption  EncryptionConfig  `json:"encryption"`
+	GitOps      GitOpsConfig      `json:"gitops"`
 }
 
 type ServerConfig struct {
@@ -47,3 +51,36 @@ type SessionConfig struct {
 type JwtConfig struct {
 	Key string `json:"key"`
 }
+
+type TerminalConfig struct {
+	Recording RecordingConfig `json:"recording"`
+}
+
+// RecordingConfig 终端会话录制，录像以 asciicast v2 格式保存在 Path 目录下
+type RecordingConfig struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path"`
+	// RetentionDays 为录像保留天数，0 表示不清理
+	RetentionDays int `json:"retentionDays"`
+	// RecordInput 同时记录用户输入，输入中可能包含密码
+	RecordInput bool `json:"recordInput"`
+}
+
+// PortForwardConfig 限制端口转发会话，时间单位为分钟，0 表示使用默认值
+type PortForwardConfig struct {
+	MaxLifetime int `json:"maxLifetime"`
+	IdleTimeout int `json:"idleTimeout"`
+	MaxPerUser  int `json:"maxPerUser"`
+}
+
+// EncryptionConfig 为数据库中敏感字段的加密主密钥，Key 为 base64 编码的 32 字节密钥，优先于 KeyFile；
+// 都未配置时使用数据库目录下的 secret.key，不存在则自动生成
+type EncryptionConfig struct {
+	Key     string `json:"key"`
+	KeyFile string `json:"keyFile"`
+}
+
+// GitOpsConfig 为 GitOps 仓库的限制，AllowFileURL 允许使用 KubePi 所在主机上的 file:// 仓库，仅用于离线环境
+type GitOpsConfig struct {
+	AllowFileURL bool `json:"allowFileUrl"`
+}
@@ -0,0 +1,39 @@
+package gitops
+
+import (
+	"time"
+
+	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+	"github.com/KubeOperator/kubepi/pkg/gitops"
+)
+
+const (
+	PhaseSynced    = "Synced"
+	PhaseOutOfSync = "OutOfSync"
+	PhaseApplied   = "Applied"
+	PhaseFailed    = "Failed"
+)
+
+// Repository 将集群绑定到 Git 仓库中的一个目录
+type Repository struct {
+	v1.BaseModel `storm:"inline"`
+	v1.Metadata  `storm:"inline"`
+	ClusterRef   string `json:"clusterRef" storm:"index"`
+	URL          string `json:"url"`
+	Branch       string `json:"branch"`
+	Path         string `json:"path"`
+	// Interval 为定时同步的间隔（秒），0 表示只在手动或 webhook 触发时同步
+	Interval  int  `json:"interval"`
+	AutoApply bool `json:"autoApply"`
+	// WebhookToken 用于校验 webhook 请求，创建时自动生成
+	WebhookToken string     `json:"webhookToken,omitempty" secret:"true"`
+	Status       SyncStatus `json:"status"`
+}
+
+type SyncStatus struct {
+	Phase      string         `json:"phase"`
+	Revision   string         `json:"revision"`
+	LastSyncAt time.Time      `json:"lastSyncAt"`
+	Message    string         `json:"message"`
+	Drifts     []gitops.Drift `json:"drifts"`
+}
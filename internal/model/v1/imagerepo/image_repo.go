@@ -17,7 +17,7 @@ type ImageRepo struct {
 
 type Credential struct {
 	Username string `json:"username"`
-	Password string `json:"password"`
+	Password string `json:"password" secret:"true"`
 }
 
 type RepoResponse struct {
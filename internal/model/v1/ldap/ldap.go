@@ -9,7 +9,7 @@ type Ldap struct {
 	v1.BaseModel `storm:"inline"`
 	v1.Metadata  `storm:"inline"`
 	Username     string `json:"username"`
-	Password     string `json:"password"`
+	Password     string `json:"password" secret:"true"`
 	Address      string `json:"address"`
 	Port         string `json:"port"`
 	Dn           string `json:"dn"`
@@ -0,0 +1,33 @@
+package mesh
+
+import v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+
+const (
+	RolePrimary = "primary"
+	RoleRemote  = "remote"
+)
+
+type Mesh struct {
+	v1.BaseModel `storm:"inline"`
+	v1.Metadata  `storm:"inline"`
+	MeshID       string    `json:"meshId"`
+	Clusters     []Cluster `json:"clusters"`
+}
+
+type Cluster struct {
+	// Name 为 KubePi 中注册的集群名称
+	Name string `json:"name"`
+	// ClusterID 为 Istio 中的集群名称，默认与 Name 相同
+	ClusterID string `json:"clusterId"`
+	Role      string `json:"role"`
+	Network   string `json:"network"`
+	// Primary 为 remote 集群所使用的控制面集群
+	Primary string `json:"primary"`
+}
+
+func (c Cluster) IstioClusterID() string {
+	if c.ClusterID != "" {
+		return c.ClusterID
+	}
+	return c.Name
+}
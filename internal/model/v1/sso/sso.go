@@ -14,8 +14,8 @@ type Sso struct {
 	Protocol         string `json:"protocol"`
 	InterfaceAddress string `json:"interfaceAddress"`
 	ClientId         string `json:"clientId"`
-	ClientSecret     string `json:"clientSecret"`
-	X509Key          string `json:"x509Key"`
+	ClientSecret     string `json:"clientSecret" secret:"true"`
+	X509Key          string `json:"x509Key" secret:"true"`
 	X509Cert         string `json:"x509Cert"`
 	IdpMetadataURL   string `json:"idpMetadataURL"`
 }
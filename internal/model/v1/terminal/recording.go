@@ -0,0 +1,32 @@
+package terminal
+
+import (
+	"time"
+
+	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+)
+
+const (
+	RecordingTypeExec       = "exec"
+	RecordingTypeNode       = "node"
+	RecordingTypeDebug      = "debug"
+	RecordingTypeWebkubectl = "webkubectl"
+)
+
+// Recording 为一次终端会话的录像信息，录像内容保存在 File 指向的 asciicast 文件中
+type Recording struct {
+	v1.BaseModel `storm:"inline"`
+	v1.Metadata  `storm:"inline"`
+	Type         string    `json:"type"`
+	User         string    `json:"user" storm:"index"`
+	Cluster      string    `json:"cluster" storm:"index"`
+	Namespace    string    `json:"namespace"`
+	Pod          string    `json:"pod" storm:"index"`
+	Container    string    `json:"container"`
+	Node         string    `json:"node"`
+	StartTime    time.Time `json:"startTime" storm:"index"`
+	EndTime      time.Time `json:"endTime"`
+	ExitReason   string    `json:"exitReason"`
+	File         string    `json:"file"`
+	Size         int64     `json:"size"`
+}
@@ -21,7 +21,7 @@ type Authenticate struct {
 
 type Mfa struct {
 	Enable bool   `json:"enable"`
-	Secret string `json:"secret"`
+	Secret string `json:"secret" secret:"true"`
 }
 
 const (
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/KubeOperator/kubepi/internal/config"
+	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
+	v1Migrate "github.com/KubeOperator/kubepi/migrate/v1"
+	"github.com/KubeOperator/kubepi/pkg/file"
+	"github.com/KubeOperator/kubepi/pkg/secret"
+	"github.com/asdine/storm/v3"
+	"github.com/coreos/etcd/pkg/fileutil"
+	bolt "go.etcd.io/bbolt"
+)
+
+const defaultKeyFileName = "secret.key"
+
+// loadEncryptionKey 读取主密钥，keyFile 为密钥所在文件，密钥直接写在配置中时为空。
+// create 为 true 时自动生成不存在的密钥文件
+func loadEncryptionKey(c v1Config.EncryptionConfig, dbDir string, create bool) (key *secret.Key, keyFile string, err error) {
+	if c.Key != "" {
+		key, err = secret.ParseKey(c.Key)
+		return key, "", err
+	}
+	keyFile = path.Join(dbDir, defaultKeyFileName)
+	if c.KeyFile != "" {
+		keyFile = file.ReplaceHomeDir(c.KeyFile)
+	}
+	if !fileutil.Exist(keyFile) && create {
+		key, err = secret.WriteKeyFile(keyFile)
+		if err == nil {
+			fmt.Printf("generated encryption key %s in %s, back it up together with the database\n", key.ID, keyFile)
+		}
+		return key, keyFile, err
+	}
+	key, err = secret.LoadKeyFile(keyFile)
+	return key, keyFile, err
+}
+
+// RotateEncryptionKey 以新密钥重新加密数据库中的敏感字段，需要先停止 KubePi。
+// newKeyFile 不存在时生成新密钥；为空时在当前密钥文件旁生成 <keyFile>.new，完成后替换当前密钥文件，旧密钥保留为 <keyFile>.<旧密钥 ID>
+func RotateEncryptionKey(configPath, newKeyFile string) error {
+	c := getDefaultConfig()
+	if err := config.ReadConfig(c, configPath); err != nil {
+		return err
+	}
+	dbDir := file.ReplaceHomeDir(c.Spec.DB.Path)
+	dbFile := path.Join(dbDir, "kubepi.db")
+	if !fileutil.Exist(dbFile) {
+		return fmt.Errorf("database %s not found", dbFile)
+	}
+	oldKey, keyFile, err := loadEncryptionKey(c.Spec.Encryption, dbDir, false)
+	if err != nil {
+		return fmt.Errorf("can not load the current encryption key: %w", err)
+	}
+	replace := false
+	if newKeyFile == "" {
+		if keyFile == "" {
+			return errors.New("the encryption key is set in the config file, a new key file is required")
+		}
+		newKeyFile = keyFile + ".new"
+		replace = true
+	}
+	var newKey *secret.Key
+	if fileutil.Exist(newKeyFile) {
+		newKey, err = secret.LoadKeyFile(newKeyFile)
+	} else {
+		newKey, err = secret.WriteKeyFile(newKeyFile)
+	}
+	if err != nil {
+		return err
+	}
+	if newKey.ID == oldKey.ID {
+		return errors.New("the new encryption key is the current one")
+	}
+
+	d, err := storm.Open(dbFile,
+		storm.BoltOptions(0600, &bolt.Options{Timeout: time.Second}),
+		storm.Codec(secret.NewCodec(secret.NewKeyring(newKey, oldKey))))
+	if err != nil {
+		return fmt.Errorf("can not open database %s, stop KubePi first: %w", dbFile, err)
+	}
+	tx, err := d.Begin(true)
+	if err != nil {
+		_ = d.Close()
+		return err
+	}
+	if err := v1Migrate.EncryptSecrets(tx); err != nil {
+		_ = tx.Rollback()
+		_ = d.Close()
+		return fmt.Errorf("re-encrypt secrets failed, nothing changed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		_ = d.Close()
+		return err
+	}
+	_ = d.Close()
+	fmt.Printf("secrets are re-encrypted with key %s\n", newKey.ID)
+	if err := compactDB(dbFile); err != nil {
+		fmt.Printf("compact database failed, values encrypted with the old key may remain in free pages: %s\n", err.Error())
+	}
+	if !replace {
+		fmt.Printf("point spec.encryption.keyFile to %s and remove spec.encryption.key before starting KubePi, keep the old key as long as backups use it\n", newKeyFile)
+		return nil
+	}
+	oldKeyFile := keyFile + "." + oldKey.ID
+	if err := os.Rename(keyFile, oldKeyFile); err != nil {
+		return fmt.Errorf("move the old key aside failed, replace %s with %s by hand: %w", keyFile, newKeyFile, err)
+	}
+	if err := os.Rename(newKeyFile, keyFile); err != nil {
+		return fmt.Errorf("replace the key failed, move %s to %s by hand: %w", newKeyFile, keyFile, err)
+	}
+	fmt.Printf("%s now holds the new key, the old key is kept in %s for existing backups\n", keyFile, oldKeyFile)
+	return nil
+}
+
+// compactDB 将数据库复制到新文件并替换原文件。bolt 不会清空释放的页，加密或更换密钥后旧的内容仍留在文件中
+func compactDB(dbFile string) error {
+	src, err := bolt.Open(dbFile, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp := dbFile + ".compact"
+	_ = os.Remove(tmp)
+	dst, err := bolt.Open(tmp, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return err
+	}
+	if err := bolt.Compact(dst, src, 64<<20); err != nil {
+		_ = dst.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dbFile)
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"embed"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -20,8 +21,10 @@ import (
 	"github.com/KubeOperator/kubepi/internal/config"
 	v1Config "github.com/KubeOperator/kubepi/internal/model/v1/config"
 	"github.com/KubeOperator/kubepi/migrate"
+	v1Migrate "github.com/KubeOperator/kubepi/migrate/v1"
 	"github.com/KubeOperator/kubepi/pkg/file"
 	"github.com/KubeOperator/kubepi/pkg/i18n"
+	"github.com/KubeOperator/kubepi/pkg/secret"
 	"github.com/asdine/storm/v3"
 	"github.com/coreos/etcd/pkg/fileutil"
 	"github.com/kataras/iris/v12"
@@ -40,6 +43,9 @@ var EmbedWebDashboard embed.FS
 var EmbedWebTerminal embed.FS
 var WebkubectlEntrypoint string
 
+// WebkubectlConnHook 在 webkubectl 的 websocket 建立后包装到 gotty 的连接，用于会话录制
+var WebkubectlConnHook func(conn io.ReadWriteCloser) io.ReadWriteCloser
+
 type Option func(server *KubePiServer)
 
 func WithServerBindHost(host string) Option {
@@ -116,7 +122,11 @@ func (e *KubePiServer) setUpDB() {
 			panic(fmt.Errorf("can not create database dir: %s message: %s", e.config.Spec.DB.Path, err))
 		}
 	}
-	d, err := storm.Open(path.Join(realDir, "kubepi.db"))
+	key, _, err := loadEncryptionKey(e.config.Spec.Encryption, realDir, true)
+	if err != nil {
+		panic(fmt.Errorf("can not load encryption key: %s", err))
+	}
+	d, err := storm.Open(path.Join(realDir, "kubepi.db"), storm.Codec(secret.NewCodec(secret.NewKeyring(key))))
 	if err != nil {
 		panic(err)
 	}
@@ -175,7 +185,7 @@ func (e *KubePiServer) setResultHandler() {
 			}
 			if len(ss) >= 3 {
 				for i := range ss {
-					if ss[i] == "proxy" || ss[i] == "ws" || ss[i] == "istio" {
+					if ss[i] == "proxy" || ss[i] == "ws" || ss[i] == "istio" || ss[i] == "agent" {
 						return true
 					}
 				}
@@ -249,7 +259,18 @@ func (e *KubePiServer) setUpErrHandler() {
 }
 
 func (e *KubePiServer) runMigrations() {
+	var version int
+	_ = e.db.Get("db", "current_db_version", &version)
 	migrate.RunMigrate(e.db, e.logger)
+	if version > 0 && version < v1Migrate.EncryptSecretsAtRest.Version {
+		// 加密前的明文仍残留在 bolt 释放的页中，压缩数据库文件清除
+		dbFile := e.db.Bolt.Path()
+		_ = e.db.Close()
+		if err := compactDB(dbFile); err != nil {
+			e.logger.Errorf("compact database failed, plaintext secrets may remain in free pages: %s", err.Error())
+		}
+		e.setUpDB()
+	}
 }
 func (e *KubePiServer) setWebkubectlProxy() {
 	handler := func(ctx *context.Context) {
@@ -261,6 +282,11 @@ func (e *KubePiServer) setWebkubectlProxy() {
 		u, _ := url.Parse("http://localhost:8080")
 		proxy := httputil.NewSingleHostReverseProxy(u)
 		proxy.ModifyResponse = func(resp *http.Response) error {
+			if resp.StatusCode == iris.StatusSwitchingProtocols && WebkubectlConnHook != nil {
+				if conn, ok := resp.Body.(io.ReadWriteCloser); ok {
+					resp.Body = WebkubectlConnHook(conn)
+				}
+			}
 			if resp.StatusCode == iris.StatusMovedPermanently {
 				// 重定向重写
 				if resp.Header.Get("Location") == "/kubepi/webkubectl/" {
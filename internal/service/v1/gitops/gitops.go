@@ -0,0 +1,112 @@
+package gitops
+
+import (
+	"time"
+
+	v1GitOps "github.com/KubeOperator/kubepi/internal/model/v1/gitops"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/asdine/storm/v3/q"
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	common.DBService
+	Create(repo *v1GitOps.Repository, options common.DBOptions) error
+	Update(name string, repo *v1GitOps.Repository, options common.DBOptions) error
+	UpdateStatus(name string, status v1GitOps.SyncStatus, options common.DBOptions) error
+	Get(name string, options common.DBOptions) (*v1GitOps.Repository, error)
+	List(options common.DBOptions) ([]v1GitOps.Repository, error)
+	ListByCluster(clusterName string, options common.DBOptions) ([]v1GitOps.Repository, error)
+	Delete(name string, options common.DBOptions) error
+	DeleteByCluster(clusterName string, options common.DBOptions) error
+}
+
+func NewService() Service {
+	return &service{}
+}
+
+type service struct {
+	common.DefaultDBService
+}
+
+func (s *service) Create(repo *v1GitOps.Repository, options common.DBOptions) error {
+	db := s.GetDB(options)
+	repo.UUID = uuid.New().String()
+	repo.CreateAt = time.Now()
+	repo.UpdateAt = time.Now()
+	if repo.WebhookToken == "" {
+		repo.WebhookToken = uuid.New().String()
+	}
+	return db.Save(repo)
+}
+
+// Update 修改仓库配置，同步状态和 webhook token 保持不变，未指定 CreatedBy 时沿用原值
+func (s *service) Update(name string, repo *v1GitOps.Repository, options common.DBOptions) error {
+	db := s.GetDB(options)
+	r, err := s.Get(name, options)
+	if err != nil {
+		return err
+	}
+	repo.UUID = r.UUID
+	if repo.CreatedBy == "" {
+		repo.CreatedBy = r.CreatedBy
+	}
+	repo.CreateAt = r.CreateAt
+	repo.UpdateAt = time.Now()
+	repo.WebhookToken = r.WebhookToken
+	repo.Status = r.Status
+	// Update 会跳过零值字段，关闭 AutoApply、清空 Branch 等修改需要整条保存
+	return db.Save(repo)
+}
+
+func (s *service) UpdateStatus(name string, status v1GitOps.SyncStatus, options common.DBOptions) error {
+	db := s.GetDB(options)
+	r, err := s.Get(name, options)
+	if err != nil {
+		return err
+	}
+	r.Status = status
+	return db.Save(r)
+}
+
+func (s *service) Get(name string, options common.DBOptions) (*v1GitOps.Repository, error) {
+	db := s.GetDB(options)
+	var repo v1GitOps.Repository
+	if err := db.One("Name", name, &repo); err != nil {
+		return nil, err
+	}
+	return &repo, nil
+}
+
+func (s *service) List(options common.DBOptions) ([]v1GitOps.Repository, error) {
+	db := s.GetDB(options)
+	repos := make([]v1GitOps.Repository, 0)
+	if err := db.All(&repos); err != nil {
+		return repos, err
+	}
+	return repos, nil
+}
+
+func (s *service) ListByCluster(clusterName string, options common.DBOptions) ([]v1GitOps.Repository, error) {
+	db := s.GetDB(options)
+	repos := make([]v1GitOps.Repository, 0)
+	if err := db.Find("ClusterRef", clusterName, &repos); err != nil {
+		return repos, err
+	}
+	return repos, nil
+}
+
+func (s *service) Delete(name string, options common.DBOptions) error {
+	db := s.GetDB(options)
+	repo, err := s.Get(name, options)
+	if err != nil {
+		return err
+	}
+	return db.DeleteStruct(repo)
+}
+
+func (s *service) DeleteByCluster(clusterName string, options common.DBOptions) error {
+	db := s.GetDB(options)
+	query := db.Select(q.Eq("ClusterRef", clusterName))
+	return query.Delete(new(v1GitOps.Repository))
+}
@@ -0,0 +1,60 @@
+package gitops
+
+import (
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+	v1GitOps "github.com/KubeOperator/kubepi/internal/model/v1/gitops"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/asdine/storm/v3"
+)
+
+func TestUpdateClearsFields(t *testing.T) {
+	db, err := storm.Open(filepath.Join(t.TempDir(), "kubepi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	options := common.DBOptions{DB: db}
+	s := NewService()
+
+	repo := &v1GitOps.Repository{
+		BaseModel: v1.BaseModel{CreatedBy: "alice"},
+		Metadata:  v1.Metadata{Name: "mesh"},
+		URL:       "https://example.com/mesh.git",
+		Branch:    "main",
+		Path:      "istio",
+		Interval:  60,
+		AutoApply: true,
+	}
+	if err := s.Create(repo, options); err != nil {
+		t.Fatal(err)
+	}
+	token := repo.WebhookToken
+	if err := s.UpdateStatus("mesh", v1GitOps.SyncStatus{Phase: v1GitOps.PhaseFailed, Message: "boom"}, options); err != nil {
+		t.Fatal(err)
+	}
+
+	update := &v1GitOps.Repository{Metadata: v1.Metadata{Name: "mesh"}, URL: "https://example.com/mesh.git"}
+	if err := s.Update("mesh", update, options); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Get("mesh", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AutoApply || got.Interval != 0 || got.Branch != "" || got.Path != "" {
+		t.Errorf("expect cleared fields to be saved, got %+v", got)
+	}
+	if got.WebhookToken != token || got.CreatedBy != "alice" || got.Status.Message != "boom" {
+		t.Errorf("expect token, creator and status to be kept, got %+v", got)
+	}
+
+	if err := s.UpdateStatus("mesh", v1GitOps.SyncStatus{Phase: v1GitOps.PhaseSynced}, options); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = s.Get("mesh", options); got.Status.Message != "" {
+		t.Errorf("expect the message of the last sync to be cleared, got %q", got.Status.Message)
+	}
+}
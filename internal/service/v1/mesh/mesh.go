@@ -0,0 +1,130 @@
+package mesh
+
+import (
+	"time"
+
+	v1Mesh "github.com/KubeOperator/kubepi/internal/model/v1/mesh"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	common.DBService
+	Create(mesh *v1Mesh.Mesh, options common.DBOptions) error
+	Update(name string, mesh *v1Mesh.Mesh, options common.DBOptions) error
+	Get(name string, options common.DBOptions) (*v1Mesh.Mesh, error)
+	List(options common.DBOptions) ([]v1Mesh.Mesh, error)
+	ListByCluster(clusterName string, options common.DBOptions) ([]v1Mesh.Mesh, error)
+	Delete(name string, options common.DBOptions) error
+	RemoveCluster(clusterName string, options common.DBOptions) error
+}
+
+func NewService() Service {
+	return &service{}
+}
+
+type service struct {
+	common.DefaultDBService
+}
+
+func (s *service) Create(mesh *v1Mesh.Mesh, options common.DBOptions) error {
+	db := s.GetDB(options)
+	mesh.UUID = uuid.New().String()
+	mesh.CreateAt = time.Now()
+	mesh.UpdateAt = time.Now()
+	return db.Save(mesh)
+}
+
+func (s *service) Update(name string, mesh *v1Mesh.Mesh, options common.DBOptions) error {
+	db := s.GetDB(options)
+	m, err := s.Get(name, options)
+	if err != nil {
+		return err
+	}
+	mesh.UUID = m.UUID
+	// 早期创建的网格没有记录创建者，由本次修改者补上
+	if m.CreatedBy != "" {
+		mesh.CreatedBy = m.CreatedBy
+	}
+	mesh.CreateAt = m.CreateAt
+	mesh.UpdateAt = time.Now()
+	return db.Update(mesh)
+}
+
+func (s *service) Get(name string, options common.DBOptions) (*v1Mesh.Mesh, error) {
+	db := s.GetDB(options)
+	var mesh v1Mesh.Mesh
+	if err := db.One("Name", name, &mesh); err != nil {
+		return nil, err
+	}
+	return &mesh, nil
+}
+
+func (s *service) List(options common.DBOptions) ([]v1Mesh.Mesh, error) {
+	db := s.GetDB(options)
+	meshes := make([]v1Mesh.Mesh, 0)
+	if err := db.Select().OrderBy("CreateAt").Reverse().Find(&meshes); err != nil {
+		return meshes, err
+	}
+	return meshes, nil
+}
+
+func (s *service) ListByCluster(clusterName string, options common.DBOptions) ([]v1Mesh.Mesh, error) {
+	meshes, err := s.List(options)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]v1Mesh.Mesh, 0)
+	for i := range meshes {
+		for j := range meshes[i].Clusters {
+			if meshes[i].Clusters[j].Name == clusterName {
+				result = append(result, meshes[i])
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func (s *service) Delete(name string, options common.DBOptions) error {
+	db := s.GetDB(options)
+	mesh, err := s.Get(name, options)
+	if err != nil {
+		return err
+	}
+	return db.DeleteStruct(mesh)
+}
+
+// RemoveCluster 在集群删除时将其移出所在的网格，以其为控制面的 remote 集群需要重新指定控制面，网格中不再有集群时一并删除
+func (s *service) RemoveCluster(clusterName string, options common.DBOptions) error {
+	db := s.GetDB(options)
+	meshes, err := s.ListByCluster(clusterName, options)
+	if err != nil {
+		return err
+	}
+	for i := range meshes {
+		m := &meshes[i]
+		clusters := make([]v1Mesh.Cluster, 0, len(m.Clusters))
+		for _, c := range m.Clusters {
+			if c.Name == clusterName {
+				continue
+			}
+			if c.Primary == clusterName {
+				c.Primary = ""
+			}
+			clusters = append(clusters, c)
+		}
+		if len(clusters) == 0 {
+			if err := db.DeleteStruct(m); err != nil {
+				return err
+			}
+			continue
+		}
+		m.Clusters = clusters
+		m.UpdateAt = time.Now()
+		if err := db.Save(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
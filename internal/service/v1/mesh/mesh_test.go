@@ -0,0 +1,50 @@
+package mesh
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+	v1Mesh "github.com/KubeOperator/kubepi/internal/model/v1/mesh"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	"github.com/asdine/storm/v3"
+)
+
+func TestRemoveCluster(t *testing.T) {
+	db, err := storm.Open(filepath.Join(t.TempDir(), "kubepi.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	options := common.DBOptions{DB: db}
+	s := NewService()
+
+	shared := &v1Mesh.Mesh{Metadata: v1.Metadata{Name: "shared"}, Clusters: []v1Mesh.Cluster{
+		{Name: "east", Role: v1Mesh.RolePrimary},
+		{Name: "west", Role: v1Mesh.RolePrimary},
+		{Name: "edge", Role: v1Mesh.RoleRemote, Primary: "east"},
+	}}
+	single := &v1Mesh.Mesh{Metadata: v1.Metadata{Name: "single"}, Clusters: []v1Mesh.Cluster{
+		{Name: "east", Role: v1Mesh.RolePrimary},
+	}}
+	for _, m := range []*v1Mesh.Mesh{shared, single} {
+		if err := s.Create(m, options); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.RemoveCluster("east", options); err != nil {
+		t.Fatal(err)
+	}
+	m, err := s.Get("shared", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Clusters) != 2 || m.Clusters[0].Name != "west" || m.Clusters[1].Primary != "" {
+		t.Errorf("unexpected clusters %+v", m.Clusters)
+	}
+	if _, err := s.Get("single", options); !errors.Is(err, storm.ErrNotFound) {
+		t.Errorf("mesh without clusters should be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,115 @@
+package terminal
+
+import (
+	"time"
+
+	v1Terminal "github.com/KubeOperator/kubepi/internal/model/v1/terminal"
+	"github.com/KubeOperator/kubepi/internal/service/v1/common"
+	costomStorm "github.com/KubeOperator/kubepi/pkg/storm"
+	"github.com/KubeOperator/kubepi/pkg/util/lang"
+	"github.com/asdine/storm/v3/q"
+	"github.com/google/uuid"
+)
+
+type Service interface {
+	common.DBService
+	Create(recording *v1Terminal.Recording, options common.DBOptions) error
+	Update(recording *v1Terminal.Recording, options common.DBOptions) error
+	Get(name string, options common.DBOptions) (*v1Terminal.Recording, error)
+	Search(num, size int, conditions common.Conditions, options common.DBOptions) ([]v1Terminal.Recording, int, error)
+	ListStartedBefore(t time.Time, options common.DBOptions) ([]v1Terminal.Recording, error)
+	Delete(name string, options common.DBOptions) error
+}
+
+func NewService() Service {
+	return &service{}
+}
+
+type service struct {
+	common.DefaultDBService
+}
+
+func (s *service) Create(recording *v1Terminal.Recording, options common.DBOptions) error {
+	db := s.GetDB(options)
+	recording.UUID = uuid.New().String()
+	recording.CreateAt = time.Now()
+	recording.UpdateAt = time.Now()
+	return db.Save(recording)
+}
+
+func (s *service) Update(recording *v1Terminal.Recording, options common.DBOptions) error {
+	db := s.GetDB(options)
+	recording.UpdateAt = time.Now()
+	return db.Update(recording)
+}
+
+func (s *service) Get(name string, options common.DBOptions) (*v1Terminal.Recording, error) {
+	db := s.GetDB(options)
+	var recording v1Terminal.Recording
+	if err := db.One("Name", name, &recording); err != nil {
+		return nil, err
+	}
+	return &recording, nil
+}
+
+// Search 支持按 user、pod、cluster 等字段过滤，quick 同时模糊匹配用户、集群、Pod 和节点
+func (s *service) Search(num, size int, conditions common.Conditions, options common.DBOptions) ([]v1Terminal.Recording, int, error) {
+	db := s.GetDB(options)
+
+	var ms []q.Matcher
+	for k := range conditions {
+		if conditions[k].Field == "quick" {
+			ms = append(ms, q.Or(
+				costomStorm.Like("User", conditions[k].Value),
+				costomStorm.Like("Cluster", conditions[k].Value),
+				costomStorm.Like("Pod", conditions[k].Value),
+				costomStorm.Like("Node", conditions[k].Value),
+			))
+		} else {
+			field := lang.FirstToUpper(conditions[k].Field)
+			value := conditions[k].Value
+
+			switch conditions[k].Operator {
+			case "eq":
+				ms = append(ms, q.Eq(field, value))
+			case "ne":
+				ms = append(ms, q.Not(q.Eq(field, value)))
+			case "like":
+				ms = append(ms, costomStorm.Like(field, value))
+			case "not like":
+				ms = append(ms, q.Not(costomStorm.Like(field, value)))
+			}
+		}
+	}
+	query := db.Select(ms...).OrderBy("StartTime").Reverse()
+	count, err := query.Count(&v1Terminal.Recording{})
+	if err != nil {
+		return nil, 0, err
+	}
+	if size != 0 {
+		query.Limit(size).Skip((num - 1) * size)
+	}
+	recordings := make([]v1Terminal.Recording, 0)
+	if err := query.Find(&recordings); err != nil {
+		return nil, 0, err
+	}
+	return recordings, count, nil
+}
+
+func (s *service) ListStartedBefore(t time.Time, options common.DBOptions) ([]v1Terminal.Recording, error) {
+	db := s.GetDB(options)
+	recordings := make([]v1Terminal.Recording, 0)
+	if err := db.Select(q.Lt("StartTime", t)).Find(&recordings); err != nil {
+		return recordings, err
+	}
+	return recordings, nil
+}
+
+func (s *service) Delete(name string, options common.DBOptions) error {
+	db := s.GetDB(options)
+	recording, err := s.Get(name, options)
+	if err != nil {
+		return err
+	}
+	return db.DeleteStruct(recording)
+}
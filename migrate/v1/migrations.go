@@ -1,10 +1,16 @@
 package v1
 
 import (
+	"reflect"
 	"time"
 
 	v1 "github.com/KubeOperator/kubepi/internal/model/v1"
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	v1GitOps "github.com/KubeOperator/kubepi/internal/model/v1/gitops"
+	v1ImageRepo "github.com/KubeOperator/kubepi/internal/model/v1/imagerepo"
+	v1Ldap "github.com/KubeOperator/kubepi/internal/model/v1/ldap"
 	v1Role "github.com/KubeOperator/kubepi/internal/model/v1/role"
+	v1Sso "github.com/KubeOperator/kubepi/internal/model/v1/sso"
 	v1User "github.com/KubeOperator/kubepi/internal/model/v1/user"
 	"github.com/KubeOperator/kubepi/migrate/migrations"
 	"github.com/asdine/storm/v3"
@@ -15,6 +21,7 @@ import (
 var Migrations = []migrations.Migration{
 	CreateAdministrator,
 	AddRoleManagerRepo,
+	EncryptSecretsAtRest,
 }
 
 // 创建默认系统角色: Admin |Manage Cluster| Manage User|Read only|Common User | Manage Chart
@@ -172,3 +179,37 @@ var AddRoleManagerRepo = migrations.Migration{
 		return db.Save(&roleManageRepo)
 	},
 }
+
+// 数据库以加密 codec 打开，重新保存即加密旧记录中的敏感字段
+var EncryptSecretsAtRest = migrations.Migration{
+	Version: 3,
+	Message: "Encrypt secrets at rest",
+	Handler: EncryptSecrets,
+}
+
+// secretModels 为含有 secret 标签字段的模型，internal/model 下新增带标签的模型时需要加入这里，
+// migrations_test.go 会检查遗漏
+var secretModels = []interface{}{
+	v1Cluster.Cluster{},
+	v1ImageRepo.ImageRepo{},
+	v1Ldap.Ldap{},
+	v1Sso.Sso{},
+	v1User.User{},
+	v1GitOps.Repository{},
+}
+
+// EncryptSecrets 重新保存 secretModels 的所有记录，以 codec 当前的主密钥加密，也用于密钥轮换
+func EncryptSecrets(db storm.Node) error {
+	for _, m := range secretModels {
+		items := reflect.New(reflect.SliceOf(reflect.TypeOf(m)))
+		if err := db.All(items.Interface()); err != nil {
+			return err
+		}
+		for i := 0; i < items.Elem().Len(); i++ {
+			if err := db.Save(items.Elem().Index(i).Addr().Interface()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
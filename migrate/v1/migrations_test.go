@@ -0,0 +1,87 @@
+package v1
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/KubeOperator/kubepi/pkg/secret"
+)
+
+const modulePath = "github.com/KubeOperator/kubepi"
+
+// taggedStructs returns the structs under internal/model with a field tagged secret:"true", as <import path>.<name>
+func taggedStructs(t *testing.T) map[string]bool {
+	root := filepath.Join("..", "..")
+	tagged := map[string]bool{}
+	err := filepath.Walk(filepath.Join(root, "internal", "model"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return err
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, filepath.Dir(path))
+		pkg := modulePath + "/" + filepath.ToSlash(rel)
+		ast.Inspect(f, func(n ast.Node) bool {
+			spec, ok := n.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			for _, field := range st.Fields.List {
+				if field.Tag != nil && reflect.StructTag(strings.Trim(field.Tag.Value, "`")).Get(secret.Tag) == "true" {
+					tagged[pkg+"."+spec.Name.Name] = true
+				}
+			}
+			return true
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tagged
+}
+
+func reachable(t reflect.Type, seen map[string]bool) {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	name := t.PkgPath() + "." + t.Name()
+	if seen[name] {
+		return
+	}
+	seen[name] = true
+	for i := 0; i < t.NumField(); i++ {
+		reachable(t.Field(i).Type, seen)
+	}
+}
+
+func TestSecretModels(t *testing.T) {
+	seen := map[string]bool{}
+	for _, m := range secretModels {
+		reachable(reflect.TypeOf(m), seen)
+	}
+	tagged := taggedStructs(t)
+	if len(tagged) == 0 {
+		t.Fatal("no tagged struct found under internal/model")
+	}
+	for name := range tagged {
+		if !seen[name] {
+			t.Errorf("%s has secret fields but is not stored by any model in secretModels", name)
+		}
+	}
+}
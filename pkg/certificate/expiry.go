@@ -0,0 +1,51 @@
+package certificate
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// renewAfter is the part of its lifetime after which a client certificate is renewed
+const renewAfter = 0.8
+
+// ClientCertificateState describes a client certificate against the CA the api server currently trusts
+type ClientCertificateState struct {
+	NotAfter time.Time
+	Expired  bool
+	// Untrusted is set when the certificate does not chain to the CA, e.g. after the CA was rotated
+	Untrusted bool
+	// RenewDue is set once most of the lifetime has passed, or when the certificate is expired or untrusted
+	RenewDue bool
+}
+
+// InspectClientCertificate parses a PEM client certificate, the trust check is skipped when caPem is empty
+func InspectClientCertificate(certPem, caPem []byte, now time.Time) (ClientCertificateState, error) {
+	cert, err := ParseX509Certificate(certPem)
+	if err != nil {
+		return ClientCertificateState{}, err
+	}
+	state := ClientCertificateState{
+		NotAfter: cert.NotAfter,
+		Expired:  now.After(cert.NotAfter),
+	}
+	if len(caPem) > 0 {
+		roots := x509.NewCertPool()
+		if roots.AppendCertsFromPEM(caPem) {
+			// only the issuer is checked here, expiry is reported by Expired
+			at := now
+			if state.Expired {
+				at = cert.NotAfter.Add(-time.Second)
+			}
+			_, err := cert.Verify(x509.VerifyOptions{
+				Roots:       roots,
+				CurrentTime: at,
+				KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			})
+			state.Untrusted = err != nil
+		}
+	}
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	renewAt := cert.NotBefore.Add(time.Duration(float64(lifetime) * renewAfter))
+	state.RenewDue = state.Expired || state.Untrusted || now.After(renewAt)
+	return state, nil
+}
@@ -0,0 +1,92 @@
+package certificate
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *rsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) testCA {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-365 * 24 * time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (ca testCA) issue(t *testing.T, notBefore, notAfter time.Time) []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "user"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestInspectClientCertificate(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	ca := newTestCA(t, "ca")
+	rotated := newTestCA(t, "rotated-ca")
+
+	cases := []struct {
+		name  string
+		cert  []byte
+		ca    []byte
+		state ClientCertificateState
+	}{
+		{name: "valid", cert: ca.issue(t, now.Add(-day), now.Add(300*day)), ca: ca.pem},
+		{name: "renew due", cert: ca.issue(t, now.Add(-90*day), now.Add(10*day)), ca: ca.pem, state: ClientCertificateState{RenewDue: true}},
+		{name: "expired", cert: ca.issue(t, now.Add(-90*day), now.Add(-day)), ca: ca.pem, state: ClientCertificateState{Expired: true, RenewDue: true}},
+		{name: "rotated ca", cert: ca.issue(t, now.Add(-day), now.Add(300*day)), ca: rotated.pem, state: ClientCertificateState{Untrusted: true, RenewDue: true}},
+		{name: "unknown ca", cert: ca.issue(t, now.Add(-day), now.Add(300*day))},
+	}
+	for _, c := range cases {
+		state, err := InspectClientCertificate(c.cert, c.ca, now)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		state.NotAfter = time.Time{}
+		if state != c.state {
+			t.Errorf("%s: got %+v, want %+v", c.name, state, c.state)
+		}
+	}
+	if _, err := InspectClientCertificate([]byte("garbage"), nil, now); err == nil {
+		t.Error("garbage was parsed")
+	}
+}
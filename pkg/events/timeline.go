@@ -0,0 +1,161 @@
+package events
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// TimelineEvent is one event of an object or of an object it owns
+type TimelineEvent struct {
+	Time      time.Time `json:"time"`
+	FirstTime time.Time `json:"firstTime"`
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Count     int32     `json:"count"`
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`
+}
+
+// ObjectRef identifies an object by kind and name, namespace is empty for cluster scoped objects
+type ObjectRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// Timeline returns the events of the object and of the ReplicaSets, Jobs and Pods it owns directly or
+// indirectly, oldest first
+func Timeline(client kubernetes.Interface, ref ObjectRef) ([]TimelineEvent, error) {
+	if ref.Namespace == "" {
+		// cluster scoped objects such as nodes report their events in any namespace
+		list, err := client.CoreV1().Events("").List(context.TODO(), metav1.ListOptions{
+			FieldSelector: fields.Set{"involvedObject.kind": ref.Kind, "involvedObject.name": ref.Name}.String(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return timeline(list.Items, map[ObjectRef]bool{ref: true}), nil
+	}
+	related, err := Descendants(client, ref)
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.CoreV1().Events(ref.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return timeline(list.Items, related), nil
+}
+
+// Descendants returns the object and the ReplicaSets, Jobs and Pods it owns, following owner references by kind and name
+func Descendants(client kubernetes.Interface, ref ObjectRef) (map[ObjectRef]bool, error) {
+	related := map[ObjectRef]bool{ref: true}
+	var candidates []metav1.Object
+	var kinds []string
+	switch ref.Kind {
+	case "Deployment":
+		rss, err := client.AppsV1().ReplicaSets(ref.Namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range rss.Items {
+			candidates = append(candidates, &rss.Items[i])
+			kinds = append(kinds, "ReplicaSet")
+		}
+	case "CronJob":
+		jobs, err := client.BatchV1().Jobs(ref.Namespace).List(context.TODO(), metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for i := range jobs.Items {
+			candidates = append(candidates, &jobs.Items[i])
+			kinds = append(kinds, "Job")
+		}
+	case "ReplicaSet", "StatefulSet", "DaemonSet", "Job", "ReplicationController":
+	default:
+		return related, nil
+	}
+	pods, err := client.CoreV1().Pods(ref.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		candidates = append(candidates, &pods.Items[i])
+		kinds = append(kinds, "Pod")
+	}
+	// candidates are ordered by level, ReplicaSets and Jobs before Pods, so one pass covers both levels of ownership
+	for i, obj := range candidates {
+		for _, owner := range obj.GetOwnerReferences() {
+			if related[ObjectRef{Kind: owner.Kind, Namespace: ref.Namespace, Name: owner.Name}] {
+				related[ObjectRef{Kind: kinds[i], Namespace: ref.Namespace, Name: obj.GetName()}] = true
+				break
+			}
+		}
+	}
+	return related, nil
+}
+
+func timeline(items []corev1.Event, related map[ObjectRef]bool) []TimelineEvent {
+	result := make([]TimelineEvent, 0)
+	for i := range items {
+		e := &items[i]
+		ref := ObjectRef{Kind: e.InvolvedObject.Kind, Namespace: e.InvolvedObject.Namespace, Name: e.InvolvedObject.Name}
+		if !related[ref] && !related[ObjectRef{Kind: ref.Kind, Name: ref.Name}] {
+			continue
+		}
+		first, last := EventTimes(e)
+		result = append(result, TimelineEvent{
+			Time:      last,
+			FirstTime: first,
+			Type:      e.Type,
+			Reason:    e.Reason,
+			Message:   e.Message,
+			Count:     e.Count,
+			Kind:      ref.Kind,
+			Namespace: ref.Namespace,
+			Name:      ref.Name,
+			Source:    eventSource(e),
+		})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+	return result
+}
+
+// EventTimes returns when the event happened first and last, falling back to eventTime and creation for
+// events written through events.k8s.io
+func EventTimes(e *corev1.Event) (first, last time.Time) {
+	first, last = e.FirstTimestamp.Time, e.LastTimestamp.Time
+	if e.Series != nil && !e.Series.LastObservedTime.IsZero() {
+		last = e.Series.LastObservedTime.Time
+	}
+	if last.IsZero() {
+		last = e.EventTime.Time
+	}
+	if last.IsZero() {
+		last = e.CreationTimestamp.Time
+	}
+	if first.IsZero() {
+		first = last
+	}
+	return first, last
+}
+
+func eventSource(e *corev1.Event) string {
+	parts := []string{e.Source.Component, e.Source.Host}
+	if parts[0] == "" {
+		parts = []string{e.ReportingController, e.ReportingInstance}
+	}
+	return strings.Trim(strings.Join(parts, " "), " ")
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func owned(name, ownerKind, owner string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: "prod", OwnerReferences: []metav1.OwnerReference{{Kind: ownerKind, Name: owner}}}
+}
+
+func event(name, kind, object, eventType string, at time.Time) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "prod"},
+		InvolvedObject: corev1.ObjectReference{Kind: kind, Namespace: "prod", Name: object},
+		Type:           eventType,
+		Reason:         name,
+		LastTimestamp:  metav1.NewTime(at),
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	client := fake.NewSimpleClientset(
+		&appsv1.ReplicaSet{ObjectMeta: owned("web-7d9", "Deployment", "web")},
+		&appsv1.ReplicaSet{ObjectMeta: owned("api-5c1", "Deployment", "api")},
+		&corev1.Pod{ObjectMeta: owned("web-7d9-x", "ReplicaSet", "web-7d9")},
+		&corev1.Pod{ObjectMeta: owned("api-5c1-y", "ReplicaSet", "api-5c1")},
+		event("BackOff", "Pod", "web-7d9-x", corev1.EventTypeWarning, now.Add(3*time.Second)),
+		event("ScalingReplicaSet", "Deployment", "web", corev1.EventTypeNormal, now),
+		event("SuccessfulCreate", "ReplicaSet", "web-7d9", corev1.EventTypeNormal, now.Add(time.Second)),
+		event("Unrelated", "Pod", "api-5c1-y", corev1.EventTypeWarning, now.Add(2*time.Second)),
+	)
+	items, err := Timeline(client, ObjectRef{Kind: "Deployment", Namespace: "prod", Name: "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reasons []string
+	for _, item := range items {
+		reasons = append(reasons, item.Reason)
+	}
+	if len(reasons) != 3 || reasons[0] != "ScalingReplicaSet" || reasons[1] != "SuccessfulCreate" || reasons[2] != "BackOff" {
+		t.Errorf("unexpected timeline %v", reasons)
+	}
+
+	filter := WarningsSince(now.Add(time.Second))
+	for _, c := range []struct {
+		e    *corev1.Event
+		want bool
+	}{
+		{event("BackOff", "Pod", "web-7d9-x", corev1.EventTypeWarning, now.Add(3*time.Second)), true},
+		{event("Old", "Pod", "web-7d9-x", corev1.EventTypeWarning, now), false},
+		{event("Normal", "Pod", "web-7d9-x", corev1.EventTypeNormal, now.Add(3*time.Second)), false},
+	} {
+		obj, _ := runtime.DefaultUnstructuredConverter.ToUnstructured(c.e)
+		if got := filter(&unstructured.Unstructured{Object: obj}); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.e.Name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package events
+
+import (
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// WarningsSince returns an informer filter keeping warning events that occurred after since, which drops
+// the events replayed when a subscription starts
+func WarningsSince(since time.Time) func(u *unstructured.Unstructured) bool {
+	return func(u *unstructured.Unstructured) bool {
+		var e corev1.Event
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, &e); err != nil {
+			return false
+		}
+		if e.Type != corev1.EventTypeWarning {
+			return false
+		}
+		_, last := EventTimes(&e)
+		return !last.Before(since)
+	}
+}
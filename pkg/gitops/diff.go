@@ -0,0 +1,99 @@
+package gitops
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/KubeOperator/kubepi/pkg/meshconfig"
+	k8sError "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	StatusInSync   = "InSync"
+	StatusMissing  = "Missing"
+	StatusModified = "Modified"
+	// StatusExtra 表示对象存在于集群但不在仓库中，只做展示，不会被删除
+	StatusExtra = "Extra"
+	StatusError = "Error"
+)
+
+type Drift struct {
+	Kind      string                 `json:"kind"`
+	Namespace string                 `json:"namespace"`
+	Name      string                 `json:"name"`
+	Status    string                 `json:"status"`
+	Desired   map[string]interface{} `json:"desired,omitempty"`
+	Live      map[string]interface{} `json:"live,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// OutOfSync reports whether applying the repository would change the cluster
+func OutOfSync(drifts []Drift) bool {
+	for i := range drifts {
+		if drifts[i].Status == StatusMissing || drifts[i].Status == StatusModified {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff compares the desired objects with the live ones. Live Istio objects in the namespaces managed by the
+// repository that are not declared in it are reported as Extra.
+func Diff(client dynamic.Interface, desired []*unstructured.Unstructured) []Drift {
+	drifts := make([]Drift, 0, len(desired))
+	declared := make(map[string]bool)
+	namespaces := make(map[string]bool)
+	for _, o := range desired {
+		obj := meshconfig.Clean(o)
+		d := Drift{Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName(), Desired: obj.Object}
+		declared[key(obj.GetKind(), obj.GetNamespace(), obj.GetName())] = true
+		namespaces[obj.GetNamespace()] = true
+		gvr, err := meshconfig.ResourceFor(obj)
+		if err != nil {
+			d.Status, d.Error = StatusError, err.Error()
+			drifts = append(drifts, d)
+			continue
+		}
+		live, err := client.Resource(gvr).Namespace(obj.GetNamespace()).Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+		switch {
+		case k8sError.IsNotFound(err):
+			d.Status = StatusMissing
+		case err != nil:
+			d.Status, d.Error = StatusError, err.Error()
+		case meshconfig.Equal(live, obj):
+			d.Status = StatusInSync
+			d.Desired = nil
+		default:
+			d.Status = StatusModified
+			d.Live = meshconfig.Clean(live).Object
+		}
+		drifts = append(drifts, d)
+	}
+	for ns := range namespaces {
+		if ns == "" {
+			continue
+		}
+		for _, k := range meshconfig.Kinds {
+			list, err := client.Resource(k.Resource).Namespace(ns).List(context.TODO(), metav1.ListOptions{})
+			if err != nil {
+				// 集群未安装对应 CRD
+				continue
+			}
+			for i := range list.Items {
+				item := &list.Items[i]
+				if declared[key(k.Kind, ns, item.GetName())] {
+					continue
+				}
+				drifts = append(drifts, Drift{Kind: k.Kind, Namespace: ns, Name: item.GetName(), Status: StatusExtra, Live: meshconfig.Clean(item).Object})
+			}
+		}
+	}
+	return drifts
+}
+
+func key(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
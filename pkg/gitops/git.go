@@ -0,0 +1,96 @@
+package gitops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// allowedProtocols are the transports git may use, local paths, file:// and remote helpers such as ext:: would let a
+// repository URL read the KubePi host or run commands on it. file:// is only added when it is explicitly allowed.
+const allowedProtocols = "http:https:ssh"
+
+// ValidateURL accepts http(s) and ssh URLs, including the scp-like [user@]host:path form. allowFile also accepts
+// file:// URLs, which read repositories from the KubePi host and are meant for offline setups; bare local paths
+// are always rejected.
+func ValidateURL(url string, allowFile bool) error {
+	if url == "" || strings.HasPrefix(url, "-") || strings.Contains(url, "::") {
+		return fmt.Errorf("invalid repository url %q", url)
+	}
+	if i := strings.Index(url, "://"); i >= 0 {
+		switch strings.ToLower(url[:i]) {
+		case "http", "https", "ssh":
+			return nil
+		case "file":
+			if allowFile {
+				return nil
+			}
+			return errors.New("file:// repository urls are not enabled")
+		}
+		return fmt.Errorf("unsupported repository url scheme %q, use http, https or ssh", url[:i])
+	}
+	colon, slash := strings.Index(url, ":"), strings.Index(url, "/")
+	if colon > 0 && (slash < 0 || colon < slash) {
+		return nil
+	}
+	return errors.New("repository url must be an http, https or ssh url")
+}
+
+// Fetch checks out the latest commit of branch from url into dir and returns its revision.
+// An empty branch means the default branch of the remote. The accepted remotes are the ones of ValidateURL.
+func Fetch(url, branch, dir string, allowFile bool) (string, error) {
+	if err := ValidateURL(url, allowFile); err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(branch, "-") {
+		return "", fmt.Errorf("invalid branch %q", branch)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if _, err := git(dir, "init", "-q"); err != nil {
+			return "", err
+		}
+	}
+	ref := branch
+	if ref == "" {
+		ref = "HEAD"
+	}
+	protocols := allowedProtocols
+	if allowFile {
+		protocols += ":file"
+	}
+	if _, err := gitWith(dir, protocols, "fetch", "-q", "--depth", "1", "--", url, ref); err != nil {
+		return "", err
+	}
+	if _, err := git(dir, "checkout", "-q", "--force", "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+	if _, err := git(dir, "clean", "-q", "-fdx"); err != nil {
+		return "", err
+	}
+	return git(dir, "rev-parse", "HEAD")
+}
+
+func git(dir string, args ...string) (string, error) {
+	return gitWith(dir, allowedProtocols, args...)
+}
+
+func gitWith(dir, protocols string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	// 禁止交互式输入凭据，避免后台同步被挂起
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ALLOW_PROTOCOL="+protocols)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()+" "+err.Error()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
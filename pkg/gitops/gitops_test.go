@@ -0,0 +1,159 @@
+package gitops
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/KubeOperator/kubepi/pkg/meshconfig"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+)
+
+const virtualService = `apiVersion: networking.istio.io/v1beta1
+kind: VirtualService
+metadata:
+  name: reviews
+  namespace: default
+spec:
+  hosts:
+  - reviews
+`
+
+func run(t *testing.T, dir string, args ...string) {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=kubepi", "-c", "user.email=kubepi@example.com"}, args...)...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %s", args, out)
+	}
+}
+
+// newBareRepo creates a bare repository with one commit containing mesh/vs.yaml and returns its file:// URL
+// together with a working copy that can push further commits
+func newBareRepo(t *testing.T) (string, string) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	base := t.TempDir()
+	bare := filepath.Join(base, "config.git")
+	work := filepath.Join(base, "work")
+	run(t, base, "init", "-q", "--bare", bare)
+	run(t, base, "clone", "-q", bare, work)
+	_ = os.MkdirAll(filepath.Join(work, "mesh"), 0755)
+	_ = os.WriteFile(filepath.Join(work, "mesh", "vs.yaml"), []byte(virtualService), 0644)
+	_ = os.WriteFile(filepath.Join(work, "README.md"), []byte("not a manifest"), 0644)
+	run(t, work, "add", "-A")
+	run(t, work, "commit", "-q", "-m", "init")
+	run(t, work, "push", "-q", "origin", "HEAD:main")
+	return "file://" + bare, work
+}
+
+func TestValidateURL(t *testing.T) {
+	for _, url := range []string{"https://example.com/mesh.git", "http://example.com/mesh.git", "ssh://git@example.com/mesh.git", "git@example.com:team/mesh.git"} {
+		if err := ValidateURL(url, false); err != nil {
+			t.Errorf("expect %s to be accepted, got %v", url, err)
+		}
+	}
+	for _, url := range []string{"", "file:///etc", "/var/lib/kubepi", "./mesh.git", "ext::sh -c id", "--upload-pack=id", "git://example.com/mesh.git"} {
+		if err := ValidateURL(url, false); err == nil {
+			t.Errorf("expect %q to be rejected", url)
+		}
+	}
+	// the opt-in only adds file://, local paths and remote helpers stay blocked
+	if err := ValidateURL("file:///srv/git/mesh.git", true); err != nil {
+		t.Errorf("expect file:// to be accepted when allowed, got %v", err)
+	}
+	for _, url := range []string{"/srv/git/mesh.git", "ext::sh -c id"} {
+		if err := ValidateURL(url, true); err == nil {
+			t.Errorf("expect %q to be rejected", url)
+		}
+	}
+	url, _ := newBareRepo(t)
+	if _, err := Fetch(url, "main", filepath.Join(t.TempDir(), "checkout"), false); err == nil {
+		t.Error("expect fetching a file:// url to fail unless allowed")
+	}
+}
+
+func TestFetchAndLoad(t *testing.T) {
+	url, work := newBareRepo(t)
+	dir := filepath.Join(t.TempDir(), "checkout")
+
+	first, err := Fetch(url, "main", dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs, err := Load(dir, "mesh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 1 || objs[0].GetName() != "reviews" {
+		t.Fatalf("expect the virtual service to be loaded, got %v", objs)
+	}
+	// 路径被限制在仓库内，../.. 等价于仓库根目录
+	if objs, err := Load(dir, "../.."); err != nil || len(objs) != 1 {
+		t.Errorf("expect path to be confined to the repository, got %v %v", objs, err)
+	}
+
+	_ = os.WriteFile(filepath.Join(work, "mesh", "dr.yaml"), []byte("apiVersion: networking.istio.io/v1beta1\nkind: DestinationRule\nmetadata:\n  name: reviews\n  namespace: default\nspec:\n  host: reviews\n"), 0644)
+	run(t, work, "add", "-A")
+	run(t, work, "commit", "-q", "-m", "add destination rule")
+	run(t, work, "push", "-q", "origin", "HEAD:main")
+
+	second, err := Fetch(url, "main", dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second == first {
+		t.Error("expect a new revision after push")
+	}
+	if objs, _ = Load(dir, "mesh"); len(objs) != 2 {
+		t.Errorf("expect 2 objects after update, got %d", len(objs))
+	}
+	if _, err := Fetch(url, "missing", dir, true); err == nil {
+		t.Error("expect fetching an unknown branch to fail")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, k := range meshconfig.Kinds {
+		listKinds[k.Resource] = k.Kind + "List"
+	}
+	live := func(kind, name string, spec map[string]interface{}) runtime.Object {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "networking.istio.io/v1beta1",
+			"kind":       kind,
+			"metadata":   map[string]interface{}{"name": name, "namespace": "default"},
+			"spec":       spec,
+		}}
+	}
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds,
+		live("VirtualService", "reviews", map[string]interface{}{"hosts": []interface{}{"reviews"}}),
+		live("DestinationRule", "reviews", map[string]interface{}{"host": "ratings"}),
+		live("Sidecar", "legacy", map[string]interface{}{}),
+	)
+	desired, _ := meshconfig.DecodeYAML([]byte(virtualService + "---\napiVersion: networking.istio.io/v1beta1\nkind: DestinationRule\nmetadata:\n  name: reviews\n  namespace: default\nspec:\n  host: reviews\n---\napiVersion: networking.istio.io/v1beta1\nkind: ServiceEntry\nmetadata:\n  name: external\n  namespace: default\nspec:\n  hosts:\n  - example.com\n"))
+
+	status := map[string]string{}
+	drifts := Diff(client, desired)
+	for _, d := range drifts {
+		status[d.Kind+"/"+d.Name] = d.Status
+	}
+	expect := map[string]string{
+		"VirtualService/reviews":  StatusInSync,
+		"DestinationRule/reviews": StatusModified,
+		"ServiceEntry/external":   StatusMissing,
+		"Sidecar/legacy":          StatusExtra,
+	}
+	for k, v := range expect {
+		if status[k] != v {
+			t.Errorf("%s: expect %s, got %s", k, v, status[k])
+		}
+	}
+	if !OutOfSync(drifts) {
+		t.Error("expect drifts to be out of sync")
+	}
+}
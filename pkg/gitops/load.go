@@ -0,0 +1,53 @@
+package gitops
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/KubeOperator/kubepi/pkg/meshconfig"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Load reads the manifests under path of the checked out repository in dir, sub directories included
+func Load(dir, path string) ([]*unstructured.Unstructured, error) {
+	root := filepath.Join(dir, filepath.Clean("/"+path))
+	if root != dir && !strings.HasPrefix(root, dir+string(filepath.Separator)) {
+		return nil, fmt.Errorf("invalid path %s", path)
+	}
+	if _, err := os.Stat(root); err != nil {
+		return nil, fmt.Errorf("path %s not found in repository", path)
+	}
+	var result []*unstructured.Unstructured
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !meshconfig.IsManifestFile(p) {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		objs, err := meshconfig.DecodeYAML(data)
+		if err != nil {
+			rel, _ := filepath.Rel(dir, p)
+			return fmt.Errorf("%s: %w", rel, err)
+		}
+		result = append(result, objs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	meshconfig.Sort(result)
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package informer
+
+import (
+	"time"
+
+	authV1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const accessTTL = time.Minute
+
+type accessKey struct {
+	username  string
+	verb      string
+	group     string
+	resource  string
+	namespace string
+	name      string
+}
+
+type accessResult struct {
+	allowed bool
+	at      time.Time
+}
+
+// Allowed asks the api server whether the user may perform verb on the resource, answers are cached for accessTTL
+func (c *ClusterCache) Allowed(username, verb string, gvr schema.GroupVersionResource, namespace, name string) (bool, error) {
+	key := accessKey{username: username, verb: verb, group: gvr.Group, resource: gvr.Resource, namespace: namespace, name: name}
+	c.accessLock.Lock()
+	r, ok := c.access[key]
+	c.accessLock.Unlock()
+	if ok && time.Since(r.at) < accessTTL {
+		return r.allowed, nil
+	}
+	result, err := c.k.UserHasPermission(username, authV1.ResourceAttributes{
+		Verb:      verb,
+		Group:     gvr.Group,
+		Resource:  gvr.Resource,
+		Namespace: namespace,
+		Name:      name,
+	})
+	if err != nil {
+		return false, err
+	}
+	c.accessLock.Lock()
+	c.access[key] = accessResult{allowed: result.Allowed, at: time.Now()}
+	c.accessLock.Unlock()
+	return result.Allowed, nil
+}
+
+// pruneAccess drops the expired answers, the cache would otherwise keep one entry per user and object ever checked
+func (c *ClusterCache) pruneAccess() {
+	c.accessLock.Lock()
+	defer c.accessLock.Unlock()
+	for key, r := range c.access {
+		if time.Since(r.at) >= accessTTL {
+			delete(c.access, key)
+		}
+	}
+}
+
+// FilterByAccess drops the objects the user is not allowed to list, the cache itself is filled with the cluster credential
+func (c *ClusterCache) FilterByAccess(username string, gvr schema.GroupVersionResource, objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	if !Namespaced(gvr) {
+		all, err := c.Allowed(username, "list", gvr, "", "")
+		if err != nil {
+			return nil, err
+		}
+		if all {
+			return objs, nil
+		}
+		// 没有集群级别权限时，只保留用户能 get 的对象，namespace 对象的 get 权限可由该命名空间内的 rolebinding 授予
+		result := make([]*unstructured.Unstructured, 0)
+		for i := range objs {
+			namespace := ""
+			if gvr == Namespaces {
+				namespace = objs[i].GetName()
+			}
+			ok, err := c.Allowed(username, "get", gvr, namespace, objs[i].GetName())
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result = append(result, objs[i])
+			}
+		}
+		return result, nil
+	}
+	all, err := c.Allowed(username, "list", gvr, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if all {
+		return objs, nil
+	}
+	namespaceAllowed := map[string]bool{}
+	result := make([]*unstructured.Unstructured, 0)
+	for i := range objs {
+		ns := objs[i].GetNamespace()
+		ok, checked := namespaceAllowed[ns]
+		if !checked {
+			ok, err = c.Allowed(username, "list", gvr, ns, "")
+			if err != nil {
+				return nil, err
+			}
+			namespaceAllowed[ns] = ok
+		}
+		if ok {
+			result = append(result, objs[i])
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package informer
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const discoveryTTL = 10 * time.Minute
+
+type discoveryCache struct {
+	lock         sync.Mutex
+	versionMinor int
+	versionAt    time.Time
+	namespaced   map[string]bool
+	namespacedAt time.Time
+}
+
+// VersionMinor returns the minor version of the cluster, the answer is cached for discoveryTTL
+func (c *ClusterCache) VersionMinor() (int, error) {
+	d := &c.discoveryCache
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if !d.versionAt.IsZero() && time.Since(d.versionAt) < discoveryTTL {
+		return d.versionMinor, nil
+	}
+	v, err := c.discovery.ServerVersion()
+	if err != nil {
+		return 0, err
+	}
+	reg := regexp.MustCompile("[^0-9]")
+	minor, err := strconv.Atoi(reg.ReplaceAllString(v.Minor, ""))
+	if err != nil {
+		return 0, err
+	}
+	d.versionMinor = minor
+	d.versionAt = time.Now()
+	return minor, nil
+}
+
+// IsNamespacedResource behaves like kubernetes.Interface.IsNamespacedResource but caches the discovery result for discoveryTTL
+func (c *ClusterCache) IsNamespacedResource(resourceName string) (bool, error) {
+	if resourceName == "events" {
+		return false, nil
+	}
+	d := &c.discoveryCache
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.namespaced == nil || time.Since(d.namespacedAt) > discoveryTTL {
+		apiList, err := c.discovery.ServerPreferredNamespacedResources()
+		if err != nil && len(apiList) == 0 {
+			return false, err
+		}
+		namespaced := make(map[string]bool)
+		for i := range apiList {
+			for j := range apiList[i].APIResources {
+				namespaced[apiList[i].APIResources[j].Name] = true
+			}
+		}
+		d.namespaced = namespaced
+		d.namespacedAt = time.Now()
+	}
+	return d.namespaced[resourceName], nil
+}
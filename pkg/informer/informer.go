@@ -0,0 +1,344 @@
+package informer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+	"github.com/KubeOperator/kubepi/pkg/kubernetes"
+	k8sError "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ErrNotServed is returned when the cluster does not serve the resource, e.g. Istio is not installed
+var ErrNotServed = errors.New("resource is not served by cluster")
+
+const (
+	syncTimeout        = 30 * time.Second
+	DefaultIdleTimeout = 30 * time.Minute
+)
+
+var (
+	VirtualServices       = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "virtualservices"}
+	DestinationRules      = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "destinationrules"}
+	Gateways              = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "gateways"}
+	ServiceEntries        = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "serviceentries"}
+	Sidecars              = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "sidecars"}
+	AuthorizationPolicies = schema.GroupVersionResource{Group: "security.istio.io", Version: "v1beta1", Resource: "authorizationpolicies"}
+	PeerAuthentications   = schema.GroupVersionResource{Group: "security.istio.io", Version: "v1beta1", Resource: "peerauthentications"}
+	Pods                  = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	Services              = schema.GroupVersionResource{Version: "v1", Resource: "services"}
+	Namespaces            = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+	Nodes                 = schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+	DaemonSets            = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}
+	Events                = schema.GroupVersionResource{Version: "v1", Resource: "events"}
+	// KubernetesGateways are Gateway API gateways, used by Istio ambient mode for waypoint proxies
+	KubernetesGateways = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+)
+
+// Kinds maps the short names accepted by the API to the resources we keep informers for
+var Kinds = map[string]schema.GroupVersionResource{
+	"virtualservices":       VirtualServices,
+	"destinationrules":      DestinationRules,
+	"gateways":              Gateways,
+	"serviceentries":        ServiceEntries,
+	"sidecars":              Sidecars,
+	"authorizationpolicies": AuthorizationPolicies,
+	"peerauthentications":   PeerAuthentications,
+	"pods":                  Pods,
+	"services":              Services,
+	"namespaces":            Namespaces,
+	"nodes":                 Nodes,
+	"daemonsets":            DaemonSets,
+	"events":                Events,
+	"kubernetesgateways":    KubernetesGateways,
+}
+
+var listKinds = map[schema.GroupVersionResource]string{
+	VirtualServices:       "VirtualServiceList",
+	DestinationRules:      "DestinationRuleList",
+	Gateways:              "GatewayList",
+	ServiceEntries:        "ServiceEntryList",
+	Sidecars:              "SidecarList",
+	AuthorizationPolicies: "AuthorizationPolicyList",
+	PeerAuthentications:   "PeerAuthenticationList",
+	Pods:                  "PodList",
+	Services:              "ServiceList",
+	Namespaces:            "NamespaceList",
+	Nodes:                 "NodeList",
+	DaemonSets:            "DaemonSetList",
+	Events:                "EventList",
+	KubernetesGateways:    "GatewayList",
+}
+
+// ListKind returns the kind of the list object of a cached resource
+func ListKind(gvr schema.GroupVersionResource) string {
+	return listKinds[gvr]
+}
+
+// Namespaced reports whether a cached resource lives in namespaces
+func Namespaced(gvr schema.GroupVersionResource) bool {
+	return gvr != Namespaces && gvr != Nodes
+}
+
+// Manager keeps one ClusterCache per registered cluster, caches unused for IdleTimeout are evicted
+type Manager struct {
+	IdleTimeout time.Duration
+	caches      map[string]*ClusterCache
+	lock        sync.Mutex
+	janitor     sync.Once
+}
+
+func NewManager(idleTimeout time.Duration) *Manager {
+	return &Manager{
+		IdleTimeout: idleTimeout,
+		caches:      make(map[string]*ClusterCache),
+	}
+}
+
+var Clusters = NewManager(DefaultIdleTimeout)
+
+// Get returns the cache of the cluster, a cache built for an older revision of the cluster is dropped and rebuilt
+func (m *Manager) Get(c *v1Cluster.Cluster) (*ClusterCache, error) {
+	m.janitor.Do(func() {
+		go m.evictLoop()
+	})
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if cc, ok := m.caches[c.Name]; ok {
+		if cc.uuid == c.UUID && cc.updateAt.Equal(c.UpdateAt) {
+			cc.touch()
+			return cc, nil
+		}
+		cc.stop()
+		delete(m.caches, c.Name)
+	}
+	k := kubernetes.NewKubernetes(c)
+	cfg, err := k.Config()
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cc := &ClusterCache{
+		uuid:      c.UUID,
+		updateAt:  c.UpdateAt,
+		k:         k,
+		client:    client,
+		discovery: dc,
+		informers: make(map[schema.GroupVersionResource]*resourceInformer),
+		access:    make(map[accessKey]accessResult),
+		lastUsed:  time.Now(),
+
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+	m.caches[c.Name] = cc
+	return cc, nil
+}
+
+func (m *Manager) evictLoop() {
+	interval := m.IdleTimeout / 2
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		m.evictIdle()
+	}
+}
+
+func (m *Manager) evictIdle() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for name, cc := range m.caches {
+		if cc.idle(m.IdleTimeout) {
+			cc.stop()
+			delete(m.caches, name)
+			continue
+		}
+		cc.pruneAccess()
+	}
+}
+
+// Remove stops all informers of the cluster
+func (m *Manager) Remove(clusterName string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if cc, ok := m.caches[clusterName]; ok {
+		cc.stop()
+		delete(m.caches, clusterName)
+	}
+}
+
+type resourceInformer struct {
+	informer cache.SharedIndexInformer
+	stopCh   chan struct{}
+}
+
+// ClusterCache holds the shared informers of one cluster, informers are started on first use
+type ClusterCache struct {
+	uuid      string
+	updateAt  time.Time
+	k         kubernetes.Interface
+	client    dynamic.Interface
+	discovery discovery.DiscoveryInterface
+	informers map[schema.GroupVersionResource]*resourceInformer
+	lock      sync.Mutex
+
+	lastUsed      time.Time
+	subscriptions map[*Subscription]struct{}
+	stopped       bool
+
+	discoveryCache discoveryCache
+	access         map[accessKey]accessResult
+	accessLock     sync.Mutex
+}
+
+func (c *ClusterCache) touch() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.lastUsed = time.Now()
+}
+
+func (c *ClusterCache) idle(timeout time.Duration) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.subscriptions) == 0 && time.Since(c.lastUsed) > timeout
+}
+
+// Informer returns a synced informer of the resource, starting it if needed
+func (c *ClusterCache) Informer(gvr schema.GroupVersionResource) (cache.SharedIndexInformer, error) {
+	c.lock.Lock()
+	c.lastUsed = time.Now()
+	ri, ok := c.informers[gvr]
+	c.lock.Unlock()
+	if !ok {
+		// discovery is a round trip to the api server, other resources of the cluster must not wait for it
+		if err := c.checkServed(gvr); err != nil {
+			return nil, err
+		}
+	}
+
+	c.lock.Lock()
+	if c.stopped {
+		c.lock.Unlock()
+		return nil, errors.New("cluster cache has been stopped")
+	}
+	ri, ok = c.informers[gvr]
+	if !ok {
+		ri = &resourceInformer{
+			informer: dynamicinformer.NewFilteredDynamicInformer(c.client, gvr, "", 0, cache.Indexers{
+				cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+			}, nil).Informer(),
+			stopCh: make(chan struct{}),
+		}
+		_ = ri.informer.SetTransform(stripManagedFields)
+		c.informers[gvr] = ri
+		go ri.informer.Run(ri.stopCh)
+	}
+	c.lock.Unlock()
+
+	if !ri.informer.HasSynced() {
+		timeout := time.After(syncTimeout)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for !ri.informer.HasSynced() {
+			select {
+			case <-timeout:
+				return nil, fmt.Errorf("wait for %s cache sync timeout", gvr.Resource)
+			case <-ri.stopCh:
+				return nil, errors.New("cluster cache has been stopped")
+			case <-ticker.C:
+			}
+		}
+	}
+	return ri.informer, nil
+}
+
+// List returns the cached objects of the resource, an empty namespace means all namespaces
+func (c *ClusterCache) List(gvr schema.GroupVersionResource, namespace string) ([]*unstructured.Unstructured, error) {
+	inf, err := c.Informer(gvr)
+	if err != nil {
+		return nil, err
+	}
+	var objs []interface{}
+	if namespace == "" {
+		objs = inf.GetStore().List()
+	} else {
+		objs, err = inf.GetIndexer().ByIndex(cache.NamespaceIndex, namespace)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := make([]*unstructured.Unstructured, 0, len(objs))
+	for i := range objs {
+		if u, ok := objs[i].(*unstructured.Unstructured); ok {
+			result = append(result, u)
+		}
+	}
+	return result, nil
+}
+
+// ResourceVersion returns the resource version the cache of the resource was last synced to
+func (c *ClusterCache) ResourceVersion(gvr schema.GroupVersionResource) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if ri, ok := c.informers[gvr]; ok {
+		return ri.informer.LastSyncResourceVersion()
+	}
+	return ""
+}
+
+func (c *ClusterCache) checkServed(gvr schema.GroupVersionResource) error {
+	resources, err := c.discovery.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		if k8sError.IsNotFound(err) {
+			return fmt.Errorf("%w: %s", ErrNotServed, gvr.String())
+		}
+		return err
+	}
+	for i := range resources.APIResources {
+		if resources.APIResources[i].Name == gvr.Resource {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotServed, gvr.String())
+}
+
+// stop stops the informers and closes the subscriptions on them, watch streams end and their clients resubscribe
+// to the new cache
+func (c *ClusterCache) stop() {
+	c.lock.Lock()
+	c.stopped = true
+	for gvr := range c.informers {
+		close(c.informers[gvr].stopCh)
+	}
+	c.informers = make(map[schema.GroupVersionResource]*resourceInformer)
+	subs := make([]*Subscription, 0, len(c.subscriptions))
+	for s := range c.subscriptions {
+		subs = append(subs, s)
+	}
+	c.lock.Unlock()
+	for _, s := range subs {
+		s.Close()
+	}
+}
+
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		u.SetManagedFields(nil)
+	}
+	return obj, nil
+}
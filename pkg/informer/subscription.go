@@ -0,0 +1,201 @@
+package informer
+
+import (
+	"sync"
+	"time"
+
+	"errors"
+	"github.com/KubeOperator/kubepi/pkg/collectons"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	EventAdded    = "ADDED"
+	EventModified = "MODIFIED"
+	EventDeleted  = "DELETED"
+	EventSynced   = "SYNCED"
+)
+
+// Event is an incremental change of a cached object
+type Event struct {
+	Type      string                 `json:"type"`
+	Kind      string                 `json:"kind"`
+	Namespace string                 `json:"namespace"`
+	Name      string                 `json:"name"`
+	Object    map[string]interface{} `json:"object,omitempty"`
+}
+
+// Subscription receives the events of a set of informers until Close is called
+type Subscription struct {
+	Events        chan Event
+	done          chan struct{}
+	once          sync.Once
+	owner         *ClusterCache
+	lock          sync.Mutex
+	closed        bool
+	registrations map[cache.SharedIndexInformer]cache.ResourceEventHandlerRegistration
+}
+
+// Subscribe registers handlers on the informers of the given kinds, objects outside of namespaces are dropped.
+// A nil namespaces set means all namespaces. The current state is delivered as ADDED events followed by one SYNCED event.
+func (c *ClusterCache) Subscribe(kinds []string, namespaces *collectons.StringSet) (*Subscription, error) {
+	return c.SubscribeFiltered(kinds, namespaces, nil)
+}
+
+// SubscribeFiltered is Subscribe with an additional filter, objects for which filter returns false are dropped
+func (c *ClusterCache) SubscribeFiltered(kinds []string, namespaces *collectons.StringSet, filter func(u *unstructured.Unstructured) bool) (*Subscription, error) {
+	return c.subscribe("", kinds, namespaces, filter)
+}
+
+// SubscribeAs is SubscribeFiltered for a user who is not an administrator, objects of a kind the user may not list
+// are dropped the way FilterByAccess drops them
+func (c *ClusterCache) SubscribeAs(username string, kinds []string, namespaces *collectons.StringSet, filter func(u *unstructured.Unstructured) bool) (*Subscription, error) {
+	return c.subscribe(username, kinds, namespaces, filter)
+}
+
+func (c *ClusterCache) subscribe(username string, kinds []string, namespaces *collectons.StringSet, filter func(u *unstructured.Unstructured) bool) (*Subscription, error) {
+	s := &Subscription{
+		Events:        make(chan Event, 100),
+		done:          make(chan struct{}),
+		owner:         c,
+		registrations: make(map[cache.SharedIndexInformer]cache.ResourceEventHandlerRegistration),
+	}
+	// 存在订阅时不回收该集群的缓存，缓存停止时关闭订阅
+	c.lock.Lock()
+	if c.stopped {
+		c.lock.Unlock()
+		return nil, errors.New("cluster cache has been stopped")
+	}
+	c.subscriptions[s] = struct{}{}
+	c.lock.Unlock()
+	for _, kind := range kinds {
+		gvr, ok := Kinds[kind]
+		if !ok {
+			continue
+		}
+		inf, err := c.Informer(gvr)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		reg, err := inf.AddEventHandler(s.handlerFor(kind, namespaces, s.accessFilter(username, gvr, filter)))
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		// 缓存停止时 Close 可能与订阅并发执行，关闭后注册的 handler 需要立即移除
+		s.lock.Lock()
+		if s.closed {
+			s.lock.Unlock()
+			_ = inf.RemoveEventHandler(reg)
+			return nil, errors.New("cluster cache has been stopped")
+		}
+		s.registrations[inf] = reg
+		s.lock.Unlock()
+	}
+	go s.notifySynced()
+	return s, nil
+}
+
+// accessFilter adds the access check of the user to filter, answers are cached by Allowed
+func (s *Subscription) accessFilter(username string, gvr schema.GroupVersionResource, filter func(u *unstructured.Unstructured) bool) func(u *unstructured.Unstructured) bool {
+	if username == "" {
+		return filter
+	}
+	return func(u *unstructured.Unstructured) bool {
+		if filter != nil && !filter(u) {
+			return false
+		}
+		objs, err := s.owner.FilterByAccess(username, gvr, []*unstructured.Unstructured{u})
+		return err == nil && len(objs) == 1
+	}
+}
+
+// Done is closed when the subscription is closed
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close removes the handlers from the informers, it is safe to call it more than once
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.lock.Lock()
+		s.closed = true
+		registrations := s.registrations
+		s.registrations = nil
+		s.lock.Unlock()
+		for inf, reg := range registrations {
+			_ = inf.RemoveEventHandler(reg)
+		}
+		s.owner.lock.Lock()
+		delete(s.owner.subscriptions, s)
+		s.owner.lastUsed = time.Now()
+		s.owner.lock.Unlock()
+	})
+}
+
+func (s *Subscription) notifySynced() {
+	s.lock.Lock()
+	regs := make([]cache.ResourceEventHandlerRegistration, 0, len(s.registrations))
+	for _, reg := range s.registrations {
+		regs = append(regs, reg)
+	}
+	s.lock.Unlock()
+	for _, reg := range regs {
+		if !cache.WaitForCacheSync(s.done, reg.HasSynced) {
+			return
+		}
+	}
+	s.send(Event{Type: EventSynced})
+}
+
+func (s *Subscription) send(e Event) {
+	select {
+	case s.Events <- e:
+	case <-s.done:
+	}
+}
+
+func (s *Subscription) handlerFor(kind string, namespaces *collectons.StringSet, filter func(u *unstructured.Unstructured) bool) cache.ResourceEventHandler {
+	emit := func(eventType string, obj interface{}) {
+		if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = d.Obj
+		}
+		u, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return
+		}
+		if namespaces != nil && !namespaces.Exists(u.GetNamespace()) {
+			return
+		}
+		if filter != nil && !filter(u) {
+			return
+		}
+		s.send(Event{
+			Type:      eventType,
+			Kind:      kind,
+			Namespace: u.GetNamespace(),
+			Name:      u.GetName(),
+			Object:    u.Object,
+		})
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			emit(EventAdded, obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			o, ok1 := oldObj.(*unstructured.Unstructured)
+			n, ok2 := newObj.(*unstructured.Unstructured)
+			if ok1 && ok2 && o.GetResourceVersion() == n.GetResourceVersion() {
+				return
+			}
+			emit(EventModified, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			emit(EventDeleted, obj)
+		},
+	}
+}
@@ -0,0 +1,82 @@
+package informer
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakeDiscovery "k8s.io/client-go/discovery/fake"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+	k8sTesting "k8s.io/client-go/testing"
+)
+
+func newTestCache() *ClusterCache {
+	pod := &unstructured.Unstructured{}
+	pod.SetAPIVersion("v1")
+	pod.SetKind("Pod")
+	pod.SetNamespace("default")
+	pod.SetName("nginx")
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		Pods: "PodList",
+	}, pod)
+	dc := &fakeDiscovery.FakeDiscovery{Fake: &k8sTesting.Fake{Resources: []*metav1.APIResourceList{
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "pods", Kind: "Pod", Namespaced: true}}},
+	}}}
+	return &ClusterCache{
+		client:        client,
+		discovery:     dc,
+		informers:     make(map[schema.GroupVersionResource]*resourceInformer),
+		access:        make(map[accessKey]accessResult),
+		lastUsed:      time.Now(),
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// run with -race, stop closes the subscriptions while they are still registering handlers
+func TestSubscribeWhileStopping(t *testing.T) {
+	kinds := make([]string, 50)
+	for i := range kinds {
+		kinds[i] = "pods"
+	}
+	for round := 0; round < 10; round++ {
+		c := newTestCache()
+		if _, err := c.Informer(Pods); err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		subs := make(chan *Subscription, 20)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if s, err := c.subscribe("", kinds, nil, nil); err == nil {
+					subs <- s
+				}
+			}()
+		}
+		time.Sleep(time.Duration(round) * 100 * time.Microsecond)
+		c.stop()
+		wg.Wait()
+		close(subs)
+
+		for s := range subs {
+			select {
+			case <-s.Done():
+			default:
+				t.Error("subscription is left open after the cache stopped")
+			}
+		}
+		if _, err := c.subscribe("", kinds, nil, nil); err == nil {
+			t.Error("expect subscribe to fail on a stopped cache")
+		}
+		c.lock.Lock()
+		if len(c.subscriptions) != 0 {
+			t.Errorf("expect no subscription after stop, got %d", len(c.subscriptions))
+		}
+		c.lock.Unlock()
+	}
+}
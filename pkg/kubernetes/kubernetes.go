@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"regexp"
 	"sort"
 	"strconv"
@@ -13,6 +14,7 @@ import (
 	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
 	"github.com/KubeOperator/kubepi/pkg/certificate"
 	"github.com/KubeOperator/kubepi/pkg/collectons"
+	"github.com/KubeOperator/kubepi/pkg/tunnel"
 	v1 "k8s.io/api/authorization/v1"
 	certv1 "k8s.io/api/certificates/v1"
 	certv1beta1 "k8s.io/api/certificates/v1beta1"
@@ -35,6 +37,7 @@ type Interface interface {
 	Config() (*rest.Config, error)
 	Client() (*kubernetes.Clientset, error)
 	HasPermission(attributes v1.ResourceAttributes) (PermissionCheckResult, error)
+	UserHasPermission(username string, attributes v1.ResourceAttributes) (PermissionCheckResult, error)
 	CreateCommonUser(commonName string) ([]byte, error)
 	CreateDefaultClusterRoles() error
 	GetUserNamespaceNames(username string, options ...interface{}) ([]string, error)
@@ -47,6 +50,7 @@ type Interface interface {
 	CreateOrUpdateClusterRoleBinding(clusterRoleName string, username string, builtIn bool) error
 	CreateOrUpdateRolebinding(namespace string, clusterRoleName string, username string, builtIn bool) error
 	CreateAppMarketCRD() error
+	ClientCA() ([]byte, error)
 }
 
 type Kubernetes struct {
@@ -378,6 +382,23 @@ func (k *Kubernetes) CreateDefaultClusterRoles() error {
 	return nil
 }
 
+// ClientCA 返回 ApiServer 用于校验客户端证书的 CA
+func (k *Kubernetes) ClientCA() ([]byte, error) {
+	client, err := k.Client()
+	if err != nil {
+		return nil, err
+	}
+	cm, err := client.CoreV1().ConfigMaps("kube-system").Get(context.TODO(), "extension-apiserver-authentication", metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	ca, ok := cm.Data["client-ca-file"]
+	if !ok {
+		return nil, errors.New("client-ca-file not found in kube-system/extension-apiserver-authentication")
+	}
+	return []byte(ca), nil
+}
+
 func (k *Kubernetes) CreateCommonUser(commonName string) ([]byte, error) {
 	// 生成用户证书申请
 	cert, err := certificate.CreateClientCertificateRequest(commonName, k.PrivateKey)
@@ -503,6 +524,11 @@ func (k *Kubernetes) HasPermission(attributes v1.ResourceAttributes) (Permission
 	if err != nil {
 		return PermissionCheckResult{}, err
 	}
+	return SelfHasPermission(client, attributes)
+}
+
+// SelfHasPermission 检查 client 所使用的凭据是否具备权限
+func SelfHasPermission(client kubernetes.Interface, attributes v1.ResourceAttributes) (PermissionCheckResult, error) {
 	resp, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(context.TODO(), &v1.SelfSubjectAccessReview{
 		Spec: v1.SelfSubjectAccessReviewSpec{
 			ResourceAttributes: &attributes,
@@ -517,11 +543,35 @@ func (k *Kubernetes) HasPermission(attributes v1.ResourceAttributes) (Permission
 	}, nil
 
 }
+
+// UserHasPermission 以管理员身份检查指定用户是否具备权限
+func (k *Kubernetes) UserHasPermission(username string, attributes v1.ResourceAttributes) (PermissionCheckResult, error) {
+	client, err := k.Client()
+	if err != nil {
+		return PermissionCheckResult{}, err
+	}
+	resp, err := client.AuthorizationV1().SubjectAccessReviews().Create(context.TODO(), &v1.SubjectAccessReview{
+		Spec: v1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+			User:               username,
+			Groups:             []string{"system:authenticated"},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return PermissionCheckResult{}, err
+	}
+	return PermissionCheckResult{
+		Resource: attributes,
+		Allowed:  resp.Status.Allowed,
+	}, nil
+}
+
 func (k *Kubernetes) Config() (*rest.Config, error) {
 	if k.Spec.Local {
 		return rest.InClusterConfig()
 	}
-	if k.Spec.Connect.Direction == "forward" {
+	direction := k.Spec.Connect.Direction
+	if direction == v1Cluster.ConnectDirectionForward || direction == v1Cluster.ConnectDirectionReverse {
 		kubeConf := &rest.Config{
 			Host: k.Spec.Connect.Forward.ApiServer,
 		}
@@ -545,6 +595,18 @@ func (k *Kubernetes) Config() (*rest.Config, error) {
 			}
 			kubeConf = cfg
 		}
+		if direction == v1Cluster.ConnectDirectionReverse {
+			// 反向连接时所有请求（包括 exec、日志等升级连接）都经 agent 的隧道发出
+			kubeConf.Dial = tunnel.Tunnels.Dialer(k.Name, k.Spec.Connect.Reverse.Token)
+		}
+		proxyURL, err := ProxyURL(k.Cluster)
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL != nil {
+			// client-go 的普通请求与 SPDY 升级连接都会使用 Proxy
+			kubeConf.Proxy = http.ProxyURL(proxyURL)
+		}
 		return kubeConf, nil
 	}
 	return nil, nil
@@ -0,0 +1,38 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+)
+
+// ProxyURL returns the proxy of the cluster with its credentials, nil when the api server is dialed directly.
+// http and https proxies are used with CONNECT, socks5 proxies resolve the api server host themselves.
+func ProxyURL(c *v1Cluster.Cluster) (*url.URL, error) {
+	p := c.Spec.Connect.Forward.Proxy
+	if c.Spec.Connect.Direction != v1Cluster.ConnectDirectionForward || p.URL == "" {
+		return nil, nil
+	}
+	raw := p.URL
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %s: %w", p.URL, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %s, only http, https and socks5 are supported", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %s: missing host", p.URL)
+	}
+	if p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+	return u, nil
+}
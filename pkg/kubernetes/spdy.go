@@ -0,0 +1,44 @@
+package kubernetes
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	apispdy "k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// SPDYRoundTripperFor is spdy.RoundTripperFor honoring cfg.Dial, client-go dials upgraded connections itself otherwise
+func SPDYRoundTripperFor(cfg *rest.Config) (http.RoundTripper, spdy.Upgrader, error) {
+	if cfg.Dial == nil {
+		return spdy.RoundTripperFor(cfg)
+	}
+	tlsConfig, err := rest.TLSConfigFor(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	upgradeRoundTripper, err := apispdy.NewRoundTripperWithConfig(apispdy.RoundTripperConfig{
+		PingPeriod:       5 * time.Second,
+		UpgradeTransport: &http.Transport{TLSClientConfig: tlsConfig, DialContext: cfg.Dial},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapper, err := rest.HTTPWrappersForConfig(cfg, upgradeRoundTripper)
+	if err != nil {
+		return nil, nil, err
+	}
+	return wrapper, upgradeRoundTripper, nil
+}
+
+// NewSPDYExecutor is remotecommand.NewSPDYExecutor on top of SPDYRoundTripperFor
+func NewSPDYExecutor(cfg *rest.Config, method string, url *url.URL) (remotecommand.Executor, error) {
+	wrapper, upgrader, err := SPDYRoundTripperFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return remotecommand.NewSPDYExecutorForTransports(wrapper, upgrader, method, url)
+}
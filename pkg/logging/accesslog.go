@@ -0,0 +1,267 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IstioProxyContainer is the name of the injected sidecar container
+const IstioProxyContainer = "istio-proxy"
+
+// AccessLogEntry holds the fields of one Envoy access log line
+type AccessLogEntry struct {
+	Pod                     string `json:"pod,omitempty"`
+	StartTime               string `json:"startTime"`
+	Method                  string `json:"method"`
+	Path                    string `json:"path"`
+	Protocol                string `json:"protocol"`
+	ResponseCode            int    `json:"responseCode"`
+	ResponseFlags           string `json:"responseFlags"`
+	ResponseCodeDetails     string `json:"responseCodeDetails,omitempty"`
+	BytesReceived           int64  `json:"bytesReceived"`
+	BytesSent               int64  `json:"bytesSent"`
+	Duration                int64  `json:"duration"`
+	UpstreamServiceTime     string `json:"upstreamServiceTime,omitempty"`
+	ForwardedFor            string `json:"forwardedFor,omitempty"`
+	UserAgent               string `json:"userAgent,omitempty"`
+	RequestID               string `json:"requestId,omitempty"`
+	Authority               string `json:"authority,omitempty"`
+	UpstreamHost            string `json:"upstreamHost,omitempty"`
+	UpstreamCluster         string `json:"upstreamCluster"`
+	DownstreamLocalAddress  string `json:"downstreamLocalAddress,omitempty"`
+	DownstreamRemoteAddress string `json:"downstreamRemoteAddress,omitempty"`
+	RequestedServerName     string `json:"requestedServerName,omitempty"`
+	RouteName               string `json:"routeName"`
+	Raw                     string `json:"raw"`
+}
+
+// ParseAccessLog parses a line written with Istio's default text format or its JSON encoding.
+// Lines that are not access logs, e.g. the proxy's own logs, are reported with ok=false.
+func ParseAccessLog(line string) (*AccessLogEntry, bool) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		return parseJSONAccessLog(line)
+	}
+	if strings.HasPrefix(line, "[") {
+		return parseTextAccessLog(line)
+	}
+	return nil, false
+}
+
+func parseJSONAccessLog(line string) (*AccessLogEntry, bool) {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &m); err != nil {
+		return nil, false
+	}
+	if _, ok := m["response_code"]; !ok {
+		return nil, false
+	}
+	str := func(key string) string {
+		switch v := m[key].(type) {
+		case string:
+			return v
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return ""
+	}
+	e := &AccessLogEntry{
+		StartTime:               str("start_time"),
+		Method:                  str("method"),
+		Path:                    str("path"),
+		Protocol:                str("protocol"),
+		ResponseFlags:           str("response_flags"),
+		ResponseCodeDetails:     str("response_code_details"),
+		UpstreamServiceTime:     str("upstream_service_time"),
+		ForwardedFor:            str("x_forwarded_for"),
+		UserAgent:               str("user_agent"),
+		RequestID:               str("request_id"),
+		Authority:               str("authority"),
+		UpstreamHost:            str("upstream_host"),
+		UpstreamCluster:         str("upstream_cluster"),
+		DownstreamLocalAddress:  str("downstream_local_address"),
+		DownstreamRemoteAddress: str("downstream_remote_address"),
+		RequestedServerName:     str("requested_server_name"),
+		RouteName:               str("route_name"),
+		Raw:                     line,
+	}
+	e.ResponseCode, _ = strconv.Atoi(str("response_code"))
+	e.BytesReceived, _ = strconv.ParseInt(str("bytes_received"), 10, 64)
+	e.BytesSent, _ = strconv.ParseInt(str("bytes_sent"), 10, 64)
+	e.Duration, _ = strconv.ParseInt(str("duration"), 10, 64)
+	return e, true
+}
+
+// 默认文本格式：
+// [%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" %RESPONSE_CODE% %RESPONSE_FLAGS%
+// %RESPONSE_CODE_DETAILS% %CONNECTION_TERMINATION_DETAILS% "%UPSTREAM_TRANSPORT_FAILURE_REASON%" %BYTES_RECEIVED% %BYTES_SENT%
+// %DURATION% %RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" "%REQ(X-REQUEST-ID)%"
+// "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%" %UPSTREAM_CLUSTER% %UPSTREAM_LOCAL_ADDRESS% %DOWNSTREAM_LOCAL_ADDRESS%
+// %DOWNSTREAM_REMOTE_ADDRESS% %REQUESTED_SERVER_NAME% %ROUTE_NAME%
+// Istio 1.9 之前没有 RESPONSE_CODE_DETAILS 等三个字段，因此响应码之后的字段从行尾开始定位
+const (
+	textFieldsLegacy = 20
+	textFields       = 22
+)
+
+func parseTextAccessLog(line string) (*AccessLogEntry, bool) {
+	fields := splitAccessLog(line)
+	if len(fields) != textFields && len(fields) != textFieldsLegacy {
+		return nil, false
+	}
+	code, err := strconv.Atoi(fields[2])
+	if err != nil && fields[2] != "-" {
+		return nil, false
+	}
+	n := len(fields)
+	e := &AccessLogEntry{
+		StartTime:               fields[0],
+		ResponseCode:            code,
+		ResponseFlags:           fields[3],
+		UpstreamServiceTime:     fields[n-12],
+		ForwardedFor:            fields[n-11],
+		UserAgent:               fields[n-10],
+		RequestID:               fields[n-9],
+		Authority:               fields[n-8],
+		UpstreamHost:            fields[n-7],
+		UpstreamCluster:         fields[n-6],
+		DownstreamLocalAddress:  fields[n-4],
+		DownstreamRemoteAddress: fields[n-3],
+		RequestedServerName:     fields[n-2],
+		RouteName:               fields[n-1],
+		Raw:                     line,
+	}
+	if n == textFields {
+		e.ResponseCodeDetails = fields[4]
+	}
+	request := strings.SplitN(fields[1], " ", 3)
+	if len(request) == 3 {
+		e.Method, e.Path, e.Protocol = request[0], request[1], request[2]
+	}
+	e.BytesReceived, _ = strconv.ParseInt(fields[n-15], 10, 64)
+	e.BytesSent, _ = strconv.ParseInt(fields[n-14], 10, 64)
+	e.Duration, _ = strconv.ParseInt(fields[n-13], 10, 64)
+	return e, true
+}
+
+// splitAccessLog splits on spaces, keeping "quoted" and [bracketed] fields together without their delimiters
+func splitAccessLog(line string) []string {
+	var fields []string
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case ' ':
+			i++
+			continue
+		case '"', '[':
+			end := byte('"')
+			if line[i] == '[' {
+				end = ']'
+			}
+			j := strings.IndexByte(line[i+1:], end)
+			if j < 0 {
+				fields = append(fields, line[i+1:])
+				return fields
+			}
+			fields = append(fields, line[i+1:i+1+j])
+			i += j + 2
+		default:
+			j := strings.IndexByte(line[i:], ' ')
+			if j < 0 {
+				fields = append(fields, line[i:])
+				return fields
+			}
+			fields = append(fields, line[i:i+j])
+			i += j
+		}
+	}
+	return fields
+}
+
+// AccessLogFilter selects entries on the server side, empty conditions match everything
+type AccessLogFilter struct {
+	// StatusCodes accepts exact codes (404), classes (5xx) and ranges (400-499)
+	StatusCodes []string
+	// ResponseFlags matches entries having any of the flags, e.g. UH, UF, NR
+	ResponseFlags []string
+	// Path matches entries whose path contains it
+	Path string
+}
+
+// ParseAccessLogFilter builds a filter from comma separated lists and validates the status code expressions
+func ParseAccessLogFilter(codes, flags, path string) (AccessLogFilter, error) {
+	f := AccessLogFilter{Path: path}
+	for _, c := range splitList(codes) {
+		if _, _, err := codeRange(c); err != nil {
+			return f, err
+		}
+		f.StatusCodes = append(f.StatusCodes, c)
+	}
+	f.ResponseFlags = splitList(flags)
+	return f, nil
+}
+
+func splitList(s string) []string {
+	var result []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func codeRange(expr string) (int, int, error) {
+	if len(expr) == 3 && strings.HasSuffix(strings.ToLower(expr), "xx") {
+		class, err := strconv.Atoi(expr[:1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid status code %s", expr)
+		}
+		return class * 100, class*100 + 99, nil
+	}
+	if ss := strings.SplitN(expr, "-", 2); len(ss) == 2 {
+		from, err1 := strconv.Atoi(ss[0])
+		to, err2 := strconv.Atoi(ss[1])
+		if err1 != nil || err2 != nil || from > to {
+			return 0, 0, fmt.Errorf("invalid status code range %s", expr)
+		}
+		return from, to, nil
+	}
+	code, err := strconv.Atoi(expr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid status code %s", expr)
+	}
+	return code, code, nil
+}
+
+func (f AccessLogFilter) Match(e *AccessLogEntry) bool {
+	if len(f.StatusCodes) > 0 {
+		matched := false
+		for _, c := range f.StatusCodes {
+			from, to, _ := codeRange(c)
+			if e.ResponseCode >= from && e.ResponseCode <= to {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.ResponseFlags) > 0 {
+		matched := false
+		flags := strings.Split(e.ResponseFlags, ",")
+		for _, want := range f.ResponseFlags {
+			for _, got := range flags {
+				if got == want {
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return f.Path == "" || strings.Contains(e.Path, f.Path)
+}
@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type AccessLogOptions struct {
+	TailLines int64
+	Follow    bool
+	Filter    AccessLogFilter
+}
+
+// WaitForAccessLogStream tails the istio-proxy container of the pods once the session is bound,
+// matching entries are sent as JSON, lines that are not access logs are dropped
+func WaitForAccessLogStream(k8sClient kubernetes.Interface, namespace string, pods []string, opts AccessLogOptions, sessionId string) {
+	select {
+	case <-LogSessions.Get(sessionId).Bound:
+		close(LogSessions.Get(sessionId).Bound)
+		err := startAccessLogProcess(k8sClient, namespace, pods, opts, LogSessions.Get(sessionId))
+		if err != nil {
+			LogSessions.Close(sessionId, err.Error(), 2)
+			return
+		}
+		LogSessions.Close(sessionId, "Process exited", 1)
+	}
+}
+
+func startAccessLogProcess(k8sClient kubernetes.Interface, namespace string, pods []string, opts AccessLogOptions, session LogSession) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	entries := make(chan *AccessLogEntry, 100)
+	errs := make(chan error, len(pods))
+	var wg sync.WaitGroup
+	for _, pod := range pods {
+		wg.Add(1)
+		go func(pod string) {
+			defer wg.Done()
+			if err := tailAccessLog(ctx, k8sClient, namespace, pod, opts, entries); err != nil && ctx.Err() == nil {
+				errs <- err
+			}
+		}(pod)
+	}
+	go func() {
+		wg.Wait()
+		close(entries)
+	}()
+
+	ss := session.sockJSSession
+	for e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			continue
+		}
+		// 前端断开后停止所有 Pod 的日志流
+		if err := ss.Send(string(data)); err != nil {
+			return err
+		}
+	}
+	// 所有 Pod 都失败时才返回错误，例如 Pod 没有注入 sidecar
+	if len(errs) == len(pods) && len(pods) > 0 {
+		return <-errs
+	}
+	return nil
+}
+
+// CollectAccessLogs reads the last TailLines access log entries of every pod without following,
+// pods whose logs can not be read, e.g. because they have no sidecar, are skipped
+func CollectAccessLogs(k8sClient kubernetes.Interface, namespace string, pods []string, opts AccessLogOptions) []*AccessLogEntry {
+	opts.Follow = false
+	entries := make(chan *AccessLogEntry, 100)
+	var wg sync.WaitGroup
+	for _, pod := range pods {
+		wg.Add(1)
+		go func(pod string) {
+			defer wg.Done()
+			_ = tailAccessLog(context.Background(), k8sClient, namespace, pod, opts, entries)
+		}(pod)
+	}
+	go func() {
+		wg.Wait()
+		close(entries)
+	}()
+	var result []*AccessLogEntry
+	for e := range entries {
+		result = append(result, e)
+	}
+	return result
+}
+
+func tailAccessLog(ctx context.Context, k8sClient kubernetes.Interface, namespace, pod string, opts AccessLogOptions, entries chan<- *AccessLogEntry) error {
+	tailLines := opts.TailLines
+	reader, err := k8sClient.CoreV1().
+		Pods(namespace).
+		GetLogs(pod, &v1.PodLogOptions{
+			Container: IstioProxyContainer,
+			Follow:    opts.Follow,
+			TailLines: &tailLines,
+		}).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		e, ok := ParseAccessLog(scanner.Text())
+		if !ok || !opts.Filter.Match(e) {
+			continue
+		}
+		e.Pod = pod
+		select {
+		case entries <- e:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return scanner.Err()
+}
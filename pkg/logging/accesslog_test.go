@@ -0,0 +1,90 @@
+package logging
+
+import "testing"
+
+func TestParseAccessLog(t *testing.T) {
+	cases := []struct {
+		line     string
+		ok       bool
+		code     int
+		flags    string
+		path     string
+		cluster  string
+		duration int64
+		route    string
+	}{
+		{
+			line:     `[2020-11-25T21:26:18.409Z] "GET /status/418 HTTP/1.1" 418 - via_upstream - "-" 0 135 4 4 "-" "curl/7.73.0-DEV" "84961386-6d84-929d-98bd-c5aee93b5c88" "httpbin:8000" "10.44.1.27:80" outbound|8000||httpbin.foo.svc.cluster.local 10.44.1.23:37652 10.0.45.184:8000 10.44.1.23:46520 - default`,
+			ok:       true,
+			code:     418,
+			flags:    "-",
+			path:     "/status/418",
+			cluster:  "outbound|8000||httpbin.foo.svc.cluster.local",
+			duration: 4,
+			route:    "default",
+		},
+		{
+			// Istio 1.9 之前的格式
+			line:     `[2020-05-01T09:00:00.000Z] "GET /productpage HTTP/1.1" 503 UH "-" 0 91 0 - "-" "curl/7.64.0" "5a6f-1" "productpage:9080" "-" outbound|9080||productpage.default.svc.cluster.local - 10.96.0.10:9080 10.1.0.5:40000 - -`,
+			ok:       true,
+			code:     503,
+			flags:    "UH",
+			path:     "/productpage",
+			cluster:  "outbound|9080||productpage.default.svc.cluster.local",
+			duration: 0,
+			route:    "-",
+		},
+		{
+			line:     `{"start_time":"2023-01-01T00:00:00.000Z","method":"POST","path":"/api","protocol":"HTTP/2","response_code":502,"response_flags":"UF,URX","upstream_cluster":"outbound|80||api.default.svc.cluster.local","duration":12,"route_name":"api"}`,
+			ok:       true,
+			code:     502,
+			flags:    "UF,URX",
+			path:     "/api",
+			cluster:  "outbound|80||api.default.svc.cluster.local",
+			duration: 12,
+			route:    "api",
+		},
+		{line: `2023-01-01T00:00:00.000000Z	info	Envoy proxy is ready`, ok: false},
+	}
+	for _, c := range cases {
+		e, ok := ParseAccessLog(c.line)
+		if ok != c.ok {
+			t.Errorf("%s: expect ok=%v", c.line, c.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if e.ResponseCode != c.code || e.ResponseFlags != c.flags || e.Path != c.path || e.UpstreamCluster != c.cluster || e.Duration != c.duration || e.RouteName != c.route {
+			t.Errorf("%s: unexpected entry %+v", c.line, e)
+		}
+	}
+}
+
+func TestAccessLogFilter(t *testing.T) {
+	entry := &AccessLogEntry{ResponseCode: 503, ResponseFlags: "UF,URX", Path: "/api/v1/orders"}
+	cases := []struct {
+		codes, flags, path string
+		match              bool
+	}{
+		{match: true},
+		{codes: "5xx", match: true},
+		{codes: "200,404", match: false},
+		{codes: "500-503", flags: "URX", match: true},
+		{flags: "UH", match: false},
+		{path: "/orders", match: true},
+		{codes: "5xx", path: "/users", match: false},
+	}
+	for _, c := range cases {
+		f, err := ParseAccessLogFilter(c.codes, c.flags, c.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.Match(entry); got != c.match {
+			t.Errorf("codes=%q flags=%q path=%q: expect %v, got %v", c.codes, c.flags, c.path, c.match, got)
+		}
+	}
+	if _, err := ParseAccessLogFilter("abc", "", ""); err == nil {
+		t.Error("expect invalid status code to be rejected")
+	}
+}
@@ -0,0 +1,363 @@
+package logging
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// maxLineSize bounds a single log line, a longer line ends the stream of its container
+	maxLineSize = 1 << 20
+	// rewatchDelay is the pause before listing the pods again after a watch ended
+	rewatchDelay = time.Second
+)
+
+// AggregateOptions selects the pods and the log range of an aggregated stream
+type AggregateOptions struct {
+	Namespace string
+	Selector  labels.Selector
+	// Container limits the stream to containers with this name, all containers when empty
+	Container    string
+	SinceTime    *metav1.Time
+	SinceSeconds *int64
+	// Until drops lines logged after it, only used without Follow
+	Until      *time.Time
+	TailLines  *int64
+	Follow     bool
+	Timestamps bool
+	// Grep keeps only the lines matching it, the prefix is not matched
+	Grep *regexp.Regexp
+}
+
+// Aggregate streams the logs of every container of the pods matching the selector to out, one line per call,
+// prefixed with [pod/container]. With Follow the pods are watched and pods started later join the stream,
+// the call returns when ctx is done. Without Follow the containers are read one after another.
+func Aggregate(ctx context.Context, client kubernetes.Interface, opts AggregateOptions, out func(line string) error) error {
+	a := &aggregator{client: client, opts: opts, out: out, streams: map[string]*containerStream{}}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a.cancel = cancel
+
+	pods, err := client.CoreV1().Pods(opts.Namespace).List(ctx, metav1.ListOptions{LabelSelector: opts.Selector.String()})
+	if err != nil {
+		return err
+	}
+	if !opts.Follow {
+		for i := range pods.Items {
+			if pods.Items[i].Status.Phase == v1.PodPending {
+				continue
+			}
+			for _, container := range a.containers(&pods.Items[i]) {
+				if err := a.stream(ctx, &pods.Items[i], container, 0, resumeFrom{}); err != nil && ctx.Err() == nil {
+					a.emit(fmt.Sprintf("[%s/%s] %s", pods.Items[i].Name, container, err.Error()))
+				}
+			}
+		}
+		return a.error()
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	start := func(pod *v1.Pod) {
+		if pod.Status.Phase != v1.PodRunning {
+			return
+		}
+		for _, container := range a.containers(pod) {
+			restarts, running := containerState(pod, container)
+			if !running {
+				continue
+			}
+			from, ok := a.claim(pod.UID, container, restarts)
+			if !ok {
+				continue
+			}
+			wg.Add(1)
+			go func(pod *v1.Pod, container string, restarts int32) {
+				defer wg.Done()
+				defer a.release(pod.UID, container, restarts)
+				if err := a.stream(ctx, pod, container, restarts, from); err != nil && ctx.Err() == nil {
+					a.emit(fmt.Sprintf("[%s/%s] %s", pod.Name, container, err.Error()))
+				}
+			}(pod, container, restarts)
+		}
+	}
+	for i := range pods.Items {
+		start(&pods.Items[i])
+	}
+	resourceVersion := pods.ResourceVersion
+	for {
+		// a watch ends when it expires or the api server restarts, list again so that no pod is missed in between
+		a.watch(ctx, resourceVersion, start)
+		for {
+			select {
+			case <-ctx.Done():
+				return a.error()
+			case <-time.After(rewatchDelay):
+			}
+			if pods, err = client.CoreV1().Pods(opts.Namespace).List(ctx, metav1.ListOptions{LabelSelector: opts.Selector.String()}); err == nil {
+				break
+			}
+		}
+		for i := range pods.Items {
+			start(&pods.Items[i])
+		}
+		resourceVersion = pods.ResourceVersion
+	}
+}
+
+// watch starts the containers of the pods added or changed after resourceVersion until the watch ends
+func (a *aggregator) watch(ctx context.Context, resourceVersion string, start func(pod *v1.Pod)) {
+	w, err := a.client.CoreV1().Pods(a.opts.Namespace).Watch(ctx, metav1.ListOptions{
+		LabelSelector:   a.opts.Selector.String(),
+		ResourceVersion: resourceVersion,
+	})
+	if err != nil {
+		return
+	}
+	defer w.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.ResultChan():
+			if !ok || event.Type == watch.Error {
+				return
+			}
+			if pod, isPod := event.Object.(*v1.Pod); isPod && (event.Type == watch.Added || event.Type == watch.Modified) {
+				start(pod)
+			}
+		}
+	}
+}
+
+// containerState returns the restart count of the container and whether it is running, a pod without container
+// statuses is taken as running
+func containerState(pod *v1.Pod, container string) (int32, bool) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container {
+			return status.RestartCount, status.State.Running != nil
+		}
+	}
+	return 0, true
+}
+
+type aggregator struct {
+	client  kubernetes.Interface
+	opts    AggregateOptions
+	out     func(line string) error
+	cancel  context.CancelFunc
+	lock    sync.Mutex
+	streams map[string]*containerStream
+	err     error
+}
+
+// containerStream is the last streamed instance of a container
+type containerStream struct {
+	restarts int32
+	running  bool
+	// last is the time of the last line read from the instance
+	last time.Time
+}
+
+// resumeFrom is where a stream starts: with the options of the aggregation for a new container, from the first line
+// of a restarted container, or after the last line read when the stream of a running instance ended early
+type resumeFrom struct {
+	restarted bool
+	after     time.Time
+}
+
+func (a *aggregator) error() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.err
+}
+
+func (a *aggregator) containers(pod *v1.Pod) []string {
+	var names []string
+	for _, c := range pod.Spec.Containers {
+		if a.opts.Container == "" || a.opts.Container == c.Name {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// claim marks the container of the pod as streamed and tells where its stream starts, it returns false while the
+// instance is streamed or when there is nothing to resume
+func (a *aggregator) claim(uid types.UID, container string, restarts int32) (resumeFrom, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	key := string(uid) + "/" + container
+	s := a.streams[key]
+	switch {
+	case s == nil:
+		a.streams[key] = &containerStream{restarts: restarts, running: true}
+		return resumeFrom{}, true
+	case restarts > s.restarts:
+		// the stream of the previous instance ends by itself
+		*s = containerStream{restarts: restarts, running: true}
+		return resumeFrom{restarted: true}, true
+	case s.running || restarts < s.restarts || s.last.IsZero():
+		return resumeFrom{}, false
+	}
+	s.running = true
+	return resumeFrom{after: s.last}, true
+}
+
+// release marks the stream of the instance as ended, it is resumed on a later event of the pod
+func (a *aggregator) release(uid types.UID, container string, restarts int32) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if s := a.streams[string(uid)+"/"+container]; s != nil && s.restarts == restarts {
+		s.running = false
+	}
+}
+
+// read records the time of a line read from the instance
+func (a *aggregator) read(key string, restarts int32, t time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if s := a.streams[key]; s != nil && s.restarts == restarts && t.After(s.last) {
+		s.last = t
+	}
+}
+
+// emit serializes writes to out, the first write error stops the whole stream and makes emit return false
+func (a *aggregator) emit(line string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.err != nil {
+		return false
+	}
+	if err := a.out(line); err != nil {
+		a.err = err
+		a.cancel()
+		return false
+	}
+	return true
+}
+
+// stream copies the log of the container instance to out
+func (a *aggregator) stream(ctx context.Context, pod *v1.Pod, container string, restarts int32, from resumeFrom) error {
+	logOpts := &v1.PodLogOptions{
+		Container:    container,
+		Follow:       a.opts.Follow,
+		SinceTime:    a.opts.SinceTime,
+		SinceSeconds: a.opts.SinceSeconds,
+		TailLines:    a.opts.TailLines,
+		// timestamps are always requested so that Until can be applied, they are removed again when not wanted
+		Timestamps: true,
+	}
+	if from.restarted || !from.after.IsZero() {
+		logOpts.SinceTime, logOpts.SinceSeconds, logOpts.TailLines = nil, nil, nil
+	}
+	if !from.after.IsZero() {
+		// since time is sent in seconds, the lines up to the last one read are dropped again in scan
+		logOpts.SinceTime = &metav1.Time{Time: from.after}
+	}
+	reader, err := a.client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, logOpts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	key := string(pod.UID) + "/" + container
+	return a.scan(reader, fmt.Sprintf("[%s/%s] ", pod.Name, container), from.after, func(t time.Time) {
+		a.read(key, restarts, t)
+	})
+}
+
+// scan emits the lines of reader logged after the given time, read is called with the time of every line
+func (a *aggregator) scan(reader io.Reader, prefix string, after time.Time, read func(time.Time)) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if t, ok := lineTime(line); ok {
+			if !t.After(after) {
+				continue
+			}
+			read(t)
+		}
+		if line = a.filter(line); line == "" {
+			continue
+		}
+		if !a.emit(prefix + line) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// lineTime parses the timestamp the api server puts in front of a line
+func lineTime(line string) (time.Time, bool) {
+	i := strings.IndexByte(line, ' ')
+	if i <= 0 {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, line[:i])
+	return t, err == nil
+}
+
+// filter applies Until, Grep and Timestamps to a line read with timestamps, it returns "" for dropped lines
+func (a *aggregator) filter(line string) string {
+	ts, msg := line, ""
+	if i := strings.IndexByte(line, ' '); i > 0 {
+		ts, msg = line[:i], line[i+1:]
+	}
+	if a.opts.Until != nil && !a.opts.Follow {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil && t.After(*a.opts.Until) {
+			return ""
+		}
+	}
+	if strings.TrimSpace(msg) == "" {
+		return ""
+	}
+	if a.opts.Grep != nil && !a.opts.Grep.MatchString(msg) {
+		return ""
+	}
+	if a.opts.Timestamps {
+		return line
+	}
+	return msg
+}
+
+// WaitForAggregatedStream is the multi pod counterpart of WaitForLoggingStream
+func WaitForAggregatedStream(k8sClient kubernetes.Interface, opts AggregateOptions, sessionId string) {
+	select {
+	case <-LogSessions.Get(sessionId).Bound:
+		close(LogSessions.Get(sessionId).Bound)
+		ss := LogSessions.Get(sessionId).sockJSSession
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// the client only sends the bind message, a failing Recv means it went away
+		go func() {
+			for {
+				if _, err := ss.Recv(); err != nil {
+					cancel()
+					return
+				}
+			}
+		}()
+		err := Aggregate(ctx, k8sClient, opts, func(line string) error {
+			return ss.Send(line + "\r\n")
+		})
+		if err != nil {
+			LogSessions.Close(sessionId, err.Error(), 2)
+			return
+		}
+		LogSessions.Close(sessionId, "Process exited", 1)
+	}
+}
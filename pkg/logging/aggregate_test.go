@@ -0,0 +1,150 @@
+package logging
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestAggregateFilter(t *testing.T) {
+	until := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a := &aggregator{opts: AggregateOptions{Until: &until, Grep: regexp.MustCompile(`(?i)error`)}}
+	cases := map[string]string{
+		"2024-05-01T11:59:59.123456789Z connection ERROR": "connection ERROR",
+		"2024-05-01T12:00:01Z another error":              "",
+		"2024-05-01T11:00:00Z all good":                   "",
+		"2024-05-01T11:00:00Z ":                           "",
+	}
+	for line, want := range cases {
+		if got := a.filter(line); got != want {
+			t.Errorf("filter(%q) = %q, want %q", line, got, want)
+		}
+	}
+	a.opts.Timestamps = true
+	if got := a.filter("2024-05-01T11:00:00Z error"); got != "2024-05-01T11:00:00Z error" {
+		t.Errorf("timestamps should be kept, got %q", got)
+	}
+}
+
+func TestAggregatePrefixes(t *testing.T) {
+	pod := func(name string, app string, phase v1.PodPhase) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "prod", Labels: map[string]string{"app": app}},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app"}, {Name: "sidecar"}}},
+			Status:     v1.PodStatus{Phase: phase},
+		}
+	}
+	client := fake.NewSimpleClientset(pod("web-1", "web", v1.PodRunning), pod("web-2", "web", v1.PodPending), pod("db-1", "db", v1.PodRunning))
+	var lines []string
+	err := Aggregate(context.TODO(), client, AggregateOptions{
+		Namespace: "prod",
+		Selector:  labels.SelectorFromSet(labels.Set{"app": "web"}),
+		Container: "app",
+	}, func(line string) error {
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fake client answers every log request with "fake logs"
+	if len(lines) != 1 || lines[0] != "[web-1/app] logs" {
+		t.Errorf("unexpected lines %q", lines)
+	}
+}
+
+func TestAggregateFollow(t *testing.T) {
+	pod := func(name string, restarts int32) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "prod", UID: "uid-" + types.UID(name), Labels: map[string]string{"app": "web"}},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app"}}},
+			Status: v1.PodStatus{Phase: v1.PodRunning, ContainerStatuses: []v1.ContainerStatus{{
+				Name: "app", RestartCount: restarts, State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+			}}},
+		}
+	}
+	client := fake.NewSimpleClientset(pod("web-1", 0))
+	watches := make(chan *watch.FakeWatcher, 2)
+	client.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFake()
+		watches <- w
+		return true, w, nil
+	})
+	lines := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.TODO())
+	done := make(chan error)
+	go func() {
+		done <- Aggregate(ctx, client, AggregateOptions{
+			Namespace: "prod",
+			Selector:  labels.SelectorFromSet(labels.Set{"app": "web"}),
+			Follow:    true,
+		}, func(line string) error {
+			lines <- line
+			return nil
+		})
+	}()
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case line := <-lines:
+			if line != want {
+				t.Fatalf("expect %q, got %q", want, line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %q", want)
+		}
+	}
+	expect("[web-1/app] logs")
+
+	w := <-watches
+	// the stream of the container ended, it is only read again once the container restarted
+	w.Modify(pod("web-1", 0))
+	w.Modify(pod("web-1", 1))
+	expect("[web-1/app] logs")
+
+	// a closed watch lists the pods again and watches from there
+	w.Stop()
+	w = <-watches
+	w.Add(pod("web-2", 0))
+	expect("[web-2/app] logs")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-lines:
+		t.Errorf("unexpected line %q", line)
+	default:
+	}
+}
+
+func TestAggregateResume(t *testing.T) {
+	var lines []string
+	a := &aggregator{opts: AggregateOptions{Follow: true}, out: func(line string) error {
+		lines = append(lines, line)
+		return nil
+	}}
+	after, _ := time.Parse(time.RFC3339, "2024-05-01T10:00:01Z")
+	var last time.Time
+	err := a.scan(strings.NewReader("2024-05-01T10:00:00Z one\n2024-05-01T10:00:01Z two\n2024-05-01T10:00:01.5Z three\n"), "", after, func(t time.Time) {
+		last = t
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lines up to the last one read before are dropped, the since time of the request only has seconds
+	if len(lines) != 1 || lines[0] != "three" || !last.Equal(after.Add(500*time.Millisecond)) {
+		t.Errorf("unexpected lines %q, last read at %s", lines, last)
+	}
+}
@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WorkloadSelector returns the pod selector of a deployment, statefulset, daemonset, replicaset or job
+func WorkloadSelector(client kubernetes.Interface, namespace, kind, name string) (labels.Selector, error) {
+	var selector *metav1.LabelSelector
+	switch strings.ToLower(kind) {
+	case "deployment", "deployments":
+		o, err := client.AppsV1().Deployments(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector = o.Spec.Selector
+	case "statefulset", "statefulsets":
+		o, err := client.AppsV1().StatefulSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector = o.Spec.Selector
+	case "daemonset", "daemonsets":
+		o, err := client.AppsV1().DaemonSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector = o.Spec.Selector
+	case "replicaset", "replicasets":
+		o, err := client.AppsV1().ReplicaSets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector = o.Spec.Selector
+	case "job", "jobs":
+		o, err := client.BatchV1().Jobs(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		selector = o.Spec.Selector
+	default:
+		return nil, fmt.Errorf("unsupported workload kind %s", kind)
+	}
+	if selector == nil {
+		return nil, fmt.Errorf("%s %s has no selector", kind, name)
+	}
+	return metav1.LabelSelectorAsSelector(selector)
+}
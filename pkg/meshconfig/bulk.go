@@ -0,0 +1,275 @@
+package meshconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	k8sError "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+)
+
+// BulkKinds are the kinds bulk operations accept
+var BulkKinds = []string{"VirtualService", "DestinationRule", "Gateway"}
+
+const (
+	BulkSucceeded  = "succeeded"
+	BulkFailed     = "failed"
+	BulkSkipped    = "skipped"
+	BulkRolledBack = "rolledBack"
+	// BulkRollbackFailed marks an item that was changed but could not be restored
+	BulkRollbackFailed = "rollbackFailed"
+)
+
+type ObjectRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+type BulkOptions struct {
+	// Atomic undoes the items already applied when one item fails, the remaining items are skipped
+	Atomic bool `json:"atomic"`
+	DryRun bool `json:"dryRun"`
+	// Kinds overrides BulkKinds for callers that manage other kinds, it is never read from a request
+	Kinds []string `json:"-"`
+}
+
+type BulkItem struct {
+	ObjectRef
+	Action string `json:"action"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BulkReport struct {
+	DryRun     bool       `json:"dryRun"`
+	RolledBack bool       `json:"rolledBack"`
+	Items      []BulkItem `json:"items"`
+	Succeeded  int        `json:"succeeded"`
+	Failed     int        `json:"failed"`
+}
+
+// bulkOp is one item of a bulk operation, undo restores the state before do and is only set once do succeeded
+type bulkOp struct {
+	item BulkItem
+	do   func(dryRun []string) (undo func() error, err error)
+}
+
+func (o BulkOptions) kinds() []string {
+	if o.Kinds != nil {
+		return o.Kinds
+	}
+	return BulkKinds
+}
+
+func bulkResource(kind string, opts BulkOptions) (schema.GroupVersionResource, error) {
+	for _, k := range opts.kinds() {
+		if k == kind {
+			for i := range Kinds {
+				if Kinds[i].Kind == kind {
+					return Kinds[i].Resource, nil
+				}
+			}
+		}
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("unsupported kind %s", kind)
+}
+
+func runBulk(ops []bulkOp, opts BulkOptions) *BulkReport {
+	report := &BulkReport{DryRun: opts.DryRun, Items: make([]BulkItem, 0, len(ops))}
+	var dryRun []string
+	if opts.DryRun {
+		dryRun = []string{metav1.DryRunAll}
+	}
+	var undos []func() error
+	failed := false
+	for _, op := range ops {
+		item := op.item
+		if failed && opts.Atomic {
+			item.Status = BulkSkipped
+			report.Items = append(report.Items, item)
+			continue
+		}
+		undo, err := op.do(dryRun)
+		if err != nil {
+			item.Status, item.Error = BulkFailed, err.Error()
+			report.Failed++
+			failed = true
+		} else {
+			item.Status = BulkSucceeded
+			report.Succeeded++
+		}
+		report.Items = append(report.Items, item)
+		undos = append(undos, undo)
+	}
+	if !failed || !opts.Atomic || opts.DryRun {
+		return report
+	}
+	// 逆序撤销已成功的条目
+	report.RolledBack = true
+	for i := len(undos) - 1; i >= 0; i-- {
+		if undos[i] == nil || report.Items[i].Status != BulkSucceeded {
+			continue
+		}
+		report.Succeeded--
+		if err := undos[i](); err != nil {
+			report.Items[i].Status, report.Items[i].Error = BulkRollbackFailed, err.Error()
+			continue
+		}
+		report.Items[i].Status = BulkRolledBack
+	}
+	return report
+}
+
+func invalidOp(item BulkItem, err error) bulkOp {
+	return bulkOp{item: item, do: func([]string) (func() error, error) { return nil, err }}
+}
+
+// BulkDelete deletes the objects, a rollback recreates them from the state read before deletion
+func BulkDelete(client dynamic.Interface, refs []ObjectRef, opts BulkOptions) *BulkReport {
+	ops := make([]bulkOp, 0, len(refs))
+	for _, ref := range refs {
+		item := BulkItem{ObjectRef: ref, Action: "delete"}
+		gvr, err := bulkResource(ref.Kind, opts)
+		if err != nil {
+			ops = append(ops, invalidOp(item, err))
+			continue
+		}
+		ri := client.Resource(gvr).Namespace(ref.Namespace)
+		name := ref.Name
+		ops = append(ops, bulkOp{item: item, do: func(dryRun []string) (func() error, error) {
+			live, err := ri.Get(context.TODO(), name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			if err := ri.Delete(context.TODO(), name, metav1.DeleteOptions{DryRun: dryRun}); err != nil {
+				return nil, err
+			}
+			return func() error {
+				_, err := ri.Create(context.TODO(), Clean(live), metav1.CreateOptions{})
+				return err
+			}, nil
+		}})
+	}
+	return runBulk(ops, opts)
+}
+
+// BulkLabel sets labels and annotations on the objects, a nil value removes the key. A rollback restores the previous values of the touched keys.
+func BulkLabel(client dynamic.Interface, refs []ObjectRef, labels, annotations map[string]*string, opts BulkOptions) *BulkReport {
+	ops := make([]bulkOp, 0, len(refs))
+	for _, ref := range refs {
+		item := BulkItem{ObjectRef: ref, Action: "label"}
+		gvr, err := bulkResource(ref.Kind, opts)
+		if err != nil {
+			ops = append(ops, invalidOp(item, err))
+			continue
+		}
+		ri := client.Resource(gvr).Namespace(ref.Namespace)
+		name := ref.Name
+		ops = append(ops, bulkOp{item: item, do: func(dryRun []string) (func() error, error) {
+			live, err := ri.Get(context.TODO(), name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			patch, err := metadataPatch(labels, annotations)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := ri.Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{DryRun: dryRun}); err != nil {
+				return nil, err
+			}
+			previousLabels := previousValues(live.GetLabels(), labels)
+			previousAnnotations := previousValues(live.GetAnnotations(), annotations)
+			return func() error {
+				patch, err := metadataPatch(previousLabels, previousAnnotations)
+				if err != nil {
+					return err
+				}
+				_, err = ri.Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+				return err
+			}, nil
+		}})
+	}
+	return runBulk(ops, opts)
+}
+
+func metadataPatch(labels, annotations map[string]*string) ([]byte, error) {
+	metadata := map[string]interface{}{}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+	return json.Marshal(map[string]interface{}{"metadata": metadata})
+}
+
+// previousValues returns the current values of the keys about to change, nil for keys that do not exist yet
+func previousValues(current map[string]string, changes map[string]*string) map[string]*string {
+	result := make(map[string]*string, len(changes))
+	for k := range changes {
+		if v, ok := current[k]; ok {
+			v := v
+			result[k] = &v
+		} else {
+			result[k] = nil
+		}
+	}
+	return result
+}
+
+// BulkApply creates or replaces the objects in order. A rollback deletes created objects and restores replaced ones.
+func BulkApply(client dynamic.Interface, objs []*unstructured.Unstructured, opts BulkOptions) *BulkReport {
+	ops := make([]bulkOp, 0, len(objs))
+	for _, o := range objs {
+		obj := Clean(o)
+		item := BulkItem{ObjectRef: ObjectRef{Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}, Action: "apply"}
+		gvr, err := ResourceFor(obj)
+		if err == nil {
+			_, err = bulkResource(obj.GetKind(), opts)
+		}
+		if err == nil && (obj.GetName() == "" || obj.GetNamespace() == "") {
+			err = fmt.Errorf("name and namespace are required")
+		}
+		if err != nil {
+			ops = append(ops, invalidOp(item, err))
+			continue
+		}
+		ri := client.Resource(gvr).Namespace(obj.GetNamespace())
+		ops = append(ops, bulkOp{item: item, do: func(dryRun []string) (func() error, error) {
+			live, err := ri.Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+			if err != nil && !k8sError.IsNotFound(err) {
+				return nil, err
+			}
+			if err != nil {
+				if _, err := ri.Create(context.TODO(), obj, metav1.CreateOptions{DryRun: dryRun}); err != nil {
+					return nil, err
+				}
+				return func() error {
+					return ri.Delete(context.TODO(), obj.GetName(), metav1.DeleteOptions{})
+				}, nil
+			}
+			desired := obj.DeepCopy()
+			desired.SetResourceVersion(live.GetResourceVersion())
+			if _, err := ri.Update(context.TODO(), desired, metav1.UpdateOptions{DryRun: dryRun}); err != nil {
+				return nil, err
+			}
+			return func() error {
+				current, err := ri.Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+				if err != nil {
+					return err
+				}
+				previous := Clean(live)
+				previous.SetResourceVersion(current.GetResourceVersion())
+				_, err = ri.Update(context.TODO(), previous, metav1.UpdateOptions{})
+				return err
+			}, nil
+		}})
+	}
+	return runBulk(ops, opts)
+}
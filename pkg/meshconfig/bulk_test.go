@@ -0,0 +1,99 @@
+package meshconfig
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestBulkRollback(t *testing.T) {
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, k := range Kinds {
+		listKinds[k.Resource] = k.Kind + "List"
+	}
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.istio.io/v1beta1",
+		"kind":       "DestinationRule",
+		"metadata":   map[string]interface{}{"name": "reviews", "namespace": "prod", "labels": map[string]interface{}{"team": "a"}},
+		"spec":       map[string]interface{}{"host": "ratings"},
+	}}
+	client := dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, live)
+	drs := client.Resource(Kinds[2].Resource).Namespace("prod")
+	vss := client.Resource(Kinds[3].Resource).Namespace("prod")
+
+	objs, err := DecodeYAML([]byte(`
+apiVersion: networking.istio.io/v1beta1
+kind: VirtualService
+metadata:
+  name: reviews
+  namespace: prod
+spec:
+  hosts: [reviews]
+---
+apiVersion: networking.istio.io/v1beta1
+kind: DestinationRule
+metadata:
+  name: reviews
+  namespace: prod
+spec:
+  host: reviews
+---
+apiVersion: networking.istio.io/v1beta1
+kind: Sidecar
+metadata:
+  name: default
+  namespace: prod
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := BulkApply(client, objs, BulkOptions{Atomic: true})
+	if !report.RolledBack || report.Failed != 1 || report.Succeeded != 0 || report.Items[0].Status != BulkRolledBack || report.Items[1].Status != BulkRolledBack {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if _, err := vss.Get(context.TODO(), "reviews", metav1.GetOptions{}); err == nil {
+		t.Error("created VirtualService should be deleted by the rollback")
+	}
+	dr, _ := drs.Get(context.TODO(), "reviews", metav1.GetOptions{})
+	if host, _, _ := unstructured.NestedString(dr.Object, "spec", "host"); host != "ratings" {
+		t.Errorf("DestinationRule is not restored, host %s", host)
+	}
+
+	env := "prod"
+	refs := []ObjectRef{{Kind: "DestinationRule", Namespace: "prod", Name: "reviews"}}
+	report = BulkLabel(client, refs, map[string]*string{"env": &env, "team": nil}, nil, BulkOptions{})
+	dr, _ = drs.Get(context.TODO(), "reviews", metav1.GetOptions{})
+	if report.Succeeded != 1 || dr.GetLabels()["env"] != "prod" || dr.GetLabels()["team"] != "" {
+		t.Fatalf("unexpected labels %v, report %+v", dr.GetLabels(), report)
+	}
+
+	refs = append(refs, ObjectRef{Kind: "VirtualService", Namespace: "prod", Name: "missing"})
+	report = BulkDelete(client, refs, BulkOptions{Atomic: true})
+	if !report.RolledBack || report.Items[0].Status != BulkRolledBack {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if _, err := drs.Get(context.TODO(), "reviews", metav1.GetOptions{}); err != nil {
+		t.Errorf("deleted DestinationRule should be recreated: %v", err)
+	}
+}
+
+func TestBulkKinds(t *testing.T) {
+	for _, kind := range []string{"VirtualService", "DestinationRule", "Gateway"} {
+		if _, err := bulkResource(kind, BulkOptions{}); err != nil {
+			t.Errorf("expect %s to be supported, got %v", kind, err)
+		}
+	}
+	for _, kind := range []string{"ServiceEntry", "Sidecar", "Pod"} {
+		if _, err := bulkResource(kind, BulkOptions{}); err == nil {
+			t.Errorf("expect %s to be rejected", kind)
+		}
+	}
+	if _, err := bulkResource("ServiceEntry", BulkOptions{Kinds: []string{"ServiceEntry"}}); err != nil {
+		t.Errorf("expect ServiceEntry to be supported when listed in Kinds, got %v", err)
+	}
+}
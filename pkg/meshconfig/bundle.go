@@ -0,0 +1,231 @@
+package meshconfig
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sYaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// Kinds maps the kinds a bundle may contain to their resources, in the order they are exported and applied
+var Kinds = []struct {
+	Kind     string
+	Resource schema.GroupVersionResource
+}{
+	{Kind: "Gateway", Resource: informer.Gateways},
+	{Kind: "ServiceEntry", Resource: informer.ServiceEntries},
+	{Kind: "DestinationRule", Resource: informer.DestinationRules},
+	{Kind: "VirtualService", Resource: informer.VirtualServices},
+	{Kind: "Sidecar", Resource: informer.Sidecars},
+	{Kind: "PeerAuthentication", Resource: informer.PeerAuthentications},
+	{Kind: "AuthorizationPolicy", Resource: informer.AuthorizationPolicies},
+}
+
+// ResourceFor returns the resource of a bundle object, the version is taken from the object itself
+func ResourceFor(obj *unstructured.Unstructured) (schema.GroupVersionResource, error) {
+	gvk := obj.GroupVersionKind()
+	for i := range Kinds {
+		if Kinds[i].Kind == gvk.Kind && Kinds[i].Resource.Group == gvk.Group {
+			return gvk.GroupVersion().WithResource(Kinds[i].Resource.Resource), nil
+		}
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("unsupported kind %s", obj.GetObjectKind().GroupVersionKind().String())
+}
+
+func kindOrder(kind string) int {
+	for i := range Kinds {
+		if Kinds[i].Kind == kind {
+			return i
+		}
+	}
+	return len(Kinds)
+}
+
+// Sort orders objects by kind, namespace and name so that bundles are stable
+func Sort(objs []*unstructured.Unstructured) {
+	sort.SliceStable(objs, func(i, j int) bool {
+		a, b := objs[i], objs[j]
+		if a.GetKind() != b.GetKind() {
+			return kindOrder(a.GetKind()) < kindOrder(b.GetKind())
+		}
+		if a.GetNamespace() != b.GetNamespace() {
+			return a.GetNamespace() < b.GetNamespace()
+		}
+		return a.GetName() < b.GetName()
+	})
+}
+
+// Clean returns a copy of the object without server populated fields
+func Clean(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	c := obj.DeepCopy()
+	delete(c.Object, "status")
+	for _, field := range []string{"managedFields", "resourceVersion", "uid", "generation", "creationTimestamp", "selfLink", "ownerReferences", "deletionTimestamp", "deletionGracePeriodSeconds"} {
+		unstructured.RemoveNestedField(c.Object, "metadata", field)
+	}
+	annotations := c.GetAnnotations()
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	if len(annotations) == 0 {
+		unstructured.RemoveNestedField(c.Object, "metadata", "annotations")
+	} else {
+		c.SetAnnotations(annotations)
+	}
+	return c
+}
+
+// EncodeYAML writes the objects as a multi-document YAML stream
+func EncodeYAML(objs []*unstructured.Unstructured) ([]byte, error) {
+	var buf bytes.Buffer
+	for i := range objs {
+		data, err := yaml.Marshal(objs[i].Object)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeTar writes one YAML file per object, named <namespace>/<kind>/<name>.yaml
+func EncodeTar(objs []*unstructured.Unstructured) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	now := time.Now()
+	for i := range objs {
+		data, err := yaml.Marshal(objs[i].Object)
+		if err != nil {
+			return nil, err
+		}
+		name := path.Join(objs[i].GetNamespace(), strings.ToLower(objs[i].GetKind()), objs[i].GetName()+".yaml")
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: now}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MaxBundleSize limits the size of a bundle, a gzipped bundle is limited again after decompression
+const MaxBundleSize = 32 << 20
+
+// ErrBundleTooLarge is returned by Decode when the decompressed bundle or a file in it exceeds MaxBundleSize
+var ErrBundleTooLarge = fmt.Errorf("bundle exceeds %d bytes", MaxBundleSize)
+
+// Decode reads a bundle, plain or gzipped tar archives and multi-document YAML or JSON are accepted
+func Decode(data []byte) ([]*unstructured.Unstructured, error) {
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		if data, err = readLimited(zr); err != nil {
+			return nil, err
+		}
+	}
+	if isTar(data) {
+		return decodeTar(data)
+	}
+	return DecodeYAML(data)
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxBundleSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxBundleSize {
+		return nil, ErrBundleTooLarge
+	}
+	return data, nil
+}
+
+func isTar(data []byte) bool {
+	return len(data) > 262 && string(data[257:262]) == "ustar"
+}
+
+func decodeTar(data []byte) ([]*unstructured.Unstructured, error) {
+	tr := tar.NewReader(bytes.NewReader(data))
+	var result []*unstructured.Unstructured
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg || !IsManifestFile(h.Name) {
+			continue
+		}
+		content, err := readLimited(tr)
+		if err != nil {
+			return nil, err
+		}
+		objs, err := DecodeYAML(content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", h.Name, err)
+		}
+		result = append(result, objs...)
+	}
+	return result, nil
+}
+
+// IsManifestFile reports whether a file name looks like a YAML or JSON manifest
+func IsManifestFile(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	return ext == ".yaml" || ext == ".yml" || ext == ".json"
+}
+
+// DecodeYAML reads a multi-document YAML or JSON stream, List objects are flattened
+func DecodeYAML(data []byte) ([]*unstructured.Unstructured, error) {
+	decoder := k8sYaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	var result []*unstructured.Unstructured
+	for {
+		var doc map[string]interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if len(doc) == 0 {
+			continue
+		}
+		obj := &unstructured.Unstructured{Object: doc}
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, err
+			}
+			for i := range list.Items {
+				result = append(result, &list.Items[i])
+			}
+			continue
+		}
+		if obj.GetKind() == "" || obj.GetName() == "" {
+			return nil, errors.New("object without kind or name in bundle")
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
@@ -0,0 +1,178 @@
+package meshconfig
+
+import (
+	"context"
+	"testing"
+
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"github.com/KubeOperator/kubepi/pkg/informer"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicFake "k8s.io/client-go/dynamic/fake"
+)
+
+const bundle = `
+apiVersion: networking.istio.io/v1beta1
+kind: VirtualService
+metadata:
+  name: reviews
+  namespace: staging
+  resourceVersion: "42"
+  uid: 0c0ffee
+  managedFields:
+  - manager: kubectl
+spec:
+  hosts:
+  - reviews.staging.svc.cluster.local
+  gateways:
+  - staging/public
+  http:
+  - route:
+    - destination:
+        host: reviews
+        port:
+          number: 9080
+status: {}
+---
+apiVersion: networking.istio.io/v1beta1
+kind: DestinationRule
+metadata:
+  name: reviews
+  namespace: staging
+spec:
+  host: reviews
+`
+
+func TestDecodeAndClean(t *testing.T) {
+	objs, err := Decode([]byte(bundle))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Fatalf("expect 2 objects, got %d", len(objs))
+	}
+	Sort(objs)
+	if objs[0].GetKind() != "DestinationRule" {
+		t.Errorf("expect DestinationRule to be ordered first, got %s", objs[0].GetKind())
+	}
+	vs := Clean(objs[1])
+	if vs.GetResourceVersion() != "" || vs.GetUID() != "" || vs.GetManagedFields() != nil {
+		t.Errorf("server fields are not stripped: %v", vs.Object["metadata"])
+	}
+	if _, ok := vs.Object["status"]; ok {
+		t.Error("status is not stripped")
+	}
+
+	archive, err := EncodeTar(objs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 2 || decoded[1].GetName() != "reviews" {
+		t.Errorf("tar round trip lost objects: %v", decoded)
+	}
+}
+
+func TestDecodeLimit(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(make([]byte, MaxBundleSize+1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decode(buf.Bytes()); !errors.Is(err, ErrBundleTooLarge) {
+		t.Fatalf("expect ErrBundleTooLarge, got %v", err)
+	}
+}
+
+func TestRemapNamespaces(t *testing.T) {
+	objs, _ := Decode([]byte(bundle))
+	vs := objs[0]
+	RemapNamespaces(vs, map[string]string{"staging": "prod"})
+	if vs.GetNamespace() != "prod" {
+		t.Errorf("expect namespace prod, got %s", vs.GetNamespace())
+	}
+	hosts, _, _ := unstructured.NestedStringSlice(vs.Object, "spec", "hosts")
+	gateways, _, _ := unstructured.NestedStringSlice(vs.Object, "spec", "gateways")
+	if hosts[0] != "reviews.prod.svc.cluster.local" || gateways[0] != "prod/public" {
+		t.Errorf("references are not remapped: %v %v", hosts, gateways)
+	}
+
+	ap := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"rules": []interface{}{map[string]interface{}{"from": []interface{}{map[string]interface{}{"source": map[string]interface{}{
+			"principals": []interface{}{"cluster.local/ns/staging/sa/web"},
+			"namespaces": []interface{}{"staging", "other"},
+		}}}}}},
+	}}
+	RemapNamespaces(ap, map[string]string{"staging": "prod"})
+	source := ap.Object["spec"].(map[string]interface{})["rules"].([]interface{})[0].(map[string]interface{})["from"].([]interface{})[0].(map[string]interface{})["source"].(map[string]interface{})
+	if source["principals"].([]interface{})[0] != "cluster.local/ns/prod/sa/web" {
+		t.Errorf("principal is not remapped: %v", source["principals"])
+	}
+	if ns := source["namespaces"].([]interface{}); ns[0] != "prod" || ns[1] != "other" {
+		t.Errorf("namespaces are not remapped: %v", ns)
+	}
+}
+
+func TestImportConflictPolicy(t *testing.T) {
+	listKinds := map[schema.GroupVersionResource]string{}
+	for _, k := range Kinds {
+		listKinds[k.Resource] = k.Kind + "List"
+	}
+	live := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.istio.io/v1beta1",
+		"kind":       "DestinationRule",
+		"metadata":   map[string]interface{}{"name": "reviews", "namespace": "prod", "resourceVersion": "1"},
+		"spec":       map[string]interface{}{"host": "ratings"},
+	}}
+	newClient := func() *dynamicFake.FakeDynamicClient {
+		return dynamicFake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, live.DeepCopy())
+	}
+	mapping := map[string]string{"staging": "prod"}
+
+	objs, _ := Decode([]byte(bundle))
+	client := newClient()
+	report := Import(client, objs, Options{Policy: PolicyFail, NamespaceMapping: mapping})
+	if !report.Aborted || report.Failed != 1 || report.Created != 0 || report.Updated != 0 {
+		t.Errorf("expect fail policy to abort on conflict without writes, got %+v", report)
+	}
+	if _, err := client.Resource(informer.DestinationRules).Namespace("prod").Get(context.TODO(), "reviews", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Resource(informer.VirtualServices).Namespace("prod").Get(context.TODO(), "reviews", metav1.GetOptions{}); err == nil {
+		t.Error("aborted import must not create objects")
+	}
+
+	objs, _ = Decode([]byte(bundle))
+	report = Import(newClient(), objs, Options{Policy: PolicySkip, NamespaceMapping: mapping})
+	if report.Aborted || report.Created != 1 || report.Skipped != 1 {
+		t.Errorf("expect skip policy to create 1 and skip 1, got %+v", report)
+	}
+
+	objs, _ = Decode([]byte(bundle))
+	client = newClient()
+	report = Import(client, objs, Options{Policy: PolicyOverwrite, NamespaceMapping: mapping})
+	if report.Created != 1 || report.Updated != 1 {
+		t.Errorf("expect overwrite policy to create 1 and update 1, got %+v", report)
+	}
+	dr, _ := client.Resource(informer.DestinationRules).Namespace("prod").Get(context.TODO(), "reviews", metav1.GetOptions{})
+	if host, _, _ := unstructured.NestedString(dr.Object, "spec", "host"); host != "reviews" {
+		t.Errorf("expect destination rule to be overwritten, host is %s", host)
+	}
+
+	objs, _ = Decode([]byte(bundle))
+	report = Import(client, objs, Options{Policy: PolicyFail, NamespaceMapping: mapping})
+	if report.Aborted || report.Skipped != 2 {
+		t.Errorf("expect unchanged objects to be skipped, got %+v", report)
+	}
+}
@@ -0,0 +1,182 @@
+package meshconfig
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	k8sError "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+)
+
+// conflict policies of an import, a conflict is an existing object whose content differs from the bundle
+const (
+	PolicySkip      = "skip"
+	PolicyOverwrite = "overwrite"
+	PolicyFail      = "fail"
+)
+
+const (
+	ActionCreate    = "create"
+	ActionUpdate    = "update"
+	ActionUnchanged = "unchanged"
+	ActionSkip      = "skip"
+	ActionConflict  = "conflict"
+	ActionError     = "error"
+)
+
+type Options struct {
+	Policy           string            `json:"policy"`
+	DryRun           bool              `json:"dryRun"`
+	NamespaceMapping map[string]string `json:"namespaceMapping"`
+}
+
+type Item struct {
+	Kind            string `json:"kind"`
+	Namespace       string `json:"namespace"`
+	Name            string `json:"name"`
+	SourceNamespace string `json:"sourceNamespace,omitempty"`
+	Action          string `json:"action"`
+	Error           string `json:"error,omitempty"`
+}
+
+type Report struct {
+	DryRun  bool   `json:"dryRun"`
+	Aborted bool   `json:"aborted"`
+	Items   []Item `json:"items"`
+	Created int    `json:"created"`
+	Updated int    `json:"updated"`
+	Skipped int    `json:"skipped"`
+	Failed  int    `json:"failed"`
+}
+
+func ValidPolicy(policy string) bool {
+	return policy == PolicySkip || policy == PolicyOverwrite || policy == PolicyFail
+}
+
+type plan struct {
+	obj      *unstructured.Unstructured
+	existing *unstructured.Unstructured
+	item     Item
+}
+
+// Import applies the bundle objects through client. Every object is first compared with the live one; with PolicyFail
+// nothing is written when any conflict is found. In dry run mode writes are sent with dryRun=All so the api server still validates them.
+func Import(client dynamic.Interface, objs []*unstructured.Unstructured, opts Options) *Report {
+	if opts.Policy == "" {
+		opts.Policy = PolicyFail
+	}
+	report := &Report{DryRun: opts.DryRun, Items: []Item{}}
+	objs = append([]*unstructured.Unstructured{}, objs...)
+	Sort(objs)
+
+	plans := make([]*plan, 0, len(objs))
+	conflicts := 0
+	for _, o := range objs {
+		obj := Clean(o)
+		source := obj.GetNamespace()
+		RemapNamespaces(obj, opts.NamespaceMapping)
+		p := &plan{obj: obj, item: Item{Kind: obj.GetKind(), Namespace: obj.GetNamespace(), Name: obj.GetName()}}
+		if source != obj.GetNamespace() {
+			p.item.SourceNamespace = source
+		}
+		plans = append(plans, p)
+		if obj.GetNamespace() == "" {
+			p.item.Action, p.item.Error = ActionError, "namespace is required"
+			continue
+		}
+		gvr, err := ResourceFor(obj)
+		if err != nil {
+			p.item.Action, p.item.Error = ActionError, err.Error()
+			continue
+		}
+		existing, err := client.Resource(gvr).Namespace(obj.GetNamespace()).Get(context.TODO(), obj.GetName(), metav1.GetOptions{})
+		switch {
+		case k8sError.IsNotFound(err):
+			p.item.Action = ActionCreate
+		case err != nil:
+			p.item.Action, p.item.Error = ActionError, err.Error()
+		case Equal(existing, obj):
+			p.item.Action = ActionUnchanged
+		default:
+			p.existing = existing
+			switch opts.Policy {
+			case PolicyOverwrite:
+				p.item.Action = ActionUpdate
+			case PolicySkip:
+				p.item.Action = ActionSkip
+			default:
+				p.item.Action = ActionConflict
+				conflicts++
+			}
+		}
+	}
+	if conflicts > 0 {
+		report.Aborted = true
+	}
+
+	for _, p := range plans {
+		if !report.Aborted {
+			apply(client, p, opts.DryRun)
+		}
+		switch p.item.Action {
+		case ActionCreate, ActionUpdate:
+			// an aborted import keeps the planned actions in its items but writes nothing
+			if report.Aborted {
+				break
+			}
+			if p.item.Action == ActionCreate {
+				report.Created++
+			} else {
+				report.Updated++
+			}
+		case ActionUnchanged, ActionSkip:
+			report.Skipped++
+		case ActionError, ActionConflict:
+			report.Failed++
+		}
+		report.Items = append(report.Items, p.item)
+	}
+	return report
+}
+
+func apply(client dynamic.Interface, p *plan, dryRun bool) {
+	if p.item.Action != ActionCreate && p.item.Action != ActionUpdate {
+		return
+	}
+	var opts []string
+	if dryRun {
+		opts = []string{metav1.DryRunAll}
+	}
+	gvr, _ := ResourceFor(p.obj)
+	ri := client.Resource(gvr).Namespace(p.obj.GetNamespace())
+	var err error
+	if p.item.Action == ActionCreate {
+		_, err = ri.Create(context.TODO(), p.obj, metav1.CreateOptions{DryRun: opts})
+	} else {
+		p.obj.SetResourceVersion(p.existing.GetResourceVersion())
+		_, err = ri.Update(context.TODO(), p.obj, metav1.UpdateOptions{DryRun: opts})
+	}
+	if err != nil {
+		p.item.Action, p.item.Error = ActionError, fmt.Sprintf("%s failed: %s", p.item.Action, err.Error())
+	}
+}
+
+// Equal reports whether the live object already has the desired spec, labels and annotations
+func Equal(live, desired *unstructured.Unstructured) bool {
+	return sameJSON(live.Object["spec"], desired.Object["spec"]) &&
+		sameJSON(Clean(live).GetLabels(), desired.GetLabels()) &&
+		sameJSON(Clean(live).GetAnnotations(), Clean(desired).GetAnnotations())
+}
+
+// sameJSON compares values by their JSON form, numbers decoded from YAML are float64 while live objects hold int64
+func sameJSON(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	if string(ja) == "null" || string(ja) == "{}" {
+		return string(jb) == "null" || string(jb) == "{}"
+	}
+	return string(ja) == string(jb)
+}
@@ -0,0 +1,62 @@
+package meshconfig
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RemapNamespaces moves the object to its mapped namespace and rewrites the namespace references in its spec:
+// FQDN hosts (reviews.staging.svc.cluster.local), namespace qualified names (staging/gateway),
+// SPIFFE principals (cluster.local/ns/staging/sa/default) and namespaces lists of AuthorizationPolicy sources
+func RemapNamespaces(obj *unstructured.Unstructured, mapping map[string]string) {
+	if len(mapping) == 0 {
+		return
+	}
+	if to, ok := mapping[obj.GetNamespace()]; ok {
+		obj.SetNamespace(to)
+	}
+	if spec, ok := obj.Object["spec"]; ok {
+		obj.Object["spec"] = remapValue(spec, "", mapping)
+	}
+}
+
+func remapValue(v interface{}, key string, mapping map[string]string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k := range t {
+			t[k] = remapValue(t[k], k, mapping)
+		}
+		return t
+	case []interface{}:
+		for i := range t {
+			t[i] = remapValue(t[i], key, mapping)
+		}
+		return t
+	case string:
+		if key == "namespaces" || key == "notNamespaces" {
+			if to, ok := mapping[t]; ok {
+				return to
+			}
+			return t
+		}
+		return remapString(t, mapping)
+	}
+	return v
+}
+
+func remapString(s string, mapping map[string]string) string {
+	for from, to := range mapping {
+		switch {
+		case strings.HasSuffix(s, "."+from+".svc.cluster.local"):
+			return strings.TrimSuffix(s, from+".svc.cluster.local") + to + ".svc.cluster.local"
+		case strings.HasSuffix(s, "."+from+".svc"):
+			return strings.TrimSuffix(s, from+".svc") + to + ".svc"
+		case strings.HasPrefix(s, from+"/"):
+			return to + strings.TrimPrefix(s, from)
+		case strings.Contains(s, "/ns/"+from+"/"):
+			return strings.Replace(s, "/ns/"+from+"/", "/ns/"+to+"/", 1)
+		}
+	}
+	return s
+}
@@ -0,0 +1,138 @@
+package meshconfig
+
+import (
+	"encoding/json"
+	"fmt"
+
+	apiextensionv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// CRDName returns the name of the CustomResourceDefinition serving the resource of a kind
+func CRDName(kind string) (string, error) {
+	for i := range Kinds {
+		if Kinds[i].Kind == kind {
+			return Kinds[i].Resource.Resource + "." + Kinds[i].Resource.Group, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported kind %s", kind)
+}
+
+// SchemaVersion picks the version whose schema forms should use: the preferred version when served, otherwise the storage version
+func SchemaVersion(crd *apiextensionv1.CustomResourceDefinition, preferred string) (*apiextensionv1.CustomResourceDefinitionVersion, error) {
+	var storage *apiextensionv1.CustomResourceDefinitionVersion
+	for i := range crd.Spec.Versions {
+		v := &crd.Spec.Versions[i]
+		if !v.Served {
+			continue
+		}
+		if v.Name == preferred {
+			return v, nil
+		}
+		if v.Storage {
+			storage = v
+		}
+	}
+	if storage == nil {
+		return nil, fmt.Errorf("crd %s serves no version", crd.Name)
+	}
+	return storage, nil
+}
+
+// ServedVersions lists the served versions of the crd
+func ServedVersions(crd *apiextensionv1.CustomResourceDefinition) []string {
+	var versions []string
+	for i := range crd.Spec.Versions {
+		if crd.Spec.Versions[i].Served {
+			versions = append(versions, crd.Spec.Versions[i].Name)
+		}
+	}
+	return versions
+}
+
+// JSONSchema converts the structural openAPIV3Schema of a crd version to a draft-07 JSON Schema a form library can validate with.
+// status is dropped, apiVersion and kind are pinned to the crd version and the kubernetes extensions are expressed with plain keywords.
+func JSONSchema(crd *apiextensionv1.CustomResourceDefinition, version *apiextensionv1.CustomResourceDefinitionVersion) (map[string]interface{}, error) {
+	if version.Schema == nil || version.Schema.OpenAPIV3Schema == nil {
+		return nil, fmt.Errorf("crd %s version %s has no schema", crd.Name, version.Name)
+	}
+	data, err := json.Marshal(version.Schema.OpenAPIV3Schema)
+	if err != nil {
+		return nil, err
+	}
+	var s map[string]interface{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	convertSchema(s)
+
+	properties, _ := s["properties"].(map[string]interface{})
+	if properties == nil {
+		properties = map[string]interface{}{}
+		s["properties"] = properties
+	}
+	delete(properties, "status")
+	properties["apiVersion"] = map[string]interface{}{"type": "string", "const": crd.Spec.Group + "/" + version.Name}
+	properties["kind"] = map[string]interface{}{"type": "string", "const": crd.Spec.Names.Kind}
+	properties["metadata"] = map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"name"},
+		"properties": map[string]interface{}{
+			"name":        map[string]interface{}{"type": "string", "pattern": "^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$", "maxLength": 253},
+			"namespace":   map[string]interface{}{"type": "string"},
+			"labels":      map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}},
+			"annotations": map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}},
+		},
+	}
+	s["$schema"] = jsonSchemaDraft
+	s["title"] = crd.Spec.Names.Kind
+	s["required"] = []interface{}{"apiVersion", "kind", "metadata", "spec"}
+	return s, nil
+}
+
+// convertSchema rewrites the openapi extensions in place, walking every nested schema
+func convertSchema(s map[string]interface{}) {
+	if v, _ := s["x-kubernetes-int-or-string"].(bool); v {
+		delete(s, "type")
+		s["anyOf"] = []interface{}{map[string]interface{}{"type": "integer"}, map[string]interface{}{"type": "string"}}
+	}
+	if v, _ := s["x-kubernetes-preserve-unknown-fields"].(bool); v {
+		if _, ok := s["additionalProperties"]; !ok {
+			s["additionalProperties"] = true
+		}
+	}
+	if v, _ := s["nullable"].(bool); v {
+		if t, ok := s["type"].(string); ok {
+			s["type"] = []interface{}{t, "null"}
+		}
+	}
+	for k := range s {
+		if len(k) > 2 && k[:2] == "x-" || k == "nullable" {
+			delete(s, k)
+		}
+	}
+	for _, key := range []string{"properties", "patternProperties", "definitions"} {
+		if m, ok := s[key].(map[string]interface{}); ok {
+			for _, v := range m {
+				if child, ok := v.(map[string]interface{}); ok {
+					convertSchema(child)
+				}
+			}
+		}
+	}
+	for _, key := range []string{"items", "additionalProperties", "not"} {
+		if child, ok := s[key].(map[string]interface{}); ok {
+			convertSchema(child)
+		}
+	}
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		if list, ok := s[key].([]interface{}); ok {
+			for i := range list {
+				if child, ok := list[i].(map[string]interface{}); ok {
+					convertSchema(child)
+				}
+			}
+		}
+	}
+}
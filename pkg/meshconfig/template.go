@@ -0,0 +1,234 @@
+package meshconfig
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+type TemplateParameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     string `json:"default,omitempty"`
+	Required    bool   `json:"required"`
+}
+
+// Template is a named starter configuration, Render fills the parameters into ready to apply objects
+type Template struct {
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Kinds       []string            `json:"kinds"`
+	Parameters  []TemplateParameter `json:"parameters"`
+	render      func(p templateParams) []*unstructured.Unstructured
+}
+
+// templateParams holds the resolved parameters and the apiVersion to use for each kind
+type templateParams struct {
+	values      map[string]string
+	apiVersions map[string]string
+}
+
+func (p templateParams) get(name string) string {
+	return p.values[name]
+}
+
+func (p templateParams) object(kind, name, namespace string, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": p.apiVersions[kind],
+		"kind":       kind,
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec":       spec,
+	}}
+}
+
+var commonParameters = []TemplateParameter{
+	{Name: "namespace", Description: "namespace of the generated objects", Required: true},
+	{Name: "host", Description: "service host, e.g. reviews or reviews.default.svc.cluster.local", Required: true},
+	{Name: "name", Description: "object name, defaults to the short host name"},
+}
+
+var subsetParameters = []TemplateParameter{
+	{Name: "versionLabel", Description: "pod label that distinguishes the versions", Default: "version"},
+	{Name: "stable", Description: "subset and label value of the stable version", Default: "v1"},
+	{Name: "canary", Description: "subset and label value of the canary version", Default: "v2"},
+}
+
+var Templates = []Template{
+	{
+		Name:        "header-canary",
+		Description: "route requests carrying a header to the canary subset, everything else to the stable subset",
+		Kinds:       []string{"DestinationRule", "VirtualService"},
+		Parameters: append(append(append([]TemplateParameter{}, commonParameters...), subsetParameters...),
+			TemplateParameter{Name: "header", Description: "request header that selects the canary", Default: "x-canary"},
+			TemplateParameter{Name: "headerValue", Description: "exact header value", Default: "true"},
+		),
+		render: func(p templateParams) []*unstructured.Unstructured {
+			return []*unstructured.Unstructured{
+				subsetDestinationRule(p),
+				p.object("VirtualService", p.get("name"), p.get("namespace"), map[string]interface{}{
+					"hosts": []interface{}{p.get("host")},
+					"http": []interface{}{
+						map[string]interface{}{
+							"name": "canary",
+							"match": []interface{}{map[string]interface{}{
+								"headers": map[string]interface{}{p.get("header"): map[string]interface{}{"exact": p.get("headerValue")}},
+							}},
+							"route": []interface{}{destination(p.get("host"), p.get("canary"))},
+						},
+						map[string]interface{}{
+							"name":  "stable",
+							"route": []interface{}{destination(p.get("host"), p.get("stable"))},
+						},
+					},
+				}),
+			}
+		},
+	},
+	{
+		Name:        "weight-split",
+		Description: "split traffic between the stable and canary subsets by weight",
+		Kinds:       []string{"DestinationRule", "VirtualService"},
+		Parameters: append(append(append([]TemplateParameter{}, commonParameters...), subsetParameters...),
+			TemplateParameter{Name: "canaryWeight", Description: "percentage of traffic sent to the canary, 0-100", Default: "10"},
+		),
+		render: func(p templateParams) []*unstructured.Unstructured {
+			weight, _ := strconv.ParseInt(p.get("canaryWeight"), 10, 64)
+			return []*unstructured.Unstructured{
+				subsetDestinationRule(p),
+				p.object("VirtualService", p.get("name"), p.get("namespace"), map[string]interface{}{
+					"hosts": []interface{}{p.get("host")},
+					"http": []interface{}{map[string]interface{}{
+						"route": []interface{}{
+							weighted(destination(p.get("host"), p.get("stable")), 100-weight),
+							weighted(destination(p.get("host"), p.get("canary")), weight),
+						},
+					}},
+				}),
+			}
+		},
+	},
+	{
+		Name:        "https-gateway",
+		Description: "HTTPS ingress gateway terminating TLS with a secret, plain HTTP redirected to HTTPS, routed to a service",
+		Kinds:       []string{"Gateway", "VirtualService"},
+		Parameters: append(append([]TemplateParameter{}, commonParameters...),
+			TemplateParameter{Name: "hosts", Description: "comma separated external host names", Required: true},
+			TemplateParameter{Name: "credentialName", Description: "TLS secret in the gateway's namespace", Required: true},
+			TemplateParameter{Name: "selector", Description: "gateway workload selector as key=value", Default: "istio=ingressgateway"},
+			TemplateParameter{Name: "port", Description: "service port the traffic is routed to", Default: "80"},
+		),
+		render: func(p templateParams) []*unstructured.Unstructured {
+			var hosts []interface{}
+			for _, h := range strings.Split(p.get("hosts"), ",") {
+				if h = strings.TrimSpace(h); h != "" {
+					hosts = append(hosts, h)
+				}
+			}
+			selector := map[string]interface{}{}
+			if kv := strings.SplitN(p.get("selector"), "=", 2); len(kv) == 2 {
+				selector[kv[0]] = kv[1]
+			}
+			port, _ := strconv.ParseInt(p.get("port"), 10, 64)
+			route := destination(p.get("host"), "")
+			_ = unstructured.SetNestedField(route, map[string]interface{}{"number": port}, "destination", "port")
+			return []*unstructured.Unstructured{
+				p.object("Gateway", p.get("name"), p.get("namespace"), map[string]interface{}{
+					"selector": selector,
+					"servers": []interface{}{
+						map[string]interface{}{
+							"port":  map[string]interface{}{"number": int64(80), "name": "http", "protocol": "HTTP"},
+							"hosts": hosts,
+							"tls":   map[string]interface{}{"httpsRedirect": true},
+						},
+						map[string]interface{}{
+							"port":  map[string]interface{}{"number": int64(443), "name": "https", "protocol": "HTTPS"},
+							"hosts": hosts,
+							"tls":   map[string]interface{}{"mode": "SIMPLE", "credentialName": p.get("credentialName")},
+						},
+					},
+				}),
+				p.object("VirtualService", p.get("name"), p.get("namespace"), map[string]interface{}{
+					"hosts":    hosts,
+					"gateways": []interface{}{p.get("name")},
+					"http":     []interface{}{map[string]interface{}{"route": []interface{}{route}}},
+				}),
+			}
+		},
+	},
+}
+
+func subsetDestinationRule(p templateParams) *unstructured.Unstructured {
+	label := p.get("versionLabel")
+	return p.object("DestinationRule", p.get("name"), p.get("namespace"), map[string]interface{}{
+		"host": p.get("host"),
+		"subsets": []interface{}{
+			map[string]interface{}{"name": p.get("stable"), "labels": map[string]interface{}{label: p.get("stable")}},
+			map[string]interface{}{"name": p.get("canary"), "labels": map[string]interface{}{label: p.get("canary")}},
+		},
+	})
+}
+
+func destination(host, subset string) map[string]interface{} {
+	d := map[string]interface{}{"host": host}
+	if subset != "" {
+		d["subset"] = subset
+	}
+	return map[string]interface{}{"destination": d}
+}
+
+func weighted(route map[string]interface{}, weight int64) map[string]interface{} {
+	route["weight"] = weight
+	return route
+}
+
+// FindTemplate returns the template with the given name
+func FindTemplate(name string) (*Template, error) {
+	for i := range Templates {
+		if Templates[i].Name == name {
+			return &Templates[i], nil
+		}
+	}
+	return nil, fmt.Errorf("template %s not found", name)
+}
+
+// Render validates the parameters, fills in defaults and generates the objects. apiVersions maps a kind to the
+// group/version served by the cluster, kinds missing from it use the version the informer cache reads.
+func (t *Template) Render(values map[string]string, apiVersions map[string]string) ([]*unstructured.Unstructured, error) {
+	p := templateParams{values: map[string]string{}, apiVersions: map[string]string{}}
+	var missing []string
+	for _, param := range t.Parameters {
+		v := strings.TrimSpace(values[param.Name])
+		if v == "" {
+			v = param.Default
+		}
+		if v == "" && param.Required {
+			missing = append(missing, param.Name)
+		}
+		p.values[param.Name] = v
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("missing required parameters: %s", strings.Join(missing, ", "))
+	}
+	if p.values["name"] == "" {
+		p.values["name"] = strings.Split(p.values["host"], ".")[0]
+	}
+	if w, ok := p.values["canaryWeight"]; ok {
+		if n, err := strconv.Atoi(w); err != nil || n < 0 || n > 100 {
+			return nil, fmt.Errorf("canaryWeight must be an integer between 0 and 100")
+		}
+	}
+	if p.values["stable"] != "" && p.values["stable"] == p.values["canary"] {
+		return nil, fmt.Errorf("stable and canary must differ")
+	}
+	for i := range Kinds {
+		p.apiVersions[Kinds[i].Kind] = Kinds[i].Resource.GroupVersion().String()
+	}
+	for kind, v := range apiVersions {
+		p.apiVersions[kind] = v
+	}
+	return t.render(p), nil
+}
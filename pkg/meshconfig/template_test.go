@@ -0,0 +1,97 @@
+package meshconfig
+
+import (
+	"testing"
+
+	apiextensionv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	tpl, err := FindTemplate("weight-split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tpl.Render(map[string]string{"host": "reviews"}, nil); err == nil {
+		t.Fatal("expect missing namespace error")
+	}
+	objs, err := tpl.Render(map[string]string{"namespace": "shop", "host": "reviews", "canaryWeight": "25"},
+		map[string]string{"VirtualService": "networking.istio.io/v1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 || objs[0].GetName() != "reviews" || objs[1].GetAPIVersion() != "networking.istio.io/v1" || objs[0].GetAPIVersion() != "networking.istio.io/v1beta1" {
+		t.Fatalf("unexpected objects %v", objs)
+	}
+	routes, _, _ := unstructured.NestedSlice(objs[1].Object, "spec", "http")
+	route := routes[0].(map[string]interface{})["route"].([]interface{})
+	if route[0].(map[string]interface{})["weight"] != int64(75) || route[1].(map[string]interface{})["weight"] != int64(25) {
+		t.Errorf("unexpected route %v", route)
+	}
+
+	for _, name := range []string{"header-canary", "https-gateway"} {
+		tpl, _ := FindTemplate(name)
+		objs, err := tpl.Render(map[string]string{"namespace": "shop", "host": "web", "hosts": "shop.example.com", "credentialName": "shop-cert"}, nil)
+		if err != nil || len(objs) != 2 {
+			t.Fatalf("render %s: %v", name, err)
+		}
+		if _, err := EncodeYAML(objs); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestJSONSchema(t *testing.T) {
+	crd := &apiextensionv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateways.networking.istio.io"},
+		Spec: apiextensionv1.CustomResourceDefinitionSpec{
+			Group: "networking.istio.io",
+			Names: apiextensionv1.CustomResourceDefinitionNames{Kind: "Gateway"},
+			Versions: []apiextensionv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha3", Served: true},
+				{Name: "v1beta1", Served: true, Storage: true, Schema: &apiextensionv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]apiextensionv1.JSONSchemaProps{
+							"spec": {Type: "object", Properties: map[string]apiextensionv1.JSONSchemaProps{
+								"port":     {XIntOrString: true},
+								"selector": {Type: "object", Nullable: true},
+							}},
+							"status": {Type: "object", XPreserveUnknownFields: boolPtr(true)},
+						},
+					},
+				}},
+			},
+		},
+	}
+	v, err := SchemaVersion(crd, "v1")
+	if err != nil || v.Name != "v1beta1" {
+		t.Fatalf("unexpected version %v %v", v, err)
+	}
+	s, err := JSONSchema(crd, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties := s["properties"].(map[string]interface{})
+	if _, ok := properties["status"]; ok {
+		t.Error("status should be dropped")
+	}
+	if properties["apiVersion"].(map[string]interface{})["const"] != "networking.istio.io/v1beta1" {
+		t.Errorf("unexpected apiVersion %v", properties["apiVersion"])
+	}
+	spec := properties["spec"].(map[string]interface{})["properties"].(map[string]interface{})
+	if _, ok := spec["port"].(map[string]interface{})["anyOf"]; !ok {
+		t.Errorf("int-or-string not converted: %v", spec["port"])
+	}
+	if _, ok := spec["port"].(map[string]interface{})["x-kubernetes-int-or-string"]; ok {
+		t.Errorf("extension not removed: %v", spec["port"])
+	}
+	if types, ok := spec["selector"].(map[string]interface{})["type"].([]interface{}); !ok || len(types) != 2 {
+		t.Errorf("nullable not converted: %v", spec["selector"])
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,84 @@
+package portforward
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	kubeClient "github.com/KubeOperator/kubepi/pkg/kubernetes"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// Tunnel forwards a random loopback port of the KubePi host to a pod port through the API server
+type Tunnel struct {
+	LocalPort uint16
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+	err       error
+}
+
+// Open starts forwarding to the pod port with the given config, it returns once the local port listens
+func Open(client kubernetes.Interface, cfg *rest.Config, namespace, podName string, port int) (*Tunnel, error) {
+	transport, upgrader, err := kubeClient.SPDYRoundTripperFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	req := client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	t := &Tunnel{stopCh: make(chan struct{}), done: make(chan struct{})}
+	readyCh := make(chan struct{})
+	fw, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", port)}, t.stopCh, readyCh, io.Discard, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- fw.ForwardPorts()
+	}()
+	select {
+	case <-readyCh:
+	case err := <-errCh:
+		if err == nil {
+			err = fmt.Errorf("port forward to %s/%s:%d stopped", namespace, podName, port)
+		}
+		return nil, err
+	}
+	ports, err := fw.GetPorts()
+	if err != nil || len(ports) == 0 {
+		t.Close()
+		return nil, fmt.Errorf("port forward to %s/%s:%d has no local port: %v", namespace, podName, port, err)
+	}
+	t.LocalPort = ports[0].Local
+	go func() {
+		t.err = <-errCh
+		close(t.done)
+	}()
+	return t, nil
+}
+
+// Close stops the tunnel, it is safe to call more than once
+func (t *Tunnel) Close() {
+	t.stopOnce.Do(func() {
+		close(t.stopCh)
+	})
+}
+
+// Done is closed when the tunnel stopped, either by Close or because the connection to the pod was lost
+func (t *Tunnel) Done() <-chan struct{} {
+	return t.done
+}
+
+// Err returns why the tunnel stopped, it is only valid after Done is closed
+func (t *Tunnel) Err() error {
+	return t.err
+}
@@ -0,0 +1,93 @@
+package portforward
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResolveService picks a ready pod behind the service and the container port serving the service port.
+// port is the number or name of the service port and may be empty when the service has a single port.
+func ResolveService(client kubernetes.Interface, namespace, name, port string) (string, int, error) {
+	svc, err := client.CoreV1().Services(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", 0, err
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return "", 0, fmt.Errorf("service %s has no selector", name)
+	}
+	servicePort, err := findServicePort(svc, port)
+	if err != nil {
+		return "", 0, err
+	}
+	pods, err := client.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if !podReady(pod) {
+			continue
+		}
+		podPort, err := containerPort(pod, servicePort)
+		if err != nil {
+			return "", 0, err
+		}
+		return pod.Name, podPort, nil
+	}
+	return "", 0, fmt.Errorf("service %s has no ready pods", name)
+}
+
+func findServicePort(svc *v1.Service, port string) (v1.ServicePort, error) {
+	if port == "" && len(svc.Spec.Ports) == 1 {
+		return svc.Spec.Ports[0], nil
+	}
+	for _, p := range svc.Spec.Ports {
+		if p.Name == port || strconv.Itoa(int(p.Port)) == port {
+			return p, nil
+		}
+	}
+	return v1.ServicePort{}, fmt.Errorf("service %s has no port %q", svc.Name, port)
+}
+
+// containerPort maps the target port of the service port to a port number of the pod
+func containerPort(pod *v1.Pod, sp v1.ServicePort) (int, error) {
+	if sp.TargetPort.Type == intstr.Int {
+		if sp.TargetPort.IntVal == 0 {
+			return int(sp.Port), nil
+		}
+		return int(sp.TargetPort.IntVal), nil
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name == sp.TargetPort.StrVal {
+				return int(p.ContainerPort), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("pod %s has no container port named %s", pod.Name, sp.TargetPort.StrVal)
+}
+
+func podReady(pod *v1.Pod) bool {
+	if pod.Status.Phase != v1.PodRunning || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package portforward
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testPod(name string, ready bool) *v1.Pod {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "prod", Labels: map[string]string{"app": "web"}},
+		Spec: v1.PodSpec{Containers: []v1.Container{{
+			Name:  "web",
+			Ports: []v1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+		}}},
+		Status: v1.PodStatus{Phase: v1.PodRunning, Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}}},
+	}
+}
+
+func TestResolveService(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"},
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{"app": "web"},
+			Ports: []v1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+				{Name: "metrics", Port: 9090},
+			},
+		},
+	}
+	client := fake.NewSimpleClientset(svc, testPod("web-a", false), testPod("web-b", true))
+
+	for port, want := range map[string]int{"http": 8080, "80": 8080, "9090": 9090} {
+		pod, podPort, err := ResolveService(client, "prod", "web", port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pod != "web-b" || podPort != want {
+			t.Errorf("port %s: got %s:%d, want web-b:%d", port, pod, podPort, want)
+		}
+	}
+	if _, _, err := ResolveService(client, "prod", "web", ""); err == nil {
+		t.Error("a port is required when the service has several")
+	}
+	if _, _, err := ResolveService(client, "prod", "web", "443"); err == nil {
+		t.Error("unknown service port should fail")
+	}
+}
@@ -0,0 +1,185 @@
+package prometheus
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+)
+
+const requestTimeout = 30 * time.Second
+
+// Client queries the Prometheus HTTP API configured for a cluster
+type Client struct {
+	endpoint string
+	config   v1Cluster.Prometheus
+	http     *http.Client
+}
+
+// Sample is one element of an instant vector
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Series is one element of a range matrix
+type Series struct {
+	Labels map[string]string
+	Points []Point
+}
+
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+// NewClient creates a client of the Prometheus of a cluster, requests go through proxy when it is not nil
+func NewClient(config v1Cluster.Prometheus, proxy *url.URL) (*Client, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("prometheus is not configured")
+	}
+	u, err := url.Parse(config.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid prometheus url %s", config.URL)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if config.InsecureSkipVerify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return &Client{
+		endpoint: strings.TrimSuffix(config.URL, "/"),
+		config:   config,
+		http:     &http.Client{Transport: transport, Timeout: requestTimeout},
+	}, nil
+}
+
+type apiResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type apiSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  [2]interface{}    `json:"value"`
+	Values [][2]interface{}  `json:"values"`
+}
+
+// Query evaluates an instant query at the given time
+func (c *Client) Query(ctx context.Context, query string, at time.Time) ([]Sample, error) {
+	params := url.Values{"query": {query}, "time": {formatTime(at)}}
+	result, err := c.do(ctx, "/api/v1/query", params, "vector")
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]Sample, 0, len(result))
+	for _, r := range result {
+		_, v, err := parsePoint(r.Value)
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, Sample{Labels: r.Metric, Value: v})
+	}
+	return samples, nil
+}
+
+// QueryRange evaluates a range query between start and end
+func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]Series, error) {
+	params := url.Values{
+		"query": {query},
+		"start": {formatTime(start)},
+		"end":   {formatTime(end)},
+		"step":  {strconv.FormatFloat(step.Seconds(), 'f', -1, 64)},
+	}
+	result, err := c.do(ctx, "/api/v1/query_range", params, "matrix")
+	if err != nil {
+		return nil, err
+	}
+	series := make([]Series, 0, len(result))
+	for _, r := range result {
+		s := Series{Labels: r.Metric, Points: make([]Point, 0, len(r.Values))}
+		for _, value := range r.Values {
+			t, v, err := parsePoint(value)
+			if err != nil {
+				return nil, err
+			}
+			s.Points = append(s.Points, Point{Time: t, Value: v})
+		}
+		series = append(series, s)
+	}
+	return series, nil
+}
+
+func (c *Client) do(ctx context.Context, path string, params url.Values, resultType string) ([]apiSample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if c.config.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.BearerToken)
+	} else if c.config.Username != "" {
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var r apiResponse
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("prometheus returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if r.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed: %s: %s", r.ErrorType, r.Error)
+	}
+	if r.Data.ResultType != resultType {
+		return nil, fmt.Errorf("unexpected result type %s", r.Data.ResultType)
+	}
+	var result []apiSample
+	if err := json.Unmarshal(r.Data.Result, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
+
+// parsePoint decodes a [timestamp, "value"] pair, values such as "NaN" and "+Inf" are kept as is
+func parsePoint(p [2]interface{}) (time.Time, float64, error) {
+	ts, ok := p[0].(float64)
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("invalid sample timestamp %v", p[0])
+	}
+	s, ok := p[1].(string)
+	if !ok {
+		return time.Time{}, 0, fmt.Errorf("invalid sample value %v", p[1])
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	sec := int64(ts)
+	return time.Unix(sec, int64((ts-float64(sec))*1e9)), v, nil
+}
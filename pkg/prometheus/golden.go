@@ -0,0 +1,215 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Labels of the Istio standard metrics used to group golden signals
+const (
+	LabelServiceName      = "destination_service_name"
+	LabelServiceNamespace = "destination_service_namespace"
+	LabelWorkloadNs       = "destination_workload_namespace"
+	LabelApp              = "destination_app"
+	LabelVersion          = "destination_version"
+)
+
+const minRateWindow = time.Minute
+
+var quantiles = []float64{0.5, 0.9, 0.99}
+
+// SignalQuery selects the destination side Istio metrics to aggregate
+type SignalQuery struct {
+	// By are the labels the results are grouped by
+	By []string
+	// Matchers restrict a label to one of the values
+	Matchers map[string][]string
+	// Window is the time range the rates and percentiles are computed over, ending at End
+	Window time.Duration
+	End    time.Time
+	// Step adds request rate, error rate and p99 series over the window when set
+	Step time.Duration
+}
+
+// Signals are the golden signals of one group, latencies are in milliseconds and nil when there was no traffic
+type Signals struct {
+	Labels      map[string]string `json:"labels"`
+	RequestRate float64           `json:"requestRate"`
+	ErrorRate   float64           `json:"errorRate"`
+	P50         *float64          `json:"p50"`
+	P90         *float64          `json:"p90"`
+	P99         *float64          `json:"p99"`
+	Series      *SignalSeries     `json:"series,omitempty"`
+}
+
+type SignalSeries struct {
+	RequestRate []Point `json:"requestRate"`
+	ErrorRate   []Point `json:"errorRate"`
+	P99         []Point `json:"p99"`
+}
+
+func (q SignalQuery) selector(extra ...string) string {
+	matchers := []string{`reporter="destination"`}
+	keys := make([]string, 0, len(q.Matchers))
+	for k := range q.Matchers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		values := make([]string, 0, len(q.Matchers[k]))
+		for _, v := range q.Matchers[k] {
+			values = append(values, regexp.QuoteMeta(v))
+		}
+		matchers = append(matchers, fmt.Sprintf("%s=~%s", k, strconv.Quote(strings.Join(values, "|"))))
+	}
+	matchers = append(matchers, extra...)
+	return "{" + strings.Join(matchers, ",") + "}"
+}
+
+func promDuration(d time.Duration) string {
+	return strconv.FormatInt(int64(d.Seconds()), 10) + "s"
+}
+
+func (q SignalQuery) requestRate(window time.Duration) string {
+	return fmt.Sprintf("sum by (%s) (rate(istio_requests_total%s[%s]))", strings.Join(q.By, ","), q.selector(), promDuration(window))
+}
+
+func (q SignalQuery) errorRate(window time.Duration) string {
+	return fmt.Sprintf("sum by (%s) (rate(istio_requests_total%s[%s]))", strings.Join(q.By, ","), q.selector(`response_code=~"5.."`), promDuration(window))
+}
+
+func (q SignalQuery) latency(quantile float64, window time.Duration) string {
+	return fmt.Sprintf("histogram_quantile(%s, sum by (le,%s) (rate(istio_request_duration_milliseconds_bucket%s[%s])))",
+		strconv.FormatFloat(quantile, 'f', -1, 64), strings.Join(q.By, ","), q.selector(), promDuration(window))
+}
+
+func (q SignalQuery) key(labels map[string]string) string {
+	values := make([]string, 0, len(q.By))
+	for _, l := range q.By {
+		values = append(values, labels[l])
+	}
+	return strings.Join(values, "/")
+}
+
+// GoldenSignals computes request rate, 5xx error ratio and latency percentiles per group
+func GoldenSignals(ctx context.Context, c *Client, q SignalQuery) ([]*Signals, error) {
+	if q.Window <= 0 {
+		return nil, fmt.Errorf("window must be positive")
+	}
+	if q.End.IsZero() {
+		q.End = time.Now()
+	}
+	groups := map[string]*Signals{}
+	group := func(labels map[string]string) *Signals {
+		k := q.key(labels)
+		if groups[k] == nil {
+			l := make(map[string]string, len(q.By))
+			for _, name := range q.By {
+				l[name] = labels[name]
+			}
+			groups[k] = &Signals{Labels: l}
+		}
+		return groups[k]
+	}
+
+	total, err := c.Query(ctx, q.requestRate(q.Window), q.End)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range total {
+		group(s.Labels).RequestRate = finite(s.Value)
+	}
+	errors, err := c.Query(ctx, q.errorRate(q.Window), q.End)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range errors {
+		g := group(s.Labels)
+		if g.RequestRate > 0 {
+			g.ErrorRate = finite(s.Value) / g.RequestRate
+		}
+	}
+	for _, quantile := range quantiles {
+		samples, err := c.Query(ctx, q.latency(quantile, q.Window), q.End)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range samples {
+			if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				continue
+			}
+			v := s.Value
+			switch quantile {
+			case 0.5:
+				group(s.Labels).P50 = &v
+			case 0.9:
+				group(s.Labels).P90 = &v
+			case 0.99:
+				group(s.Labels).P99 = &v
+			}
+		}
+	}
+
+	if q.Step > 0 {
+		if err := q.series(ctx, c, group); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]*Signals, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool { return q.key(result[i].Labels) < q.key(result[j].Labels) })
+	return result, nil
+}
+
+// series fills the per step values, each step is a rate over max(step, 1m) so sparse scrapes still yield a value
+func (q SignalQuery) series(ctx context.Context, c *Client, group func(map[string]string) *Signals) error {
+	window := q.Step
+	if window < minRateWindow {
+		window = minRateWindow
+	}
+	start := q.End.Add(-q.Window)
+	queries := []struct {
+		query string
+		set   func(s *SignalSeries, points []Point)
+	}{
+		{q.requestRate(window), func(s *SignalSeries, points []Point) { s.RequestRate = points }},
+		{fmt.Sprintf("%s / %s", q.errorRate(window), q.requestRate(window)), func(s *SignalSeries, points []Point) { s.ErrorRate = points }},
+		{q.latency(0.99, window), func(s *SignalSeries, points []Point) { s.P99 = points }},
+	}
+	for _, item := range queries {
+		series, err := c.QueryRange(ctx, item.query, start, q.End, q.Step)
+		if err != nil {
+			return err
+		}
+		for _, s := range series {
+			g := group(s.Labels)
+			if g.Series == nil {
+				g.Series = &SignalSeries{}
+			}
+			points := make([]Point, 0, len(s.Points))
+			for _, p := range s.Points {
+				if !math.IsNaN(p.Value) && !math.IsInf(p.Value, 0) {
+					points = append(points, p)
+				}
+			}
+			item.set(g.Series, points)
+		}
+	}
+	return nil
+}
+
+func finite(v float64) float64 {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
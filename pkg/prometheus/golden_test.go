@@ -0,0 +1,102 @@
+package prometheus
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	v1Cluster "github.com/KubeOperator/kubepi/internal/model/v1/cluster"
+)
+
+func vector(samples ...string) string {
+	return fmt.Sprintf(`{"status":"success","data":{"resultType":"vector","result":[%s]}}`, strings.Join(samples, ","))
+}
+
+func sample(version, value string) string {
+	return fmt.Sprintf(`{"metric":{"destination_service_namespace":"default","destination_service_name":"reviews","destination_version":"%s"},"value":[1700000000.5,"%s"]}`, version, value)
+}
+
+func TestGoldenSignals(t *testing.T) {
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = r.ParseForm()
+		q := r.Form.Get("query")
+		queries = append(queries, q)
+		switch {
+		case strings.HasPrefix(q, "histogram_quantile(0.99"):
+			_, _ = fmt.Fprint(w, vector(sample("v1", "120"), sample("v2", "NaN")))
+		case strings.HasPrefix(q, "histogram_quantile"):
+			_, _ = fmt.Fprint(w, vector(sample("v1", "20")))
+		case strings.Contains(q, `response_code=~"5.."`):
+			_, _ = fmt.Fprint(w, vector(sample("v2", "0.5")))
+		default:
+			_, _ = fmt.Fprint(w, vector(sample("v1", "10"), sample("v2", "2")))
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewClient(v1Cluster.Prometheus{URL: server.URL + "/", BearerToken: "token"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signals, err := GoldenSignals(context.TODO(), c, SignalQuery{
+		By:       []string{LabelServiceNamespace, LabelServiceName, LabelVersion},
+		Matchers: map[string][]string{LabelServiceNamespace: {"default", "a.b"}},
+		Window:   10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signals) != 2 {
+		t.Fatalf("expected 2 groups, got %d", len(signals))
+	}
+	v1, v2 := signals[0], signals[1]
+	if v1.Labels[LabelVersion] != "v1" || v1.RequestRate != 10 || v1.ErrorRate != 0 || *v1.P50 != 20 || *v1.P99 != 120 {
+		t.Errorf("unexpected v1 signals %+v", v1)
+	}
+	if v2.RequestRate != 2 || v2.ErrorRate != 0.25 || v2.P99 != nil {
+		t.Errorf("unexpected v2 signals %+v", v2)
+	}
+	want := `sum by (destination_service_namespace,destination_service_name,destination_version) (rate(istio_requests_total{reporter="destination",destination_service_namespace=~"default|a\\.b"}[600s]))`
+	if queries[0] != want {
+		t.Errorf("unexpected query\n%s\nwant\n%s", queries[0], want)
+	}
+}
+
+func TestNewClientRequiresURL(t *testing.T) {
+	if _, err := NewClient(v1Cluster.Prometheus{}, nil); err == nil {
+		t.Error("expected error without url")
+	}
+	if _, err := NewClient(v1Cluster.Prometheus{URL: "prometheus:9090"}, nil); err == nil {
+		t.Error("expected error without scheme")
+	}
+}
+
+func TestClientUsesProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		_, _ = fmt.Fprint(w, vector(sample("v1", "1")))
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+	c, err := NewClient(v1Cluster.Prometheus{URL: "http://prometheus.istio-system:9090"}, proxyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Query(context.TODO(), "up", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(proxied, "http://prometheus.istio-system:9090/api/v1/query") {
+		t.Fatalf("request did not go through the proxy: %q", proxied)
+	}
+}
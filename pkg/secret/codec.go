@@ -0,0 +1,181 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Tag marks a field to encrypt, the field must be a string or []byte:
+//
+//	Password string `json:"password" secret:"true"`
+const Tag = "secret"
+
+// Codec is a storm codec that stores records as JSON like the default codec, with the fields tagged secret:"true"
+// encrypted. Services keep working on plaintext structs. Values stored before the codec was in use are read as
+// they are and encrypted the next time the record is saved.
+type Codec struct {
+	keys  *Keyring
+	paths sync.Map
+}
+
+func NewCodec(keys *Keyring) *Codec {
+	return &Codec{keys: keys}
+}
+
+// Name is the name of the default JSON codec, storm refuses to open buckets written by a codec of another name
+// and the records keep the JSON format
+func (c *Codec) Name() string {
+	return "json"
+}
+
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	paths := c.secretPaths(reflect.TypeOf(v))
+	if len(paths) == 0 {
+		return b, nil
+	}
+	tree, err := decodeTree(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		// structs always hold plaintext, a value that looks encrypted is user input and is encrypted like any other
+		if err := transform(tree, p, func(s string) (string, error) {
+			return c.keys.Encrypt([]byte(s))
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(tree)
+}
+
+func (c *Codec) Unmarshal(b []byte, v interface{}) error {
+	if !bytes.Contains(b, []byte(Prefix)) {
+		return json.Unmarshal(b, v)
+	}
+	paths := c.secretPaths(reflect.TypeOf(v))
+	if len(paths) == 0 {
+		return json.Unmarshal(b, v)
+	}
+	tree, err := decodeTree(b)
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		if err := transform(tree, p, func(s string) (string, error) {
+			if !IsEncrypted(s) {
+				return s, nil
+			}
+			plaintext, err := c.keys.Decrypt(s)
+			return string(plaintext), err
+		}); err != nil {
+			return err
+		}
+	}
+	b, err = json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func decodeTree(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// transform replaces the non empty string at path
+func transform(tree interface{}, path []string, fn func(string) (string, error)) error {
+	for i, name := range path {
+		obj, ok := tree.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if i < len(path)-1 {
+			tree = obj[name]
+			continue
+		}
+		s, ok := obj[name].(string)
+		if !ok || s == "" {
+			return nil
+		}
+		out, err := fn(s)
+		if err != nil {
+			return err
+		}
+		obj[name] = out
+	}
+	return nil
+}
+
+// secretPaths returns the JSON paths of the tagged fields of t
+func (c *Codec) secretPaths(t reflect.Type) [][]string {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	if p, ok := c.paths.Load(t); ok {
+		return p.([][]string)
+	}
+	var paths [][]string
+	collectPaths(t, nil, &paths, map[reflect.Type]bool{})
+	c.paths.Store(t, paths)
+	return paths
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func collectPaths(t reflect.Type, prefix []string, paths *[][]string, visiting map[reflect.Type]bool) {
+	if visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		isStruct := ft.Kind() == reflect.Struct && !ft.Implements(marshalerType) && !reflect.PtrTo(ft).Implements(marshalerType)
+		if f.Anonymous && name == "" {
+			if isStruct {
+				collectPaths(ft, prefix, paths, visiting)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		path := append(append([]string{}, prefix...), name)
+		if f.Tag.Get(Tag) == "true" {
+			*paths = append(*paths, path)
+		} else if isStruct {
+			collectPaths(ft, path, paths, visiting)
+		}
+	}
+}
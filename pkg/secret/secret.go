@@ -0,0 +1,197 @@
+// Package secret encrypts sensitive values at rest with envelope encryption. Every value gets its own random data
+// key, the data key is stored next to the value wrapped by the master key. Both layers use AES-256-GCM.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Prefix marks an encrypted value, the full format is enc:v1:<key id>:<wrapped data key>:<ciphertext>
+const Prefix = "enc:v1:"
+
+const keySize = 32
+
+var encoding = base64.RawURLEncoding
+
+// Key is a master key
+type Key struct {
+	// ID identifies the key in encrypted values, it is derived from the key and reveals nothing about it
+	ID   string
+	aead cipher.AEAD
+}
+
+// ParseKey reads a base64 encoded 32 byte key
+func ParseKey(s string) (*Key, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	if len(raw) != keySize {
+		return nil, fmt.Errorf("invalid encryption key: want %d bytes, got %d", keySize, len(raw))
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(raw)
+	return &Key{ID: hex.EncodeToString(sum[:])[:8], aead: aead}, nil
+}
+
+// GenerateKey returns a new random key in the format ParseKey reads
+func GenerateKey() (string, error) {
+	raw := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// LoadKeyFile reads the key from a file
+func LoadKeyFile(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
+
+// WriteKeyFile generates a key into a new file only the owner can read, an existing file is never overwritten
+func WriteKeyFile(path string) (*Key, error) {
+	s, err := GenerateKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteString(s + "\n"); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return ParseKey(s)
+}
+
+// Keyring encrypts with its primary key and decrypts with any of its keys, so that values written before a key
+// rotation stay readable while they are re-encrypted
+type Keyring struct {
+	primary *Key
+	keys    map[string]*Key
+}
+
+func NewKeyring(primary *Key, old ...*Key) *Keyring {
+	r := &Keyring{primary: primary, keys: map[string]*Key{primary.ID: primary}}
+	for _, k := range old {
+		r.keys[k.ID] = k
+	}
+	return r
+}
+
+// Primary returns the key new values are encrypted with
+func (r *Keyring) Primary() *Key {
+	return r.primary
+}
+
+// IsEncrypted reports whether s looks like a value returned by Encrypt
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, Prefix)
+}
+
+// Encrypt seals plaintext under a new data key
+func (r *Keyring) Encrypt(plaintext []byte) (string, error) {
+	dek := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return "", err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := seal(r.primary.aead, dek, []byte(r.primary.ID))
+	if err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(aead, plaintext, wrapped)
+	if err != nil {
+		return "", err
+	}
+	return Prefix + r.primary.ID + ":" + encoding.EncodeToString(wrapped) + ":" + encoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt opens a value returned by Encrypt
+func (r *Keyring) Decrypt(s string) ([]byte, error) {
+	if !IsEncrypted(s) {
+		return nil, errors.New("value is not encrypted")
+	}
+	parts := strings.Split(strings.TrimPrefix(s, Prefix), ":")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed encrypted value")
+	}
+	key, ok := r.keys[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("value is encrypted with unknown key %s", parts[0])
+	}
+	wrapped, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	ciphertext, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	dek, err := open(key.aead, wrapped, []byte(key.ID))
+	if err != nil {
+		return nil, fmt.Errorf("can not unwrap data key with key %s: %w", key.ID, err)
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, ciphertext, wrapped)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce|ciphertext
+func seal(aead cipher.AEAD, plaintext, ad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+func open(aead cipher.AEAD, data, ad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("malformed encrypted value")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, ad)
+}
@@ -0,0 +1,109 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type base struct {
+	Name string `json:"name"`
+}
+
+type auth struct {
+	Token string `json:"token" secret:"true"`
+	Key   []byte `json:"key" secret:"true"`
+}
+
+type record struct {
+	base
+	Auth     auth   `json:"auth"`
+	Password string `json:"password" secret:"true"`
+	Empty    string `json:"empty" secret:"true"`
+	Count    int64  `json:"count"`
+}
+
+func newKey(t *testing.T) *Key {
+	s, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := ParseKey(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestKeyring(t *testing.T) {
+	oldKey, newKey := newKey(t), newKey(t)
+	enc, err := NewKeyring(oldKey).Encrypt([]byte("s3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(enc) || strings.Contains(enc, "s3cret") {
+		t.Fatalf("not encrypted: %s", enc)
+	}
+	if _, err := NewKeyring(newKey).Decrypt(enc); err == nil {
+		t.Fatal("decrypted with a wrong key")
+	}
+	plain, err := NewKeyring(newKey, oldKey).Decrypt(enc)
+	if err != nil || string(plain) != "s3cret" {
+		t.Fatalf("got %q, %v", plain, err)
+	}
+	tampered := enc[:len(enc)-2] + "AA"
+	if _, err := NewKeyring(oldKey).Decrypt(tampered); err == nil {
+		t.Fatal("decrypted a tampered value")
+	}
+}
+
+func TestCodec(t *testing.T) {
+	codec := NewCodec(NewKeyring(newKey(t)))
+	in := record{base: base{Name: "c1"}, Auth: auth{Token: "tok", Key: []byte("pem")}, Password: "pass", Count: 1 << 60}
+	b, err := codec.Marshal(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"tok", "pass", base64Of("pem")} {
+		if bytes.Contains(b, []byte(`"`+s+`"`)) {
+			t.Fatalf("%s stored in plaintext: %s", s, b)
+		}
+	}
+	if !bytes.Contains(b, []byte(`"name":"c1"`)) || !bytes.Contains(b, []byte(`"empty":""`)) {
+		t.Fatalf("unexpected record: %s", b)
+	}
+	var out record
+	if err := codec.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "c1" || out.Auth.Token != "tok" || string(out.Auth.Key) != "pem" || out.Password != "pass" || out.Count != 1<<60 {
+		t.Fatalf("got %+v", out)
+	}
+
+	// a plaintext that looks like an encrypted value is still encrypted and read back as it was
+	in.Password = Prefix + "kid:a:b"
+	if b, err = codec.Marshal(&in); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte(in.Password)) {
+		t.Fatalf("value with the prefix stored in plaintext: %s", b)
+	}
+	out = record{}
+	if err := codec.Unmarshal(b, &out); err != nil || out.Password != in.Password {
+		t.Fatalf("got %+v, %v", out, err)
+	}
+
+	// records written before encryption are read as they are
+	in.Password = "pass"
+	plain, _ := json.Marshal(&in)
+	out = record{}
+	if err := codec.Unmarshal(plain, &out); err != nil || out.Password != "pass" {
+		t.Fatalf("got %+v, %v", out, err)
+	}
+}
+
+func base64Of(s string) string {
+	b, _ := json.Marshal([]byte(s))
+	return strings.Trim(string(b), `"`)
+}
@@ -0,0 +1,166 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kubeClient "github.com/KubeOperator/kubepi/pkg/kubernetes"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+const (
+	DefaultDebugImage = "busybox:latest"
+
+	debugStartTimeout = 2 * time.Minute
+)
+
+// DebugContainerOptions describes the ephemeral container injected into a running pod
+type DebugContainerOptions struct {
+	Image string
+	// TargetContainer shares its process namespace with the debug container, empty when the pod shares it already
+	TargetContainer string
+	Shell           string
+}
+
+// AddDebugContainer injects an ephemeral container running an interactive shell and returns its name.
+// Ephemeral containers can not be removed again, the container ends when the attached shell exits.
+func AddDebugContainer(k8sClient kubernetes.Interface, namespace, podName string, opts DebugContainerOptions) (string, error) {
+	pods := k8sClient.CoreV1().Pods(namespace)
+	pod, err := pods.Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if opts.TargetContainer != "" && !hasContainer(pod, opts.TargetContainer) {
+		return "", fmt.Errorf("container %s not found in pod %s", opts.TargetContainer, podName)
+	}
+	if opts.Image == "" {
+		opts.Image = DefaultDebugImage
+	}
+	if opts.Shell == "" {
+		opts.Shell = "sh"
+	}
+	name := debugContainerName(pod)
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, v1.EphemeralContainer{
+		EphemeralContainerCommon: v1.EphemeralContainerCommon{
+			Name:                     name,
+			Image:                    opts.Image,
+			ImagePullPolicy:          v1.PullIfNotPresent,
+			Command:                  []string{opts.Shell},
+			Stdin:                    true,
+			TTY:                      true,
+			TerminationMessagePolicy: v1.TerminationMessageFallbackToLogsOnError,
+		},
+		TargetContainerName: opts.TargetContainer,
+	})
+	if _, err := pods.UpdateEphemeralContainers(context.TODO(), podName, pod, metav1.UpdateOptions{}); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func hasContainer(pod *v1.Pod, name string) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func debugContainerName(pod *v1.Pod) string {
+	for {
+		name := "debugger-" + utilrand.String(5)
+		exists := false
+		for _, c := range pod.Spec.EphemeralContainers {
+			if c.Name == name {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			return name
+		}
+	}
+}
+
+// waitForEphemeralContainer returns once the ephemeral container runs, and fails early when it can not start
+func waitForEphemeralContainer(ctx context.Context, k8sClient kubernetes.Interface, namespace, podName, containerName string) error {
+	return wait.PollUntilContextTimeout(ctx, time.Second, debugStartTimeout, true, func(ctx context.Context) (bool, error) {
+		pod, err := k8sClient.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name != containerName {
+				continue
+			}
+			if status.State.Running != nil {
+				return true, nil
+			}
+			if t := status.State.Terminated; t != nil {
+				return false, fmt.Errorf("debug container %s exited: %s %s", containerName, t.Reason, t.Message)
+			}
+			if err := containerStartError(status); err != nil {
+				return false, fmt.Errorf("debug container %s can not start: %v", containerName, err)
+			}
+		}
+		return false, nil
+	})
+}
+
+// startAttach attaches the pty to the main process of a container, used for ephemeral containers whose shell was
+// started with the container
+func startAttach(k8sClient kubernetes.Interface, cfg *rest.Config, namespace, podName, containerName string, ptyHandler PtyHandler) error {
+	req := k8sClient.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("attach")
+	req.VersionedParams(&v1.PodAttachOptions{
+		Container: containerName,
+		Stdin:     true,
+		Stdout:    true,
+		Stderr:    true,
+		TTY:       true,
+	}, scheme.ParameterCodec)
+
+	exec, err := kubeClient.NewSPDYExecutor(cfg, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+	return exec.StreamWithContext(context.Background(), remotecommand.StreamOptions{
+		Stdin:             ptyHandler,
+		Stdout:            ptyHandler,
+		Stderr:            ptyHandler,
+		TerminalSizeQueue: ptyHandler,
+		Tty:               true,
+	})
+}
+
+// WaitForDebugTerminal is the ephemeral container counterpart of WaitForTerminal, it attaches the session once the
+// client is bound and the debug container runs
+func WaitForDebugTerminal(k8sClient kubernetes.Interface, cfg *rest.Config, namespace, podName, containerName, sessionId string) {
+	select {
+	case <-TerminalSessions.Get(sessionId).Bound:
+		close(TerminalSessions.Get(sessionId).Bound)
+
+		err := waitForEphemeralContainer(context.Background(), k8sClient, namespace, podName, containerName)
+		if err == nil {
+			err = startAttach(k8sClient, cfg, namespace, podName, containerName, TerminalSessions.Get(sessionId))
+		}
+		if err != nil {
+			TerminalSessions.Close(sessionId, 2, err.Error())
+			return
+		}
+
+		TerminalSessions.Close(sessionId, 1, "Process exited")
+	}
+}
@@ -0,0 +1,32 @@
+package terminal
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAddDebugContainer(t *testing.T) {
+	client := fake.NewSimpleClientset(&v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "prod"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "app", Image: "gcr.io/distroless/static"}}},
+	})
+	if _, err := AddDebugContainer(client, "prod", "api", DebugContainerOptions{TargetContainer: "missing"}); err == nil {
+		t.Fatal("unknown target container should be rejected")
+	}
+	name, err := AddDebugContainer(client, "prod", "api", DebugContainerOptions{TargetContainer: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod, _ := client.CoreV1().Pods("prod").Get(context.TODO(), "api", metav1.GetOptions{})
+	if len(pod.Spec.EphemeralContainers) != 1 {
+		t.Fatalf("expected one ephemeral container, got %v", pod.Spec.EphemeralContainers)
+	}
+	c := pod.Spec.EphemeralContainers[0]
+	if c.Name != name || c.Image != DefaultDebugImage || c.TargetContainerName != "app" || !c.Stdin || !c.TTY || c.Command[0] != "sh" {
+		t.Errorf("unexpected debug container %+v", c)
+	}
+}
@@ -0,0 +1,231 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	k8sError "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	DefaultNodeShellImage       = "alpine:latest"
+	DefaultNodeShellNamespace   = "default"
+	DefaultNodeShellIdleTimeout = 30 * time.Minute
+
+	nodeShellContainer    = "node-shell"
+	nodeShellLabel        = "kubepi.io/node-shell"
+	nodeShellNodeAnnotate = "kubepi.io/node-shell-node"
+	nodeShellStartTimeout = 2 * time.Minute
+)
+
+// nodeShells are the node shell pods of the open sessions of this process, keyed by namespace/name
+var nodeShells = struct {
+	lock sync.Mutex
+	pods map[string]bool
+}{pods: map[string]bool{}}
+
+func trackNodeShell(pod *v1.Pod, open bool) {
+	nodeShells.lock.Lock()
+	defer nodeShells.lock.Unlock()
+	key := pod.Namespace + "/" + pod.Name
+	if open {
+		nodeShells.pods[key] = true
+	} else {
+		delete(nodeShells.pods, key)
+	}
+}
+
+// SweepNodeShells deletes the node shell pods of the cluster that belong to no open session, they are left behind
+// when KubePi stops while a session is open. Pods younger than the start timeout are kept, another KubePi sharing
+// the cluster may still be starting them. It returns the number of deleted pods.
+func SweepNodeShells(ctx context.Context, k8sClient kubernetes.Interface) (int, error) {
+	pods, err := k8sClient.CoreV1().Pods("").List(ctx, metav1.ListOptions{LabelSelector: nodeShellLabel + "=true"})
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if time.Since(pod.CreationTimestamp.Time) < nodeShellStartTimeout {
+			continue
+		}
+		nodeShells.lock.Lock()
+		open := nodeShells.pods[pod.Namespace+"/"+pod.Name]
+		nodeShells.lock.Unlock()
+		if open {
+			continue
+		}
+		if err := k8sClient.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{GracePeriodSeconds: ptr.To(int64(0))}); err != nil && !k8sError.IsNotFound(err) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// nodeShellCommand enters the node's root filesystem mounted at /host, preferring bash when the node has it
+var nodeShellCommand = []string{"chroot", "/host", "/bin/sh", "-c", "if [ -x /bin/bash ]; then exec /bin/bash -l; else exec /bin/sh -l; fi"}
+
+// NodeShellOptions configures the privileged pod a node shell runs in
+type NodeShellOptions struct {
+	Image       string
+	Namespace   string
+	Tolerations []v1.Toleration
+	Resources   v1.ResourceRequirements
+	// IdleTimeout closes the session when the user sent no input for this long
+	IdleTimeout time.Duration
+}
+
+func (o NodeShellOptions) withDefaults() NodeShellOptions {
+	if o.Image == "" {
+		o.Image = DefaultNodeShellImage
+	}
+	if o.Namespace == "" {
+		o.Namespace = DefaultNodeShellNamespace
+	}
+	if o.Tolerations == nil {
+		// tolerate every taint so that the shell also starts on control plane and cordoned nodes
+		o.Tolerations = []v1.Toleration{{Operator: v1.TolerationOpExists}}
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = DefaultNodeShellIdleTimeout
+	}
+	return o
+}
+
+// nodeShellPod builds the debug pod of one session, every session gets its own pod so closing one never affects another
+func nodeShellPod(nodeName, sessionId string, o NodeShellOptions) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        fmt.Sprintf("node-shell-%s", sessionId[:12]),
+			Namespace:   o.Namespace,
+			Labels:      map[string]string{nodeShellLabel: "true"},
+			Annotations: map[string]string{nodeShellNodeAnnotate: nodeName},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:            nodeShellContainer,
+				Image:           o.Image,
+				ImagePullPolicy: v1.PullIfNotPresent,
+				Stdin:           true,
+				TTY:             true,
+				Command:         []string{"/bin/sh"},
+				Resources:       o.Resources,
+				SecurityContext: &v1.SecurityContext{
+					Privileged: ptr.To(true),
+				},
+				VolumeMounts: []v1.VolumeMount{{Name: "host-root", MountPath: "/host"}},
+			}},
+			NodeName:                      nodeName,
+			RestartPolicy:                 v1.RestartPolicyNever,
+			HostNetwork:                   true,
+			HostPID:                       true,
+			HostIPC:                       true,
+			TerminationGracePeriodSeconds: ptr.To(int64(0)),
+			Tolerations:                   o.Tolerations,
+			Volumes: []v1.Volume{{
+				Name:         "host-root",
+				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/"}},
+			}},
+		},
+	}
+}
+
+// waitForPodRunning returns once the pod runs, and fails early when it terminated or can not pull its image
+func waitForPodRunning(ctx context.Context, k8sClient kubernetes.Interface, namespace, name string) error {
+	return wait.PollUntilContextTimeout(ctx, time.Second, nodeShellStartTimeout, true, func(ctx context.Context) (bool, error) {
+		pod, err := k8sClient.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		switch pod.Status.Phase {
+		case v1.PodRunning:
+			return true, nil
+		case v1.PodFailed, v1.PodSucceeded:
+			return false, fmt.Errorf("node shell pod %s/%s exited: %s", namespace, name, pod.Status.Message)
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if err := containerStartError(status); err != nil {
+				return false, fmt.Errorf("node shell pod %s/%s can not start: %v", namespace, name, err)
+			}
+		}
+		return false, nil
+	})
+}
+
+// containerStartError reports waiting reasons a container does not recover from without user action
+func containerStartError(status v1.ContainerStatus) error {
+	if w := status.State.Waiting; w != nil {
+		switch w.Reason {
+		case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError":
+			return fmt.Errorf("%s %s", w.Reason, w.Message)
+		}
+	}
+	return nil
+}
+
+// idlePty closes the stream when no input arrived within the timeout, output alone does not keep the session alive
+type idlePty struct {
+	PtyHandler
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (p idlePty) Read(b []byte) (int, error) {
+	n, err := p.PtyHandler.Read(b)
+	p.timer.Reset(p.timeout)
+	return n, err
+}
+
+// WaitForNodeShellTerminal is the node counterpart of WaitForTerminal. Once the client is bound it starts a debug pod
+// on the node, opens a shell chrooted into the host and deletes the pod when the session ends.
+func WaitForNodeShellTerminal(k8sClient kubernetes.Interface, cfg *rest.Config, nodeName string, sessionId string, opts NodeShellOptions) {
+	select {
+	case <-TerminalSessions.Get(sessionId).Bound:
+		close(TerminalSessions.Get(sessionId).Bound)
+
+		if err := startNodeShellProcess(k8sClient, cfg, nodeName, sessionId, opts.withDefaults()); err != nil {
+			TerminalSessions.Close(sessionId, 2, err.Error())
+			return
+		}
+
+		TerminalSessions.Close(sessionId, 1, "Process exited")
+	}
+}
+
+func startNodeShellProcess(k8sClient kubernetes.Interface, cfg *rest.Config, nodeName string, sessionId string, opts NodeShellOptions) error {
+	pod := nodeShellPod(nodeName, sessionId, opts)
+	pods := k8sClient.CoreV1().Pods(pod.Namespace)
+	trackNodeShell(pod, true)
+	defer trackNodeShell(pod, false)
+	if _, err := pods.Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		return err
+	}
+	defer func() {
+		// the session context may already be cancelled, deletion uses its own
+		_ = pods.Delete(context.Background(), pod.Name, metav1.DeleteOptions{GracePeriodSeconds: ptr.To(int64(0))})
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := waitForPodRunning(ctx, k8sClient, pod.Namespace, pod.Name); err != nil {
+		return err
+	}
+
+	timer := time.AfterFunc(opts.IdleTimeout, cancel)
+	defer timer.Stop()
+	pty := idlePty{PtyHandler: TerminalSessions.Get(sessionId), timer: timer, timeout: opts.IdleTimeout}
+	err := startProcess(ctx, k8sClient, cfg, nodeShellCommand, pod.Namespace, pod.Name, nodeShellContainer, pty)
+	if ctx.Err() != nil {
+		return fmt.Errorf("session closed after %s without input", opts.IdleTimeout)
+	}
+	return err
+}
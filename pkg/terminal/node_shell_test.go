@@ -0,0 +1,67 @@
+package terminal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeShellPod(t *testing.T) {
+	pod := nodeShellPod("worker-1", "0123456789abcdef0123456789abcdef", NodeShellOptions{}.withDefaults())
+	if pod.Name != "node-shell-0123456789ab" || pod.Namespace != DefaultNodeShellNamespace || pod.Spec.NodeName != "worker-1" {
+		t.Fatalf("unexpected pod %s/%s on %s", pod.Namespace, pod.Name, pod.Spec.NodeName)
+	}
+	if len(pod.Spec.Tolerations) != 1 || pod.Spec.Tolerations[0].Operator != v1.TolerationOpExists {
+		t.Errorf("default tolerations should tolerate every taint, got %v", pod.Spec.Tolerations)
+	}
+
+	opts := NodeShellOptions{
+		Image:       "registry.local/library/alpine:3.19",
+		Namespace:   "ops",
+		Tolerations: []v1.Toleration{},
+		Resources:   v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("128Mi")}},
+	}.withDefaults()
+	pod = nodeShellPod("worker-1", "0123456789abcdef0123456789abcdef", opts)
+	c := pod.Spec.Containers[0]
+	if pod.Namespace != "ops" || c.Image != opts.Image || c.Resources.Limits.Memory().String() != "128Mi" {
+		t.Fatalf("options not applied: %s %s %v", pod.Namespace, c.Image, c.Resources)
+	}
+	if len(pod.Spec.Tolerations) != 0 {
+		t.Errorf("an explicit empty toleration list must be kept, got %v", pod.Spec.Tolerations)
+	}
+	if opts.IdleTimeout != DefaultNodeShellIdleTimeout {
+		t.Errorf("unexpected idle timeout %s", opts.IdleTimeout)
+	}
+}
+
+func TestSweepNodeShells(t *testing.T) {
+	pod := func(name string, age time.Duration) *v1.Pod {
+		p := nodeShellPod("worker-1", name+"0123456789ab", NodeShellOptions{}.withDefaults())
+		p.CreationTimestamp = metav1.NewTime(time.Now().Add(-age))
+		return p
+	}
+	orphaned, open, starting := pod("orphaned", time.Hour), pod("open", time.Hour), pod("starting", time.Second)
+	other := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: DefaultNodeShellNamespace, CreationTimestamp: metav1.NewTime(time.Now().Add(-time.Hour))}}
+	client := fake.NewSimpleClientset(orphaned, open, starting, other)
+	trackNodeShell(open, true)
+	defer trackNodeShell(open, false)
+
+	deleted, err := SweepNodeShells(context.TODO(), client)
+	if err != nil || deleted != 1 {
+		t.Fatalf("expect one pod deleted, got %d %v", deleted, err)
+	}
+	pods, _ := client.CoreV1().Pods(DefaultNodeShellNamespace).List(context.TODO(), metav1.ListOptions{})
+	for _, p := range pods.Items {
+		if p.Name == orphaned.Name {
+			t.Errorf("orphaned pod %s is kept", p.Name)
+		}
+	}
+	if len(pods.Items) != 3 {
+		t.Errorf("expect the open, starting and unrelated pods to be kept, got %d pods", len(pods.Items))
+	}
+}
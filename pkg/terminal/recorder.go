@@ -0,0 +1,149 @@
+package terminal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	defaultRecordWidth  = 80
+	defaultRecordHeight = 24
+)
+
+// Recorder writes a terminal session as an asciicast v2 file, see https://docs.asciinema.org/manual/asciicast/v2/
+type Recorder struct {
+	lock        sync.Mutex
+	f           *os.File
+	start       time.Time
+	recordInput bool
+	size        int64
+	closed      bool
+	// pending keeps an incomplete trailing UTF-8 sequence of each stream until the next chunk arrives
+	pending map[string][]byte
+	onClose func(reason string, size int64)
+}
+
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env"`
+}
+
+// NewRecorder creates the cast file and writes its header, input is only recorded when recordInput is set
+func NewRecorder(path, title string, recordInput bool) (*Recorder, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{f: f, start: time.Now(), recordInput: recordInput, pending: map[string][]byte{}}
+	header, err := json.Marshal(castHeader{
+		Version:   2,
+		Width:     defaultRecordWidth,
+		Height:    defaultRecordHeight,
+		Timestamp: r.start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": "xterm"},
+	})
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := r.writeLine(header); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// OnClose registers a callback invoked once when the recording is closed
+func (r *Recorder) OnClose(fn func(reason string, size int64)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.onClose = fn
+}
+
+func (r *Recorder) Output(p []byte) {
+	r.event("o", p)
+}
+
+func (r *Recorder) Input(p []byte) {
+	if r != nil && r.recordInput {
+		r.event("i", p)
+	}
+}
+
+func (r *Recorder) Resize(cols, rows uint16) {
+	r.event("r", []byte(fmt.Sprintf("%dx%d", cols, rows)))
+}
+
+func (r *Recorder) event(code string, p []byte) {
+	if r == nil || len(p) == 0 {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return
+	}
+	data := p
+	if code != "r" {
+		data, r.pending[code] = splitUTF8(append(r.pending[code], p...))
+		if len(data) == 0 {
+			return
+		}
+	}
+	line, err := json.Marshal([]interface{}{time.Since(r.start).Seconds(), code, string(data)})
+	if err != nil {
+		return
+	}
+	_ = r.writeLine(line)
+}
+
+func (r *Recorder) writeLine(line []byte) error {
+	n, err := r.f.Write(append(line, '\n'))
+	r.size += int64(n)
+	return err
+}
+
+// Close finishes the recording, it is safe to call more than once and on a nil recorder
+func (r *Recorder) Close(reason string) {
+	if r == nil {
+		return
+	}
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return
+	}
+	r.closed = true
+	_ = r.f.Close()
+	onClose, size := r.onClose, r.size
+	r.lock.Unlock()
+	if onClose != nil {
+		onClose(reason, size)
+	}
+}
+
+// splitUTF8 returns the longest prefix that does not end inside a multi-byte sequence and the remaining bytes
+func splitUTF8(p []byte) ([]byte, []byte) {
+	for i := 1; i <= utf8.UTFMax-1 && i <= len(p); i++ {
+		b := p[len(p)-i]
+		if b < utf8.RuneSelf {
+			break
+		}
+		if utf8.RuneStart(b) {
+			if !utf8.FullRune(p[len(p)-i:]) {
+				return p[:len(p)-i], append([]byte{}, p[len(p)-i:]...)
+			}
+			break
+		}
+	}
+	return p, nil
+}
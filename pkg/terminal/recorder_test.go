@@ -0,0 +1,111 @@
+package terminal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fakeConn struct {
+	bytes.Buffer
+	written bytes.Buffer
+}
+
+func (c *fakeConn) Write(p []byte) (int, error) { return c.written.Write(p) }
+func (c *fakeConn) Close() error                { return nil }
+
+func wsFrame(payload []byte, mask bool, fin bool) []byte {
+	b0 := byte(0x1)
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0}
+	b1 := byte(len(payload))
+	if mask {
+		b1 |= 0x80
+	}
+	frame = append(frame, b1)
+	if !mask {
+		return append(frame, payload...)
+	}
+	key := []byte{1, 2, 3, 4}
+	frame = append(frame, key...)
+	for i, c := range payload {
+		frame = append(frame, c^key[i%4])
+	}
+	return frame
+}
+
+func TestTapGottyRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.cast")
+	conn := &fakeConn{}
+	var token, reason string
+	tap := TapGotty(conn, func(arguments url.Values) *Recorder {
+		token = arguments.Get("token")
+		r, err := NewRecorder(path, "test", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.OnClose(func(r string, _ int64) { reason = r })
+		return r
+	})
+
+	init, _ := json.Marshal(map[string]string{"Arguments": "?token=abc", "AuthToken": ""})
+	input := wsFrame([]byte("1ls\n"), true, true)
+	// a fragmented resize message split across two writes
+	resize := append(wsFrame([]byte(`3{"Columns":120,`), true, false), 0x80, 0x80|11, 1, 2, 3, 4)
+	for i, c := range []byte(`"Rows":40}` + " ") {
+		resize = append(resize, c^[]byte{1, 2, 3, 4}[i%4])
+	}
+	var sent []byte
+	for _, p := range [][]byte{wsFrame(init, true, true), input, resize[:5], resize[5:]} {
+		sent = append(sent, p...)
+		if _, err := tap.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// "世" split between two output messages
+	out := "1" + base64.StdEncoding.EncodeToString([]byte("hi \xe4\xb8"))
+	conn.Buffer.Write(wsFrame([]byte(out), false, true))
+	conn.Buffer.Write(wsFrame([]byte("1"+base64.StdEncoding.EncodeToString([]byte("\x96"))), false, true))
+	buf := make([]byte, 4096)
+	for {
+		if _, err := tap.Read(buf); err == io.EOF {
+			break
+		}
+	}
+	if !bytes.Equal(conn.written.Bytes(), sent) {
+		t.Error("client frames must be forwarded unchanged")
+	}
+	if token != "abc" || reason != io.EOF.Error() {
+		t.Fatalf("unexpected token %q, reason %q", token, reason)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("expected header and 4 events, got %q", lines)
+	}
+	var header castHeader
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil || header.Version != 2 {
+		t.Fatalf("unexpected header %s", lines[0])
+	}
+	for i, want := range [][2]string{{"i", "ls\n"}, {"r", "120x40"}, {"o", "hi "}, {"o", "世"}} {
+		var event []interface{}
+		if err := json.Unmarshal([]byte(lines[i+1]), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event[1] != want[0] || event[2] != want[1] {
+			t.Errorf("event %d: got %v, want %v", i, event, want)
+		}
+	}
+}
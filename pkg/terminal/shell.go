@@ -13,14 +13,13 @@ import (
 	"sync"
 	"time"
 
+	kubeClient "github.com/KubeOperator/kubepi/pkg/kubernetes"
 	"gopkg.in/igm/sockjs-go.v2/sockjs"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/remotecommand"
-	"k8s.io/utils/ptr"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const END_OF_TRANSMISSION = "\u0004"
@@ -41,6 +40,8 @@ type TerminalSession struct {
 	SizeChan      chan remotecommand.TerminalSize
 	doneChan      chan struct{}
 	TimeOut       time.Time
+	// Recorder is nil when the session is not recorded
+	Recorder *Recorder
 }
 
 // TerminalMessage is the messaging protocol between ShellController and TerminalSession.
@@ -90,8 +91,10 @@ func (t TerminalSession) Read(p []byte) (int, error) {
 
 	switch msg.Op {
 	case "stdin":
+		session.Recorder.Input([]byte(msg.Data))
 		return copy(p, msg.Data), nil
 	case "resize":
+		session.Recorder.Resize(msg.Cols, msg.Rows)
 		session.SizeChan <- remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows}
 		return 0, nil
 	default:
@@ -119,6 +122,7 @@ func (t TerminalSession) Write(p []byte) (int, error) {
 	if err = session.sockJSSession.Send(string(msg)); err != nil {
 		return 0, err
 	}
+	session.Recorder.Output(p)
 	return len(p), nil
 }
 
@@ -173,6 +177,7 @@ func (sm *SessionMap) Close(sessionId string, status uint32, reason string) {
 	if err != nil && status != 1 {
 		log.Println(err)
 	}
+	sm.Sessions[sessionId].Recorder.Close(reason)
 
 	delete(sm.Sessions, sessionId)
 }
@@ -181,6 +186,7 @@ func (sm *SessionMap) Close(sessionId string, status uint32, reason string) {
 func (sm *SessionMap) Clean() {
 	for _, v := range sm.Sessions {
 		v.sockJSSession.Close(2, "system is logout, please retry...")
+		v.Recorder.Close("system is logout")
 	}
 	sm.Sessions = make(map[string]TerminalSession)
 }
@@ -226,7 +232,7 @@ func CreateAttachHandler(path string) http.Handler {
 	return sockjs.NewHandler(path, sockjs.DefaultOptions, handleTerminalSession)
 }
 
-func startProcess(k8sClient kubernetes.Interface, cfg *rest.Config, cmd []string, namespace string, podName string, containerName string, ptyHandler PtyHandler) error {
+func startProcess(ctx context.Context, k8sClient kubernetes.Interface, cfg *rest.Config, cmd []string, namespace string, podName string, containerName string, ptyHandler PtyHandler) error {
 
 	req := k8sClient.CoreV1().RESTClient().Post().
 		Resource("pods").
@@ -243,11 +249,10 @@ func startProcess(k8sClient kubernetes.Interface, cfg *rest.Config, cmd []string
 		TTY:       true,
 	}, scheme.ParameterCodec)
 
-	exec, err := remotecommand.NewSPDYExecutor(cfg, "POST", req.URL())
+	exec, err := kubeClient.NewSPDYExecutor(cfg, "POST", req.URL())
 	if err != nil {
 		return err
 	}
-	ctx :=context.Background()
 	err = exec.StreamWithContext(ctx,remotecommand.StreamOptions{
 		Stdin:             ptyHandler,
 		Stdout:            ptyHandler,
@@ -294,13 +299,13 @@ func WaitForTerminal(k8sClient kubernetes.Interface, cfg *rest.Config, namespace
 
 		if isValidShell(validShells, shell) {
 			cmd := []string{shell}
-			err = startProcess(k8sClient, cfg, cmd, namespace, podName, containerName, TerminalSessions.Get(sessionId))
+			err = startProcess(context.Background(), k8sClient, cfg, cmd, namespace, podName, containerName, TerminalSessions.Get(sessionId))
 		} else {
 			// No shell given or it was not valid: try some shells until one succeeds or all fail
 			// FIXME: if the first shell fails then the first keyboard event is lost
 			for _, testShell := range validShells {
 				cmd := []string{testShell}
-				if err = startProcess(k8sClient, cfg, cmd, namespace, podName, containerName, TerminalSessions.Get(sessionId)); err == nil {
+				if err = startProcess(context.Background(), k8sClient, cfg, cmd, namespace, podName, containerName, TerminalSessions.Get(sessionId)); err == nil {
 					break
 				}
 			}
@@ -314,139 +319,3 @@ func WaitForTerminal(k8sClient kubernetes.Interface, cfg *rest.Config, namespace
 		TerminalSessions.Close(sessionId, 1, "Process exited")
 	}
 }
-
-//node shell
-func WaitForNodeShellTerminal(k8sClient kubernetes.Interface, cfg *rest.Config,nodeName string, sessionId string) {
-	select {
-	case <-TerminalSessions.Get(sessionId).Bound:
-		close(TerminalSessions.Get(sessionId).Bound)
-
-		err := startNodeShellProcess(k8sClient, cfg, nodeName, TerminalSessions.Get(sessionId))
-		
-
-		if err != nil {
-			TerminalSessions.Close(sessionId, 2, err.Error())
-			return
-		}
-
-		TerminalSessions.Close(sessionId, 1, "Process exited")
-	}
-}
-func startNodeShellProcess(k8sClient kubernetes.Interface, cfg *rest.Config, nodeName string, ptyHandler PtyHandler) error {
-
-	/*创建特权容器*/
-	containerName := "node-shell"
-	podName :="node-"+nodeName+"-shell"
-	namespace :="default"
-	image := "alpine:latest"
-	ctx :=context.Background()
-
-	getpod ,err :=k8sClient.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-	    FieldSelector :"metadata.name="+podName+",metadata.namespace="+namespace,
-	})
-	if err != nil {
-	    return err
-	}
-	//没有pod则创建
-	if len(getpod.Items) == 0 {
-	    container := &v1.Container{
-			Name:            containerName,
-			Image:           image,
-			ImagePullPolicy: v1.PullIfNotPresent,
-			Stdin:           true,
-			StdinOnce:       true,
-			TTY:             true,
-			Command:         []string{"/bin/sh"},
-			SecurityContext: &v1.SecurityContext{
-				Privileged : ptr.To(true),
-			},
-			//挂载hostPath到容器中
-			VolumeMounts: []v1.VolumeMount{
-			    {
-					Name:      "host-root",
-					MountPath: "/host",
-				},
-			},
-		}
-	
-	
-		pod := &v1.Pod{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: podName,
-				Namespace: namespace,
-			},
-			Spec: v1.PodSpec{
-				Containers: []v1.Container{*container},
-				NodeName: nodeName,
-				RestartPolicy: v1.RestartPolicyNever,
-				HostNetwork: true,
-				HostPID: true,
-				Tolerations: []v1.Toleration{
-				  
-					{
-							Key: "CriticalAddonsOnly",
-							Operator: v1.TolerationOpExists,
-					},
-					{
-							Key: "NoExecute",
-							Operator: v1.TolerationOpExists,
-					},
-				},
-				//挂载hostPath到容器中
-				Volumes: []v1.Volume{
-				    v1.Volume{
-						Name: "host-root",
-						VolumeSource: v1.VolumeSource{
-								HostPath: &v1.HostPathVolumeSource{
-									Path: "/",
-								},
-						},
-					},
-				},
-			},
-		}
-		_, err = k8sClient.CoreV1().Pods(namespace).Create(context.TODO(), pod, metav1.CreateOptions{
-		});
-		if err != nil {
-			return err
-		}
-		//等待pod创建完成
-		time.Sleep(5 * time.Second)
-	}
-
-	
-
-	cmd :=[]string{"sh"}
-	req := k8sClient.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(podName).
-		Namespace(namespace).
-		SubResource("exec")
-
-	req.VersionedParams(&v1.PodExecOptions{
-		Container: containerName,
-		Command:   cmd,
-		Stdin:     true,
-		Stdout:    true,
-		Stderr:    true,
-		TTY:       true,
-	}, scheme.ParameterCodec)
-
-	exec, err := remotecommand.NewSPDYExecutor(cfg, "POST", req.URL())
-	if err != nil {
-		return err
-	}
-	
-	err = exec.StreamWithContext(ctx,remotecommand.StreamOptions{
-		Stdin:             ptyHandler,
-		Stdout:            ptyHandler,
-		Stderr:            ptyHandler,
-		TerminalSizeQueue: ptyHandler,
-		Tty:               true,
-	})
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
\ No newline at end of file
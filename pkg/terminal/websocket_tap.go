@@ -0,0 +1,161 @@
+package terminal
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/url"
+	"sync/atomic"
+)
+
+const maxTapFrameSize = 16 << 20
+
+// wsReader reassembles websocket messages from one direction of a raw connection.
+// It only observes the bytes, frames it can not follow (compressed or oversized) stop the parsing.
+type wsReader struct {
+	buf      []byte
+	message  []byte
+	disabled bool
+}
+
+func (w *wsReader) feed(p []byte, onMessage func([]byte)) {
+	if w.disabled {
+		return
+	}
+	w.buf = append(w.buf, p...)
+	for {
+		if len(w.buf) < 2 {
+			return
+		}
+		fin, rsv, opcode := w.buf[0]&0x80 != 0, w.buf[0]&0x70, w.buf[0]&0x0f
+		masked := w.buf[1]&0x80 != 0
+		length := uint64(w.buf[1] & 0x7f)
+		offset := 2
+		switch length {
+		case 126:
+			if len(w.buf) < 4 {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(w.buf[2:4]))
+			offset = 4
+		case 127:
+			if len(w.buf) < 10 {
+				return
+			}
+			length = binary.BigEndian.Uint64(w.buf[2:10])
+			offset = 10
+		}
+		if rsv != 0 || length > maxTapFrameSize {
+			w.disabled, w.buf, w.message = true, nil, nil
+			return
+		}
+		var mask []byte
+		if masked {
+			if len(w.buf) < offset+4 {
+				return
+			}
+			mask = w.buf[offset : offset+4]
+			offset += 4
+		}
+		if uint64(len(w.buf)-offset) < length {
+			return
+		}
+		payload := w.buf[offset : offset+int(length)]
+		if masked {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+		// control frames may be interleaved with a fragmented message and are skipped
+		if opcode < 0x8 {
+			w.message = append(w.message, payload...)
+			if fin {
+				onMessage(w.message)
+				w.message = nil
+			}
+		}
+		w.buf = w.buf[offset+int(length):]
+	}
+}
+
+// gottyTap records a gotty websocket connection passing through the reverse proxy
+type gottyTap struct {
+	io.ReadWriteCloser
+	server   wsReader
+	client   wsReader
+	start    func(arguments url.Values) *Recorder
+	recorder atomic.Pointer[Recorder]
+}
+
+// TapGotty wraps the backend side of a proxied gotty websocket. start is called with the query arguments of the
+// gotty init message and returns the recorder for the session, or nil to skip recording.
+func TapGotty(conn io.ReadWriteCloser, start func(arguments url.Values) *Recorder) io.ReadWriteCloser {
+	return &gottyTap{ReadWriteCloser: conn, start: start}
+}
+
+// Read carries gotty output to the browser: '1' followed by base64 encoded terminal data
+func (t *gottyTap) Read(p []byte) (int, error) {
+	n, err := t.ReadWriteCloser.Read(p)
+	if n > 0 {
+		// the parser unmasks in place, so it always works on a copy of the forwarded bytes
+		t.server.feed(append([]byte{}, p[:n]...), func(msg []byte) {
+			if len(msg) == 0 || msg[0] != '1' {
+				return
+			}
+			if data, err := base64.StdEncoding.DecodeString(string(msg[1:])); err == nil {
+				t.recorder.Load().Output(data)
+			}
+		})
+	}
+	if err != nil {
+		t.recorder.Load().Close(err.Error())
+	}
+	return n, err
+}
+
+// Write carries browser messages to gotty: the JSON init message first, then '1' input and '3' resize
+func (t *gottyTap) Write(p []byte) (int, error) {
+	t.client.feed(append([]byte{}, p...), func(msg []byte) {
+		if len(msg) == 0 {
+			return
+		}
+		if t.start != nil {
+			var init struct {
+				Arguments string
+			}
+			start := t.start
+			t.start = nil
+			if json.Unmarshal(msg, &init) == nil {
+				args, _ := url.ParseQuery(trimQuery(init.Arguments))
+				t.recorder.Store(start(args))
+			}
+			return
+		}
+		switch msg[0] {
+		case '1':
+			t.recorder.Load().Input(msg[1:])
+		case '3':
+			var size struct {
+				Columns float64
+				Rows    float64
+			}
+			if json.Unmarshal(msg[1:], &size) == nil {
+				t.recorder.Load().Resize(uint16(size.Columns), uint16(size.Rows))
+			}
+		}
+	})
+	return t.ReadWriteCloser.Write(p)
+}
+
+func (t *gottyTap) Close() error {
+	t.recorder.Load().Close("connection closed")
+	return t.ReadWriteCloser.Close()
+}
+
+func trimQuery(s string) string {
+	if len(s) > 0 && s[0] == '?' {
+		return s[1:]
+	}
+	return s
+}
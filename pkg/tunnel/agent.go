@@ -0,0 +1,139 @@
+package tunnel
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/http2"
+)
+
+const (
+	// agentIdleTimeout drops a tunnel that received nothing, KubePi pings idle tunnels every pingInterval
+	agentIdleTimeout = 3 * pingInterval
+	maxBackoff       = 30 * time.Second
+	maxStreams       = 1000
+)
+
+// Agent keeps a tunnel to KubePi open and relays the streams KubePi opens to Target
+type Agent struct {
+	// Server is the address KubePi is reachable at, e.g. https://kubepi.example.com
+	Server  string
+	Cluster string
+	Token   string
+	// Target is the host:port of the API server, every stream goes there whatever address KubePi asked for
+	Target    string
+	TLSConfig *tls.Config
+	Logf      func(format string, args ...interface{})
+}
+
+// Run connects to KubePi and reconnects with backoff until ctx is done
+func (a *Agent) Run(ctx context.Context) error {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := a.serve(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if time.Since(start) > maxBackoff {
+			backoff = time.Second
+		}
+		a.logf("tunnel to %s closed: %v, reconnecting in %s", a.Server, err, backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (a *Agent) logf(format string, args ...interface{}) {
+	if a.Logf != nil {
+		a.Logf(format, args...)
+	}
+}
+
+func (a *Agent) connectURL() string {
+	u := strings.TrimSuffix(a.Server, "/") + ConnectPath
+	if strings.HasPrefix(u, "https://") {
+		return "wss://" + strings.TrimPrefix(u, "https://")
+	}
+	return "ws://" + strings.TrimPrefix(u, "http://")
+}
+
+// serve runs one tunnel until it breaks
+func (a *Agent) serve(ctx context.Context) error {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		TLSClientConfig:  a.TLSConfig,
+		HandshakeTimeout: dialTimeout,
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+a.Token)
+	header.Set(HeaderCluster, a.Cluster)
+	ws, resp, err := dialer.DialContext(ctx, a.connectURL(), header)
+	if err != nil {
+		if resp != nil {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			_ = resp.Body.Close()
+			return fmt.Errorf("%s: %s %s", err.Error(), resp.Status, strings.TrimSpace(string(msg)))
+		}
+		return err
+	}
+	a.logf("tunnel to %s established for cluster %s", a.Server, a.Cluster)
+	conn := newConn(ws, agentIdleTimeout)
+	defer conn.Close()
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-conn.done:
+		}
+	}()
+	srv := &http2.Server{MaxConcurrentStreams: maxStreams}
+	srv.ServeConn(conn, &http2.ServeConnOpts{Context: ctx, Handler: http.HandlerFunc(a.relay)})
+	return fmt.Errorf("connection lost")
+}
+
+// relay serves one CONNECT stream
+func (a *Agent) relay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	backend, err := net.DialTimeout("tcp", a.Target, dialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer backend.Close()
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	go func() {
+		_, _ = io.Copy(backend, r.Body)
+		if c, ok := backend.(*net.TCPConn); ok {
+			_ = c.CloseWrite()
+		}
+	}()
+	_, _ = io.Copy(flushWriter{w}, backend)
+}
+
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.w.(http.Flusher).Flush()
+	return n, err
+}
@@ -0,0 +1,141 @@
+package tunnel
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsConn adapts a websocket connection to a net.Conn, every Write is sent as one binary message
+type wsConn struct {
+	ws *websocket.Conn
+	// idleTimeout closes the connection when nothing was read for that long, 0 disables it
+	idleTimeout time.Duration
+	reader      io.Reader
+	wlock       sync.Mutex
+	done        chan struct{}
+	once        sync.Once
+}
+
+func newConn(ws *websocket.Conn, idleTimeout time.Duration) *wsConn {
+	return &wsConn{ws: ws, idleTimeout: idleTimeout, done: make(chan struct{})}
+}
+
+func (c *wsConn) Read(p []byte) (int, error) {
+	for {
+		if c.idleTimeout > 0 {
+			_ = c.ws.SetReadDeadline(time.Now().Add(c.idleTimeout))
+		}
+		if c.reader == nil {
+			t, r, err := c.ws.NextReader()
+			if err != nil {
+				c.finish()
+				return 0, err
+			}
+			if t != websocket.BinaryMessage {
+				continue
+			}
+			c.reader = r
+		}
+		n, err := c.reader.Read(p)
+		if err == io.EOF {
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		if err != nil {
+			c.finish()
+		}
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	if err := c.ws.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *wsConn) Close() error {
+	c.finish()
+	return c.ws.Close()
+}
+
+func (c *wsConn) finish() {
+	c.once.Do(func() {
+		close(c.done)
+	})
+}
+
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.ws.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
+
+// streamConn is one CONNECT stream of a tunnel, deadlines are not supported and silently ignored
+type streamConn struct {
+	io.Reader
+	w      *io.PipeWriter
+	body   io.Closer
+	local  net.Addr
+	remote net.Addr
+	once   sync.Once
+}
+
+func (s *streamConn) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+func (s *streamConn) Close() error {
+	s.once.Do(func() {
+		_ = s.w.Close()
+		_ = s.body.Close()
+	})
+	return nil
+}
+
+func (s *streamConn) LocalAddr() net.Addr {
+	return s.local
+}
+
+func (s *streamConn) RemoteAddr() net.Addr {
+	return s.remote
+}
+
+func (s *streamConn) SetDeadline(t time.Time) error {
+	return nil
+}
+
+func (s *streamConn) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+func (s *streamConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
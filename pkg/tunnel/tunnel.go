@@ -0,0 +1,384 @@
+// Package tunnel connects KubePi to clusters it can not reach directly. An agent inside the cluster dials KubePi
+// over a websocket and serves HTTP/2 on it, KubePi opens one CONNECT stream per connection to the API server.
+// TLS to the API server runs end to end through the stream, the agent only relays bytes.
+package tunnel
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/net/http2"
+)
+
+const (
+	// ConnectPath is where agents open the tunnel, relative to the KubePi address
+	ConnectPath = "/kubepi/api/v1/agent/connect"
+	// HeaderCluster names the cluster an agent serves, the token is sent as bearer token
+	HeaderCluster = "X-KubePi-Cluster"
+
+	pingInterval = 30 * time.Second
+	pingTimeout  = 15 * time.Second
+	dialTimeout  = 30 * time.Second
+)
+
+// Tunnel is the KubePi end of an agent connection
+type Tunnel struct {
+	Cluster     string
+	RemoteAddr  string
+	ConnectedAt time.Time
+	token       string
+	conn        *wsConn
+	cc          *http2.ClientConn
+
+	lock     sync.Mutex
+	listener net.Listener
+}
+
+// Done is closed when the agent connection is gone
+func (t *Tunnel) Done() <-chan struct{} {
+	return t.conn.done
+}
+
+// Close ends the tunnel, every stream opened through it and its loopback listener
+func (t *Tunnel) Close() {
+	_ = t.cc.Close()
+	_ = t.conn.Close()
+	t.lock.Lock()
+	if t.listener != nil {
+		_ = t.listener.Close()
+	}
+	t.lock.Unlock()
+}
+
+// dial opens a stream to the API server. ctx only bounds the setup, the stream outlives it like a TCP connection
+// outlives the context of net.Dialer.DialContext.
+func (t *Tunnel) dial(ctx context.Context, addr string) (net.Conn, error) {
+	pr, pw := io.Pipe()
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Host: addr},
+		Host:   addr,
+		Header: http.Header{},
+		Body:   pr,
+	}
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		resp, err := t.cc.RoundTrip(req)
+		ch <- result{resp, err}
+	}()
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	var r result
+	select {
+	case r = <-ch:
+	case <-ctx.Done():
+		_ = pw.CloseWithError(ctx.Err())
+		go func() {
+			if r := <-ch; r.resp != nil {
+				_ = r.resp.Body.Close()
+			}
+		}()
+		return nil, fmt.Errorf("dial %s through the agent of cluster %s: %w", addr, t.Cluster, ctx.Err())
+	}
+	if r.err != nil {
+		_ = pw.Close()
+		return nil, fmt.Errorf("dial %s through the agent of cluster %s: %w", addr, t.Cluster, r.err)
+	}
+	if r.resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(r.resp.Body, 1024))
+		_ = r.resp.Body.Close()
+		_ = pw.Close()
+		return nil, fmt.Errorf("dial %s through the agent of cluster %s: %s %s", addr, t.Cluster, r.resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return &streamConn{
+		Reader: r.resp.Body,
+		w:      pw,
+		body:   r.resp.Body,
+		local:  t.conn.LocalAddr(),
+		remote: t.conn.RemoteAddr(),
+	}, nil
+}
+
+// ErrTunnelExists is returned for a pending agent of a cluster whose tunnel is already taken
+var ErrTunnelExists = errors.New("an agent with this token is already connected for the cluster")
+
+// ErrTooManyPending is returned when too many agents wait for their cluster to be created
+var ErrTooManyPending = errors.New("too many agents of unknown clusters")
+
+const maxPending = 32
+
+type pendingKey struct {
+	cluster string
+	token   string
+}
+
+// Registry holds the connected agents by cluster name. Agents of clusters that are not created yet wait apart,
+// keyed by cluster and token, until Claim hands the one with the token of the created cluster over.
+type Registry struct {
+	lock    sync.Mutex
+	tunnels map[string]*Tunnel
+	pending map[pendingKey]*Tunnel
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tunnels: map[string]*Tunnel{}, pending: map[pendingKey]*Tunnel{}}
+}
+
+// Tunnels is the registry used by the server and pkg/kubernetes
+var Tunnels = NewRegistry()
+
+func newTunnel(cluster, token string, ws *websocket.Conn) (*Tunnel, error) {
+	conn := newConn(ws, 0)
+	cc, err := (&http2.Transport{ReadIdleTimeout: pingInterval, PingTimeout: pingTimeout}).NewClientConn(conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &Tunnel{
+		Cluster:     cluster,
+		RemoteAddr:  ws.RemoteAddr().String(),
+		ConnectedAt: time.Now(),
+		token:       token,
+		conn:        conn,
+		cc:          cc,
+	}, nil
+}
+
+// Register takes over the websocket as the tunnel of an existing cluster whose token the caller checked, a former
+// tunnel of the cluster is closed. The tunnel is removed again once it is done.
+func (r *Registry) Register(cluster, token string, ws *websocket.Conn) (*Tunnel, error) {
+	t, err := newTunnel(cluster, token, ws)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	old := r.tunnels[cluster]
+	r.tunnels[cluster] = t
+	r.lock.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	go r.release(t)
+	return t, nil
+}
+
+// CheckPending tells whether RegisterPending would accept the agent, so that the caller can answer before the
+// websocket upgrade
+func (r *Registry) CheckPending(cluster, token string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.checkPending(pendingKey{cluster, token})
+}
+
+func (r *Registry) checkPending(key pendingKey) error {
+	if r.tunnels[key.cluster] != nil || r.pending[key] != nil {
+		return ErrTunnelExists
+	}
+	if len(r.pending) >= maxPending {
+		return ErrTooManyPending
+	}
+	return nil
+}
+
+// RegisterPending keeps the websocket of an agent whose cluster does not exist yet. It never replaces another
+// tunnel, and the tunnel is closed when no cluster claims it within timeout.
+func (r *Registry) RegisterPending(cluster, token string, ws *websocket.Conn, timeout time.Duration) (*Tunnel, error) {
+	t, err := newTunnel(cluster, token, ws)
+	if err != nil {
+		return nil, err
+	}
+	key := pendingKey{cluster, token}
+	r.lock.Lock()
+	if err := r.checkPending(key); err != nil {
+		r.lock.Unlock()
+		t.Close()
+		return nil, err
+	}
+	r.pending[key] = t
+	r.lock.Unlock()
+	time.AfterFunc(timeout, func() {
+		r.lock.Lock()
+		expired := r.pending[key] == t
+		if expired {
+			delete(r.pending, key)
+		}
+		r.lock.Unlock()
+		if expired {
+			t.Close()
+		}
+	})
+	go r.release(t)
+	return t, nil
+}
+
+// release removes the tunnel once it is done
+func (r *Registry) release(t *Tunnel) {
+	<-t.Done()
+	t.Close()
+	key := pendingKey{t.Cluster, t.token}
+	r.lock.Lock()
+	if r.tunnels[t.Cluster] == t {
+		delete(r.tunnels, t.Cluster)
+	}
+	if r.pending[key] == t {
+		delete(r.pending, key)
+	}
+	r.lock.Unlock()
+}
+
+// Claim is called when the cluster is created: the pending agent that connected with token becomes the tunnel of
+// the cluster, pending agents with other tokens are closed. An empty token closes all of them.
+func (r *Registry) Claim(cluster, token string) {
+	var closing []*Tunnel
+	r.lock.Lock()
+	for key, t := range r.pending {
+		if key.cluster != cluster {
+			continue
+		}
+		delete(r.pending, key)
+		if token != "" && TokenEqual(key.token, token) && r.tunnels[cluster] == nil {
+			r.tunnels[cluster] = t
+		} else {
+			closing = append(closing, t)
+		}
+	}
+	r.lock.Unlock()
+	for _, t := range closing {
+		t.Close()
+	}
+}
+
+// Remove closes every tunnel of the cluster, when the cluster is deleted
+func (r *Registry) Remove(cluster string) {
+	var closing []*Tunnel
+	r.lock.Lock()
+	if t := r.tunnels[cluster]; t != nil {
+		delete(r.tunnels, cluster)
+		closing = append(closing, t)
+	}
+	for key, t := range r.pending {
+		if key.cluster == cluster {
+			delete(r.pending, key)
+			closing = append(closing, t)
+		}
+	}
+	r.lock.Unlock()
+	for _, t := range closing {
+		t.Close()
+	}
+}
+
+// Get returns the tunnel of the cluster, nil when its agent is not connected
+func (r *Registry) Get(cluster string) *Tunnel {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.tunnels[cluster]
+}
+
+// Dial opens a connection to addr through the agent of the cluster. The agent must have connected with token.
+func (r *Registry) Dial(ctx context.Context, cluster, token, addr string) (net.Conn, error) {
+	t, err := r.get(cluster, token)
+	if err != nil {
+		return nil, err
+	}
+	return t.dial(ctx, addr)
+}
+
+func (r *Registry) get(cluster, token string) (*Tunnel, error) {
+	t := r.Get(cluster)
+	if t == nil {
+		return nil, fmt.Errorf("the agent of cluster %s is not connected", cluster)
+	}
+	if !TokenEqual(t.token, token) {
+		return nil, fmt.Errorf("the agent of cluster %s connected with another token", cluster)
+	}
+	return t, nil
+}
+
+// Dialer returns a dial function for rest.Config.Dial and http.Transport.DialContext
+func (r *Registry) Dialer(cluster, token string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return r.Dial(ctx, cluster, token, addr)
+	}
+}
+
+// Listen returns a loopback address whose connections are relayed to addr through the tunnel of the cluster, for
+// clients in other processes such as kubectl. The listener is closed together with the tunnel.
+func (r *Registry) Listen(cluster, token, addr string) (string, error) {
+	t, err := r.get(cluster, token)
+	if err != nil {
+		return "", err
+	}
+	return t.listen(addr)
+}
+
+func (t *Tunnel) listen(addr string) (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	select {
+	case <-t.Done():
+		return "", fmt.Errorf("the agent of cluster %s is not connected", t.Cluster)
+	default:
+	}
+	if t.listener != nil {
+		return t.listener.Addr().String(), nil
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	t.listener = l
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go t.relay(conn, addr)
+		}
+	}()
+	return l.Addr().String(), nil
+}
+
+func (t *Tunnel) relay(conn net.Conn, addr string) {
+	defer conn.Close()
+	upstream, err := t.dial(context.Background(), addr)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	pipe(conn, upstream)
+}
+
+// pipe copies between both connections until one side is done
+func pipe(a, b io.ReadWriter) {
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(a, b)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(b, a)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// TokenEqual compares agent tokens in constant time
+func TokenEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,166 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func echoServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					_, _ = conn.Write([]byte("echo " + scanner.Text() + "\n"))
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestAgentTunnel(t *testing.T) {
+	registry := NewRegistry()
+	registered := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		tun, err := registry.Register(r.Header.Get(HeaderCluster), r.Header.Get("Authorization")[len("Bearer "):], ws)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		close(registered)
+		<-tun.Done()
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	agent := &Agent{Server: srv.URL, Cluster: "c1", Token: "secret", Target: echoServer(t)}
+	go func() { _ = agent.Run(ctx) }()
+	select {
+	case <-registered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("agent did not connect")
+	}
+
+	if _, err := registry.Dial(ctx, "c1", "other", "kubernetes:443"); err == nil {
+		t.Fatal("dial with a wrong token succeeded")
+	}
+	if _, err := registry.Dial(ctx, "c2", "secret", "kubernetes:443"); err == nil {
+		t.Fatal("dial to a cluster without agent succeeded")
+	}
+
+	// two streams at once, the second one must not wait for the first one
+	var conns []net.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := registry.Dial(ctx, "c1", "secret", "kubernetes:443")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	for i, msg := range []string{"b", "a"} {
+		conn := conns[1-i]
+		if _, err := conn.Write([]byte(msg + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != "echo "+msg+"\n" {
+			t.Fatalf("got %q", line)
+		}
+	}
+}
+
+// wsConns returns n server side websockets whose clients stay open until the test ends
+func wsConns(t *testing.T, n int) []*websocket.Conn {
+	conns := make(chan *websocket.Conn, n)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- ws
+	}))
+	t.Cleanup(srv.Close)
+	var result []*websocket.Conn
+	for i := 0; i < n; i++ {
+		client, _, err := websocket.DefaultDialer.Dial("ws"+srv.URL[len("http"):], nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = client.Close() })
+		result = append(result, <-conns)
+	}
+	return result
+}
+
+func waitClosed(t *testing.T, tun *Tunnel) {
+	select {
+	case <-tun.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("tunnel is not closed")
+	}
+}
+
+func TestPendingClaim(t *testing.T) {
+	registry := NewRegistry()
+	ws := wsConns(t, 4)
+	good, err := registry.RegisterPending("c1", "good", ws[0], time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.RegisterPending("c1", "good", ws[1], time.Minute); err != ErrTunnelExists {
+		t.Fatalf("a second pending agent with the same token got %v", err)
+	}
+	bad, err := registry.RegisterPending("c1", "bad", ws[2], time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registry.Get("c1") != nil {
+		t.Fatal("pending tunnel is usable before the cluster is created")
+	}
+
+	registry.Claim("c1", "good")
+	if registry.Get("c1") != good {
+		t.Fatal("the tunnel with the cluster token is not claimed")
+	}
+	waitClosed(t, bad)
+	if err := registry.CheckPending("c1", "bad"); err != ErrTunnelExists {
+		t.Fatalf("pending agent of a claimed cluster got %v", err)
+	}
+
+	expiring, err := registry.RegisterPending("c2", "token", ws[3], 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, expiring)
+	time.Sleep(10 * time.Millisecond)
+	if err := registry.CheckPending("c2", "token"); err != nil {
+		t.Fatalf("expired agent still holds its slot: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package podtool
 
 import (
 	"bytes"
+	kubeClient "github.com/KubeOperator/kubepi/pkg/kubernetes"
 	"io"
 	coreV1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
@@ -60,7 +61,7 @@ func (p *PodTool) Exec(actionType ActionType) error {
 			Stderr:    config.Stderr != nil,
 			TTY:       config.Tty,
 		}, scheme.ParameterCodec)
-	exec, err := remotecommand.NewSPDYExecutor(p.RestClient, "POST", req.URL())
+	exec, err := kubeClient.NewSPDYExecutor(p.RestClient, "POST", req.URL())
 	if err != nil {
 		return err
 	}
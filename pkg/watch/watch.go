@@ -0,0 +1,132 @@
+package watch
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/KubeOperator/kubepi/pkg/informer"
+	"github.com/KubeOperator/kubepi/pkg/terminal"
+	"gopkg.in/igm/sockjs-go.v2/sockjs"
+)
+
+const bindTimeout = time.Minute
+
+type WatchSession struct {
+	Id            string
+	Bound         chan error
+	Subscription  *informer.Subscription
+	sockJSSession sockjs.Session
+}
+
+type SessionMap struct {
+	Sessions map[string]WatchSession
+	Lock     sync.Mutex
+}
+
+func (sm *SessionMap) Get(sessionId string) WatchSession {
+	sm.Lock.Lock()
+	defer sm.Lock.Unlock()
+	return sm.Sessions[sessionId]
+}
+
+func (sm *SessionMap) Set(sessionId string, session WatchSession) {
+	sm.Lock.Lock()
+	defer sm.Lock.Unlock()
+	sm.Sessions[sessionId] = session
+}
+
+func (sm *SessionMap) Close(sessionId, reason string, status uint32) {
+	sm.Lock.Lock()
+	defer sm.Lock.Unlock()
+	s, ok := sm.Sessions[sessionId]
+	if !ok {
+		return
+	}
+	if s.Subscription != nil {
+		s.Subscription.Close()
+	}
+	if s.sockJSSession != nil {
+		if err := s.sockJSSession.Close(status, reason); err != nil {
+			log.Println(err)
+		}
+	}
+	delete(sm.Sessions, sessionId)
+}
+
+var WatchSessions = SessionMap{Sessions: make(map[string]WatchSession)}
+
+type WatchMessage struct {
+	SessionID string
+}
+
+func GenWatchSessionId() (string, error) {
+	return terminal.GenTerminalSessionId()
+}
+
+func CreateWatchHandler(path string) http.Handler {
+	return sockjs.NewHandler(path, sockjs.DefaultOptions, watchHandler)
+}
+
+func watchHandler(session sockjs.Session) {
+	var (
+		buf          string
+		err          error
+		msg          WatchMessage
+		watchSession WatchSession
+	)
+	if buf, err = session.Recv(); err != nil {
+		log.Printf("handleWatchSession: can't Recv: %v", err)
+		return
+	}
+	if err = json.Unmarshal([]byte(buf), &msg); err != nil {
+		log.Printf("handleWatchSession: can't UnMarshal (%v): %s", err, buf)
+		return
+	}
+	if watchSession = WatchSessions.Get(msg.SessionID); watchSession.Id == "" {
+		log.Printf("handleWatchSession: can't find session '%s'", msg.SessionID)
+		return
+	}
+	watchSession.sockJSSession = session
+	WatchSessions.Set(msg.SessionID, watchSession)
+	watchSession.Bound <- nil
+	// sockjs 会话在客户端断开前一直阻塞在 Recv 上，断开后回收订阅
+	for {
+		if _, err := session.Recv(); err != nil {
+			WatchSessions.Close(msg.SessionID, "client closed", 1)
+			return
+		}
+	}
+}
+
+// WaitForWatchStream pushes the events of the subscription to the bound sockjs session until either side closes
+func WaitForWatchStream(sessionId string) {
+	s := WatchSessions.Get(sessionId)
+	select {
+	case <-s.Bound:
+		close(s.Bound)
+	case <-time.After(bindTimeout):
+		WatchSessions.Close(sessionId, "bind timeout", 2)
+		return
+	}
+	s = WatchSessions.Get(sessionId)
+	for {
+		select {
+		case <-s.Subscription.Done():
+			WatchSessions.Close(sessionId, "watch closed", 1)
+			return
+		case e := <-s.Subscription.Events:
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("watch stream: can't Marshal event: %v", err)
+				continue
+			}
+			if err := s.sockJSSession.Send(string(data)); err != nil {
+				WatchSessions.Close(sessionId, err.Error(), 2)
+				return
+			}
+		}
+	}
+}